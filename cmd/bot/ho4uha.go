@@ -3,16 +3,29 @@ package main
 import (
 	"context"
 	"github.com/roman-clancy/ho4uha-bot/internal/client"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
 	"github.com/roman-clancy/ho4uha-bot/internal/config"
+	"github.com/roman-clancy/ho4uha-bot/internal/digest"
+	"github.com/roman-clancy/ho4uha-bot/internal/export"
+	"github.com/roman-clancy/ho4uha-bot/internal/fetcher"
+	"github.com/roman-clancy/ho4uha-bot/internal/importer"
+	"github.com/roman-clancy/ho4uha-bot/internal/linkmeta"
 	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/pricewatch"
+	"github.com/roman-clancy/ho4uha-bot/internal/reminders"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/eventlog"
 	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/roman-clancy/ho4uha-bot/internal/web"
+	"github.com/roman-clancy/ho4uha-bot/internal/webapp"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 )
 
 func main() {
-	_, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 	cfg := config.MustLoad()
 
@@ -23,12 +36,60 @@ func main() {
 	if err != nil {
 		return
 	}
-	storage, err := inmemory.New()
+	storage, err := openStorage(cfg.Storage, log)
 	if err != nil {
+		log.Error("storage not opened", slog.String("error", err.Error()))
 		return
 	}
+	defer func() {
+		if err := storage.Close(); err != nil {
+			log.Error("storage not closed", slog.String("error", err.Error()))
+		}
+	}()
 	botModel := messages.New(storage, tgClient)
-	tgClient.ListenUpdates(botModel)
+	botModel.BotUserName = tgClient.BotUserName()
+	botModel.Importer = importer.New()
+	botModel.DocumentLoader = tgClient
+	botModel.Exporter = export.New()
+	if cfg.CachePhotos {
+		botModel.PhotoLoader = tgClient
+	}
+	if cfg.LinkPreview {
+		botModel.LinkInspector = linkmeta.New(fetcher.New(fetcher.DefaultOptions()))
+	}
+	jobs := scheduler.New(storage, clock.Real{})
+	jobs.OnError(func(job scheduler.Job, err error) {
+		log.Error("job failed", slog.String("id", job.ID), slog.String("error", err.Error()))
+	})
+	botModel.Reminders = reminders.New(storage, tgClient, botModel, jobs, clock.Real{})
+	digests := digest.New(storage, tgClient, botModel, jobs, clock.Real{}, digest.DefaultDelay)
+	digests.OnError(func(followerId int64, err error) {
+		log.Warn("digest not sent", slog.Int64("follower", followerId), slog.String("error", err.Error()))
+	})
+	storage.OnChange(func(change messages.Change) {
+		if err := digests.Notify(ctx, change); err != nil {
+			log.Error("digest planning failed", slog.Int64("owner", change.OwnerID), slog.String("error", err.Error()))
+		}
+	})
+	if cfg.PriceWatch.Enabled {
+		opts := pricewatch.DefaultOptions()
+		opts.CheckEvery, opts.HostInterval = cfg.PriceWatch.CheckEvery, cfg.PriceWatch.HostInterval
+		prices := pricewatch.New(storage, linkmeta.New(fetcher.New(fetcher.DefaultOptions())), tgClient, jobs, clock.Real{}, opts)
+		prices.OnError(func(watch messages.PriceWatch, err error) {
+			log.Warn("price check failed", slog.Int64("item", watch.ItemID), slog.String("error", err.Error()))
+		})
+		if err := prices.Start(); err != nil {
+			log.Error("price watch not started", slog.String("error", err.Error()))
+		}
+	}
+	go jobs.Run(ctx)
+	if cfg.HTTP.Enabled {
+		botModel.ShareBaseURL = cfg.HTTP.PublicURL
+		server := web.New(storage)
+		server.Handle("/api/", webapp.New(storage, cfg.Token))
+		go serveHTTP(ctx, log, cfg.HTTP.Addr, server)
+	}
+	tgClient.ListenUpdates(ctx, botModel)
 	//opts := []bot.Option{
 	//	bot.WithDefaultHandler(handler),
 	//	bot.
@@ -38,6 +99,52 @@ func main() {
 	//b.Start(ctx)
 }
 
+type storage interface {
+	messages.UserStorage
+	scheduler.JobStore
+	pricewatch.Storage
+	OnChange(f func(messages.Change))
+	Close() error
+}
+
+// memoryStorage has nothing to close.
+type memoryStorage struct {
+	*inmemory.Storage
+}
+
+func (memoryStorage) Close() error {
+	return nil
+}
+
+func openStorage(cfg config.StorageConfig, log *slog.Logger) (storage, error) {
+	if cfg.Dir == "" {
+		mem, err := inmemory.New()
+		return memoryStorage{mem}, err
+	}
+	opts := eventlog.DefaultOptions()
+	opts.SnapshotEvery = cfg.SnapshotEvery
+	events, err := eventlog.Open(cfg.Dir, clock.Real{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	events.OnError(func(err error) {
+		log.Warn("snapshot not written", slog.String("error", err.Error()))
+	})
+	return events, nil
+}
+
+func serveHTTP(ctx context.Context, log *slog.Logger, addr string, handler http.Handler) {
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+	log.Info("starting http server", slog.String("addr", addr))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error("http server stopped", slog.String("error", err.Error()))
+	}
+}
+
 func setupLogger(env string) *slog.Logger {
 	var log *slog.Logger
 	switch env {
@@ -1,17 +1,31 @@
 package client
 
 import (
+	"context"
+	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
 	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	maxPhotoSize    = 10 << 20
+	maxDocumentSize = 1 << 20
+	// fileTimeout bounds a download, which runs on the update loop.
+	fileTimeout = 30 * time.Second
 )
 
 type TgClient struct {
 	client      *tgbotapi.BotAPI
 	handlerFunc HandlerFunc
+	files       *http.Client
+	fileURL     func(fileID string) (string, error)
 }
 
-type HandlerFunc func(update tgbotapi.Update, c *TgClient, m *messages.BotModel)
+type HandlerFunc func(ctx context.Context, update tgbotapi.Update, c *TgClient, m *messages.BotModel)
 
 func New(token string, handlerFunc HandlerFunc) (*TgClient, error) {
 	client, err := tgbotapi.NewBotAPI(token)
@@ -21,21 +35,28 @@ func New(token string, handlerFunc HandlerFunc) (*TgClient, error) {
 	return &TgClient{
 		client:      client,
 		handlerFunc: handlerFunc,
+		files:       &http.Client{Timeout: fileTimeout},
+		fileURL:     client.GetFileDirectURL,
 	}, nil
 }
 
+func (c *TgClient) BotUserName() string {
+	return c.client.Self.UserName
+}
+
 func (c *TgClient) SendMessage(userId int64, text string) error {
 	message := tgbotapi.NewMessage(userId, text)
 	_, err := c.client.Send(message)
 	return err
 }
 
-func (c *TgClient) ListenUpdates(botModel *messages.BotModel) {
+// ListenUpdates passes ctx on to the handling of every update.
+func (c *TgClient) ListenUpdates(ctx context.Context, botModel *messages.BotModel) {
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 	updatesChan := c.client.GetUpdatesChan(u)
 	for update := range updatesChan {
-		c.handlerFunc(update, c, botModel)
+		c.handlerFunc(ctx, update, c, botModel)
 	}
 }
 
@@ -57,13 +78,83 @@ func (c *TgClient) ShowButtons(userId int64, text string, buttons []types.TgRowB
 	return err
 }
 
-func ProcessingMessage(update tgbotapi.Update, client *TgClient, botModel *messages.BotModel) {
+func (c *TgClient) SendPhoto(userId int64, photo types.TgPhoto, caption string) error {
+	var file tgbotapi.RequestFileData
+	switch {
+	case photo.FileID != "":
+		file = tgbotapi.FileID(photo.FileID)
+	case len(photo.Data) > 0:
+		file = tgbotapi.FileBytes{Name: "photo.jpg", Bytes: photo.Data}
+	default:
+		file = tgbotapi.FileURL(photo.URL)
+	}
+	msg := tgbotapi.NewPhoto(userId, file)
+	msg.Caption = caption
+	_, err := c.client.Send(msg)
+	return err
+}
+
+func (c *TgClient) SendDocument(userId int64, fileName string, data []byte, caption string) error {
+	msg := tgbotapi.NewDocument(userId, tgbotapi.FileBytes{Name: fileName, Bytes: data})
+	msg.Caption = caption
+	_, err := c.client.Send(msg)
+	return err
+}
+
+func (c *TgClient) LoadPhoto(fileID string) ([]byte, error) {
+	return c.loadFile(fileID, maxPhotoSize)
+}
+
+func (c *TgClient) LoadDocument(fileID string) ([]byte, error) {
+	return c.loadFile(fileID, maxDocumentSize)
+}
+
+func (c *TgClient) loadFile(fileID string, maxSize int64) ([]byte, error) {
+	url, err := c.fileURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.files.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("load file %s: unexpected status %s", fileID, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("load file %s: larger than %d bytes", fileID, maxSize)
+	}
+	return data, nil
+}
+
+func ProcessingMessage(ctx context.Context, update tgbotapi.Update, client *TgClient, botModel *messages.BotModel) {
 	if update.Message != nil {
-		err := botModel.OnMessage(messages.Message{
-			Text:     update.Message.Text,
-			UserID:   update.Message.From.ID,
-			UserName: update.Message.From.UserName,
-		})
+		text := update.Message.Text
+		if text == "" {
+			text = update.Message.Caption
+		}
+		msg := messages.Message{
+			Text:        text,
+			ChatID:      update.Message.Chat.ID,
+			ChatTitle:   update.Message.Chat.Title,
+			UserID:      update.Message.From.ID,
+			UserName:    update.Message.From.UserName,
+			FirstName:   update.Message.From.FirstName,
+			PhotoFileID: largestPhotoID(update.Message.Photo),
+		}
+		if reply := update.Message.ReplyToMessage; reply != nil && reply.From != nil && !reply.From.IsBot {
+			msg.ReplyToUserID = reply.From.ID
+		}
+		if doc := update.Message.Document; doc != nil {
+			msg.DocFileID = doc.FileID
+			msg.DocFileName = doc.FileName
+		}
+		err := botModel.OnMessage(ctx, msg)
 		if err != nil {
 			return
 		}
@@ -72,13 +163,20 @@ func ProcessingMessage(update tgbotapi.Update, client *TgClient, botModel *messa
 		if _, err := client.client.Request(callback); err != nil {
 			return
 		}
-		if err := deleteInlineButtons(client, update.CallbackQuery.From.ID, update.CallbackQuery.Message.MessageID, update.CallbackQuery.Message.Text); err != nil {
-			return
+		chat := update.CallbackQuery.Message.Chat
+		// A list posted to a group stays clickable for the other members.
+		if chat.IsPrivate() {
+			if err := deleteInlineButtons(client, chat.ID, update.CallbackQuery.Message.MessageID, update.CallbackQuery.Message.Text); err != nil {
+				return
+			}
 		}
-		err := botModel.OnMessage(messages.Message{
+		err := botModel.OnMessage(ctx, messages.Message{
 			Text:          update.CallbackQuery.Data,
+			ChatID:        chat.ID,
+			ChatTitle:     chat.Title,
 			UserID:        update.CallbackQuery.From.ID,
 			UserName:      update.CallbackQuery.From.UserName,
+			FirstName:     update.CallbackQuery.From.FirstName,
 			IsCallback:    true,
 			CallbackMsgID: update.CallbackQuery.ID,
 		})
@@ -93,3 +191,10 @@ func deleteInlineButtons(c *TgClient, userID int64, msgID int, sourceText string
 	_, err := c.client.Send(msg)
 	return err
 }
+
+func largestPhotoID(sizes []tgbotapi.PhotoSize) string {
+	if len(sizes) == 0 {
+		return ""
+	}
+	return sizes[len(sizes)-1].FileID
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFileClient(t *testing.T, handler http.HandlerFunc, timeout time.Duration) *TgClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	files := server.Client()
+	files.Timeout = timeout
+	return &TgClient{
+		files:   files,
+		fileURL: func(fileID string) (string, error) { return server.URL + "/" + fileID, nil },
+	}
+}
+
+func TestTgClient_LoadPhoto(t *testing.T) {
+	t.Run("Should download the file", func(t *testing.T) {
+		c := newFileClient(t, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/photo-1", r.URL.Path)
+			_, _ = w.Write([]byte("jpeg"))
+		}, time.Second)
+		data, err := c.LoadPhoto("photo-1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("jpeg"), data)
+	})
+
+	t.Run("Should refuse a missing or oversized file", func(t *testing.T) {
+		c := newFileClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/missing" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(strings.Repeat("x", maxDocumentSize+1)))
+		}, time.Second)
+		_, err := c.LoadPhoto("missing")
+		require.ErrorContains(t, err, "404")
+		_, err = c.LoadDocument("big")
+		require.ErrorContains(t, err, "larger than")
+	})
+
+	t.Run("Should give up on a stuck download", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		c := newFileClient(t, func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}, 50*time.Millisecond)
+		_, err := c.LoadPhoto("photo-1")
+		require.Error(t, err)
+	})
+}
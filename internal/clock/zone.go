@@ -0,0 +1,73 @@
+package clock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+const DefaultZone = "Europe/Moscow"
+
+// ParseZone accepts IANA names ("Asia/Yekaterinburg") and UTC offsets ("+5", "UTC+05:30", "-3")
+// and returns the canonical name to store.
+func ParseZone(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", false
+	}
+	if offset, ok := parseOffset(s); ok {
+		sign := "+"
+		if offset < 0 {
+			sign, offset = "-", -offset
+		}
+		return fmt.Sprintf("UTC%s%02d:%02d", sign, offset/3600, offset%3600/60), true
+	}
+	if strings.EqualFold(s, "UTC") {
+		return "UTC", true
+	}
+	if _, err := time.LoadLocation(s); err != nil || !strings.Contains(s, "/") {
+		return "", false
+	}
+	return s, true
+}
+
+// LoadZone resolves a name produced by ParseZone, falling back to DefaultZone.
+func LoadZone(name string) *time.Location {
+	if name == "" {
+		name = DefaultZone
+	}
+	if offset, ok := parseOffset(name); ok {
+		return time.FixedZone(name, offset)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc, _ = time.LoadLocation(DefaultZone)
+	}
+	return loc
+}
+
+func parseOffset(s string) (int, bool) {
+	s = strings.TrimPrefix(strings.ToUpper(s), "UTC")
+	s = strings.TrimPrefix(s, "GMT")
+	if len(s) < 2 || (s[0] != '+' && s[0] != '-') {
+		return 0, false
+	}
+	sign := 1
+	if s[0] == '-' {
+		sign = -1
+	}
+	hoursStr, minutesStr, _ := strings.Cut(s[1:], ":")
+	hours, err := strconv.Atoi(hoursStr)
+	if err != nil || hours > 14 {
+		return 0, false
+	}
+	minutes := 0
+	if minutesStr != "" {
+		if minutes, err = strconv.Atoi(minutesStr); err != nil || minutes >= 60 {
+			return 0, false
+		}
+	}
+	return sign * (hours*3600 + minutes*60), true
+}
@@ -0,0 +1,36 @@
+package clock
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseZone(t *testing.T) {
+	cases := map[string]string{
+		"Asia/Yekaterinburg": "Asia/Yekaterinburg",
+		"+3":                 "UTC+03:00",
+		"UTC+05:30":          "UTC+05:30",
+		"-3":                 "UTC-03:00",
+		"utc":                "UTC",
+	}
+	for in, expected := range cases {
+		actual, ok := ParseZone(in)
+		require.Truef(t, ok, "Should parse '%s'", in)
+		require.Equal(t, expected, actual)
+	}
+	for _, in := range []string{"", "Moscow", "+25", "Mars/Olympus", "EST"} {
+		_, ok := ParseZone(in)
+		require.Falsef(t, ok, "Shouldn't parse '%s'", in)
+	}
+}
+
+func TestLoadZone(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, offset := at.In(LoadZone("UTC+05:30")).Zone()
+	require.Equal(t, 5*3600+30*60, offset)
+	_, offset = at.In(LoadZone("")).Zone()
+	require.Equal(t, 3*3600, offset, "Default zone should be Moscow")
+	_, offset = at.In(LoadZone("Asia/Vladivostok")).Zone()
+	require.Equal(t, 10*3600, offset)
+}
@@ -4,11 +4,42 @@ import (
 	"github.com/ilyakaznacheev/cleanenv"
 	"log"
 	"os"
+	"time"
 )
 
 type Config struct {
-	Token string `yml:"token"`
-	Env   string `yml:"env"`
+	Token string `yaml:"token"`
+	Env   string `yaml:"env"`
+	// CachePhotos keeps a local copy of item photos in addition to the Telegram file_id.
+	CachePhotos bool `yaml:"cache_photos"`
+	// LinkPreview enables fetching pasted links to pre-fill item name, image and price.
+	LinkPreview bool             `yaml:"link_preview"`
+	PriceWatch  PriceWatchConfig `yaml:"price_watch"`
+	HTTP        HTTPConfig       `yaml:"http"`
+	Storage     StorageConfig    `yaml:"storage"`
+}
+
+// StorageConfig switches from keeping everything in memory to an event log on disk.
+type StorageConfig struct {
+	// Dir holds the log and its snapshots, data only lives in memory when it is empty.
+	Dir string `yaml:"dir"`
+	// SnapshotEvery is how many events are logged between two snapshots.
+	SnapshotEvery int `yaml:"snapshot_every" env-default:"1000"`
+}
+
+// PriceWatchConfig enables re-checking prices of items their owners asked to watch.
+type PriceWatchConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	CheckEvery time.Duration `yaml:"check_every" env-default:"6h"`
+	// HostInterval is the minimal pause between two requests to the same shop.
+	HostInterval time.Duration `yaml:"host_interval" env-default:"1m"`
+}
+
+type HTTPConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Addr    string `yaml:"addr" env-default:":8080"`
+	// PublicURL is how friends reach the server, e.g. https://wish.example.com. Share links are built from it.
+	PublicURL string `yaml:"public_url"`
 }
 
 func MustLoad() *Config {
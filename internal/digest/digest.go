@@ -0,0 +1,235 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	JobKind = "follow_digest"
+	// DefaultDelay is how long changes are collected before followers get a digest.
+	DefaultDelay = 30 * time.Minute
+	maxNames     = 5
+)
+
+type Storage interface {
+	GetUserName(ctx context.Context, userId int64) string
+	GetFollowers(ctx context.Context, ownerId int64) []int64
+	GetListFollowers(ctx context.Context, listId int64) []int64
+	IsFollowMuted(ctx context.Context, ownerId int64, followerId int64) bool
+	GetChanges(ctx context.Context, ownerId int64) []messages.Change
+	ClearChanges(ctx context.Context, ownerId int64, upToId int64) error
+	messages.WishListsReader
+}
+
+type Sender interface {
+	SendMessage(userId int64, text string) error
+}
+
+type Linker interface {
+	ShareLink(ctx context.Context, listId int64) (string, error)
+}
+
+type Service struct {
+	storage   Storage
+	sender    Sender
+	linker    Linker
+	scheduler *scheduler.Scheduler
+	clock     clock.Clock
+	delay     time.Duration
+	onError   func(followerId int64, err error)
+}
+
+func New(storage Storage, sender Sender, linker Linker, sched *scheduler.Scheduler, clk clock.Clock, delay time.Duration) *Service {
+	s := &Service{
+		storage:   storage,
+		sender:    sender,
+		linker:    linker,
+		scheduler: sched,
+		clock:     clk,
+		delay:     delay,
+		onError:   func(int64, error) {},
+	}
+	sched.Handle(JobKind, s.handle)
+	return s
+}
+
+// OnError is called when a digest could not be sent to a follower. The others still get it and
+// the changes are cleared, a retry would send the digest twice to everybody else.
+func (s *Service) OnError(f func(followerId int64, err error)) {
+	s.onError = f
+}
+
+// Notify consumes the storage change stream. The first pending change of an owner opens a window,
+// everything that happens until it closes goes into the same digest.
+func (s *Service) Notify(ctx context.Context, change messages.Change) error {
+	if len(s.storage.GetFollowers(ctx, change.OwnerID)) == 0 {
+		err := s.storage.ClearChanges(ctx, change.OwnerID, change.ID)
+		return err
+	}
+	pending := s.storage.GetChanges(ctx, change.OwnerID)
+	if len(pending) == 0 || pending[0].ID != change.ID {
+		return nil
+	}
+	return s.schedule(change)
+}
+
+// schedule names the job after the first change of the window, so a window opened
+// while the previous digest is still being sent gets a job of its own.
+func (s *Service) schedule(first messages.Change) error {
+	id := fmt.Sprintf("%s:%d:%d", JobKind, first.OwnerID, first.ID)
+	return s.scheduler.Schedule(scheduler.Job{
+		ID:      id,
+		Kind:    JobKind,
+		RunAt:   s.clock.Now().Add(s.delay),
+		Payload: strconv.FormatInt(first.OwnerID, 10),
+		Key:     id,
+	})
+}
+
+func (s *Service) handle(ctx context.Context, job scheduler.Job) error {
+	ownerId, err := strconv.ParseInt(job.Payload, 10, 64)
+	if err != nil {
+		return err
+	}
+	changes := s.storage.GetChanges(ctx, ownerId)
+	if len(changes) == 0 {
+		return nil
+	}
+	visible := s.visibleChanges(ctx, ownerId, changes)
+	ownerName := messages.OwnerName(ctx, s.storage, ownerId)
+	for _, follower := range s.storage.GetFollowers(ctx, ownerId) {
+		if s.storage.IsFollowMuted(ctx, ownerId, follower) {
+			continue
+		}
+		text, err := s.text(ctx, ownerName, messages.FollowedLists(ctx, s.storage, ownerId, follower), visible)
+		if err == nil && text != "" {
+			err = s.sender.SendMessage(follower, text+fmt.Sprintf("\nНе присылать такие сводки: /mute %d", ownerId))
+		}
+		if err != nil {
+			s.onError(follower, err)
+		}
+	}
+	if err := s.storage.ClearChanges(ctx, ownerId, changes[len(changes)-1].ID); err != nil {
+		return err
+	}
+	if rest := s.storage.GetChanges(ctx, ownerId); len(rest) > 0 {
+		return s.schedule(rest[0])
+	}
+	return nil
+}
+
+// text is the digest of the lists a follower subscribed to, the other lists of the owner are none of their business.
+func (s *Service) text(ctx context.Context, ownerName string, lists []messages.WishList, changes []messages.Change) (string, error) {
+	var parts []string
+	for _, list := range lists {
+		var listChanges []messages.Change
+		for _, c := range changes {
+			if c.ListID == list.ID {
+				listChanges = append(listChanges, c)
+			}
+		}
+		part := Text(ownerName, listChanges)
+		if part == "" {
+			continue
+		}
+		if len(lists) > 1 {
+			part = "📋 " + list.Name + "\n" + part
+		}
+		link, err := s.linker.ShareLink(ctx, list.ID)
+		if err != nil {
+			return "", err
+		}
+		if link != "" {
+			part += "\n\nСписок: " + link
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// visibleChanges drops changes of items followers may not see. Items that still exist are
+// checked as they are now, so a wish hidden right after it was added is not announced.
+func (s *Service) visibleChanges(ctx context.Context, ownerId int64, changes []messages.Change) []messages.Change {
+	exists := make(map[int64]bool)
+	visible := make(map[int64]bool)
+	for _, list := range s.storage.GetLists(ctx, ownerId) {
+		for _, cat := range s.storage.GetListWishList(ctx, list.ID) {
+			for _, item := range cat.Items {
+				exists[item.ID] = true
+			}
+		}
+		for _, cat := range messages.ReadWishList(ctx, s.storage, list.ID, messages.AudienceFollower) {
+			for _, item := range cat.Items {
+				visible[item.ID] = true
+			}
+		}
+	}
+	result := make([]messages.Change, 0, len(changes))
+	for _, c := range changes {
+		if exists[c.ItemID] && !visible[c.ItemID] {
+			continue
+		}
+		if !exists[c.ItemID] && !c.Visibility.VisibleTo(messages.AudienceFollower) {
+			continue
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// Text summarises changes of one owner. A wish added and removed within the same digest is left out.
+func Text(ownerName string, changes []messages.Change) string {
+	added := make(map[int64]bool)
+	removed := make(map[int64]bool)
+	for _, c := range changes {
+		switch c.Kind {
+		case messages.ChangeItemAdded:
+			added[c.ItemID] = true
+		case messages.ChangeItemRemoved:
+			if added[c.ItemID] {
+				delete(added, c.ItemID)
+			} else {
+				removed[c.ItemID] = true
+			}
+		}
+	}
+	var addedNames []string
+	removedCount := 0
+	for _, c := range changes {
+		if c.Kind == messages.ChangeItemAdded && added[c.ItemID] {
+			addedNames = append(addedNames, c.ItemName)
+		}
+		if c.Kind == messages.ChangeItemRemoved && removed[c.ItemID] {
+			removedCount++
+		}
+	}
+	var lines []string
+	if n := len(addedNames); n > 0 {
+		line := fmt.Sprintf("🎁 %s добавил(а) %d %s: %s", ownerName, n, pluralWishes(n), strings.Join(addedNames[:min(n, maxNames)], ", "))
+		if n > maxNames {
+			line += fmt.Sprintf(" и ещё %d", n-maxNames)
+		}
+		lines = append(lines, line)
+	}
+	if removedCount > 0 {
+		lines = append(lines, fmt.Sprintf("🗑 %s убрал(а) %d %s", ownerName, removedCount, pluralWishes(removedCount)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func pluralWishes(n int) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "хотелку"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "хотелки"
+	}
+	return "хотелок"
+}
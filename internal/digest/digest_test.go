@@ -0,0 +1,249 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const (
+	ownerId    = int64(1)
+	followerId = int64(2)
+	mutedId    = int64(3)
+)
+
+type sentMessage struct {
+	userId int64
+	text   string
+}
+
+type fakeSender struct {
+	sent []sentMessage
+	fail map[int64]error
+}
+
+func (f *fakeSender) SendMessage(userId int64, text string) error {
+	if err := f.fail[userId]; err != nil {
+		return err
+	}
+	f.sent = append(f.sent, sentMessage{userId: userId, text: text})
+	return nil
+}
+
+type fakeLinker struct{}
+
+func (fakeLinker) ShareLink(_ context.Context, listId int64) (string, error) {
+	return fmt.Sprintf("https://t.me/ho4uha_bot?start=w_%d", listId), nil
+}
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+type env struct {
+	storage *inmemory.Storage
+	clock   *clock.Fake
+	sender  *fakeSender
+	sched   *scheduler.Scheduler
+	service *Service
+}
+
+func newEnv(t *testing.T) *env {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	for _, id := range []int64{ownerId, followerId, mutedId} {
+		err := storage.AddNewUser(ctx, id)
+		require.NoError(t, err)
+	}
+	err = storage.SetUserName(ctx, ownerId, "Аня")
+	require.NoError(t, err)
+	list, _ := storage.GetActiveList(ctx, ownerId)
+	for _, id := range []int64{followerId, mutedId} {
+		err = storage.AddListFollower(ctx, list.ID, id)
+		require.NoError(t, err)
+	}
+	err = storage.SetFollowMuted(ctx, ownerId, mutedId, true)
+	require.NoError(t, err)
+	e := &env{storage: storage, clock: clock.NewFake(start), sender: &fakeSender{}}
+	e.sched = scheduler.New(storage, e.clock)
+	e.service = New(storage, e.sender, fakeLinker{}, e.sched, e.clock, DefaultDelay)
+	storage.OnChange(func(change messages.Change) {
+		require.NoError(t, e.service.Notify(ctx, change))
+	})
+	return e
+}
+
+func (e *env) add(t *testing.T, name string) int64 {
+	ctx := context.Background()
+	err := e.storage.AddWishItem(ctx, ownerId, messages.WishItem{Name: name})
+	require.NoError(t, err)
+	items := e.storage.GetWishListByCategory(ctx, ownerId).Items("default")
+	return items[len(items)-1].ID
+}
+
+func (e *env) runAt(t *testing.T, at time.Time) int {
+	e.clock.Set(at)
+	done, err := e.sched.RunDue(context.Background())
+	require.NoError(t, err)
+	return done
+}
+
+func TestService_Digest(t *testing.T) {
+	ctx := context.Background()
+	e := newEnv(t)
+	e.add(t, "Книга")
+	e.clock.Advance(10 * time.Minute)
+	e.add(t, "Лего")
+	mistake := e.add(t, "Опечатка")
+	err := e.storage.DeleteWishItem(ctx, ownerId, mistake)
+	require.NoError(t, err)
+
+	t.Run("Should wait until the window closes", func(t *testing.T) {
+		require.Zero(t, e.runAt(t, start.Add(DefaultDelay-time.Minute)))
+		require.Empty(t, e.sender.sent)
+	})
+
+	t.Run("Should send one digest to followers that did not mute the owner", func(t *testing.T) {
+		require.Equal(t, 1, e.runAt(t, start.Add(DefaultDelay)))
+		require.Equal(t, []sentMessage{{
+			userId: followerId,
+			text: "🎁 Аня добавил(а) 2 хотелки: Книга, Лего\n\nСписок: https://t.me/ho4uha_bot?start=w_1" +
+				"\nНе присылать такие сводки: /mute 1",
+		}}, e.sender.sent)
+		require.Empty(t, e.storage.GetChanges(ctx, ownerId))
+	})
+
+	t.Run("Should open a new window for later changes", func(t *testing.T) {
+		e.add(t, "Кружка")
+		require.Zero(t, e.runAt(t, e.clock.Now().Add(time.Minute)))
+		require.Equal(t, 1, e.runAt(t, e.clock.Now().Add(DefaultDelay)))
+		require.Len(t, e.sender.sent, 2)
+		require.Contains(t, e.sender.sent[1].text, "добавил(а) 1 хотелку: Кружка")
+	})
+}
+
+func TestService_FailedFollower(t *testing.T) {
+	ctx := context.Background()
+	e := newEnv(t)
+	const otherId = int64(4)
+	require.NoError(t, e.storage.AddNewUser(ctx, otherId))
+	list, _ := e.storage.GetActiveList(ctx, ownerId)
+	require.NoError(t, e.storage.AddListFollower(ctx, list.ID, otherId))
+	blocked := errors.New("bot was blocked by the user")
+	e.sender.fail = map[int64]error{followerId: blocked}
+	var failed []int64
+	e.service.OnError(func(id int64, err error) {
+		require.ErrorIs(t, err, blocked)
+		failed = append(failed, id)
+	})
+	e.add(t, "Книга")
+
+	require.Equal(t, 1, e.runAt(t, start.Add(DefaultDelay)))
+	require.Equal(t, []int64{followerId}, failed)
+	require.Len(t, e.sender.sent, 1)
+	require.Equal(t, otherId, e.sender.sent[0].userId)
+	require.Empty(t, e.storage.GetChanges(ctx, ownerId))
+
+	e.sender.fail = nil
+	e.add(t, "Лего")
+	require.Equal(t, 1, e.runAt(t, e.clock.Now().Add(DefaultDelay)))
+	require.Len(t, e.sender.sent, 3, "The next digest should reach everybody again")
+}
+
+func TestService_HiddenItems(t *testing.T) {
+	ctx := context.Background()
+	e := newEnv(t)
+	e.add(t, "Книга")
+	secret := e.add(t, "Сюрприз")
+	item, _ := e.storage.GetWishListByCategory(ctx, ownerId).Find(secret)
+	item.Visibility = messages.VisibilityPrivate
+	err := e.storage.UpdateWishItem(ctx, ownerId, item)
+	require.NoError(t, err)
+	err = e.storage.AddUserCategory(ctx, ownerId, "Личное")
+	require.NoError(t, err)
+	err = e.storage.SetCategoryVisibility(ctx, ownerId, "Личное", messages.VisibilityPrivate)
+	require.NoError(t, err)
+	err = e.storage.AddWishItemToCategory(ctx, ownerId, "Личное", messages.WishItem{Name: "Дневник"})
+	require.NoError(t, err)
+	diary := e.storage.GetWishListByCategory(ctx, ownerId).Items("Личное")[0].ID
+	err = e.storage.DeleteWishItem(ctx, ownerId, diary)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, e.runAt(t, start.Add(DefaultDelay)))
+	require.Len(t, e.sender.sent, 1)
+	text := e.sender.sent[0].text
+	require.Contains(t, text, "добавил(а) 1 хотелку: Книга")
+	require.NotContains(t, text, "Сюрприз")
+	require.NotContains(t, text, "убрал", "Removing a private item shouldn't be announced")
+}
+
+func TestService_PerList(t *testing.T) {
+	ctx := context.Background()
+	e := newEnv(t)
+	const kidsFollowerId = int64(4)
+	require.NoError(t, e.storage.AddNewUser(ctx, kidsFollowerId))
+	home, _ := e.storage.GetActiveList(ctx, ownerId)
+	kids, err := e.storage.CreateList(ctx, ownerId, "Для ребёнка")
+	require.NoError(t, err)
+	require.NoError(t, e.storage.AddListFollower(ctx, kids.ID, kidsFollowerId))
+	require.NoError(t, e.storage.AddListFollower(ctx, kids.ID, followerId))
+	require.NoError(t, e.storage.SetActiveList(ctx, ownerId, kids.ID))
+	e.add(t, "Самокат")
+	require.NoError(t, e.storage.SetActiveList(ctx, ownerId, home.ID))
+	e.add(t, "Книга")
+
+	require.Equal(t, 1, e.runAt(t, start.Add(DefaultDelay)))
+	require.Len(t, e.sender.sent, 2)
+	texts := map[int64]string{}
+	for _, sent := range e.sender.sent {
+		texts[sent.userId] = sent.text
+	}
+	require.Contains(t, texts[kidsFollowerId], "Самокат")
+	require.NotContains(t, texts[kidsFollowerId], "Книга", "Changes of a list they don't follow are none of their business")
+	require.Contains(t, texts[followerId], "📋 Мой вишлист")
+	require.Contains(t, texts[followerId], "📋 Для ребёнка")
+	require.Contains(t, texts[followerId], fmt.Sprintf("start=w_%d", kids.ID))
+}
+
+func TestService_NoFollowers(t *testing.T) {
+	ctx := context.Background()
+	e := newEnv(t)
+	for _, id := range []int64{followerId, mutedId} {
+		err := e.storage.RemoveFollower(ctx, ownerId, id)
+		require.NoError(t, err)
+	}
+	e.add(t, "Книга")
+	require.Empty(t, e.storage.GetChanges(ctx, ownerId), "Changes nobody follows shouldn't pile up")
+	require.Zero(t, e.runAt(t, start.Add(DefaultDelay)))
+}
+
+func TestText(t *testing.T) {
+	change := func(id int64, kind messages.ChangeKind, item int64) messages.Change {
+		return messages.Change{ID: id, Kind: kind, ItemID: item, ItemName: fmt.Sprintf("Хотелка %d", item)}
+	}
+
+	t.Run("Should report removals of older items", func(t *testing.T) {
+		text := Text("Аня", []messages.Change{change(1, messages.ChangeItemRemoved, 7)})
+		require.Equal(t, "🗑 Аня убрал(а) 1 хотелку", text)
+	})
+
+	t.Run("Should be empty when changes cancel out", func(t *testing.T) {
+		text := Text("Аня", []messages.Change{change(1, messages.ChangeItemAdded, 7), change(2, messages.ChangeItemRemoved, 7)})
+		require.Empty(t, text)
+	})
+
+	t.Run("Should shorten long lists", func(t *testing.T) {
+		var changes []messages.Change
+		for i := int64(1); i <= 7; i++ {
+			changes = append(changes, change(i, messages.ChangeItemAdded, i))
+		}
+		text := Text("Аня", changes)
+		require.Equal(t, "🎁 Аня добавил(а) 7 хотелок: Хотелка 1, Хотелка 2, Хотелка 3, Хотелка 4, Хотелка 5 и ещё 2", text)
+	})
+}
@@ -0,0 +1,82 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"github.com/roman-clancy/ho4uha-bot/internal/importer"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"io"
+	"time"
+)
+
+var ErrUnknownFormat = errors.New("export: unknown format")
+
+type Renderer interface {
+	Extension() string
+	Render(w io.Writer, doc importer.Document) error
+}
+
+type Exporter struct {
+	renderers map[string]Renderer
+	formats   []string
+	now       func() time.Time
+}
+
+func New() *Exporter {
+	e := &Exporter{
+		renderers: make(map[string]Renderer),
+		now:       time.Now,
+	}
+	e.Register("json", JSONRenderer{})
+	e.Register("csv", CSVRenderer{})
+	e.Register("md", MarkdownRenderer{})
+	e.Register("html", HTMLRenderer{})
+	return e
+}
+
+// Register adds a renderer or replaces an existing one under the same name.
+func (e *Exporter) Register(format string, r Renderer) {
+	if _, ok := e.renderers[format]; !ok {
+		e.formats = append(e.formats, format)
+	}
+	e.renderers[format] = r
+}
+
+func (e *Exporter) Formats() []string {
+	return append([]string(nil), e.formats...)
+}
+
+func (e *Exporter) Export(format string, wishList messages.Categories) (messages.ExportFile, error) {
+	r, ok := e.renderers[format]
+	if !ok {
+		return messages.ExportFile{}, ErrUnknownFormat
+	}
+	var buf bytes.Buffer
+	if err := r.Render(&buf, NewDocument(wishList)); err != nil {
+		return messages.ExportFile{}, err
+	}
+	return messages.ExportFile{
+		Name: "wishlist-" + e.now().Format("2006-01-02") + "." + r.Extension(),
+		Data: buf.Bytes(),
+	}, nil
+}
+
+// NewDocument keeps the order of the list, so repeated exports of the same data are identical.
+func NewDocument(wishList messages.Categories) importer.Document {
+	doc := importer.Document{Version: 1, Categories: make([]importer.Category, 0, len(wishList))}
+	for _, cat := range wishList {
+		category := importer.Category{Name: cat.Name, Items: make([]importer.Item, 0, len(cat.Items))}
+		for _, item := range cat.Items {
+			category.Items = append(category.Items, importer.FromWishItem(item))
+		}
+		doc.Categories = append(doc.Categories, category)
+	}
+	return doc
+}
+
+func categoryTitle(name string) string {
+	if name == "default" {
+		return "Без категории"
+	}
+	return name
+}
@@ -0,0 +1,108 @@
+package export
+
+import (
+	"github.com/roman-clancy/ho4uha-bot/internal/importer"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testWishList() messages.Categories {
+	return messages.Categories{
+		{Name: "default", Items: []messages.WishItem{{Name: "Носки", ImageURL: "https://example.com/socks.jpg"}}},
+		{Name: "Игры", Items: []messages.WishItem{{Name: "<Катан>", URL: "https://example.com/catan?a=1&b=2"}}},
+		{Name: "Книги", Items: []messages.WishItem{
+			{Name: "Дюна", URL: "https://example.com/dune", Price: 120050, Currency: "RUB", Priority: messages.PriorityHigh},
+			{Name: "Солярис [переиздание]"},
+		}},
+	}
+}
+
+func newTestExporter() *Exporter {
+	e := New()
+	e.now = func() time.Time { return time.Date(2024, 12, 31, 10, 0, 0, 0, time.UTC) }
+	return e
+}
+
+func TestExporter_Export(t *testing.T) {
+	exporter := newTestExporter()
+
+	t.Run("Should name the file by date and format", func(t *testing.T) {
+		file, err := exporter.Export("md", testWishList())
+		require.NoError(t, err)
+		require.Equal(t, "wishlist-2024-12-31.md", file.Name)
+	})
+
+	t.Run("Should render markdown with default category first", func(t *testing.T) {
+		file, err := exporter.Export("md", testWishList())
+		require.NoError(t, err)
+		expected := "# Мой вишлист\n\n" +
+			"## Без категории\n\n- Носки\n\n" +
+			"## Игры\n\n- [<Катан>](https://example.com/catan?a=1&b=2)\n\n" +
+			"## Книги\n\n- [Дюна](https://example.com/dune) — 1 200,50 ₽ ❗\n- Солярис \\[переиздание\\]\n"
+		require.Equal(t, expected, string(file.Data))
+	})
+
+	t.Run("Should escape HTML", func(t *testing.T) {
+		file, err := exporter.Export("html", testWishList())
+		require.NoError(t, err)
+		html := string(file.Data)
+		require.Contains(t, html, `<a href="https://example.com/catan?a=1&amp;b=2">&lt;Катан&gt;</a>`)
+		require.Contains(t, html, `<span class="price">1 200,50 ₽</span>`)
+		require.NotContains(t, html, "<Катан>")
+	})
+
+	t.Run("Should fail on unknown format", func(t *testing.T) {
+		_, err := exporter.Export("pdf", testWishList())
+		require.ErrorIs(t, err, ErrUnknownFormat)
+	})
+
+	t.Run("Should produce identical output for identical data", func(t *testing.T) {
+		first, err := exporter.Export("json", testWishList())
+		require.NoError(t, err)
+		second, err := exporter.Export("json", testWishList())
+		require.NoError(t, err)
+		require.Equal(t, first.Data, second.Data)
+	})
+}
+
+type upperRenderer struct{}
+
+func (upperRenderer) Extension() string { return "txt" }
+
+func (upperRenderer) Render(w io.Writer, doc importer.Document) error {
+	_, err := io.WriteString(w, strings.ToUpper(doc.Categories[0].Items[0].Name))
+	return err
+}
+
+func TestExporter_Register(t *testing.T) {
+	exporter := newTestExporter()
+	exporter.Register("upper", upperRenderer{})
+	require.Equal(t, []string{"json", "csv", "md", "html", "upper"}, exporter.Formats())
+	file, err := exporter.Export("upper", testWishList())
+	require.NoError(t, err)
+	require.Equal(t, "НОСКИ", string(file.Data))
+	require.Equal(t, "wishlist-2024-12-31.txt", file.Name)
+}
+
+func TestExporter_RoundTrip(t *testing.T) {
+	exporter := newTestExporter()
+	for _, format := range []string{"json", "csv"} {
+		t.Run("Should import back what was exported as "+format, func(t *testing.T) {
+			file, err := exporter.Export(format, testWishList())
+			require.NoError(t, err)
+			batch, err := importer.New().Parse(file.Name, file.Data, messages.DefaultLimits())
+			require.NoError(t, err)
+			require.Empty(t, batch.Errors)
+			expected := testWishList()
+			if format == "csv" {
+				// CSV keeps only the columns a spreadsheet user edits.
+				expected[0].Items[0].ImageURL = ""
+			}
+			require.Equal(t, expected, batch.WishList())
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/importer"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"html/template"
+	"io"
+	"strings"
+)
+
+type JSONRenderer struct{}
+
+func (JSONRenderer) Extension() string { return "json" }
+
+func (JSONRenderer) Render(w io.Writer, doc importer.Document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// CSVRenderer writes the columns the CSV import understands.
+type CSVRenderer struct{}
+
+func (CSVRenderer) Extension() string { return "csv" }
+
+func (CSVRenderer) Render(w io.Writer, doc importer.Document) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"category", "name", "url", "price", "currency", "priority"}); err != nil {
+		return err
+	}
+	for _, cat := range doc.Categories {
+		for _, item := range cat.Items {
+			amount := ""
+			if item.Price > 0 {
+				amount = fmt.Sprintf("%d.%02d", item.Price/100, item.Price%100)
+			}
+			priority := ""
+			if item.Priority != messages.PriorityNone {
+				priority = priorityCode(item.Priority)
+			}
+			if err := writer.Write([]string{cat.Name, item.Name, item.URL, amount, item.Currency, priority}); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func priorityCode(p messages.Priority) string {
+	switch p {
+	case messages.PriorityLow:
+		return "low"
+	case messages.PriorityNormal:
+		return "normal"
+	case messages.PriorityHigh:
+		return "high"
+	}
+	return ""
+}
+
+type MarkdownRenderer struct{}
+
+func (MarkdownRenderer) Extension() string { return "md" }
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`, "`", "\\`")
+
+func (MarkdownRenderer) Render(w io.Writer, doc importer.Document) error {
+	var b strings.Builder
+	b.WriteString("# Мой вишлист\n")
+	for _, cat := range doc.Categories {
+		b.WriteString("\n## " + markdownEscaper.Replace(categoryTitle(cat.Name)) + "\n\n")
+		for _, item := range cat.Items {
+			name := markdownEscaper.Replace(item.Name)
+			if item.URL != "" {
+				name = "[" + name + "](" + strings.ReplaceAll(item.URL, ")", "%29") + ")"
+			}
+			b.WriteString("- " + name)
+			if item.Price > 0 {
+				b.WriteString(" — " + price.Format(item.Price, item.Currency))
+			}
+			if item.Priority == messages.PriorityHigh {
+				b.WriteString(" ❗")
+			}
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type HTMLRenderer struct{}
+
+func (HTMLRenderer) Extension() string { return "html" }
+
+var htmlTemplate = template.Must(template.New("wishlist").Funcs(template.FuncMap{
+	"title": categoryTitle,
+	"price": price.Format,
+	"high":  func(p messages.Priority) bool { return p == messages.PriorityHigh },
+}).Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>Мой вишлист</title>
+<style>
+body { font-family: sans-serif; max-width: 720px; margin: 2em auto; }
+li { margin: .3em 0; }
+.price { color: #555; }
+</style>
+</head>
+<body>
+<h1>Мой вишлист</h1>
+{{range .Categories}}<h2>{{title .Name}}</h2>
+<ul>
+{{range .Items}}<li>{{if .URL}}<a href="{{.URL}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}{{if .Price}} <span class="price">{{price .Price .Currency}}</span>{{end}}{{if high .Priority}} ❗{{end}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+func (HTMLRenderer) Render(w io.Writer, doc importer.Document) error {
+	return htmlTemplate.Execute(w, doc)
+}
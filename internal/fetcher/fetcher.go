@@ -0,0 +1,148 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrUnsupportedScheme = errors.New("fetcher: unsupported url scheme")
+	ErrPrivateAddress    = errors.New("fetcher: private network address")
+	ErrTooManyRedirects  = errors.New("fetcher: too many redirects")
+	ErrTooLarge          = errors.New("fetcher: response body too large")
+)
+
+type Options struct {
+	Timeout      time.Duration
+	MaxBodySize  int64
+	MaxRedirects int
+	UserAgent    string
+	// AllowPrivate disables private address blocking. Only tests against local servers need it.
+	AllowPrivate bool
+}
+
+type Page struct {
+	URL         *url.URL
+	ContentType string
+	Body        []byte
+}
+
+type Fetcher struct {
+	client *http.Client
+	opts   Options
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:      10 * time.Second,
+		MaxBodySize:  2 << 20,
+		MaxRedirects: 5,
+		UserAgent:    "Mozilla/5.0 (compatible; ho4uha-bot/1.0)",
+	}
+}
+
+func New(opts Options) *Fetcher {
+	f := &Fetcher{opts: opts}
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivate {
+		dialer.Control = checkDialAddress
+	}
+	f.client = &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: opts.Timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     30 * time.Second,
+		},
+		CheckRedirect: f.checkRedirect,
+	}
+	return f
+}
+
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.opts.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.5")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetcher: unexpected status %s for %s", resp.Status, u)
+	}
+	if resp.ContentLength > f.opts.MaxBodySize {
+		return nil, ErrTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.opts.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > f.opts.MaxBodySize {
+		return nil, ErrTooLarge
+	}
+	return &Page{
+		URL:         resp.Request.URL,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        body,
+	}, nil
+}
+
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > f.opts.MaxRedirects {
+		return ErrTooManyRedirects
+	}
+	return checkScheme(req.URL)
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrUnsupportedScheme
+	}
+	return nil
+}
+
+// checkDialAddress runs after DNS resolution, so hostnames pointing to internal
+// addresses are rejected as well as literal IPs.
+func checkDialAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || IsPrivateIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func IsPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		carrierGradeNAT.Contains(ip)
+}
@@ -0,0 +1,123 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.Timeout = time.Second
+	opts.MaxBodySize = 1024
+	opts.MaxRedirects = 2
+	opts.AllowPrivate = true
+	return opts
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><title>Page</title></html>")
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("a", 2048))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(3 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/redirect/"), "%d", &n)
+		if n == 0 {
+			http.Redirect(w, r, "/page", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/redirect/%d", n-1), http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	f := New(testOptions())
+
+	t.Run("Should fetch page body and content type", func(t *testing.T) {
+		page, err := f.Fetch(context.Background(), server.URL+"/page")
+		require.NoError(t, err)
+		require.Equal(t, "<html><title>Page</title></html>", string(page.Body))
+		require.Contains(t, page.ContentType, "text/html")
+	})
+
+	t.Run("Should follow redirects within limit and report final URL", func(t *testing.T) {
+		page, err := f.Fetch(context.Background(), server.URL+"/redirect/1")
+		require.NoError(t, err)
+		require.Equal(t, "/page", page.URL.Path)
+	})
+
+	t.Run("Should stop after too many redirects", func(t *testing.T) {
+		_, err := f.Fetch(context.Background(), server.URL+"/redirect/5")
+		require.ErrorIs(t, err, ErrTooManyRedirects)
+	})
+
+	t.Run("Should reject body bigger than limit", func(t *testing.T) {
+		_, err := f.Fetch(context.Background(), server.URL+"/big")
+		require.ErrorIs(t, err, ErrTooLarge)
+	})
+
+	t.Run("Should give up on slow server", func(t *testing.T) {
+		start := time.Now()
+		_, err := f.Fetch(context.Background(), server.URL+"/slow")
+		require.Error(t, err)
+		require.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("Should fail on non-200 status", func(t *testing.T) {
+		_, err := f.Fetch(context.Background(), server.URL+"/missing")
+		require.Error(t, err)
+	})
+
+	t.Run("Should reject non-http schemes", func(t *testing.T) {
+		_, err := f.Fetch(context.Background(), "file:///etc/passwd")
+		require.ErrorIs(t, err, ErrUnsupportedScheme)
+	})
+}
+
+func TestFetcher_PrivateAddressBlocking(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "internal")
+	}))
+	defer server.Close()
+	opts := testOptions()
+	opts.AllowPrivate = false
+	f := New(opts)
+
+	t.Run("Should refuse to connect to loopback address", func(t *testing.T) {
+		_, err := f.Fetch(context.Background(), server.URL)
+		require.ErrorIs(t, err, ErrPrivateAddress)
+	})
+
+	t.Run("Should refuse to follow redirect into private network", func(t *testing.T) {
+		redirector := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+		defer redirector.Close()
+		_, err := f.Fetch(context.Background(), redirector.URL)
+		require.ErrorIs(t, err, ErrPrivateAddress)
+	})
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "192.168.0.1", "172.16.5.4", "169.254.169.254", "100.64.0.1", "::1", "fc00::1", "0.0.0.0"} {
+		require.Truef(t, IsPrivateIP(net.ParseIP(ip)), "%s should be private", ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "93.184.216.34", "2a00:1450:4010::64"} {
+		require.Falsef(t, IsPrivateIP(net.ParseIP(ip)), "%s should be public", ip)
+	}
+}
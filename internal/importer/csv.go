@@ -0,0 +1,145 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"io"
+	"strings"
+)
+
+const (
+	colCategory = "category"
+	colName     = "name"
+	colURL      = "url"
+	colPrice    = "price"
+	colCurrency = "currency"
+	colPriority = "priority"
+)
+
+var headerAliases = map[string]string{
+	"category":  colCategory,
+	"категория": colCategory,
+	"name":      colName,
+	"title":     colName,
+	"название":  colName,
+	"хотелка":   colName,
+	"url":       colURL,
+	"link":      colURL,
+	"ссылка":    colURL,
+	"price":     colPrice,
+	"цена":      colPrice,
+	"currency":  colCurrency,
+	"валюта":    colCurrency,
+	"priority":  colPriority,
+	"приоритет": colPriority,
+}
+
+var priorityAliases = map[string]messages.Priority{
+	"":        messages.PriorityNone,
+	"low":     messages.PriorityLow,
+	"низкий":  messages.PriorityLow,
+	"normal":  messages.PriorityNormal,
+	"средний": messages.PriorityNormal,
+	"high":    messages.PriorityHigh,
+	"высокий": messages.PriorityHigh,
+}
+
+func ParseCSV(data []byte) (messages.ImportBatch, error) {
+	var batch messages.ImportBatch
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectDelimiter(string(firstLine))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return batch, fmt.Errorf("пустой CSV: %w", err)
+	}
+	columns, ok := csvHeader(header)
+	if !ok {
+		return batch, fmt.Errorf("в первой строке CSV нужны названия колонок, например: category,name,url,price")
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			batch.Errors = append(batch.Errors, messages.ImportError{Line: parseErr.Line, Reason: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return batch, err
+		}
+		line, _ := reader.FieldPos(0)
+		if isBlank(record) {
+			continue
+		}
+		get := func(col string) string {
+			if idx, ok := columns[col]; ok && idx < len(record) {
+				return strings.TrimSpace(record[idx])
+			}
+			return ""
+		}
+		item := messages.WishItem{Name: get(colName), URL: get(colURL)}
+		if raw := get(colPrice); raw != "" {
+			amount, ok := price.Parse(raw)
+			if !ok {
+				batch.Errors = append(batch.Errors, messages.ImportError{Line: line, Reason: fmt.Sprintf("не понял цену '%s'", raw)})
+				continue
+			}
+			item.Price = amount
+			item.Currency = price.NormalizeCurrency(get(colCurrency))
+		}
+		priority, ok := priorityAliases[strings.ToLower(get(colPriority))]
+		if !ok {
+			batch.Errors = append(batch.Errors, messages.ImportError{Line: line, Reason: fmt.Sprintf("неизвестный приоритет '%s'", get(colPriority))})
+			continue
+		}
+		item.Priority = priority
+		addRow(&batch, line, get(colCategory), item)
+	}
+	return batch, nil
+}
+
+func csvHeader(header []string) (map[string]int, bool) {
+	columns := make(map[string]int)
+	for i, h := range header {
+		if col, ok := headerAliases[strings.ToLower(strings.TrimSpace(h))]; ok {
+			columns[col] = i
+		}
+	}
+	_, hasName := columns[colName]
+	_, hasURL := columns[colURL]
+	return columns, hasName || hasURL
+}
+
+func splitCSVHeader(line string) []string {
+	return strings.Split(line, string(detectDelimiter(line)))
+}
+
+// detectDelimiter picks between the comma and the semicolon Excel uses in Russian locale.
+func detectDelimiter(line string) rune {
+	best, bestCount := ',', strings.Count(line, ",")
+	for _, d := range []rune{';', '\t'} {
+		if c := strings.Count(line, string(d)); c > bestCount {
+			best, bestCount = d, c
+		}
+	}
+	return best
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
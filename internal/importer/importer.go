@@ -0,0 +1,129 @@
+package importer
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatText = "text"
+
+	MaxFileSize = 1 << 20
+	MaxRows     = 1000
+)
+
+var (
+	ErrTooLarge      = errors.New("файл больше 1 МБ")
+	ErrNotUTF8       = errors.New("файл должен быть в кодировке UTF-8")
+	ErrUnknownFormat = errors.New("неизвестный формат файла")
+)
+
+type Importer struct{}
+
+func New() *Importer {
+	return &Importer{}
+}
+
+// Parse reads the file and checks every row against limits, rows that don't fit are reported as errors.
+func (i *Importer) Parse(fileName string, data []byte, limits messages.Limits) (messages.ImportBatch, error) {
+	if len(data) > MaxFileSize {
+		return messages.ImportBatch{}, ErrTooLarge
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return messages.ImportBatch{}, ErrNotUTF8
+	}
+	format := DetectFormat(fileName, data)
+	var batch messages.ImportBatch
+	var err error
+	switch format {
+	case FormatCSV:
+		batch, err = ParseCSV(data)
+	case FormatJSON:
+		batch, err = ParseJSON(data)
+	case FormatText:
+		batch, err = ParseText(data)
+	default:
+		return messages.ImportBatch{}, ErrUnknownFormat
+	}
+	if err != nil {
+		return messages.ImportBatch{}, err
+	}
+	batch.Format = format
+	batch.Rows = slices.DeleteFunc(batch.Rows, func(row messages.ImportRow) bool {
+		reason := validate(limits, row.Category, row.Item)
+		if reason != "" {
+			batch.Errors = append(batch.Errors, messages.ImportError{Line: row.Line, Reason: reason})
+		}
+		return reason != ""
+	})
+	slices.SortStableFunc(batch.Errors, func(a, b messages.ImportError) int { return cmp.Compare(a.Line, b.Line) })
+	if len(batch.Rows) > MaxRows {
+		for _, row := range batch.Rows[MaxRows:] {
+			batch.Errors = append(batch.Errors, messages.ImportError{Line: row.Line, Reason: fmt.Sprintf("больше %d строк за раз не импортируется", MaxRows)})
+		}
+		batch.Rows = batch.Rows[:MaxRows]
+	}
+	return batch, nil
+}
+
+// DetectFormat trusts the file extension and sniffs the content otherwise.
+func DetectFormat(fileName string, data []byte) string {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".csv", ".tsv":
+		return FormatCSV
+	case ".json":
+		return FormatJSON
+	case ".txt", ".md":
+		return FormatText
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return FormatJSON
+	}
+	firstLine, _, _ := bytes.Cut(trimmed, []byte("\n"))
+	if _, ok := csvHeader(splitCSVHeader(string(firstLine))); ok {
+		return FormatCSV
+	}
+	if len(trimmed) == 0 {
+		return ""
+	}
+	return FormatText
+}
+
+// addRow appends the item to the batch, Parse validates it afterwards.
+func addRow(batch *messages.ImportBatch, line int, category string, item messages.WishItem) {
+	item.Name = strings.TrimSpace(item.Name)
+	item.URL = strings.TrimSpace(item.URL)
+	category = strings.TrimSpace(category)
+	if category == "" {
+		category = "default"
+	}
+	batch.Rows = append(batch.Rows, messages.ImportRow{Line: line, Category: category, Item: item})
+}
+
+func validate(limits messages.Limits, category string, item messages.WishItem) string {
+	if err := limits.ValidateItem(item); err != nil {
+		return messages.ValidationText(err)
+	}
+	if category != "" && category != "default" {
+		var invalid *messages.ValidationError
+		err := limits.ValidateCategoryName(category, nil)
+		if errors.As(err, &invalid) && invalid.Reason != messages.ReasonReserved {
+			return invalid.Text()
+		}
+	}
+	if item.Price < 0 {
+		return "отрицательная цена"
+	}
+	return ""
+}
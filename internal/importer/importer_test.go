@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	require.Equal(t, FormatCSV, DetectFormat("list.CSV", nil))
+	require.Equal(t, FormatJSON, DetectFormat("export.json", nil))
+	require.Equal(t, FormatText, DetectFormat("notes.txt", nil))
+	require.Equal(t, FormatJSON, DetectFormat("file", []byte(` [{"name":"x"}]`)))
+	require.Equal(t, FormatCSV, DetectFormat("file", []byte("Категория;Название;Ссылка\nA;B;C")))
+	require.Equal(t, FormatText, DetectFormat("file", []byte("Носки\nКнига")))
+	require.Equal(t, "", DetectFormat("file", []byte("  ")))
+}
+
+func TestImporter_ParseCSV(t *testing.T) {
+	importer := New()
+
+	t.Run("Should map columns by header and validate every row", func(t *testing.T) {
+		data := "category,name,url,price,currency,priority\n" +
+			"Книги,Дюна,https://example.com/dune,\"1 200\",RUB,high\n" +
+			",Носки,,,,\n" +
+			"Игры,Катан,ftp://example.com/catan,,,\n" +
+			"Игры,,,,,\n" +
+			"Игры,Каркассон,,дорого,,\n" +
+			"Игры,Манчкин,,,,срочно\n"
+		batch, err := importer.Parse("list.csv", []byte(data), messages.DefaultLimits())
+		require.NoError(t, err)
+		require.Equal(t, FormatCSV, batch.Format)
+		require.Len(t, batch.Rows, 2)
+		require.Equal(t, messages.ImportRow{Line: 2, Category: "Книги", Item: messages.WishItem{
+			Name: "Дюна", URL: "https://example.com/dune", Price: 120000, Currency: "RUB", Priority: messages.PriorityHigh,
+		}}, batch.Rows[0])
+		require.Equal(t, "default", batch.Rows[1].Category)
+		require.Len(t, batch.Errors, 4)
+		lines := []int{}
+		for _, e := range batch.Errors {
+			lines = append(lines, e.Line)
+		}
+		require.Equal(t, []int{4, 5, 6, 7}, lines)
+	})
+
+	t.Run("Should understand semicolon separated russian headers", func(t *testing.T) {
+		data := "\xef\xbb\xbfКатегория;Название;Цена\nДом;Плед;2 500,50\n"
+		batch, err := importer.Parse("list.csv", []byte(data), messages.DefaultLimits())
+		require.NoError(t, err)
+		require.Len(t, batch.Rows, 1)
+		require.Equal(t, "Плед", batch.Rows[0].Item.Name)
+		require.Equal(t, int64(250050), batch.Rows[0].Item.Price)
+	})
+
+	t.Run("Should report rows with broken quotes and keep reading", func(t *testing.T) {
+		for _, row := range []string{"a\"b,c", "\"a\"b,c", "\"abc,http://x"} {
+			data := "name,url\nДюна,\n" + row + "\n"
+			batch, err := importer.Parse("list.csv", []byte(data), messages.DefaultLimits())
+			require.NoError(t, err, row)
+			require.Len(t, batch.Rows, 1, row)
+			require.Len(t, batch.Errors, 1, row)
+			require.Equal(t, 3, batch.Errors[0].Line, row)
+		}
+
+		batch, err := importer.Parse("list.csv", []byte("name,url\na\"b,c\nКатан,\n"), messages.DefaultLimits())
+		require.NoError(t, err)
+		require.Equal(t, "Катан", batch.Rows[0].Item.Name)
+		require.Equal(t, 2, batch.Errors[0].Line)
+	})
+
+	t.Run("Should reject CSV without known header", func(t *testing.T) {
+		_, err := importer.Parse("list.csv", []byte("a,b,c\n1,2,3\n"), messages.DefaultLimits())
+		require.Error(t, err)
+	})
+}
+
+func TestImporter_ParseJSON(t *testing.T) {
+	importer := New()
+
+	t.Run("Should read export document", func(t *testing.T) {
+		data := `{"version":1,"categories":[
+			{"name":"default","items":[{"name":"Носки"}]},
+			{"name":"Книги","items":[{"name":"Дюна","url":"https://example.com","price":120000,"currency":"RUB"},{"name":""}]}
+		]}`
+		batch, err := importer.Parse("export.json", []byte(data), messages.DefaultLimits())
+		require.NoError(t, err)
+		require.Len(t, batch.Rows, 2)
+		require.Equal(t, "Книги", batch.Rows[1].Category)
+		require.Equal(t, int64(120000), batch.Rows[1].Item.Price)
+		require.Equal(t, []messages.ImportError{{Line: 3, Reason: "нет ни названия, ни ссылки"}}, batch.Errors)
+	})
+
+	t.Run("Should read flat array", func(t *testing.T) {
+		batch, err := importer.Parse("items.json", []byte(`[{"category":"Игры","name":"Катан"},{"name":"Носки"}]`), messages.DefaultLimits())
+		require.NoError(t, err)
+		require.Len(t, batch.Rows, 2)
+		require.Equal(t, "Игры", batch.Rows[0].Category)
+		require.Equal(t, "default", batch.Rows[1].Category)
+	})
+
+	t.Run("Should fail on broken JSON", func(t *testing.T) {
+		_, err := importer.Parse("items.json", []byte(`{"categories":[`), messages.DefaultLimits())
+		require.Error(t, err)
+	})
+}
+
+func TestImporter_ParseText(t *testing.T) {
+	importer := New()
+	data := strings.Join([]string{
+		"Носки",
+		"",
+		"Книги:",
+		"- Дюна 1 200 ₽",
+		"2) Солярис https://example.com/solaris",
+		"## Игры",
+		"[ ] Катан !высокий",
+		"* Манчкин #настолки",
+		"- #пусто",
+	}, "\n")
+	batch, err := importer.Parse("notes.txt", []byte(data), messages.DefaultLimits())
+	require.NoError(t, err)
+	require.Equal(t, FormatText, batch.Format)
+	require.Len(t, batch.Rows, 5)
+	require.Equal(t, messages.ImportRow{Line: 1, Category: "default", Item: messages.WishItem{Name: "Носки"}}, batch.Rows[0])
+	require.Equal(t, "Книги", batch.Rows[1].Category)
+	require.Equal(t, int64(120000), batch.Rows[1].Item.Price)
+	require.Equal(t, "https://example.com/solaris", batch.Rows[2].Item.URL)
+	require.Equal(t, "Игры", batch.Rows[3].Category)
+	require.Equal(t, messages.PriorityHigh, batch.Rows[3].Item.Priority)
+	require.Equal(t, "настолки", batch.Rows[4].Category)
+	require.Equal(t, []messages.ImportError{{Line: 9, Reason: "не нашёл ни названия, ни ссылки"}}, batch.Errors)
+}
+
+func TestImporter_Limits(t *testing.T) {
+	importer := New()
+
+	t.Run("Should reject files that are too large", func(t *testing.T) {
+		_, err := importer.Parse("big.txt", make([]byte, MaxFileSize+1), messages.DefaultLimits())
+		require.ErrorIs(t, err, ErrTooLarge)
+	})
+
+	t.Run("Should reject files that aren't UTF-8", func(t *testing.T) {
+		_, err := importer.Parse("cp1251.txt", []byte{0xcd, 0xee, 0xf1, 0xea, 0xe8}, messages.DefaultLimits())
+		require.ErrorIs(t, err, ErrNotUTF8)
+	})
+
+	t.Run("Should cut rows above the limit and report them", func(t *testing.T) {
+		data := strings.Repeat("Носки\n", MaxRows+2)
+		batch, err := importer.Parse("many.txt", []byte(data), messages.DefaultLimits())
+		require.NoError(t, err)
+		require.Len(t, batch.Rows, MaxRows)
+		require.Len(t, batch.Errors, 2)
+	})
+}
@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+)
+
+// Document is the JSON layout written by /export, so exported files can be imported back.
+type Document struct {
+	Version    int        `json:"version"`
+	Categories []Category `json:"categories"`
+}
+
+type Category struct {
+	Name  string `json:"name"`
+	Items []Item `json:"items"`
+}
+
+type Item struct {
+	Name     string            `json:"name"`
+	URL      string            `json:"url,omitempty"`
+	Price    int64             `json:"price,omitempty"`
+	Currency string            `json:"currency,omitempty"`
+	Priority messages.Priority `json:"priority,omitempty"`
+	ImageURL string            `json:"image_url,omitempty"`
+	PhotoID  string            `json:"photo_file_id,omitempty"`
+	Note     string            `json:"note,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+}
+
+// flatItem is a row of a plain JSON array, the shape most spreadsheet converters produce.
+type flatItem struct {
+	Item
+	Category string `json:"category"`
+}
+
+func ToWishItem(i Item) messages.WishItem {
+	return messages.WishItem{
+		Name:        i.Name,
+		URL:         i.URL,
+		Price:       i.Price,
+		Currency:    i.Currency,
+		Priority:    i.Priority,
+		ImageURL:    i.ImageURL,
+		PhotoFileID: i.PhotoID,
+		Note:        i.Note,
+		Tags:        i.Tags,
+	}
+}
+
+func FromWishItem(i messages.WishItem) Item {
+	return Item{
+		Name:     i.Name,
+		URL:      i.URL,
+		Price:    i.Price,
+		Currency: i.Currency,
+		Priority: i.Priority,
+		ImageURL: i.ImageURL,
+		PhotoID:  i.PhotoFileID,
+		Note:     i.Note,
+		Tags:     i.Tags,
+	}
+}
+
+func ParseJSON(data []byte) (messages.ImportBatch, error) {
+	var batch messages.ImportBatch
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var rows []flatItem
+		if err := json.Unmarshal(trimmed, &rows); err != nil {
+			return batch, fmt.Errorf("некорректный JSON: %w", err)
+		}
+		for i, row := range rows {
+			addRow(&batch, i+1, row.Category, ToWishItem(row.Item))
+		}
+		return batch, nil
+	}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return batch, fmt.Errorf("некорректный JSON: %w", err)
+	}
+	// Line numbers count items through the whole document, as JSON has no meaningful lines.
+	n := 0
+	for _, cat := range doc.Categories {
+		for _, item := range cat.Items {
+			n++
+			addRow(&batch, n, cat.Name, ToWishItem(item))
+		}
+	}
+	return batch, nil
+}
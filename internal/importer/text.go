@@ -0,0 +1,53 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"regexp"
+	"strings"
+)
+
+var reListMarker = regexp.MustCompile(`^(?:[-*•—]|\d+[.)]|\[[ xX]?\])\s*`)
+
+// ParseText reads notes-app style lists: one item per line, "Категория:" or "## Категория"
+// lines open a category, and every line is understood like a one-shot /add message.
+func ParseText(data []byte) (messages.ImportBatch, error) {
+	var batch messages.ImportBatch
+	category := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if heading, ok := parseHeading(text); ok {
+			category = heading
+			continue
+		}
+		text = reListMarker.ReplaceAllString(text, "")
+		parsed, ok := messages.ParseItemText(text)
+		if !ok {
+			batch.Errors = append(batch.Errors, messages.ImportError{Line: line, Reason: "не нашёл ни названия, ни ссылки"})
+			continue
+		}
+		rowCategory := category
+		if parsed.Category != "" {
+			rowCategory = parsed.Category
+		}
+		addRow(&batch, line, rowCategory, parsed.Item)
+	}
+	return batch, scanner.Err()
+}
+
+func parseHeading(text string) (string, bool) {
+	if strings.HasPrefix(text, "# ") || strings.HasPrefix(text, "##") {
+		return strings.TrimSpace(strings.TrimLeft(text, "#")), true
+	}
+	if heading, ok := strings.CutSuffix(text, ":"); ok && !strings.Contains(heading, "://") {
+		return strings.TrimSpace(heading), true
+	}
+	return "", false
+}
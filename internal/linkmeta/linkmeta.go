@@ -0,0 +1,137 @@
+package linkmeta
+
+import (
+	"context"
+	"errors"
+	"github.com/roman-clancy/ho4uha-bot/internal/fetcher"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrNothingFound = errors.New("linkmeta: no metadata found")
+
+type Metadata struct {
+	Title    string
+	Image    string
+	Price    int64
+	Currency string
+}
+
+func (m Metadata) IsEmpty() bool {
+	return m.Title == "" && m.Image == "" && m.Price == 0
+}
+
+// Merge fills empty fields of m from other, so earlier sources take precedence.
+func (m Metadata) Merge(other Metadata) Metadata {
+	if m.Title == "" {
+		m.Title = other.Title
+	}
+	if m.Image == "" {
+		m.Image = other.Image
+	}
+	if m.Price == 0 {
+		m.Price, m.Currency = other.Price, other.Currency
+	}
+	return m
+}
+
+type Parser interface {
+	Parse(pageURL *url.URL, body []byte) Metadata
+}
+
+type ParserFunc func(pageURL *url.URL, body []byte) Metadata
+
+func (f ParserFunc) Parse(pageURL *url.URL, body []byte) Metadata {
+	return f(pageURL, body)
+}
+
+// Chain runs parsers in order and merges their results.
+func Chain(parsers ...Parser) Parser {
+	return ParserFunc(func(pageURL *url.URL, body []byte) Metadata {
+		var result Metadata
+		for _, p := range parsers {
+			result = result.Merge(p.Parse(pageURL, body))
+		}
+		return result
+	})
+}
+
+var DefaultParser = Chain(ParserFunc(ParseJSONLD), ParserFunc(ParseOpenGraph), ParserFunc(ParseMeta))
+
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) (*fetcher.Page, error)
+}
+
+type Extractor struct {
+	fetcher Fetcher
+	timeout time.Duration
+	sites   map[string]Parser
+}
+
+// inspectTimeout is short because InspectLink runs on the update loop and a slow shop would hold
+// up every user. The draft falls back to what the user typed when it runs out.
+const inspectTimeout = 4 * time.Second
+
+func New(f Fetcher) *Extractor {
+	e := &Extractor{
+		fetcher: f,
+		timeout: inspectTimeout,
+		sites:   make(map[string]Parser),
+	}
+	e.Register("ozon.ru", ParserFunc(ParseOzon))
+	return e
+}
+
+// Register adds a marketplace specific parser for host and all its subdomains.
+// Its results take precedence over the generic parsers.
+func (e *Extractor) Register(host string, p Parser) {
+	e.sites[strings.ToLower(host)] = p
+}
+
+func (e *Extractor) Extract(ctx context.Context, rawURL string) (Metadata, error) {
+	page, err := e.fetcher.Fetch(ctx, rawURL)
+	if err != nil {
+		return Metadata{}, err
+	}
+	meta := DefaultParser.Parse(page.URL, page.Body)
+	if site := e.siteParser(page.URL.Hostname()); site != nil {
+		meta = site.Parse(page.URL, page.Body).Merge(meta)
+	}
+	if meta.IsEmpty() {
+		return Metadata{}, ErrNothingFound
+	}
+	return meta, nil
+}
+
+func (e *Extractor) siteParser(host string) Parser {
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	for host != "" {
+		if p, ok := e.sites[host]; ok {
+			return p
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			break
+		}
+		host = parent
+	}
+	return nil
+}
+
+func (e *Extractor) InspectLink(rawURL string) (messages.WishItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	meta, err := e.Extract(ctx, rawURL)
+	if err != nil {
+		return messages.WishItem{}, err
+	}
+	return messages.WishItem{
+		Name:     meta.Title,
+		URL:      rawURL,
+		ImageURL: meta.Image,
+		Price:    meta.Price,
+		Currency: meta.Currency,
+	}, nil
+}
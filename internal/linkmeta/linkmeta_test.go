@@ -0,0 +1,124 @@
+package linkmeta
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/fetcher"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newTestExtractor(t *testing.T) (*Extractor, *httptest.Server) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	t.Cleanup(server.Close)
+	opts := fetcher.DefaultOptions()
+	opts.AllowPrivate = true
+	return New(fetcher.New(opts)), server
+}
+
+func TestExtractor_Extract(t *testing.T) {
+	extractor, server := newTestExtractor(t)
+
+	t.Run("Should prefer JSON-LD product over other sources", func(t *testing.T) {
+		meta, err := extractor.Extract(context.Background(), server.URL+"/jsonld.html")
+		require.NoError(t, err)
+		require.Equal(t, `LEGO Technic 42100 "Liebherr"`, meta.Title)
+		require.Equal(t, server.URL+"/img/42100.jpg", meta.Image)
+		require.Equal(t, int64(1599000), meta.Price)
+		require.Equal(t, "RUB", meta.Currency)
+	})
+
+	t.Run("Should read OpenGraph tags regardless of attribute order", func(t *testing.T) {
+		meta, err := extractor.Extract(context.Background(), server.URL+"/opengraph.html")
+		require.NoError(t, err)
+		require.Equal(t, "Наушники Sony WH-1000XM5", meta.Title)
+		require.Equal(t, "https://cdn.example.com/wh1000xm5.png", meta.Image)
+		require.Equal(t, int64(3499000), meta.Price)
+		require.Equal(t, "RUB", meta.Currency)
+	})
+
+	t.Run("Should fall back to title, twitter card and microdata", func(t *testing.T) {
+		meta, err := extractor.Extract(context.Background(), server.URL+"/meta.html")
+		require.NoError(t, err)
+		require.Equal(t, "Кофемолка & аксессуары", meta.Title)
+		require.Equal(t, server.URL+"/images/grinder.jpg", meta.Image)
+		require.Equal(t, int64(499950), meta.Price)
+	})
+
+	t.Run("Should report pages without metadata", func(t *testing.T) {
+		_, err := extractor.Extract(context.Background(), server.URL+"/empty.html")
+		require.ErrorIs(t, err, ErrNothingFound)
+	})
+
+	t.Run("Should return fetch errors", func(t *testing.T) {
+		_, err := extractor.Extract(context.Background(), server.URL+"/missing.html")
+		require.Error(t, err)
+	})
+}
+
+func TestExtractor_Register(t *testing.T) {
+	extractor, server := newTestExtractor(t)
+	host, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	extractor.Register(host.Hostname(), ParserFunc(func(pageURL *url.URL, body []byte) Metadata {
+		return Metadata{Title: fmt.Sprintf("Site parser for %s", pageURL.Path)}
+	}))
+
+	t.Run("Should let site parser override generic fields and keep the rest", func(t *testing.T) {
+		meta, err := extractor.Extract(context.Background(), server.URL+"/opengraph.html")
+		require.NoError(t, err)
+		require.Equal(t, "Site parser for /opengraph.html", meta.Title)
+		require.Equal(t, int64(3499000), meta.Price)
+	})
+
+	t.Run("Should match subdomains of registered host", func(t *testing.T) {
+		extractor.Register("example.com", ParserFunc(ParseMeta))
+		require.NotNil(t, extractor.siteParser("www.shop.example.com"))
+		require.Nil(t, extractor.siteParser("example.org"))
+	})
+
+	t.Run("Should ship the Ozon parser", func(t *testing.T) {
+		require.NotNil(t, extractor.siteParser("www.ozon.ru"))
+	})
+}
+
+func TestParseOzon(t *testing.T) {
+	extractor, server := newTestExtractor(t)
+	host, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	extractor.Register(host.Hostname(), ParserFunc(ParseOzon))
+
+	meta, err := extractor.Extract(context.Background(), server.URL+"/ozon.html")
+	require.NoError(t, err)
+	require.Equal(t, `Конструктор LEGO Technic 42100 "Liebherr"`, meta.Title)
+	require.Equal(t, "https://cdn1.ozone.ru/s3/multimedia-1/6543210.jpg", meta.Image)
+	require.Equal(t, int64(1599000), meta.Price)
+	require.Equal(t, "RUB", meta.Currency)
+}
+
+func TestExtractor_InspectLink(t *testing.T) {
+	extractor, server := newTestExtractor(t)
+	item, err := extractor.InspectLink(server.URL + "/jsonld.html")
+	require.NoError(t, err)
+	require.Equal(t, server.URL+"/jsonld.html", item.URL)
+	require.Equal(t, `LEGO Technic 42100 "Liebherr"`, item.Name)
+	require.Equal(t, int64(1599000), item.Price)
+
+	t.Run("Should give up on a slow page", func(t *testing.T) {
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer slow.Close()
+		defer close(release)
+		extractor.timeout = 50 * time.Millisecond
+		start := time.Now()
+		_, err := extractor.InspectLink(slow.URL + "/item")
+		require.Error(t, err)
+		require.Less(t, time.Since(start), time.Second)
+	})
+}
@@ -0,0 +1,189 @@
+package linkmeta
+
+import (
+	"encoding/json"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	reJSONLD   = regexp.MustCompile(`(?is)<script[^>]+type\s*=\s*["']application/ld\+json["'][^>]*>(.*?)</script>`)
+	reMetaTag  = regexp.MustCompile(`(?is)<meta\s([^>]*)>`)
+	reAttr     = regexp.MustCompile(`(?s)([a-zA-Z_:\-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	reTitleTag = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+func ParseJSONLD(pageURL *url.URL, body []byte) Metadata {
+	var result Metadata
+	for _, match := range reJSONLD.FindAllSubmatch(body, -1) {
+		var doc any
+		if err := json.Unmarshal(match[1], &doc); err != nil {
+			continue
+		}
+		result = result.Merge(findProduct(doc))
+	}
+	result.Image = resolveURL(pageURL, result.Image)
+	return result
+}
+
+func findProduct(node any) Metadata {
+	switch v := node.(type) {
+	case []any:
+		for _, child := range v {
+			if meta := findProduct(child); !meta.IsEmpty() {
+				return meta
+			}
+		}
+	case map[string]any:
+		if hasType(v["@type"], "Product") {
+			meta := Metadata{
+				Title: html.UnescapeString(jsonString(v["name"])),
+				Image: jsonImage(v["image"]),
+			}
+			meta.Price, meta.Currency = jsonOffer(v["offers"])
+			return meta
+		}
+		if graph, ok := v["@graph"]; ok {
+			return findProduct(graph)
+		}
+	}
+	return Metadata{}
+}
+
+func hasType(t any, name string) bool {
+	switch v := t.(type) {
+	case string:
+		return v == name
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonString(v any) string {
+	switch s := v.(type) {
+	case string:
+		return strings.TrimSpace(s)
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	return ""
+}
+
+func jsonImage(v any) string {
+	switch img := v.(type) {
+	case string:
+		return img
+	case []any:
+		if len(img) > 0 {
+			return jsonImage(img[0])
+		}
+	case map[string]any:
+		return jsonString(img["url"])
+	}
+	return ""
+}
+
+func jsonOffer(v any) (int64, string) {
+	switch offer := v.(type) {
+	case []any:
+		for _, o := range offer {
+			if amount, currency := jsonOffer(o); amount > 0 {
+				return amount, currency
+			}
+		}
+	case map[string]any:
+		amountStr := jsonString(offer["price"])
+		if amountStr == "" {
+			amountStr = jsonString(offer["lowPrice"])
+		}
+		if amount, ok := price.Parse(amountStr); ok {
+			return amount, price.NormalizeCurrency(jsonString(offer["priceCurrency"]))
+		}
+	}
+	return 0, ""
+}
+
+func ParseOpenGraph(pageURL *url.URL, body []byte) Metadata {
+	tags := metaTags(body)
+	meta := Metadata{
+		Title: first(tags, "og:title"),
+		Image: resolveURL(pageURL, first(tags, "og:image:secure_url", "og:image")),
+	}
+	if amount, ok := price.Parse(first(tags, "product:price:amount", "og:price:amount")); ok {
+		meta.Price = amount
+		meta.Currency = price.NormalizeCurrency(first(tags, "product:price:currency", "og:price:currency"))
+	}
+	return meta
+}
+
+// ParseMeta covers pages without OpenGraph: twitter cards, microdata and <title>.
+func ParseMeta(pageURL *url.URL, body []byte) Metadata {
+	tags := metaTags(body)
+	meta := Metadata{
+		Title: first(tags, "twitter:title", "title"),
+		Image: resolveURL(pageURL, first(tags, "twitter:image", "image")),
+	}
+	if meta.Title == "" {
+		if match := reTitleTag.FindSubmatch(body); match != nil {
+			meta.Title = strings.TrimSpace(html.UnescapeString(string(match[1])))
+		}
+	}
+	if amount, ok := price.Parse(first(tags, "price")); ok {
+		meta.Price = amount
+		meta.Currency = price.NormalizeCurrency(first(tags, "pricecurrency"))
+	}
+	return meta
+}
+
+// metaTags indexes <meta> content by property, name and itemprop attributes.
+func metaTags(body []byte) map[string]string {
+	tags := make(map[string]string)
+	for _, match := range reMetaTag.FindAllSubmatch(body, -1) {
+		attrs := make(map[string]string)
+		for _, attr := range reAttr.FindAllSubmatch(match[1], -1) {
+			value := string(attr[2]) + string(attr[3]) + string(attr[4])
+			attrs[strings.ToLower(string(attr[1]))] = html.UnescapeString(value)
+		}
+		content, ok := attrs["content"]
+		if !ok {
+			continue
+		}
+		for _, key := range []string{"property", "name", "itemprop"} {
+			if name := strings.ToLower(attrs[key]); name != "" {
+				if _, exists := tags[name]; !exists {
+					tags[name] = strings.TrimSpace(content)
+				}
+			}
+		}
+	}
+	return tags
+}
+
+func first(tags map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := tags[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" || base == nil {
+		return ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(u).String()
+}
@@ -0,0 +1,46 @@
+package linkmeta
+
+import (
+	"encoding/json"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Ozon renders product pages from widgets whose state is JSON in a data-state attribute,
+// OpenGraph tags there carry neither the price nor the full title.
+var reOzonWidget = regexp.MustCompile(`(?s)<div[^>]+id\s*=\s*["']state-(webProductHeading|webPrice|webGallery)-[^"']*["'][^>]*data-state\s*=\s*'([^']*)'`)
+
+func ParseOzon(pageURL *url.URL, body []byte) Metadata {
+	var meta Metadata
+	for _, match := range reOzonWidget.FindAllSubmatch(body, -1) {
+		var state struct {
+			Title      string `json:"title"`
+			Price      string `json:"price"`
+			CardPrice  string `json:"cardPrice"`
+			CoverImage string `json:"coverImage"`
+		}
+		if err := json.Unmarshal([]byte(html.UnescapeString(string(match[2]))), &state); err != nil {
+			continue
+		}
+		switch string(match[1]) {
+		case "webProductHeading":
+			meta.Title = strings.TrimSpace(state.Title)
+		case "webPrice":
+			// The card price needs the shop's own card, the plain one is what everybody pays.
+			if amount, ok := price.Parse(strings.TrimRightFunc(state.Price, isNotDigit)); ok {
+				meta.Price, meta.Currency = amount, "RUB"
+			}
+		case "webGallery":
+			meta.Image = resolveURL(pageURL, state.CoverImage)
+		}
+	}
+	return meta
+}
+
+func isNotDigit(r rune) bool {
+	return !unicode.IsDigit(r)
+}
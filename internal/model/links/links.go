@@ -0,0 +1,144 @@
+package links
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// trackingParams are dropped from every link, parameters starting with utm_ as well.
+var trackingParams = map[string]bool{
+	"ref":       true,
+	"ref_":      true,
+	"referrer":  true,
+	"fbclid":    true,
+	"gclid":     true,
+	"yclid":     true,
+	"ysclid":    true,
+	"_openstat": true,
+	"spm":       true,
+	"from":      true,
+	"utm":       true,
+	"mc_cid":    true,
+	"mc_eid":    true,
+}
+
+// rule rewrites links of one site, returning false when the link is not a product page it knows.
+type rule func(u *url.URL) (*url.URL, bool)
+
+var (
+	reOzon        = regexp.MustCompile(`^/product/(?:[^/]*-)?(\d+)/?$`)
+	reWildberries = regexp.MustCompile(`^/catalog/(\d+)/`)
+	reAmazon      = regexp.MustCompile(`/(?:dp|gp/product|gp/aw/d)/([A-Z0-9]{10})(?:[/?]|$)`)
+	reAliExpress  = regexp.MustCompile(`^/item/(\d+)\.html`)
+	reYandex      = regexp.MustCompile(`^/product(?:--[^/]*)?/(\d+)`)
+)
+
+// rules are keyed by the host without www. and its subdomains match too.
+var rules = map[string]rule{
+	"ozon.ru":          productRule(reOzon, "ozon.ru", "/product/%s/"),
+	"wildberries.ru":   productRule(reWildberries, "www.wildberries.ru", "/catalog/%s/detail.aspx"),
+	"wb.ru":            productRule(reWildberries, "www.wildberries.ru", "/catalog/%s/detail.aspx"),
+	"amazon.com":       amazonRule("www.amazon.com"),
+	"amazon.de":        amazonRule("www.amazon.de"),
+	"amazon.co.uk":     amazonRule("www.amazon.co.uk"),
+	"amzn.com":         amazonRule("www.amazon.com"),
+	"aliexpress.com":   productRule(reAliExpress, "aliexpress.com", "/item/%s.html"),
+	"aliexpress.ru":    productRule(reAliExpress, "aliexpress.ru", "/item/%s.html"),
+	"market.yandex.ru": productRule(reYandex, "market.yandex.ru", "/product/%s"),
+	"youtu.be":         youtubeShortRule,
+}
+
+// productRule keeps only the product ID found by re and builds the link from format.
+func productRule(re *regexp.Regexp, host, format string) rule {
+	return func(u *url.URL) (*url.URL, bool) {
+		match := re.FindStringSubmatch(u.Path)
+		if match == nil {
+			return nil, false
+		}
+		return &url.URL{Scheme: "https", Host: host, Path: strings.Replace(format, "%s", match[1], 1)}, true
+	}
+}
+
+func amazonRule(host string) rule {
+	return func(u *url.URL) (*url.URL, bool) {
+		match := reAmazon.FindStringSubmatch(u.Path)
+		if match == nil {
+			return nil, false
+		}
+		return &url.URL{Scheme: "https", Host: host, Path: "/dp/" + match[1]}, true
+	}
+}
+
+// youtubeShortRule resolves youtu.be links offline, the video ID is the whole path.
+func youtubeShortRule(u *url.URL) (*url.URL, bool) {
+	id := strings.Trim(u.Path, "/")
+	if id == "" || strings.Contains(id, "/") {
+		return nil, false
+	}
+	return &url.URL{Scheme: "https", Host: "www.youtube.com", Path: "/watch", RawQuery: "v=" + url.QueryEscape(id)}, true
+}
+
+// Canonical turns different spellings of the same link into one: the host is lower-cased,
+// tracking parameters and the fragment are dropped, the rest of the query is sorted and
+// product pages of known marketplaces are reduced to their product ID. Anything that is
+// not an absolute http(s) link is returned trimmed but otherwise unchanged.
+func Canonical(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return rawURL
+	}
+	u.Scheme = scheme
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+	if r := siteRule(u.Hostname()); r != nil {
+		if canonical, ok := r(u); ok {
+			return canonical.String()
+		}
+	}
+	u.Fragment, u.RawFragment = "", ""
+	u.User = nil
+	u.RawQuery = cleanQuery(u.Query())
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+	}
+	return u.String()
+}
+
+// Same compares links by their canonical form.
+func Same(a, b string) bool {
+	return a != "" && b != "" && Canonical(a) == Canonical(b)
+}
+
+func siteRule(host string) rule {
+	for host != "" {
+		if r, ok := rules[host]; ok {
+			return r
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			break
+		}
+		host = parent
+	}
+	return nil
+}
+
+// cleanQuery drops tracking parameters, Encode sorts the rest by key.
+func cleanQuery(query url.Values) string {
+	for key := range query {
+		lower := strings.ToLower(key)
+		if trackingParams[lower] || strings.HasPrefix(lower, "utm_") {
+			query.Del(key)
+		}
+	}
+	return query.Encode()
+}
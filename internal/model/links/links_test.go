@@ -0,0 +1,45 @@
+package links
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected string
+	}{
+		{"https://Example.COM/Shop/", "https://example.com/Shop"},
+		{"http://example.com:80/a?b=2&a=1#reviews", "http://example.com/a?a=1&b=2"},
+		{"https://example.com/a?utm_source=tg&utm_medium=social&fbclid=x&ref=main&color=red", "https://example.com/a?color=red"},
+		{"https://www.ozon.ru/product/lego-technic-42100-1599000/?asb=abc&sh=xyz", "https://ozon.ru/product/1599000/"},
+		{"https://m.ozon.ru/product/1599000", "https://ozon.ru/product/1599000/"},
+		{"https://global.wildberries.ru/catalog/12345678/detail.aspx?targetUrl=GP", "https://www.wildberries.ru/catalog/12345678/detail.aspx"},
+		{"https://wb.ru/catalog/12345678/", "https://www.wildberries.ru/catalog/12345678/detail.aspx"},
+		{"https://www.amazon.com/Some-Book-Title/dp/B08N5WRWNW/ref=sr_1_1?keywords=book", "https://www.amazon.com/dp/B08N5WRWNW"},
+		{"https://amzn.com/gp/product/B08N5WRWNW", "https://www.amazon.com/dp/B08N5WRWNW"},
+		{"https://m.aliexpress.com/item/1005001234567890.html?spm=a2g0o", "https://aliexpress.com/item/1005001234567890.html"},
+		{"https://market.yandex.ru/product--naushniki-sony/1779436?sku=1", "https://market.yandex.ru/product/1779436"},
+		{"https://youtu.be/dQw4w9WgXcQ?t=42", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://www.ozon.ru/category/igrushki/", "https://www.ozon.ru/category/igrushki"},
+		{"  example.com/page ", "example.com/page"},
+		{"ftp://Example.com/file", "ftp://Example.com/file"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.in, func(t *testing.T) {
+			require.Equal(t, c.expected, Canonical(c.in))
+		})
+	}
+}
+
+func TestSame(t *testing.T) {
+	t.Run("Should match links differing only in tracking", func(t *testing.T) {
+		require.True(t, Same("https://www.ozon.ru/product/1599000/?utm_source=a", "https://ozon.ru/product/lego-1599000/"))
+	})
+
+	t.Run("Should not match empty links", func(t *testing.T) {
+		require.False(t, Same("", ""))
+	})
+}
@@ -0,0 +1,216 @@
+package messages
+
+import (
+	"context"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/links"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+type draft struct {
+	category string
+	item     WishItem
+}
+
+var draftBtn = []types.TgRowButtons{
+	{
+		types.TgInlineButton{DisplayName: "✅ Сохранить", Value: "/draft_save"},
+		types.TgInlineButton{DisplayName: "✏️ Изменить название", Value: "/draft_name"},
+	},
+	{
+		types.TgInlineButton{DisplayName: "📁 Изменить категорию", Value: "/draft_cat"},
+		types.TgInlineButton{DisplayName: "Отмена", Value: "/cancel"},
+	},
+}
+
+const (
+	txtDraftFound    = "Вот что я нашёл по ссылке. Сохранить?"
+	txtDraftNotFound = "Не удалось получить данные со страницы. Сохранить как есть?"
+	txtDraftCheck    = "Проверьте хотелку. Сохранить?"
+	txtDraftNoName   = "Без названия"
+	txtDraftName     = "Введите новое название хотелки"
+	txtNoCategory    = "Без категории"
+)
+
+func isLink(text string) bool {
+	if !strings.HasPrefix(text, "http://") && !strings.HasPrefix(text, "https://") {
+		return false
+	}
+	u, err := url.Parse(text)
+	return err == nil && u.Host != ""
+}
+
+// fillFromLink completes empty fields of item with the page metadata.
+func fillFromLink(m *BotModel, item *WishItem) bool {
+	if m.LinkInspector == nil || item.URL == "" {
+		return false
+	}
+	found, err := m.LinkInspector.InspectLink(item.URL)
+	if err != nil {
+		return false
+	}
+	if item.Name == "" {
+		item.Name = found.Name
+	}
+	if item.ImageURL == "" {
+		item.ImageURL = found.ImageURL
+	}
+	if item.Price == 0 {
+		item.Price, item.Currency = found.Price, found.Currency
+	}
+	return true
+}
+
+// startLinkDraft fetches page metadata and asks the user to confirm the pre-filled item.
+// A name typed by the user wins over the page title.
+func startLinkDraft(ctx context.Context, m *BotModel, msg Message, name string) error {
+	item := WishItem{
+		Name:        name,
+		URL:         msg.Text,
+		PhotoFileID: m.lastUserItemPhoto[msg.UserID],
+	}
+	if msg.PhotoFileID != "" {
+		item.PhotoFileID = msg.PhotoFileID
+	}
+	header := txtDraftFound
+	if !fillFromLink(m, &item) {
+		header = txtDraftNotFound
+	}
+	m.drafts[msg.UserID] = &draft{category: m.lastUserCat[msg.UserID], item: item}
+	m.lastUserCat[msg.UserID] = ""
+	m.lastUserItemName[msg.UserID] = ""
+	m.lastUserItemPhoto[msg.UserID] = ""
+	return showDraft(ctx, m, msg.UserID, header)
+}
+
+// checkQuickAdd creates a draft in one step from "/add ..." or from any message with a link.
+func checkQuickAdd(ctx context.Context, m *BotModel, msg Message) (bool, error) {
+	if msg.IsCallback {
+		return false, nil
+	}
+	text, isCmd := strings.CutPrefix(msg.Text, "/add ")
+	if !isCmd && (strings.HasPrefix(msg.Text, "/") || !reLink.MatchString(msg.Text)) {
+		return false, nil
+	}
+	parsed, ok := ParseItemText(text)
+	if !ok {
+		return false, nil
+	}
+	parsed.Item.PhotoFileID = msg.PhotoFileID
+	if parsed.Item.Name == "" {
+		fillFromLink(m, &parsed.Item)
+	}
+	if parsed.Category == "" {
+		parsed.Category = "default"
+	}
+	m.drafts[msg.UserID] = &draft{category: parsed.Category, item: parsed.Item}
+	return true, showDraft(ctx, m, msg.UserID, txtDraftCheck)
+}
+
+func showDraft(ctx context.Context, m *BotModel, userId int64, header string) error {
+	d := m.drafts[userId]
+	if d.item.Name == "" {
+		d.item.Name = txtDraftNoName
+	}
+	d.item.URL = links.Canonical(d.item.URL)
+	if d.item.HasPhoto() {
+		// A broken image link shouldn't prevent the user from saving the item.
+		_ = m.MessageSender.SendPhoto(userId, d.item.Photo(), d.item.Name)
+	}
+	text := header + "\n\n" + formatDraft(d)
+	if warning := duplicatesText(ctx, m, userId, d.item); warning != "" {
+		text += "\n" + warning
+	}
+	return m.MessageSender.ShowButtons(userId, text, draftBtn)
+}
+
+func formatDraft(d *draft) string {
+	var b strings.Builder
+	b.WriteString("Название: " + d.item.Name + "\n")
+	if d.item.URL != "" {
+		b.WriteString("Ссылка: " + d.item.URL + "\n")
+	}
+	if d.item.Price > 0 {
+		b.WriteString("Цена: " + price.Format(d.item.Price, d.item.Currency) + "\n")
+	}
+	category := d.category
+	if category == "default" {
+		category = txtNoCategory
+	}
+	b.WriteString("Категория: " + category + "\n")
+	if d.item.Priority != PriorityNone {
+		b.WriteString("Приоритет: " + d.item.Priority.String() + "\n")
+	}
+	return b.String()
+}
+
+func checkDraft(ctx context.Context, m *BotModel, msg Message, lastCmd string) (bool, error) {
+	d, ok := m.drafts[msg.UserID]
+	if !ok {
+		return false, nil
+	}
+	if lastCmd == "/draft_name" && !msg.IsCallback {
+		if err := m.Limits.ValidateItemName(msg.Text); err != nil {
+			return true, rePrompt(m, msg.UserID, err, "/draft_name", txtDraftName)
+		}
+		d.item.Name = msg.Text
+		return true, showDraft(ctx, m, msg.UserID, txtDraftCheck)
+	}
+	if cat, ok := strings.CutPrefix(msg.Text, "/draft_cat "); ok && msg.IsCallback {
+		d.category = cat
+		return true, showDraft(ctx, m, msg.UserID, txtDraftCheck)
+	}
+	switch msg.Text {
+	case "/draft_save":
+		cachePhoto(m, &d.item)
+		// A category created for the item must not stay behind when the item is not saved.
+		err := m.inTx(ctx, func(tx *BotModel) error {
+			if err := tx.UserStorage.AddNewUser(ctx, msg.UserID); err != nil {
+				return err
+			}
+			if err := checkNewItem(ctx, tx, msg.UserID, d.item); err != nil {
+				return err
+			}
+			category, err := ensureCategory(ctx, tx, msg.UserID, d.category)
+			if err != nil {
+				return err
+			}
+			return tx.UserStorage.AddWishItemToCategory(ctx, msg.UserID, category, d.item)
+		})
+		if text := ValidationText(err); text != "" {
+			return true, showDraft(ctx, m, msg.UserID, "⚠️ "+text)
+		}
+		if err != nil {
+			return true, err
+		}
+		delete(m.drafts, msg.UserID)
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtAddDone, btnStart)
+	case "/draft_name":
+		m.lastUserCmd[msg.UserID] = "/draft_name"
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtDraftName, cancelBtn)
+	case "/draft_cat":
+		buttons := getCategoryButtons(m.UserStorage.GetCategories(ctx, msg.UserID), "/draft_cat ")
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtCatChoose, buttons)
+	}
+	return false, nil
+}
+
+// ensureCategory creates a category mentioned by a #tag the first time it is used.
+// A tag spelled in another case refers to the existing category, whose name is returned.
+func ensureCategory(ctx context.Context, m *BotModel, userId int64, category string) (string, error) {
+	if category == "default" {
+		return category, nil
+	}
+	existing := m.UserStorage.GetCategories(ctx, userId)
+	if i := slices.IndexFunc(existing, func(name string) bool { return strings.EqualFold(name, category) }); i != -1 {
+		return existing[i], nil
+	}
+	if err := checkNewCategory(ctx, m, userId, category); err != nil {
+		return category, err
+	}
+	err := m.UserStorage.AddUserCategory(ctx, userId, category)
+	return category, err
+}
@@ -0,0 +1,97 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/links"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	// minFuzzyName is the shortest name compared with typos allowed, shorter ones must match exactly.
+	minFuzzyName  = 6
+	maxDuplicates = 3
+
+	txtDuplicates = "⚠️ Похоже, это уже есть в ваших списках:"
+)
+
+// SimilarNames compares names ignoring case, punctuation and word order and allows
+// a typo in every five letters of longer names.
+func SimilarNames(a, b string) bool {
+	wordsA, wordsB := nameWords(a), nameWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return false
+	}
+	slices.Sort(wordsA)
+	slices.Sort(wordsB)
+	x, y := []rune(strings.Join(wordsA, " ")), []rune(strings.Join(wordsB, " "))
+	if string(x) == string(y) {
+		return true
+	}
+	n := max(len(x), len(y))
+	return n >= minFuzzyName && editDistance(x, y)*5 <= n
+}
+
+func nameWords(name string) []string {
+	return strings.FieldsFunc(NormalizeSearch(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// findDuplicates looks through all lists of the user for items with the same canonical link or a similar name.
+func findDuplicates(ctx context.Context, m *BotModel, userId int64, item WishItem) []FoundItem {
+	var result []FoundItem
+	for _, list := range m.UserStorage.GetLists(ctx, userId) {
+		for _, cat := range m.UserStorage.GetListWishList(ctx, list.ID) {
+			for _, other := range cat.Items {
+				if other.ID == item.ID && item.ID != 0 {
+					continue
+				}
+				sameName := item.Name != txtDraftNoName && SimilarNames(item.Name, other.Name)
+				if links.Same(item.URL, other.URL) || sameName {
+					result = append(result, FoundItem{WishItem: other, ListID: list.ID, Category: cat.Name})
+				}
+			}
+		}
+	}
+	return result
+}
+
+// duplicatesText is empty when there is nothing to warn about.
+func duplicatesText(ctx context.Context, m *BotModel, userId int64, item WishItem) string {
+	found := findDuplicates(ctx, m, userId, item)
+	if len(found) == 0 {
+		return ""
+	}
+	lines := []string{txtDuplicates}
+	for _, dup := range found[:min(len(found), maxDuplicates)] {
+		where := categoryTitle(dup.Category)
+		if list, ok := m.UserStorage.GetList(ctx, dup.ListID); ok {
+			where = list.Name + ", " + where
+		}
+		lines = append(lines, fmt.Sprintf("• %s (%s)", dup.Name, where))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,75 @@
+package messages_test
+
+import (
+	"context"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSimilarNames(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"LEGO Technic 42100", "lego technic 42100!", true},
+		{"Наушники Sony", "Sony наушники", true},
+		{"Ёлочные игрушки", "елочные игрушки", true},
+		{"Кофемолка ручная", "Кофемолка ручня", true},
+		{"Носки", "Сумки", false},
+		{"Наушники Sony", "Наушники JBL", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.a+" / "+c.b, func(t *testing.T) {
+			require.Equal(t, c.expected, messages.SimilarNames(c.a, c.b))
+		})
+	}
+}
+
+func TestBotModel_Duplicates(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	send := func(msg messages.Message) {
+		msg.ChatID, msg.UserID = ownerId, ownerId
+		require.NoError(t, model.OnMessage(ctx, msg))
+	}
+	err = storage.AddNewUser(ctx, ownerId)
+	require.NoError(t, err)
+	err = storage.ImportWishList(ctx, ownerId, messages.Categories{
+		{Name: "Игрушки", Items: []messages.WishItem{{Name: "Конструктор", URL: "https://www.ozon.ru/product/lego-technic-1599000/?utm_source=tg"}}},
+		{Name: "default", Items: []messages.WishItem{{Name: "Кофемолка ручная"}}},
+	})
+	require.NoError(t, err)
+
+	t.Run("Should store canonical links", func(t *testing.T) {
+		item := storage.GetWishListByCategory(ctx, ownerId).Items("Игрушки")[0]
+		require.Equal(t, "https://ozon.ru/product/1599000/", item.URL)
+	})
+
+	t.Run("Should warn about the same link in a draft", func(t *testing.T) {
+		send(messages.Message{Text: "/add LEGO https://m.ozon.ru/product/1599000/?from=share"})
+		text := sender.last().text
+		require.Contains(t, text, "Ссылка: https://ozon.ru/product/1599000/")
+		require.Contains(t, text, "⚠️ Похоже, это уже есть в ваших списках:\n• Конструктор (Мой вишлист, Игрушки)")
+	})
+
+	t.Run("Should warn about a similar name after adding", func(t *testing.T) {
+		send(messages.Message{Text: "/cancel"})
+		send(messages.Message{Text: "/add_item"})
+		send(messages.Message{Text: "/cat default", IsCallback: true})
+		send(messages.Message{Text: "Кофемолка ручня"})
+		send(messages.Message{Text: "-"})
+		require.Contains(t, sender.last().text, "• Кофемолка ручная (Мой вишлист, Без категории)")
+		require.Equal(t, 3, storage.GetWishListByCategory(ctx, ownerId).Count(), "The warning doesn't stop adding")
+	})
+
+	t.Run("Should not warn about new items", func(t *testing.T) {
+		send(messages.Message{Text: "/add Самокат https://example.com/scooter"})
+		require.NotContains(t, sender.last().text, "⚠️")
+	})
+}
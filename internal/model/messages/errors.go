@@ -0,0 +1,73 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Storage backends return these errors, wrapped or not, so callers can tell them apart with errors.Is.
+// The more specific not found errors match ErrNotFound as well.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrUserNotFound     = fmt.Errorf("user %w", ErrNotFound)
+	ErrListNotFound     = fmt.Errorf("list %w", ErrNotFound)
+	ErrCategoryNotFound = fmt.Errorf("category %w", ErrNotFound)
+	ErrItemNotFound     = fmt.Errorf("item %w", ErrNotFound)
+	ErrFollowerNotFound = fmt.Errorf("follower %w", ErrNotFound)
+	ErrDuplicate        = errors.New("already exists")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	// ErrLastList is returned for an attempt to delete the only list of a user.
+	ErrLastList = errors.New("last list")
+	// ErrConflict is returned for reverting a revision something newer has changed since.
+	ErrConflict = errors.New("changed since")
+	// ErrUndoUnavailable is returned for undoing a write whose revision is gone or too old.
+	ErrUndoUnavailable = errors.New("nothing to undo")
+)
+
+const (
+	txtUserNotFound     = "Сначала нажмите /start"
+	txtCategoryNotFound = "Категория не найдена"
+	txtItemNotFound     = "Хотелка не найдена"
+	txtNotFound         = "Ничего не найдено"
+	txtDuplicate        = "Такое уже есть"
+	txtQuotaExceeded    = "Больше сохранить нельзя"
+)
+
+// Is lets validation errors be checked against ErrDuplicate and ErrQuotaExceeded like storage ones.
+func (e *ValidationError) Is(target error) bool {
+	return (target == ErrDuplicate && e.Reason == ReasonDuplicate) || (target == ErrQuotaExceeded && e.Reason == ReasonQuota)
+}
+
+// ErrorText is what the user is told about a domain error, empty for errors the user can do nothing about.
+func ErrorText(err error) string {
+	if text := ValidationText(err); text != "" {
+		return capitalize(text)
+	}
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrUserNotFound):
+		return txtUserNotFound
+	case errors.Is(err, ErrListNotFound):
+		return txtListNotFound
+	case errors.Is(err, ErrCategoryNotFound):
+		return txtCategoryNotFound
+	case errors.Is(err, ErrItemNotFound):
+		return txtItemNotFound
+	case errors.Is(err, ErrFollowerNotFound):
+		return txtNotFollowing
+	case errors.Is(err, ErrNotFound):
+		return txtNotFound
+	case errors.Is(err, ErrDuplicate):
+		return txtDuplicate
+	case errors.Is(err, ErrQuotaExceeded):
+		return txtQuotaExceeded
+	case errors.Is(err, ErrLastList):
+		return txtListLast
+	case errors.Is(err, ErrConflict):
+		return txtConflict
+	case errors.Is(err, ErrUndoUnavailable):
+		return txtUndoUnavailable
+	}
+	return ""
+}
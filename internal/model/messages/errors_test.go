@@ -0,0 +1,39 @@
+package messages_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestErrorText(t *testing.T) {
+	t.Run("Should explain domain errors, wrapped or not", func(t *testing.T) {
+		for _, test := range []struct {
+			err      error
+			expected string
+		}{
+			{err: messages.ErrItemNotFound, expected: "Хотелка не найдена"},
+			{err: fmt.Errorf("move: %w", messages.ErrCategoryNotFound), expected: "Категория не найдена"},
+			{err: messages.ErrLastList, expected: "Нельзя удалить единственный список"},
+			{err: messages.ErrNotFound, expected: "Ничего не найдено"},
+			{err: fmt.Errorf("revert: %w", messages.ErrConflict), expected: "Это уже изменилось с тех пор, отменить нельзя"},
+			{err: &messages.ValidationError{Field: messages.FieldListName, Reason: messages.ReasonEmpty}, expected: "Название списка не может быть пустым"},
+		} {
+			require.Equal(t, test.expected, messages.ErrorText(test.err))
+		}
+	})
+
+	t.Run("Should leave other errors alone", func(t *testing.T) {
+		require.Empty(t, messages.ErrorText(nil))
+		require.Empty(t, messages.ErrorText(errors.New("connection reset")))
+	})
+
+	t.Run("Should match validation errors with storage ones", func(t *testing.T) {
+		quota := &messages.ValidationError{Field: messages.FieldItems, Reason: messages.ReasonQuota, Limit: 500}
+		require.ErrorIs(t, quota, messages.ErrQuotaExceeded)
+		require.NotErrorIs(t, quota, messages.ErrDuplicate)
+		require.ErrorIs(t, &messages.ValidationError{Field: messages.FieldCategory, Reason: messages.ReasonDuplicate}, messages.ErrDuplicate)
+	})
+}
@@ -0,0 +1,316 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EventKind string
+
+const (
+	EventBirthday EventKind = "birthday"
+	EventNewYear  EventKind = "new_year"
+	EventWedding  EventKind = "wedding"
+	EventOther    EventKind = "other"
+
+	defaultRemindDays = 7
+	maxRemindDays     = 60
+)
+
+var eventKindNames = map[EventKind]string{
+	EventBirthday: "День рождения",
+	EventNewYear:  "Новый год",
+	EventWedding:  "Свадьба",
+	EventOther:    "Событие",
+}
+
+type Event struct {
+	ID    int64
+	Kind  EventKind
+	Title string
+	Month time.Month
+	Day   int
+	// Year is set for one-off events, yearly ones such as birthdays leave it zero.
+	Year             int
+	RemindDaysBefore int
+}
+
+func (e Event) DisplayTitle() string {
+	if e.Title != "" {
+		return e.Title
+	}
+	return eventKindNames[e.Kind]
+}
+
+func (e Event) DateString() string {
+	if e.Year != 0 {
+		return fmt.Sprintf("%02d.%02d.%d", e.Day, e.Month, e.Year)
+	}
+	return fmt.Sprintf("%02d.%02d", e.Day, e.Month)
+}
+
+type ReminderPlanner interface {
+	PlanOwner(ctx context.Context, ownerId int64) error
+}
+
+var eventKindBtn = []types.TgRowButtons{
+	{
+		types.TgInlineButton{DisplayName: "🎂 " + eventKindNames[EventBirthday], Value: "/event_kind " + string(EventBirthday)},
+		types.TgInlineButton{DisplayName: "🎄 " + eventKindNames[EventNewYear], Value: "/event_kind " + string(EventNewYear)},
+	},
+	{
+		types.TgInlineButton{DisplayName: "💍 " + eventKindNames[EventWedding], Value: "/event_kind " + string(EventWedding)},
+		types.TgInlineButton{DisplayName: "📅 Другое", Value: "/event_kind " + string(EventOther)},
+	},
+	{types.TgInlineButton{DisplayName: "Отмена", Value: "/cancel"}},
+}
+
+const (
+	txtEventsEmpty   = "Праздников пока нет. Добавьте день рождения, и друзья, подписанные на ваш список, получат напоминание заранее."
+	txtEventsList    = "Ваши праздники (часовой пояс %s):"
+	txtEventKind     = "Какой праздник добавить?"
+	txtEventDate     = "Введите дату в формате ДД.ММ (каждый год) или ДД.ММ.ГГГГ (один раз). Через пробел можно указать, за сколько дней напомнить друзьям (по умолчанию %d), и название, например: 25.12 14 Юбилей"
+	txtEventBadDate  = "Не получилось разобрать дату. Пример: 25.12 или 25.12.2025 14"
+	txtEventAdded    = "Праздник сохранён: %s, %s. Друзья получат напоминание за %d дн."
+	txtEventDeleted  = "Праздник удалён"
+	txtTimeZone      = "Текущий часовой пояс: %s. Чтобы изменить, отправьте /timezone Europe/Moscow или /timezone +5"
+	txtTimeZoneSet   = "Часовой пояс установлен: %s"
+	txtTimeZoneBad   = "Не знаю такой часовой пояс. Примеры: Europe/Moscow, Asia/Novosibirsk, +3, UTC-05:00"
+	txtFollowed      = "Вы подписались на вишлист (%s). Напомню заранее о праздниках и пришлю сводку, когда в списке появятся новые хотелки. Управлять подписками: /following\n\n%s"
+	txtFollowUnknown = "Ссылка устарела или неверна"
+	txtFollowSelf    = "Это ссылка на ваш собственный вишлист"
+	txtSomeone       = "друга"
+)
+
+func checkEvents(ctx context.Context, m *BotModel, msg Message, lastCmd string) (bool, error) {
+	if lastCmd == "/event_date" && !msg.IsCallback {
+		return true, saveEventDate(ctx, m, msg)
+	}
+	switch {
+	case msg.Text == "/events":
+		return true, showEvents(ctx, m, msg.UserID)
+	case msg.Text == "/add_event":
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtEventKind, eventKindBtn)
+	case strings.HasPrefix(msg.Text, "/event_kind "):
+		kind := EventKind(strings.TrimPrefix(msg.Text, "/event_kind "))
+		if _, ok := eventKindNames[kind]; !ok {
+			return false, nil
+		}
+		if kind == EventNewYear {
+			return true, saveEvent(ctx, m, msg.UserID, Event{Kind: kind, Month: time.January, Day: 1, RemindDaysBefore: defaultRemindDays})
+		}
+		m.eventDrafts[msg.UserID] = Event{Kind: kind}
+		m.lastUserCmd[msg.UserID] = "/event_date"
+		return true, m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtEventDate, defaultRemindDays), cancelBtn)
+	case strings.HasPrefix(msg.Text, "/event_del "):
+		id, err := strconv.ParseInt(strings.TrimPrefix(msg.Text, "/event_del "), 10, 64)
+		if err != nil {
+			return false, nil
+		}
+		if err := m.UserStorage.DeleteEvent(ctx, msg.UserID, id); err != nil {
+			return true, err
+		}
+		if err := m.MessageSender.SendMessage(msg.UserID, txtEventDeleted); err != nil {
+			return true, err
+		}
+		return true, showEvents(ctx, m, msg.UserID)
+	case msg.Text == "/timezone":
+		return true, m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtTimeZone, userZone(ctx, m, msg.UserID)), btnStart)
+	case strings.HasPrefix(msg.Text, "/timezone "):
+		zone, ok := clock.ParseZone(strings.TrimPrefix(msg.Text, "/timezone "))
+		if !ok {
+			return true, m.MessageSender.SendMessage(msg.UserID, txtTimeZoneBad)
+		}
+		if err := registerUser(ctx, m, msg); err != nil {
+			return true, err
+		}
+		if err := m.UserStorage.SetTimeZone(ctx, msg.UserID, zone); err != nil {
+			return true, err
+		}
+		if err := planReminders(ctx, m, msg.UserID); err != nil {
+			return true, err
+		}
+		return true, m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtTimeZoneSet, zone), btnStart)
+	}
+	return false, nil
+}
+
+func showEvents(ctx context.Context, m *BotModel, userId int64) error {
+	events := m.UserStorage.GetEvents(ctx, userId)
+	buttons := []types.TgRowButtons{{types.TgInlineButton{DisplayName: "➕ Добавить праздник", Value: "/add_event"}}}
+	if len(events) == 0 {
+		return m.MessageSender.ShowButtons(userId, txtEventsEmpty, append(buttons, btnStart...))
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf(txtEventsList, userZone(ctx, m, userId)))
+	for _, e := range events {
+		b.WriteString(fmt.Sprintf("\n• %s — %s, напомнить за %d дн.", e.DisplayTitle(), e.DateString(), e.RemindDaysBefore))
+		buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{
+			DisplayName: "❌ " + e.DisplayTitle() + " " + e.DateString(),
+			Value:       fmt.Sprintf("/event_del %d", e.ID),
+		}})
+	}
+	return m.MessageSender.ShowButtons(userId, b.String(), append(buttons, btnStart...))
+}
+
+func saveEventDate(ctx context.Context, m *BotModel, msg Message) error {
+	event, ok := m.eventDrafts[msg.UserID]
+	if !ok {
+		return m.MessageSender.ShowButtons(msg.UserID, txtChooseCmd, btnStart)
+	}
+	parsed, ok := ParseEventDate(msg.Text)
+	if !ok {
+		m.lastUserCmd[msg.UserID] = "/event_date"
+		return m.MessageSender.ShowButtons(msg.UserID, txtEventBadDate, cancelBtn)
+	}
+	delete(m.eventDrafts, msg.UserID)
+	parsed.Kind = event.Kind
+	return saveEvent(ctx, m, msg.UserID, parsed)
+}
+
+func saveEvent(ctx context.Context, m *BotModel, userId int64, event Event) error {
+	if err := m.UserStorage.AddNewUser(ctx, userId); err != nil {
+		return err
+	}
+	if err := m.UserStorage.AddEvent(ctx, userId, event); err != nil {
+		return err
+	}
+	if err := planReminders(ctx, m, userId); err != nil {
+		return err
+	}
+	text := fmt.Sprintf(txtEventAdded, event.DisplayTitle(), event.DateString(), event.RemindDaysBefore)
+	return m.MessageSender.ShowButtons(userId, text, btnStart)
+}
+
+// ParseEventDate reads "ДД.ММ[.ГГГГ] [дней] [название]".
+func ParseEventDate(text string) (Event, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return Event{}, false
+	}
+	parts := strings.Split(fields[0], ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Event{}, false
+	}
+	day, errDay := strconv.Atoi(parts[0])
+	month, errMonth := strconv.Atoi(parts[1])
+	if errDay != nil || errMonth != nil || month < 1 || month > 12 {
+		return Event{}, false
+	}
+	event := Event{Month: time.Month(month), Day: day, RemindDaysBefore: defaultRemindDays}
+	checkYear := 2024 // a leap year, so 29.02 is a valid yearly date
+	if len(parts) == 3 {
+		year, err := strconv.Atoi(parts[2])
+		if err != nil || year < 1900 || year > 3000 {
+			return Event{}, false
+		}
+		event.Year, checkYear = year, year
+	}
+	if day < 1 || time.Date(checkYear, event.Month, day, 0, 0, 0, 0, time.UTC).Day() != day {
+		return Event{}, false
+	}
+	rest := fields[1:]
+	if len(rest) > 0 {
+		if days, err := strconv.Atoi(rest[0]); err == nil {
+			if days < 0 || days > maxRemindDays {
+				return Event{}, false
+			}
+			event.RemindDaysBefore = days
+			rest = rest[1:]
+		}
+	}
+	event.Title = strings.Join(rest, " ")
+	return event, true
+}
+
+// checkFollow handles the t.me/<bot>?start=w_<token> deep link that friends get from /share.
+func checkFollow(ctx context.Context, m *BotModel, msg Message) (bool, error) {
+	token, ok := strings.CutPrefix(msg.Text, "/start w_")
+	if !ok {
+		return false, nil
+	}
+	if err := registerUser(ctx, m, msg); err != nil {
+		return true, err
+	}
+	sharedList, ok := m.UserStorage.GetListByShareToken(ctx, token)
+	ownerId := sharedList.OwnerID
+	if !ok {
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtFollowUnknown, btnStart)
+	}
+	if ownerId == msg.UserID {
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtFollowSelf, btnStart)
+	}
+	if err := m.UserStorage.AddListFollower(ctx, sharedList.ID, msg.UserID); err != nil && !errors.Is(err, ErrDuplicate) {
+		return true, err
+	}
+	if err := planReminders(ctx, m, ownerId); err != nil {
+		return true, err
+	}
+	list := getListText(ctx, m, sharedList, AudienceFollower)
+	return true, m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtFollowed, OwnerName(ctx, m.UserStorage, ownerId), list), btnStart)
+}
+
+func registerUser(ctx context.Context, m *BotModel, msg Message) error {
+	if err := m.UserStorage.AddNewUser(ctx, msg.UserID); err != nil {
+		return err
+	}
+	name := msg.FirstName
+	if name == "" {
+		name = msg.UserName
+	}
+	if name == "" {
+		return nil
+	}
+	err := m.UserStorage.SetUserName(ctx, msg.UserID, name)
+	return err
+}
+
+func planReminders(ctx context.Context, m *BotModel, ownerId int64) error {
+	if m.Reminders == nil {
+		return nil
+	}
+	return m.Reminders.PlanOwner(ctx, ownerId)
+}
+
+func userZone(ctx context.Context, m *BotModel, userId int64) string {
+	if zone := m.UserStorage.GetTimeZone(ctx, userId); zone != "" {
+		return zone
+	}
+	return clock.DefaultZone
+}
+
+type NameReader interface {
+	GetUserName(ctx context.Context, userId int64) string
+}
+
+func OwnerName(ctx context.Context, storage NameReader, userId int64) string {
+	if name := storage.GetUserName(ctx, userId); name != "" {
+		return name
+	}
+	return txtSomeone
+}
+
+func botLink(m *BotModel, token string) string {
+	return "https://t.me/" + m.BotUserName + "?start=w_" + token
+}
+
+// ShareLink is the link to a list reminders and notifications point its followers to.
+func (m *BotModel) ShareLink(ctx context.Context, listId int64) (string, error) {
+	token, err := m.UserStorage.GetListShareToken(ctx, listId)
+	if err != nil || token == "" {
+		return "", err
+	}
+	if m.BotUserName != "" {
+		return botLink(m, token), nil
+	}
+	if m.ShareBaseURL != "" {
+		return strings.TrimSuffix(m.ShareBaseURL, "/") + "/w/" + token, nil
+	}
+	return "", nil
+}
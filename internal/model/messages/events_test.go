@@ -0,0 +1,37 @@
+package messages
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseEventDate(t *testing.T) {
+	t.Run("Should parse yearly date with defaults", func(t *testing.T) {
+		event, ok := ParseEventDate("25.12")
+		require.True(t, ok)
+		require.Equal(t, Event{Month: time.December, Day: 25, RemindDaysBefore: defaultRemindDays}, event)
+	})
+
+	t.Run("Should parse one-off date, days and title", func(t *testing.T) {
+		event, ok := ParseEventDate("01.06.2025 14 Свадьба Маши")
+		require.True(t, ok)
+		require.Equal(t, Event{Month: time.June, Day: 1, Year: 2025, RemindDaysBefore: 14, Title: "Свадьба Маши"}, event)
+	})
+
+	t.Run("Should accept 29.02 only for yearly or leap years", func(t *testing.T) {
+		_, ok := ParseEventDate("29.02")
+		require.True(t, ok)
+		_, ok = ParseEventDate("29.02.2028")
+		require.True(t, ok)
+		_, ok = ParseEventDate("29.02.2025")
+		require.False(t, ok)
+	})
+
+	t.Run("Should reject invalid dates", func(t *testing.T) {
+		for _, in := range []string{"", "завтра", "32.01", "00.05", "10.13", "31.04", "10.05.99", "10.05 100"} {
+			_, ok := ParseEventDate(in)
+			require.Falsef(t, ok, "Shouldn't parse '%s'", in)
+		}
+	})
+}
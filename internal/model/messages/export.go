@@ -0,0 +1,66 @@
+package messages
+
+import (
+	"context"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"slices"
+	"strings"
+)
+
+type ExportFile struct {
+	Name string
+	Data []byte
+}
+
+type Exporter interface {
+	Formats() []string
+	Export(format string, wishList Categories) (ExportFile, error)
+}
+
+var formatNames = map[string]string{
+	"json": "JSON",
+	"csv":  "CSV (Excel)",
+	"md":   "Markdown",
+	"html": "HTML",
+}
+
+const (
+	txtExportChoose   = "В каком формате выгрузить вишлист?"
+	txtExportDisabled = "Экспорт сейчас недоступен"
+	txtExportEmpty    = "Пока нечего выгружать — список пуст"
+	txtExportCaption  = "Ваш вишлист. Файл JSON можно загрузить обратно через /import"
+)
+
+func checkExport(ctx context.Context, m *BotModel, msg Message) (bool, error) {
+	if msg.Text != "/export" && !strings.HasPrefix(msg.Text, "/export ") {
+		return false, nil
+	}
+	if m.Exporter == nil {
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtExportDisabled, btnStart)
+	}
+	format, ok := strings.CutPrefix(msg.Text, "/export ")
+	if !ok || !slices.Contains(m.Exporter.Formats(), format) {
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtExportChoose, getFormatButtons(m.Exporter.Formats()))
+	}
+	wishList := m.UserStorage.GetWishListByCategory(ctx, msg.UserID)
+	if wishList.Count() == 0 {
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtExportEmpty, btnStart)
+	}
+	file, err := m.Exporter.Export(format, wishList)
+	if err != nil {
+		return true, err
+	}
+	return true, m.MessageSender.SendDocument(msg.UserID, file.Name, file.Data, txtExportCaption)
+}
+
+func getFormatButtons(formats []string) []types.TgRowButtons {
+	row := types.TgRowButtons{}
+	for _, format := range formats {
+		name, ok := formatNames[format]
+		if !ok {
+			name = strings.ToUpper(format)
+		}
+		row = append(row, types.TgInlineButton{DisplayName: name, Value: "/export " + format})
+	}
+	return append([]types.TgRowButtons{row}, cancelBtn...)
+}
@@ -0,0 +1,27 @@
+package messages_test
+
+import (
+	"context"
+	"github.com/roman-clancy/ho4uha-bot/internal/export"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBotModel_Export(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	model.Exporter = export.New()
+	require.NoError(t, storage.AddNewUser(ctx, ownerId))
+	require.NoError(t, storage.AddWishItem(ctx, ownerId, messages.WishItem{Name: "Дюна"}))
+
+	t.Run("Should offer the formats again for an unknown one", func(t *testing.T) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/export xyz", ChatID: ownerId, UserID: ownerId}))
+		require.Equal(t, "В каком формате выгрузить вишлист?", sender.last().text)
+		require.Equal(t, "/export json", sender.last().buttons[0][0].Value)
+	})
+}
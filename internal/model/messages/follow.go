@@ -0,0 +1,95 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"strconv"
+	"strings"
+)
+
+type ChangeKind string
+
+const (
+	ChangeItemAdded   ChangeKind = "item_added"
+	ChangeItemRemoved ChangeKind = "item_removed"
+)
+
+// Change is an entry of the stream storage emits for every wish added to or removed from a list.
+type Change struct {
+	ID       int64
+	OwnerID  int64
+	ListID   int64
+	Kind     ChangeKind
+	ItemID   int64
+	ItemName string
+	// Visibility is the effective visibility of the item when the change happened.
+	Visibility Visibility
+}
+
+const (
+	txtFollowingEmpty = "Вы ни на кого не подписаны. Попросите друга поделиться ссылкой на вишлист."
+	txtFollowingList  = "Ваши подписки. Когда друг меняет список, я присылаю короткую сводку; 🔕 отключает сводки, напоминания о праздниках остаются."
+	txtUnfollowed     = "Вы отписались от вишлиста (%s)"
+	txtMuted          = "Сводки об изменениях списка (%s) отключены"
+	txtUnmuted        = "Сводки об изменениях списка (%s) включены"
+	txtNotFollowing   = "Вы не подписаны на этот список"
+)
+
+// checkFollowing lets a follower list, mute and leave the lists they follow.
+func checkFollowing(ctx context.Context, m *BotModel, msg Message) (bool, error) {
+	if msg.Text == "/following" {
+		return true, showFollowing(ctx, m, msg.UserID)
+	}
+	cmd, arg, ok := strings.Cut(msg.Text, " ")
+	if !ok || (cmd != "/unfollow" && cmd != "/mute" && cmd != "/unmute") {
+		return false, nil
+	}
+	ownerId, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	var text string
+	switch cmd {
+	case "/unfollow":
+		err = m.UserStorage.RemoveFollower(ctx, ownerId, msg.UserID)
+		text = txtUnfollowed
+	case "/mute":
+		err = m.UserStorage.SetFollowMuted(ctx, ownerId, msg.UserID, true)
+		text = txtMuted
+	case "/unmute":
+		err = m.UserStorage.SetFollowMuted(ctx, ownerId, msg.UserID, false)
+		text = txtUnmuted
+	}
+	if errors.Is(err, ErrNotFound) {
+		return true, m.MessageSender.SendMessage(msg.UserID, txtNotFollowing)
+	}
+	if err != nil {
+		return true, err
+	}
+	if err := m.MessageSender.SendMessage(msg.UserID, fmt.Sprintf(text, OwnerName(ctx, m.UserStorage, ownerId))); err != nil {
+		return true, err
+	}
+	return true, showFollowing(ctx, m, msg.UserID)
+}
+
+func showFollowing(ctx context.Context, m *BotModel, userId int64) error {
+	owners := m.UserStorage.GetFollowing(ctx, userId)
+	if len(owners) == 0 {
+		return m.MessageSender.ShowButtons(userId, txtFollowingEmpty, btnStart)
+	}
+	buttons := make([]types.TgRowButtons, 0, len(owners)+len(btnStart))
+	for _, ownerId := range owners {
+		name := OwnerName(ctx, m.UserStorage, ownerId)
+		mute := types.TgInlineButton{DisplayName: "🔕 " + name, Value: fmt.Sprintf("/mute %d", ownerId)}
+		if m.UserStorage.IsFollowMuted(ctx, ownerId, userId) {
+			mute = types.TgInlineButton{DisplayName: "🔔 " + name, Value: fmt.Sprintf("/unmute %d", ownerId)}
+		}
+		buttons = append(buttons, types.TgRowButtons{
+			mute,
+			types.TgInlineButton{DisplayName: "❌ Отписаться", Value: fmt.Sprintf("/unfollow %d", ownerId)},
+		})
+	}
+	return m.MessageSender.ShowButtons(userId, txtFollowingList, append(buttons, btnStart...))
+}
@@ -0,0 +1,219 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"strconv"
+	"strings"
+)
+
+const (
+	txtGroupHelp = "Я веду вишлисты прямо в чате.\n" +
+		"/add <хотелка> — добавить в общий список чата, можно со ссылкой, ценой и #категорией\n" +
+		"/show_item — общий список чата\n" +
+		"Ответьте командой /show_item на сообщение участника, чтобы увидеть его вишлист.\n" +
+		"Кнопка 🎁 бронирует подарок, 🤝 — собирает на него вместе с другими. Бронь и взносы видны только участникам: подробности придут в личные сообщения."
+	txtGroupAdded      = "Добавлено в список чата: %s"
+	txtGroupAddUsage   = "Напишите, что добавить: /add Настольная игра 3000 ₽"
+	txtGroupNoList     = "У %s пока нет вишлиста. Его можно завести в личных сообщениях со мной."
+	txtGroupListTitle  = "Вишлист: %s"
+	txtGroupChat       = "этого чата"
+	txtReserved        = "Вы забронировали «%s» (%s). Никто, кроме вас, этого не видит. Нажмите 🎁 ещё раз, чтобы снять бронь."
+	txtUnreserved      = "Бронь «%s» снята"
+	txtReservedByOther = "«%s» уже кто-то забронировал"
+	txtReserveOwn      = "Это ваша хотелка, её нельзя забронировать"
+	txtReserveGone     = "Этой хотелки уже нет в списке"
+	txtReservePrivate  = "Чтобы бронировать подарки, сначала напишите мне в личные сообщения"
+)
+
+func (msg Message) IsGroup() bool {
+	return msg.ChatID != 0 && msg.ChatID != msg.UserID
+}
+
+// onGroupMessage serves group chats. Only stateless commands are supported there and every
+// reply goes to the chat, except reservations, which are confirmed privately to keep them secret.
+func onGroupMessage(ctx context.Context, m *BotModel, msg Message) error {
+	cmd, arg, _ := strings.Cut(strings.TrimSpace(msg.Text), " ")
+	cmd, ok := groupCommand(m, cmd)
+	if !ok {
+		return nil
+	}
+	switch cmd {
+	case "/start", "/help":
+		return m.MessageSender.SendMessage(msg.ChatID, txtGroupHelp)
+	case "/add":
+		return addGroupItem(ctx, m, msg, arg)
+	case "/show_item":
+		if msg.ReplyToUserID != 0 && msg.ReplyToUserID != msg.ChatID {
+			return showGroupList(ctx, m, msg.ChatID, msg.ReplyToUserID)
+		}
+		return showGroupList(ctx, m, msg.ChatID, msg.ChatID)
+	case "/reserve":
+		return reserveItem(ctx, m, msg, arg)
+	case "/chip":
+		ids, ok := parseIds(arg)
+		if !ok || len(ids) != 2 {
+			return nil
+		}
+		if err := registerUser(ctx, m, msg); err != nil {
+			return err
+		}
+		if err := showCollection(ctx, m, msg.UserID, ids[0], ids[1]); err != nil {
+			return m.MessageSender.SendMessage(msg.ChatID, txtReservePrivate)
+		}
+		return nil
+	}
+	return nil
+}
+
+// groupCommand strips the "@bot" suffix Telegram adds in groups and ignores commands for other bots.
+func groupCommand(m *BotModel, cmd string) (string, bool) {
+	if !strings.HasPrefix(cmd, "/") {
+		return "", false
+	}
+	cmd, bot, addressed := strings.Cut(cmd, "@")
+	if addressed && m.BotUserName != "" && !strings.EqualFold(bot, m.BotUserName) {
+		return "", false
+	}
+	return cmd, true
+}
+
+func addGroupItem(ctx context.Context, m *BotModel, msg Message, text string) error {
+	parsed, ok := ParseItemText(text)
+	if !ok {
+		return m.MessageSender.SendMessage(msg.ChatID, txtGroupAddUsage)
+	}
+	if parsed.Item.Name == "" {
+		fillFromLink(m, &parsed.Item)
+	}
+	if parsed.Item.Name == "" {
+		parsed.Item.Name = parsed.Item.URL
+	}
+	if err := m.UserStorage.AddNewUser(ctx, msg.ChatID); err != nil {
+		return err
+	}
+	if msg.ChatTitle != "" {
+		if err := m.UserStorage.SetUserName(ctx, msg.ChatID, msg.ChatTitle); err != nil {
+			return err
+		}
+	}
+	if parsed.Category == "" {
+		parsed.Category = "default"
+	}
+	err := m.inTx(ctx, func(tx *BotModel) error {
+		if err := checkNewItem(ctx, tx, msg.ChatID, parsed.Item); err != nil {
+			return err
+		}
+		category, err := ensureCategory(ctx, tx, msg.ChatID, parsed.Category)
+		if err != nil {
+			return err
+		}
+		return tx.UserStorage.AddWishItemToCategory(ctx, msg.ChatID, category, parsed.Item)
+	})
+	if text := ValidationText(err); text != "" {
+		return m.MessageSender.SendMessage(msg.ChatID, "⚠️ "+text)
+	}
+	if err != nil {
+		return err
+	}
+	return m.MessageSender.SendMessage(msg.ChatID, fmt.Sprintf(txtGroupAdded, parsed.Item.Name))
+}
+
+// showGroupList posts the list of ownerId to the chat. The text never mentions reservations,
+// because the owner is usually a member of the same chat, and a member's list is shown
+// to the chat as to the public. The chat's own list belongs to all of its members.
+func showGroupList(ctx context.Context, m *BotModel, chatId int64, ownerId int64) error {
+	audience := AudienceOwner
+	name := txtGroupChat
+	var lists []VisibleList
+	if ownerId == chatId {
+		// The chat has a single list of its own.
+		active, _ := m.UserStorage.GetActiveList(ctx, ownerId)
+		if items := ReadWishList(ctx, m.UserStorage, active.ID, audience); items.Count() > 0 {
+			lists = append(lists, VisibleList{WishList: active, Items: items})
+		}
+	} else {
+		audience = AudiencePublic
+		name = OwnerName(ctx, m.UserStorage, ownerId)
+		lists = ReadWishLists(ctx, m.UserStorage, ownerId, audience)
+	}
+	if len(lists) == 0 {
+		return m.MessageSender.SendMessage(chatId, fmt.Sprintf(txtGroupNoList, name))
+	}
+	list, err := getItemList(ctx, m, ownerId, audience)
+	if err != nil {
+		return err
+	}
+	buttons := make([]types.TgRowButtons, 0)
+	for _, visible := range lists {
+		for _, cat := range visible.Items {
+			for _, item := range cat.Items {
+				if !item.Active() {
+					continue
+				}
+				row := types.TgRowButtons{types.TgInlineButton{
+					DisplayName: "🎁 " + item.Name,
+					Value:       fmt.Sprintf("/reserve %d %d", ownerId, item.ID),
+				}}
+				if item.Price > 0 {
+					row = append(row, types.TgInlineButton{DisplayName: "🤝 Скинуться", Value: fmt.Sprintf("/chip %d %d", ownerId, item.ID)})
+				}
+				buttons = append(buttons, row)
+			}
+		}
+	}
+	return m.MessageSender.ShowButtons(chatId, fmt.Sprintf(txtGroupListTitle, name)+"\n"+list, buttons)
+}
+
+// reserveItem toggles the reservation of the member who pressed the button.
+func reserveItem(ctx context.Context, m *BotModel, msg Message, arg string) error {
+	ownerArg, itemArg, _ := strings.Cut(arg, " ")
+	ownerId, err := strconv.ParseInt(ownerArg, 10, 64)
+	if err != nil {
+		return nil
+	}
+	itemId, err := strconv.ParseInt(itemArg, 10, 64)
+	if err != nil {
+		return nil
+	}
+	if err := registerUser(ctx, m, msg); err != nil {
+		return err
+	}
+	reply := func(text string) error {
+		if err := m.MessageSender.SendMessage(msg.UserID, text); err != nil {
+			// Telegram refuses to write first to users who never opened the bot.
+			return m.MessageSender.SendMessage(msg.ChatID, txtReservePrivate)
+		}
+		return nil
+	}
+	if ownerId == msg.UserID {
+		return reply(txtReserveOwn)
+	}
+	lists := ReadWishListsFor(ctx, m.UserStorage, ownerId, msg.UserID)
+	if ownerId == msg.ChatID {
+		lists = ReadWishLists(ctx, m.UserStorage, ownerId, AudienceOwner)
+	}
+	item, ok := findItem(lists, itemId)
+	if !ok || !item.Active() {
+		return reply(txtReserveGone)
+	}
+	if len(m.UserStorage.GetPledges(ctx, ownerId, itemId)) > 0 {
+		return reply(fmt.Sprintf(txtPledgeCollecting, item.Name))
+	}
+	var text string
+	switch item.ReservedBy {
+	case 0:
+		item.ReservedBy = msg.UserID
+		text = fmt.Sprintf(txtReserved, item.Name, OwnerName(ctx, m.UserStorage, ownerId))
+	case msg.UserID:
+		item.ReservedBy = 0
+		text = fmt.Sprintf(txtUnreserved, item.Name)
+	default:
+		return reply(fmt.Sprintf(txtReservedByOther, item.Name))
+	}
+	if err := m.UserStorage.UpdateWishItem(ctx, ownerId, item); err != nil {
+		return err
+	}
+	return reply(text)
+}
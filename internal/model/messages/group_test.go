@@ -0,0 +1,137 @@
+package messages_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const (
+	chatId  = int64(-100)
+	ownerId = int64(1)
+	guestId = int64(2)
+	thirdId = int64(3)
+)
+
+type sent struct {
+	chatId  int64
+	text    string
+	buttons []types.TgRowButtons
+}
+
+type fakeSender struct {
+	sent     []sent
+	photos   []types.TgPhoto
+	photoErr error
+	// fail makes messages to the user fail, as if the bot was blocked.
+	fail map[int64]error
+}
+
+func (f *fakeSender) SendMessage(userId int64, text string) error {
+	if err := f.fail[userId]; err != nil {
+		return err
+	}
+	f.sent = append(f.sent, sent{chatId: userId, text: text})
+	return nil
+}
+
+func (f *fakeSender) ShowButtons(userId int64, text string, buttons []types.TgRowButtons) error {
+	if err := f.fail[userId]; err != nil {
+		return err
+	}
+	f.sent = append(f.sent, sent{chatId: userId, text: text, buttons: buttons})
+	return nil
+}
+
+func (f *fakeSender) SendPhoto(_ int64, photo types.TgPhoto, _ string) error {
+	if f.photoErr != nil {
+		return f.photoErr
+	}
+	f.photos = append(f.photos, photo)
+	return nil
+}
+
+func (f *fakeSender) SendDocument(int64, string, []byte, string) error {
+	return nil
+}
+
+func (f *fakeSender) last() sent {
+	return f.sent[len(f.sent)-1]
+}
+
+func TestBotModel_Group(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	model.BotUserName = "ho4uha_bot"
+	err = storage.AddNewUser(ctx, ownerId)
+	require.NoError(t, err)
+	err = storage.SetUserName(ctx, ownerId, "Аня")
+	require.NoError(t, err)
+	err = storage.AddWishItem(ctx, ownerId, messages.WishItem{Name: "Книга"})
+	require.NoError(t, err)
+	reserve := fmt.Sprintf("/reserve %d %d", ownerId, storage.GetWishListByCategory(ctx, ownerId).Items("default")[0].ID)
+	inGroup := func(userId int64, text string) messages.Message {
+		return messages.Message{Text: text, ChatID: chatId, ChatTitle: "Семья", UserID: userId, FirstName: "Гость"}
+	}
+
+	t.Run("Should ignore commands for other bots", func(t *testing.T) {
+		require.NoError(t, model.OnMessage(ctx, inGroup(guestId, "/start@other_bot")))
+		require.Empty(t, sender.sent)
+	})
+
+	t.Run("Should add items to the shared chat list", func(t *testing.T) {
+		require.NoError(t, model.OnMessage(ctx, inGroup(guestId, "/add@ho4uha_bot Настольная игра 3000 ₽")))
+		require.Equal(t, sent{chatId: chatId, text: "Добавлено в список чата: Настольная игра"}, sender.last())
+		require.Len(t, storage.GetWishListByCategory(ctx, chatId).Items("default"), 1)
+		require.Equal(t, "Семья", storage.GetUserName(ctx, chatId))
+	})
+
+	t.Run("Should show a member's list to the chat on reply", func(t *testing.T) {
+		msg := inGroup(guestId, "/show_item")
+		msg.ReplyToUserID = ownerId
+		require.NoError(t, model.OnMessage(ctx, msg))
+		last := sender.last()
+		require.Equal(t, chatId, last.chatId)
+		require.Contains(t, last.text, "Вишлист: Аня")
+		require.Equal(t, reserve, last.buttons[0][0].Value)
+	})
+
+	t.Run("Should confirm reservation privately", func(t *testing.T) {
+		sender.sent = nil
+		msg := inGroup(guestId, reserve)
+		msg.IsCallback = true
+		require.NoError(t, model.OnMessage(ctx, msg))
+		require.Len(t, sender.sent, 1)
+		require.Equal(t, guestId, sender.sent[0].chatId)
+		require.Equal(t, guestId, storage.GetWishListByCategory(ctx, ownerId).Items("default")[0].ReservedBy)
+	})
+
+	t.Run("Should keep reservations out of the chat", func(t *testing.T) {
+		sender.sent = nil
+		msg := inGroup(ownerId, "/show_item")
+		msg.ReplyToUserID = ownerId
+		require.NoError(t, model.OnMessage(ctx, msg))
+		require.NotContains(t, sender.last().text, "заброн")
+		require.NoError(t, model.OnMessage(ctx, inGroup(ownerId, reserve)))
+		require.Equal(t, sent{chatId: ownerId, text: "Это ваша хотелка, её нельзя забронировать"}, sender.last())
+	})
+
+	t.Run("Should not let another member take the reservation", func(t *testing.T) {
+		require.NoError(t, model.OnMessage(ctx, inGroup(thirdId, reserve)))
+		require.Equal(t, sent{chatId: thirdId, text: "«Книга» уже кто-то забронировал"}, sender.last())
+		require.Equal(t, guestId, storage.GetWishListByCategory(ctx, ownerId).Items("default")[0].ReservedBy)
+	})
+
+	t.Run("Should release own reservation", func(t *testing.T) {
+		require.NoError(t, model.OnMessage(ctx, inGroup(guestId, reserve)))
+		require.Equal(t, sent{chatId: guestId, text: "Бронь «Книга» снята"}, sender.last())
+		require.Zero(t, storage.GetWishListByCategory(ctx, ownerId).Items("default")[0].ReservedBy)
+	})
+}
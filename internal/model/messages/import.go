@@ -0,0 +1,150 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"slices"
+	"strings"
+)
+
+type ImportRow struct {
+	Line     int
+	Category string
+	Item     WishItem
+}
+
+type ImportError struct {
+	Line   int
+	Reason string
+}
+
+type ImportBatch struct {
+	Format string
+	Rows   []ImportRow
+	Errors []ImportError
+}
+
+// WishList keeps categories and items in the order they appear in the file.
+func (b ImportBatch) WishList() Categories {
+	var result Categories
+	index := make(map[string]int)
+	for _, row := range b.Rows {
+		key := strings.ToLower(row.Category)
+		i, ok := index[key]
+		if !ok {
+			i = len(result)
+			index[key] = i
+			result = append(result, WishCategory{Name: row.Category})
+		}
+		result[i].Items = append(result[i].Items, row.Item)
+	}
+	return result
+}
+
+type Importer interface {
+	Parse(fileName string, data []byte, limits Limits) (ImportBatch, error)
+}
+
+var importBtn = []types.TgRowButtons{
+	{
+		types.TgInlineButton{DisplayName: "✅ Импортировать", Value: "/import_commit"},
+		types.TgInlineButton{DisplayName: "Отмена", Value: "/cancel"},
+	},
+}
+
+const (
+	maxImportErrorsShown = 10
+
+	txtImportHelp     = "Пришлите файл со списком: CSV (колонки category, name, url, price, currency), JSON из /export или обычный текст — одна хотелка на строку, строка с двоеточием в конце задаёт категорию. Перед сохранением я покажу, что получилось."
+	txtImportDisabled = "Импорт сейчас недоступен"
+	txtImportFailed   = "Не удалось прочитать файл: %s"
+	txtImportEmpty    = "В файле не нашлось ни одной хотелки."
+	txtImportPreview  = "Проверка файла (%s), ничего ещё не сохранено.\nСтрок с хотелками: %d\nКатегорий: %d\nОшибок: %d"
+	txtImportDone     = "Импортировано хотелок: %d"
+)
+
+func checkImport(ctx context.Context, m *BotModel, msg Message) (bool, error) {
+	switch {
+	case msg.Text == "/import":
+		if m.Importer == nil || m.DocumentLoader == nil {
+			return true, m.MessageSender.ShowButtons(msg.UserID, txtImportDisabled, btnStart)
+		}
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtImportHelp, cancelBtn)
+	case msg.DocFileID != "":
+		if m.Importer == nil || m.DocumentLoader == nil {
+			return true, m.MessageSender.ShowButtons(msg.UserID, txtImportDisabled, btnStart)
+		}
+		return true, previewImport(m, msg)
+	case msg.Text == "/import_commit":
+		batch, ok := m.pendingImports[msg.UserID]
+		if !ok {
+			return false, nil
+		}
+		delete(m.pendingImports, msg.UserID)
+		err := m.inTx(ctx, func(tx *BotModel) error {
+			if err := tx.UserStorage.AddNewUser(ctx, msg.UserID); err != nil {
+				return err
+			}
+			if err := tx.Limits.CheckItemQuota(CountItems(ctx, tx.UserStorage, msg.UserID), len(batch.Rows)); err != nil {
+				return err
+			}
+			wishList := batch.WishList()
+			existing := tx.UserStorage.GetCategories(ctx, msg.UserID)
+			added := 0
+			for _, cat := range wishList {
+				if !slices.ContainsFunc(existing, func(name string) bool { return strings.EqualFold(name, cat.Name) }) {
+					added++
+				}
+			}
+			if err := tx.Limits.CheckCategoryQuota(len(existing), added); err != nil {
+				return err
+			}
+			return tx.UserStorage.ImportWishList(ctx, msg.UserID, wishList)
+		})
+		if ValidationText(err) != "" {
+			return true, rePrompt(m, msg.UserID, err, "", "")
+		}
+		if err != nil {
+			return true, err
+		}
+		return true, m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtImportDone, len(batch.Rows)), btnStart)
+	}
+	return false, nil
+}
+
+// previewImport is the dry run: it parses and validates the file and shows the outcome,
+// while the storage is only touched after the user confirms.
+func previewImport(m *BotModel, msg Message) error {
+	data, err := m.DocumentLoader.LoadDocument(msg.DocFileID)
+	if err != nil {
+		return m.MessageSender.SendMessage(msg.UserID, fmt.Sprintf(txtImportFailed, err))
+	}
+	batch, err := m.Importer.Parse(msg.DocFileName, data, m.Limits)
+	if err != nil {
+		return m.MessageSender.SendMessage(msg.UserID, fmt.Sprintf(txtImportFailed, err))
+	}
+	report := formatImportReport(batch)
+	if len(batch.Rows) == 0 {
+		return m.MessageSender.ShowButtons(msg.UserID, report+"\n\n"+txtImportEmpty, btnStart)
+	}
+	m.pendingImports[msg.UserID] = batch
+	return m.MessageSender.ShowButtons(msg.UserID, report, importBtn)
+}
+
+func formatImportReport(batch ImportBatch) string {
+	var b strings.Builder
+	wishList := batch.WishList()
+	b.WriteString(fmt.Sprintf(txtImportPreview, batch.Format, len(batch.Rows), len(wishList), len(batch.Errors)))
+	for _, cat := range wishList {
+		b.WriteString(fmt.Sprintf("\n• %s: %d", categoryTitle(cat.Name), len(cat.Items)))
+	}
+	for i, e := range batch.Errors {
+		if i == maxImportErrorsShown {
+			b.WriteString(fmt.Sprintf("\n…и ещё %d", len(batch.Errors)-maxImportErrorsShown))
+			break
+		}
+		b.WriteString(fmt.Sprintf("\nСтрока %d: %s", e.Line, e.Reason))
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package messages_test
+
+import (
+	"context"
+	"github.com/roman-clancy/ho4uha-bot/internal/importer"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type fakeDocuments map[string][]byte
+
+func (f fakeDocuments) LoadDocument(fileID string) ([]byte, error) {
+	return f[fileID], nil
+}
+
+func TestBotModel_Import(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	model.Importer = importer.New()
+	docs := fakeDocuments{}
+	model.DocumentLoader = docs
+	require.NoError(t, storage.AddNewUser(ctx, ownerId))
+	require.NoError(t, storage.AddUserCategory(ctx, ownerId, "Книги"))
+	send := func(text string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: ownerId, UserID: ownerId}))
+	}
+	upload := func(data string) {
+		docs["file"] = []byte(data)
+		msg := messages.Message{DocFileID: "file", DocFileName: "list.txt", ChatID: ownerId, UserID: ownerId}
+		require.NoError(t, model.OnMessage(ctx, msg))
+	}
+
+	t.Run("Should merge categories whatever their case", func(t *testing.T) {
+		upload("книги:\nДюна\nКНИГИ:\nСолярис\n")
+		require.Contains(t, sender.last().text, "Категорий: 1")
+		send("/import_commit")
+		require.Equal(t, []string{"Книги"}, storage.GetCategories(ctx, ownerId))
+		require.Len(t, storage.GetWishListByCategory(ctx, ownerId).Items("Книги"), 2)
+	})
+
+	t.Run("Should not import more categories than allowed", func(t *testing.T) {
+		model.Limits.MaxCategories = 2
+		upload("Игры:\nКатан\nКниги:\nЛес\nСпорт:\nМяч\n")
+		send("/import_commit")
+		require.Contains(t, sender.last().text, "⚠️")
+		require.Equal(t, []string{"Книги"}, storage.GetCategories(ctx, ownerId))
+		require.Equal(t, 2, storage.GetWishListByCategory(ctx, ownerId).Count())
+	})
+
+	t.Run("Should check rows against the limits of the bot", func(t *testing.T) {
+		model.Limits.MaxItemName = 4
+		upload("Мяч\nВелосипед\n")
+		require.Contains(t, sender.last().text, "Строк с хотелками: 1")
+		require.Contains(t, sender.last().text, "Строка 2:")
+	})
+}
@@ -0,0 +1,219 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ItemStatus is where a wish is in its life: wanted → reserved → received → archived.
+type ItemStatus string
+
+const (
+	ItemWanted   ItemStatus = "wanted"
+	ItemReserved ItemStatus = "reserved"
+	ItemReceived ItemStatus = "received"
+	ItemArchived ItemStatus = "archived"
+)
+
+// CurrentStatus derives wanted and reserved from ReservedBy, so a reservation is never
+// out of sync with the status.
+func (i WishItem) CurrentStatus() ItemStatus {
+	switch {
+	case i.Status == ItemReceived || i.Status == ItemArchived:
+		return i.Status
+	case i.ReservedBy != 0:
+		return ItemReserved
+	}
+	return ItemWanted
+}
+
+// Active items are still wished for and visible to friends.
+func (i WishItem) Active() bool {
+	status := i.CurrentStatus()
+	return status == ItemWanted || status == ItemReserved
+}
+
+const (
+	txtReceivedChoose = "Что вам подарили? Отмеченная хотелка пропадёт из списка у друзей."
+	txtReceivedEmpty  = "В списке нет хотелок, которые ждут подарка"
+	txtReceivedDone   = "«%s» теперь в архиве полученных подарков 🎉"
+	txtThanksAsk      = "Напишите пару слов благодарности, я передам их тому, кто подарил. Кто это был, останется секретом."
+	txtThanksSent     = "Спасибо передано 💌"
+	txtThanksMissed   = "Спасибо передано, но не всем: кому-то из дарителей не получилось написать"
+	txtThanks         = "💌 %s получил(а) «%s» и благодарит вас:\n%s"
+	txtArchive        = "Полученные подарки. ✅ ещё на виду в вашем списке, 🗄 убраны в архив; нажмите, чтобы убрать в архив или вернуть в список."
+	txtArchiveEmpty   = "Полученных подарков пока нет"
+	txtArchived       = "«%s» убрана в архив"
+	txtRestored       = "«%s» снова в списке"
+)
+
+var thanksSkipBtn = []types.TgRowButtons{
+	{types.TgInlineButton{DisplayName: "Пропустить", Value: "/cancel"}},
+}
+
+// checkLifecycle lets the owner mark wishes received, thank the givers and manage the archive.
+func checkLifecycle(ctx context.Context, m *BotModel, msg Message, lastCmd string) (bool, error) {
+	if rawId, ok := strings.CutPrefix(lastCmd, "/thanks "); ok && !msg.IsCallback {
+		return true, sendThanks(ctx, m, msg, rawId)
+	}
+	switch msg.Text {
+	case "/received":
+		return true, showReceivable(ctx, m, msg.UserID)
+	case "/archive":
+		return true, showArchive(ctx, m, msg.UserID)
+	}
+	cmd, arg, _ := strings.Cut(msg.Text, " ")
+	if cmd != "/got" && cmd != "/archive_item" && cmd != "/restore" {
+		return false, nil
+	}
+	itemId, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	item, ok := m.UserStorage.GetWishListByCategory(ctx, msg.UserID).Find(itemId)
+	if !ok {
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtReserveGone, btnStart)
+	}
+	switch cmd {
+	case "/got":
+		return true, markReceived(ctx, m, msg.UserID, item)
+	case "/archive_item":
+		if item.CurrentStatus() != ItemReceived {
+			return true, showArchive(ctx, m, msg.UserID)
+		}
+		item.Status = ItemArchived
+		undo, err := updateUndoable(ctx, m.UserStorage, msg.UserID, item)
+		if err != nil {
+			return true, err
+		}
+		if err := m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtArchived, item.Name), undo); err != nil {
+			return true, err
+		}
+		return true, showArchive(ctx, m, msg.UserID)
+	}
+	return true, restoreItem(ctx, m, msg.UserID, item)
+}
+
+func showReceivable(ctx context.Context, m *BotModel, userId int64) error {
+	wishList := m.UserStorage.GetWishListByStatus(ctx, userId, ItemWanted, ItemReserved)
+	if wishList.Count() == 0 {
+		return m.MessageSender.ShowButtons(userId, txtReceivedEmpty, btnStart)
+	}
+	buttons := make([]types.TgRowButtons, 0)
+	for _, cat := range wishList {
+		for _, item := range cat.Items {
+			buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{
+				DisplayName: "🎁 " + item.Name,
+				Value:       fmt.Sprintf("/got %d", item.ID),
+			}})
+		}
+	}
+	return m.MessageSender.ShowButtons(userId, txtReceivedChoose, append(buttons, cancelBtn...))
+}
+
+// markReceived takes the wish out of friends' sight and offers to thank whoever gifted it.
+func markReceived(ctx context.Context, m *BotModel, userId int64, item WishItem) error {
+	if !item.Active() {
+		return showArchive(ctx, m, userId)
+	}
+	item.Status = ItemReceived
+	undo, err := updateUndoable(ctx, m.UserStorage, userId, item)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf(txtReceivedDone, item.Name)
+	if len(givers(ctx, m, userId, item)) == 0 {
+		return m.MessageSender.ShowButtons(userId, text, append(undo, btnStart...))
+	}
+	m.lastUserCmd[userId] = fmt.Sprintf("/thanks %d", item.ID)
+	return m.MessageSender.ShowButtons(userId, text+"\n\n"+txtThanksAsk, append(undo, thanksSkipBtn...))
+}
+
+// givers are the friend who reserved the item and everybody who chipped in for it.
+func givers(ctx context.Context, m *BotModel, ownerId int64, item WishItem) []int64 {
+	var result []int64
+	if item.ReservedBy != 0 {
+		result = append(result, item.ReservedBy)
+	}
+	for _, p := range m.UserStorage.GetPledges(ctx, ownerId, item.ID) {
+		if !slices.Contains(result, p.UserID) {
+			result = append(result, p.UserID)
+		}
+	}
+	return result
+}
+
+func sendThanks(ctx context.Context, m *BotModel, msg Message, rawId string) error {
+	itemId, err := strconv.ParseInt(rawId, 10, 64)
+	if err != nil {
+		return nil
+	}
+	item, ok := m.UserStorage.GetWishListByCategory(ctx, msg.UserID).Find(itemId)
+	note := strings.TrimSpace(msg.Text)
+	// Undoing /got takes back the thanks it asked for.
+	if !ok || item.CurrentStatus() != ItemReceived || note == "" {
+		return m.MessageSender.ShowButtons(msg.UserID, txtChooseCmd, btnStart)
+	}
+	text := fmt.Sprintf(txtThanks, OwnerName(ctx, m.UserStorage, msg.UserID), item.Name, note)
+	var errs []error
+	for _, giver := range givers(ctx, m, msg.UserID, item) {
+		if err := m.MessageSender.SendMessage(giver, text); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// Givers stay secret, so the owner isn't told who missed the thanks.
+	done := txtThanksSent
+	if len(errs) > 0 {
+		done = txtThanksMissed
+	}
+	return errors.Join(append(errs, m.MessageSender.ShowButtons(msg.UserID, done, btnStart))...)
+}
+
+func showArchive(ctx context.Context, m *BotModel, userId int64) error {
+	wishList := m.UserStorage.GetWishListByStatus(ctx, userId, ItemReceived, ItemArchived)
+	if wishList.Count() == 0 {
+		return m.MessageSender.ShowButtons(userId, txtArchiveEmpty, btnStart)
+	}
+	buttons := make([]types.TgRowButtons, 0)
+	for _, cat := range wishList {
+		for _, item := range cat.Items {
+			button := types.TgInlineButton{DisplayName: "✅ " + item.Name, Value: fmt.Sprintf("/archive_item %d", item.ID)}
+			if item.CurrentStatus() == ItemArchived {
+				button = types.TgInlineButton{DisplayName: "🗄 " + item.Name, Value: fmt.Sprintf("/restore %d", item.ID)}
+			}
+			buttons = append(buttons, types.TgRowButtons{button})
+		}
+	}
+	return m.MessageSender.ShowButtons(userId, txtArchive, append(buttons, btnStart...))
+}
+
+// restoreItem puts the wish back as a fresh one: the old reservation and collection belong
+// to the gift already given.
+func restoreItem(ctx context.Context, m *BotModel, userId int64, item WishItem) error {
+	if item.Active() {
+		return showArchive(ctx, m, userId)
+	}
+	err := m.UserStorage.WithTx(ctx, func(tx UserStorage) error {
+		for _, p := range tx.GetPledges(ctx, userId, item.ID) {
+			p.Amount = 0
+			if err := tx.SetPledge(ctx, p); err != nil {
+				return err
+			}
+		}
+		item.Status = ""
+		item.ReservedBy = 0
+		return tx.UpdateWishItem(ctx, userId, item)
+	})
+	if err != nil {
+		return err
+	}
+	if err := m.MessageSender.SendMessage(userId, fmt.Sprintf(txtRestored, item.Name)); err != nil {
+		return err
+	}
+	return showArchive(ctx, m, userId)
+}
@@ -0,0 +1,126 @@
+package messages_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWishItem_CurrentStatus(t *testing.T) {
+	tests := []struct {
+		item messages.WishItem
+		want messages.ItemStatus
+	}{
+		{messages.WishItem{}, messages.ItemWanted},
+		{messages.WishItem{ReservedBy: 2}, messages.ItemReserved},
+		{messages.WishItem{ReservedBy: 2, Status: messages.ItemReceived}, messages.ItemReceived},
+		{messages.WishItem{Status: messages.ItemArchived}, messages.ItemArchived},
+	}
+	for _, tt := range tests {
+		t.Run("Should derive "+string(tt.want), func(t *testing.T) {
+			require.Equal(t, tt.want, tt.item.CurrentStatus())
+			require.Equal(t, tt.want == messages.ItemWanted || tt.want == messages.ItemReserved, tt.item.Active())
+		})
+	}
+}
+
+func TestBotModel_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	send := func(userId int64, text string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: userId, UserID: userId}))
+	}
+	for _, id := range []int64{ownerId, guestId} {
+		err := storage.AddNewUser(ctx, id)
+		require.NoError(t, err)
+	}
+	err = storage.SetUserName(ctx, ownerId, "Аня")
+	require.NoError(t, err)
+	list, _ := storage.GetActiveList(ctx, ownerId)
+	err = storage.AddListFollower(ctx, list.ID, guestId)
+	require.NoError(t, err)
+	err = storage.ImportWishList(ctx, ownerId, messages.Categories{
+		{Name: "default", Items: []messages.WishItem{{Name: "Велосипед", ReservedBy: guestId}, {Name: "Шарф"}}},
+	})
+	require.NoError(t, err)
+	items := storage.GetWishListByCategory(ctx, ownerId).Items("default")
+	bike, scarf := items[0], items[1]
+
+	t.Run("Should offer active wishes to mark received", func(t *testing.T) {
+		send(ownerId, "/received")
+		buttons := sender.last().buttons
+		require.Equal(t, fmt.Sprintf("/got %d", bike.ID), buttons[0][0].Value)
+		require.Equal(t, fmt.Sprintf("/got %d", scarf.ID), buttons[1][0].Value)
+	})
+
+	t.Run("Should hide received wish from friends and pass thanks to the giver", func(t *testing.T) {
+		send(ownerId, fmt.Sprintf("/got %d", bike.ID))
+		require.Contains(t, sender.last().text, "Напишите пару слов благодарности")
+		require.Equal(t, messages.ItemReceived, storage.GetWishListByCategory(ctx, ownerId).Items("default")[0].CurrentStatus())
+		list, _ := storage.GetActiveList(ctx, ownerId)
+		require.NotContains(t, visibleNames(messages.ReadWishList(ctx, storage, list.ID, messages.AudienceFollower)), "Велосипед")
+
+		send(ownerId, "Катаюсь каждый день!")
+		require.Equal(t, "Спасибо передано 💌", sender.last().text)
+		thanks := sender.sent[len(sender.sent)-2]
+		require.Equal(t, guestId, thanks.chatId)
+		require.Equal(t, "💌 Аня получил(а) «Велосипед» и благодарит вас:\nКатаюсь каждый день!", thanks.text)
+	})
+
+	t.Run("Should not ask for thanks when nobody reserved", func(t *testing.T) {
+		send(ownerId, fmt.Sprintf("/got %d", scarf.ID))
+		require.Equal(t, "«Шарф» теперь в архиве полученных подарков 🎉", sender.last().text)
+		send(ownerId, "просто текст")
+		require.NotEqual(t, "Спасибо передано 💌", sender.last().text)
+	})
+
+	t.Run("Should archive received wishes and hide them from the owner's list", func(t *testing.T) {
+		send(ownerId, fmt.Sprintf("/archive_item %d", bike.ID))
+		require.Equal(t, []string{"Велосипед"}, visibleNames(storage.GetWishListByStatus(ctx, ownerId, messages.ItemArchived)))
+		send(ownerId, "/show_item")
+		text := sender.last().text
+		require.NotContains(t, text, "Велосипед")
+		require.Contains(t, text, "1. Шарф. Сайт:  ✅")
+	})
+
+	t.Run("Should restore an archived wish as a fresh one", func(t *testing.T) {
+		send(ownerId, "/archive")
+		require.Equal(t, "🗄 Велосипед", sender.last().buttons[0][0].DisplayName)
+		send(ownerId, fmt.Sprintf("/restore %d", bike.ID))
+		restored := storage.GetWishListByCategory(ctx, ownerId).Items("default")[0]
+		require.Equal(t, messages.ItemWanted, restored.CurrentStatus())
+		require.Zero(t, restored.ReservedBy)
+	})
+}
+
+func TestBotModel_ThanksUnreachable(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	for _, id := range []int64{ownerId, guestId, thirdId} {
+		require.NoError(t, storage.AddNewUser(ctx, id))
+	}
+	err = storage.ImportWishList(ctx, ownerId, messages.Categories{
+		{Name: "default", Items: []messages.WishItem{{Name: "Велосипед", Price: 1000000, Currency: "RUB", ReservedBy: guestId}}},
+	})
+	require.NoError(t, err)
+	bike := storage.GetWishListByCategory(ctx, ownerId).Items("default")[0]
+	require.NoError(t, storage.SetPledge(ctx, messages.Pledge{OwnerID: ownerId, ItemID: bike.ID, UserID: thirdId, Amount: 500000}))
+	blocked := errors.New("bot was blocked by the user")
+	sender.fail = map[int64]error{guestId: blocked}
+
+	require.NoError(t, model.OnMessage(ctx, messages.Message{Text: fmt.Sprintf("/got %d", bike.ID), UserID: ownerId}))
+	err = model.OnMessage(ctx, messages.Message{Text: "Спасибо!", UserID: ownerId})
+	require.ErrorIs(t, err, blocked)
+	require.Equal(t, thirdId, sender.sent[len(sender.sent)-2].chatId, "The other giver should still get the thanks")
+	require.Equal(t, "Спасибо передано, но не всем: кому-то из дарителей не получилось написать", sender.last().text)
+}
@@ -0,0 +1,142 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"strconv"
+	"strings"
+)
+
+// DefaultListName is given to the list every user starts with. Data saved before lists
+// existed is moved into such a list.
+const DefaultListName = "Мой вишлист"
+
+// WishList groups categories: "День рождения", "Для дома". Each list has its own share link,
+// and all owner commands work on the active one.
+type WishList struct {
+	ID      int64
+	OwnerID int64
+	Name    string
+}
+
+const (
+	txtLists        = "Ваши списки. Команды добавления, просмотра, импорта и ссылка «Поделиться» работают с активным списком ✅."
+	txtListName     = "Введите название списка"
+	txtListRename   = "Введите новое название списка"
+	txtListCreated  = "Список «%s» создан и выбран"
+	txtListUsed     = "Выбран список «%s»"
+	txtListRenamed  = "Список переименован в «%s»"
+	txtListDeleted  = "Список «%s» удалён"
+	txtListLast     = "Нельзя удалить единственный список"
+	txtListNotFound = "Список не найден"
+)
+
+// checkLists lets the owner create, switch, rename and delete lists.
+func checkLists(ctx context.Context, m *BotModel, msg Message, lastCmd string) (bool, error) {
+	if !msg.IsCallback {
+		switch {
+		case lastCmd == "/list_name":
+			return true, createList(ctx, m, msg)
+		case strings.HasPrefix(lastCmd, "/list_rename "):
+			return true, renameList(ctx, m, msg, strings.TrimPrefix(lastCmd, "/list_rename "))
+		}
+	}
+	switch msg.Text {
+	case "/lists":
+		return true, showLists(ctx, m, msg.UserID)
+	case "/list_new":
+		m.lastUserCmd[msg.UserID] = "/list_name"
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtListName, cancelBtn)
+	}
+	cmd, arg, _ := strings.Cut(msg.Text, " ")
+	if cmd != "/list_use" && cmd != "/list_rename" && cmd != "/list_del" {
+		return false, nil
+	}
+	listId, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	list, ok := m.UserStorage.GetList(ctx, listId)
+	if !ok || list.OwnerID != msg.UserID {
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtListNotFound, btnStart)
+	}
+	switch cmd {
+	case "/list_use":
+		if err := m.UserStorage.SetActiveList(ctx, msg.UserID, listId); err != nil {
+			return true, err
+		}
+		return true, m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtListUsed, list.Name), btnStart)
+	case "/list_rename":
+		m.lastUserCmd[msg.UserID] = msg.Text
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtListRename, cancelBtn)
+	}
+	revisionId, err := WithUndo(ctx, m.UserStorage, msg.UserID, func(tx UserStorage) error {
+		return tx.DeleteList(ctx, msg.UserID, listId)
+	})
+	if err != nil {
+		return true, err
+	}
+	if err := m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtListDeleted, list.Name), undoButtons(revisionId)); err != nil {
+		return true, err
+	}
+	return true, showLists(ctx, m, msg.UserID)
+}
+
+func showLists(ctx context.Context, m *BotModel, userId int64) error {
+	if err := m.UserStorage.AddNewUser(ctx, userId); err != nil {
+		return err
+	}
+	active, _ := m.UserStorage.GetActiveList(ctx, userId)
+	lists := m.UserStorage.GetLists(ctx, userId)
+	buttons := make([]types.TgRowButtons, 0, len(lists)+1+len(btnStart))
+	for _, list := range lists {
+		name := list.Name
+		if list.ID == active.ID {
+			name = "✅ " + name
+		}
+		buttons = append(buttons, types.TgRowButtons{
+			types.TgInlineButton{DisplayName: name, Value: fmt.Sprintf("/list_use %d", list.ID)},
+			types.TgInlineButton{DisplayName: "✏️", Value: fmt.Sprintf("/list_rename %d", list.ID)},
+			types.TgInlineButton{DisplayName: "❌", Value: fmt.Sprintf("/list_del %d", list.ID)},
+		})
+	}
+	buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{DisplayName: "➕ Новый список", Value: "/list_new"}})
+	return m.MessageSender.ShowButtons(userId, txtLists, append(buttons, btnStart...))
+}
+
+func createList(ctx context.Context, m *BotModel, msg Message) error {
+	name := strings.TrimSpace(msg.Text)
+	if err := m.Limits.ValidateListName(name); err != nil {
+		return rePrompt(m, msg.UserID, err, "/list_name", txtListName)
+	}
+	if err := m.UserStorage.AddNewUser(ctx, msg.UserID); err != nil {
+		return err
+	}
+	list, err := m.UserStorage.CreateList(ctx, msg.UserID, name)
+	if err != nil {
+		return err
+	}
+	if err := m.UserStorage.SetActiveList(ctx, msg.UserID, list.ID); err != nil {
+		return err
+	}
+	return m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtListCreated, name), btnStart)
+}
+
+func renameList(ctx context.Context, m *BotModel, msg Message, rawId string) error {
+	listId, err := strconv.ParseInt(rawId, 10, 64)
+	if err != nil {
+		return nil
+	}
+	name := strings.TrimSpace(msg.Text)
+	if err := m.Limits.ValidateListName(name); err != nil {
+		return rePrompt(m, msg.UserID, err, "/list_rename "+rawId, txtListRename)
+	}
+	if err := m.UserStorage.RenameList(ctx, msg.UserID, listId, name); err != nil {
+		return err
+	}
+	if err := m.MessageSender.SendMessage(msg.UserID, fmt.Sprintf(txtListRenamed, name)); err != nil {
+		return err
+	}
+	return showLists(ctx, m, msg.UserID)
+}
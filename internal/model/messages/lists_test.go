@@ -0,0 +1,90 @@
+package messages_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBotModel_Lists(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	model.BotUserName = "ho4uha_bot"
+	send := func(userId int64, text string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: userId, UserID: userId}))
+	}
+	err = storage.AddNewUser(ctx, ownerId)
+	require.NoError(t, err)
+	err = storage.AddWishItem(ctx, ownerId, messages.WishItem{Name: "Велосипед"})
+	require.NoError(t, err)
+	first, _ := storage.GetActiveList(ctx, ownerId)
+
+	t.Run("Should create a list and make it active", func(t *testing.T) {
+		send(ownerId, "/list_new")
+		send(ownerId, "Для дома")
+		require.Equal(t, "Список «Для дома» создан и выбран", sender.last().text)
+		active, _ := storage.GetActiveList(ctx, ownerId)
+		require.Equal(t, "Для дома", active.Name)
+	})
+
+	t.Run("Should scope owner commands to the active list", func(t *testing.T) {
+		err := storage.AddWishItem(ctx, ownerId, messages.WishItem{Name: "Плед"})
+		require.NoError(t, err)
+		send(ownerId, "/show_item")
+		text := sender.last().text
+		require.Contains(t, text, "📋 Для дома")
+		require.Contains(t, text, "Плед")
+		require.NotContains(t, text, "Велосипед")
+	})
+
+	t.Run("Should mark the active list in the switcher", func(t *testing.T) {
+		send(ownerId, "/lists")
+		buttons := sender.last().buttons
+		require.Equal(t, messages.DefaultListName, buttons[0][0].DisplayName)
+		require.Equal(t, "✅ Для дома", buttons[1][0].DisplayName)
+		send(ownerId, fmt.Sprintf("/list_use %d", first.ID))
+		active, _ := storage.GetActiveList(ctx, ownerId)
+		require.Equal(t, first.ID, active.ID)
+	})
+
+	t.Run("Should let friends follow a single list by its link", func(t *testing.T) {
+		lists := storage.GetLists(ctx, ownerId)
+		token, err := storage.GetListShareToken(ctx, lists[1].ID)
+		require.NoError(t, err)
+		send(guestId, "/start w_"+token)
+		text := sender.last().text
+		require.Contains(t, text, "Плед")
+		require.NotContains(t, text, "Велосипед")
+		require.Equal(t, []int64{guestId}, storage.GetFollowers(ctx, ownerId))
+	})
+
+	t.Run("Should show friends every list in groups", func(t *testing.T) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/show_item", ChatID: chatId, UserID: guestId, ReplyToUserID: ownerId}))
+		text := sender.last().text
+		require.Contains(t, text, "📋 "+messages.DefaultListName)
+		require.Contains(t, text, "📋 Для дома")
+	})
+
+	t.Run("Should rename and delete lists", func(t *testing.T) {
+		home := storage.GetLists(ctx, ownerId)[1]
+		send(ownerId, fmt.Sprintf("/list_rename %d", home.ID))
+		send(ownerId, "Дом")
+		renamed, _ := storage.GetList(ctx, home.ID)
+		require.Equal(t, "Дом", renamed.Name)
+		send(ownerId, fmt.Sprintf("/list_del %d", home.ID))
+		require.Len(t, storage.GetLists(ctx, ownerId), 1)
+		send(ownerId, fmt.Sprintf("/list_del %d", first.ID))
+		require.Equal(t, "Нельзя удалить единственный список", sender.last().text)
+	})
+
+	t.Run("Should refuse lists of other users", func(t *testing.T) {
+		send(guestId, fmt.Sprintf("/list_use %d", first.ID))
+		require.Equal(t, "Список не найден", sender.last().text)
+	})
+}
@@ -1,44 +1,227 @@
 package messages
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
 	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"slices"
 	"strings"
 )
 
 type WishItem struct {
-	Name string
-	URL  string
+	// ID is assigned by the storage when the item is saved.
+	ID          int64
+	Name        string
+	URL         string
+	PhotoFileID string
+	PhotoData   []byte
+	ImageURL    string
+	// Price is kept in minor units (kopecks, cents).
+	Price    int64
+	Currency string
+	Priority Priority
+	Note     string
+	// Tags are free-form labels without the leading "#".
+	Tags []string
+	// ReservedBy is the friend who promised to gift the item. Owner facing views must
+	// only show whether it is set, never who it is.
+	ReservedBy int64
+	Visibility Visibility
+	// Status is only set once the item is received, see CurrentStatus.
+	Status ItemStatus
 }
 
+func (i WishItem) HasPhoto() bool {
+	return i.PhotoFileID != "" || len(i.PhotoData) > 0 || i.ImageURL != ""
+}
+
+func (i WishItem) Photo() types.TgPhoto {
+	return types.TgPhoto{FileID: i.PhotoFileID, Data: i.PhotoData, URL: i.ImageURL}
+}
+
+// WishCategory is a category with its items, both kept in the order the owner arranged them.
+type WishCategory struct {
+	Name  string
+	Items []WishItem
+}
+
+// Categories is a wish list as storage returns it: ordered, the default category first.
+type Categories []WishCategory
+
+func (c Categories) Get(name string) ([]WishItem, bool) {
+	for _, category := range c {
+		if category.Name == name {
+			return category.Items, true
+		}
+	}
+	return nil, false
+}
+
+// Items is nil for a category that does not exist.
+func (c Categories) Items(name string) []WishItem {
+	items, _ := c.Get(name)
+	return items
+}
+
+func (c Categories) Find(itemId int64) (WishItem, bool) {
+	for _, category := range c {
+		for _, item := range category.Items {
+			if item.ID == itemId {
+				return item, true
+			}
+		}
+	}
+	return WishItem{}, false
+}
+
+func (c Categories) CategoryOf(itemId int64) string {
+	for _, category := range c {
+		if slices.ContainsFunc(category.Items, func(item WishItem) bool { return item.ID == itemId }) {
+			return category.Name
+		}
+	}
+	return ""
+}
+
+func (c Categories) Count() int {
+	n := 0
+	for _, category := range c {
+		n += len(category.Items)
+	}
+	return n
+}
+
+// UserStorage is implemented by the storage backends. Writes report missing records and conflicts
+// with the errors of errors.go, so every backend fails the same way.
 type UserStorage interface {
-	AddNewUser(userId int64) (bool, error)
-	AddUserCategory(userId int64, catName string) (bool, error)
-	AddWishItem(userId int64, item WishItem) (bool, error)
-	AddWishItemToCategory(userId int64, catName string, item WishItem) (bool, error)
-	GetWishListByCategory(userId int64) map[string][]WishItem
-	GetCategories(userId int64) []string
+	// WithTx runs f in a transaction: what f changes through tx is kept only when f returns nil
+	// and ctx is not done by then. SQL backends map it onto a database transaction.
+	WithTx(ctx context.Context, f func(tx UserStorage) error) error
+	AddNewUser(ctx context.Context, userId int64) error
+	AddUserCategory(ctx context.Context, userId int64, catName string) error
+	AddWishItem(ctx context.Context, userId int64, item WishItem) error
+	AddWishItemToCategory(ctx context.Context, userId int64, catName string, item WishItem) error
+	GetWishListByCategory(ctx context.Context, userId int64) Categories
+	GetWishListByStatus(ctx context.Context, userId int64, statuses ...ItemStatus) Categories
+	// SearchWishItems finds items of all lists of the user matching WishItem.MatchesSearch and
+	// returns a page of them with the total number of hits.
+	SearchWishItems(ctx context.Context, userId int64, query string, offset, limit int) ([]FoundItem, int)
+	GetCategories(ctx context.Context, userId int64) []string
+	ImportWishList(ctx context.Context, userId int64, wishList Categories) error
+	UpdateWishItem(ctx context.Context, userId int64, item WishItem) error
+	DeleteWishItem(ctx context.Context, userId int64, itemId int64) error
+	MoveWishItem(ctx context.Context, userId int64, itemId int64, catName string, position int) error
+	RenameUserCategory(ctx context.Context, userId int64, catName string, newName string) error
+	DeleteUserCategory(ctx context.Context, userId int64, catName string) error
+	MoveUserCategory(ctx context.Context, userId int64, catName string, position int) error
+	GetShareToken(ctx context.Context, userId int64) (string, error)
+	GetListByShareToken(ctx context.Context, token string) (WishList, bool)
+	SetUserName(ctx context.Context, userId int64, name string) error
+	GetUserName(ctx context.Context, userId int64) string
+	SetTimeZone(ctx context.Context, userId int64, timeZone string) error
+	GetTimeZone(ctx context.Context, userId int64) string
+	AddEvent(ctx context.Context, userId int64, event Event) error
+	GetEvents(ctx context.Context, userId int64) []Event
+	DeleteEvent(ctx context.Context, userId int64, eventId int64) error
+	AddListFollower(ctx context.Context, listId int64, followerId int64) error
+	GetListFollowers(ctx context.Context, listId int64) []int64
+	GetFollowers(ctx context.Context, ownerId int64) []int64
+	RemoveFollower(ctx context.Context, ownerId int64, followerId int64) error
+	GetFollowing(ctx context.Context, followerId int64) []int64
+	SetFollowMuted(ctx context.Context, ownerId int64, followerId int64, muted bool) error
+	IsFollowMuted(ctx context.Context, ownerId int64, followerId int64) bool
+	GetChanges(ctx context.Context, ownerId int64) []Change
+	ClearChanges(ctx context.Context, ownerId int64, upToId int64) error
+	CreateSantaGame(ctx context.Context, organizerId int64, title string) (SantaGame, error)
+	GetSantaGame(ctx context.Context, gameId int64) (SantaGame, bool)
+	GetSantaGameByToken(ctx context.Context, token string) (SantaGame, bool)
+	GetSantaGames(ctx context.Context, userId int64) []SantaGame
+	UpdateSantaGame(ctx context.Context, game SantaGame) error
+	SetPledge(ctx context.Context, pledge Pledge) error
+	GetPledges(ctx context.Context, ownerId int64, itemId int64) []Pledge
+	SetCategoryVisibility(ctx context.Context, userId int64, catName string, visibility Visibility) error
+	GetCategoryVisibility(ctx context.Context, userId int64) map[string]Visibility
+	CreateList(ctx context.Context, userId int64, name string) (WishList, error)
+	GetLists(ctx context.Context, userId int64) []WishList
+	GetList(ctx context.Context, listId int64) (WishList, bool)
+	GetActiveList(ctx context.Context, userId int64) (WishList, bool)
+	SetActiveList(ctx context.Context, userId int64, listId int64) error
+	RenameList(ctx context.Context, userId int64, listId int64, name string) error
+	DeleteList(ctx context.Context, userId int64, listId int64) error
+	GetListShareToken(ctx context.Context, listId int64) (string, error)
+	GetListWishList(ctx context.Context, listId int64) Categories
+	GetListCategoryVisibility(ctx context.Context, listId int64) map[string]Visibility
+	SetPriceWatch(ctx context.Context, watch PriceWatch) error
+	GetPriceWatch(ctx context.Context, ownerId int64, itemId int64) (PriceWatch, bool)
+	DeletePriceWatch(ctx context.Context, ownerId int64, itemId int64) error
+	GetPriceHistory(ctx context.Context, itemId int64) []PricePoint
+	// GetRevisions returns the undo stack of the user, newest first. UpdateWishItem, DeleteWishItem,
+	// RenameUserCategory, DeleteUserCategory and DeleteList push a revision each.
+	GetRevisions(ctx context.Context, userId int64) []Revision
+	// RevertRevision puts the item, category or list back the way the revision saved it and drops the
+	// revision. It returns ErrConflict when a newer revision touches the same item or category.
+	RevertRevision(ctx context.Context, userId int64, revisionId int64) error
 }
 
 type MessageSender interface {
 	SendMessage(userId int64, text string) error
 	ShowButtons(userId int64, text string, buttons []types.TgRowButtons) error
+	SendPhoto(userId int64, photo types.TgPhoto, caption string) error
+	SendDocument(userId int64, fileName string, data []byte, caption string) error
+}
+
+type PhotoLoader interface {
+	LoadPhoto(fileID string) ([]byte, error)
+}
+
+type DocumentLoader interface {
+	LoadDocument(fileID string) ([]byte, error)
+}
+
+type LinkInspector interface {
+	InspectLink(url string) (WishItem, error)
 }
 
 type Message struct {
-	Text          string
+	Text string
+	// ChatID is where the message was written: equal to UserID in private chats, a group otherwise.
+	ChatID        int64
+	ChatTitle     string
 	UserID        int64
 	UserName      string
+	FirstName     string
+	ReplyToUserID int64
 	IsCallback    bool
 	CallbackMsgID string
+	PhotoFileID   string
+	DocFileID     string
+	DocFileName   string
 }
 
 type BotModel struct {
-	UserStorage      UserStorage
-	MessageSender    MessageSender
-	lastUserCmd      map[int64]string
-	lastUserCat      map[int64]string
-	lastUserItemName map[int64]string
+	UserStorage       UserStorage
+	MessageSender     MessageSender
+	PhotoLoader       PhotoLoader
+	LinkInspector     LinkInspector
+	Importer          Importer
+	Exporter          Exporter
+	ShareBaseURL      string
+	BotUserName       string
+	Reminders         ReminderPlanner
+	DocumentLoader    DocumentLoader
+	Limits            Limits
+	Clock             clock.Clock
+	lastUserCmd       map[int64]string
+	lastUserCat       map[int64]string
+	lastUserItemName  map[int64]string
+	lastUserItemPhoto map[int64]string
+	drafts            map[int64]*draft
+	pendingImports    map[int64]ImportBatch
+	eventDrafts       map[int64]Event
+	searches          map[int64]search
 }
 
 var btnStart = []types.TgRowButtons{
@@ -50,6 +233,26 @@ var btnStart = []types.TgRowButtons{
 		types.TgInlineButton{DisplayName: "Показать мои категории", Value: "/show_cat"},
 		types.TgInlineButton{DisplayName: "Показать мои хотелки", Value: "/show_item"},
 	},
+	{
+		types.TgInlineButton{DisplayName: "📥 Импорт", Value: "/import"},
+		types.TgInlineButton{DisplayName: "📤 Экспорт", Value: "/export"},
+		types.TgInlineButton{DisplayName: "🔗 Поделиться", Value: "/share"},
+	},
+	{
+		types.TgInlineButton{DisplayName: "🎉 Праздники", Value: "/events"},
+		types.TgInlineButton{DisplayName: "👥 Подписки", Value: "/following"},
+		types.TgInlineButton{DisplayName: "🎅 Санта", Value: "/santa"},
+	},
+	{
+		types.TgInlineButton{DisplayName: "📋 Списки", Value: "/lists"},
+		types.TgInlineButton{DisplayName: "🔒 Приватность", Value: "/privacy"},
+		types.TgInlineButton{DisplayName: "🔍 Поиск", Value: "/find"},
+	},
+	{
+		types.TgInlineButton{DisplayName: "Получил 🎁", Value: "/received"},
+		types.TgInlineButton{DisplayName: "🗄 Архив", Value: "/archive"},
+		types.TgInlineButton{DisplayName: "↕️ Порядок", Value: "/order"},
+	},
 }
 var cancelBtn = []types.TgRowButtons{
 	{types.TgInlineButton{DisplayName: "Отмена", Value: "/cancel"}},
@@ -61,48 +264,138 @@ const (
 	txtUnknownCommand = "К сожалению, данная команда мне неизвестна. Для начала работы введите /start"
 	txtCatAdd         = "Введите название категории"
 	txtItemAdd        = "Введите название хотелки"
-	txtItemUrl        = "Добавьте ссылку на вашу хотелку"
+	txtItemUrl        = "Добавьте ссылку на вашу хотелку или отправьте «-», если её нет"
+	txtItemPhotoName  = "Фото сохранено. Введите название хотелки"
 	txtItemShow       = "Ваши хотелки:"
 	txtCatChoose      = "Выберите категорию хотелки"
 	txtCatShow        = "Ваши категории:"
 	txtCatShowErr     = "Ошибка при формировании списка категорий"
 	txtAddDone        = "Сохранение успешно"
+	txtShare          = "Ссылка на ваш вишлист, её можно отправить друзьям даже без Telegram:\n%s"
+	txtShareDisabled  = "Публичные ссылки сейчас недоступны"
+	txtShareFollow    = "По этой ссылке друзья в Telegram подпишутся на список и получат напоминание перед вашими праздниками:\n%s"
 )
 
 func New(userStorage UserStorage, sender MessageSender) *BotModel {
 	return &BotModel{
-		UserStorage:      userStorage,
-		MessageSender:    sender,
-		lastUserCmd:      map[int64]string{},
-		lastUserCat:      map[int64]string{},
-		lastUserItemName: map[int64]string{},
+		UserStorage:       userStorage,
+		MessageSender:     sender,
+		Limits:            DefaultLimits(),
+		Clock:             clock.Real{},
+		lastUserCmd:       map[int64]string{},
+		lastUserCat:       map[int64]string{},
+		lastUserItemName:  map[int64]string{},
+		lastUserItemPhoto: map[int64]string{},
+		drafts:            map[int64]*draft{},
+		pendingImports:    map[int64]ImportBatch{},
+		eventDrafts:       map[int64]Event{},
+		searches:          map[int64]search{},
+	}
+}
+
+// inTx runs f with a copy of the model whose storage is the transaction, so the helpers f
+// calls take part in it. Messages are better sent after it, they cannot be taken back.
+func (m *BotModel) inTx(ctx context.Context, f func(tx *BotModel) error) error {
+	return m.UserStorage.WithTx(ctx, func(storage UserStorage) error {
+		tx := *m
+		tx.UserStorage = storage
+		return f(&tx)
+	})
+}
+
+// OnMessage answers domain errors, such as an item deleted meanwhile, with an explanation
+// instead of returning them.
+func (m *BotModel) OnMessage(ctx context.Context, msg Message) error {
+	err := m.onMessage(ctx, msg)
+	text := ErrorText(err)
+	if text == "" {
+		return err
+	}
+	if msg.IsGroup() {
+		return m.MessageSender.SendMessage(msg.ChatID, text)
 	}
+	return m.MessageSender.ShowButtons(msg.UserID, text, btnStart)
 }
 
-func (m *BotModel) OnMessage(msg Message) error {
+func (m *BotModel) onMessage(ctx context.Context, msg Message) error {
+	if msg.IsGroup() {
+		return onGroupMessage(ctx, m, msg)
+	}
 	lastUserCmd := m.lastUserCmd[msg.UserID]
 	m.lastUserCmd[msg.UserID] = ""
-	if isNeedReturn, err := checkNewCategoryAdded(m, msg, lastUserCmd); isNeedReturn || err != nil {
+	if isNeedReturn, err := checkUndo(ctx, m, msg); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkNewCategoryAdded(ctx, m, msg, lastUserCmd); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkDraft(ctx, m, msg, lastUserCmd); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkImport(ctx, m, msg); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkExport(ctx, m, msg); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkEvents(ctx, m, msg, lastUserCmd); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkFollow(ctx, m, msg); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkFollowing(ctx, m, msg); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkSanta(ctx, m, msg, lastUserCmd); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkPledge(ctx, m, msg, lastUserCmd); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkPrivacy(ctx, m, msg); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkLists(ctx, m, msg, lastUserCmd); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkLifecycle(ctx, m, msg, lastUserCmd); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkOrder(ctx, m, msg); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkFind(ctx, m, msg, lastUserCmd); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkPriceWatch(ctx, m, msg, lastUserCmd); isNeedReturn || err != nil {
 		return err
 	}
 	if isNeedReturn, err := checkNewItemAdded(m, msg); isNeedReturn || err != nil {
 		return err
 	}
-	if isNeedReturn, err := checkNewItemNameAdded(m, msg); isNeedReturn || err != nil {
+	if isNeedReturn, err := checkNewItemNameAdded(ctx, m, msg); isNeedReturn || err != nil {
+		return err
+	}
+	if isNeedReturn, err := checkNewItemUrlAdded(ctx, m, msg); isNeedReturn || err != nil {
 		return err
 	}
-	if isNeedReturn, err := checkNewItemUrlAdded(m, msg); isNeedReturn || err != nil {
+	if isNeedReturn, err := checkBotCommands(ctx, m, msg); isNeedReturn || err != nil {
 		return err
 	}
-	if isNeedReturn, err := checkBotCommands(m, msg); isNeedReturn || err != nil {
+	if isNeedReturn, err := checkQuickAdd(ctx, m, msg); isNeedReturn || err != nil {
 		return err
 	}
 	return m.MessageSender.SendMessage(msg.UserID, txtUnknownCommand)
 }
 
-func checkNewCategoryAdded(m *BotModel, msg Message, lastCmd string) (bool, error) {
-	if lastCmd == "/add_cat" {
-		_, err := m.UserStorage.AddUserCategory(msg.UserID, msg.Text)
+func checkNewCategoryAdded(ctx context.Context, m *BotModel, msg Message, lastCmd string) (bool, error) {
+	if lastCmd == "/add_cat" && !msg.IsCallback {
+		name := strings.TrimSpace(msg.Text)
+		if err := checkNewCategory(ctx, m, msg.UserID, name); err != nil {
+			return true, rePrompt(m, msg.UserID, err, "/add_cat", txtCatAdd)
+		}
+		err := m.UserStorage.AddUserCategory(ctx, msg.UserID, name)
 		if err != nil {
 			return true, err
 		}
@@ -122,36 +415,92 @@ func checkNewItemAdded(m *BotModel, msg Message) (bool, error) {
 	return false, nil
 }
 
-func checkNewItemNameAdded(m *BotModel, msg Message) (bool, error) {
-	if m.lastUserCat[msg.UserID] != "" && m.lastUserItemName[msg.UserID] == "" && msg.Text != "" {
+func checkNewItemNameAdded(ctx context.Context, m *BotModel, msg Message) (bool, error) {
+	if m.lastUserCat[msg.UserID] != "" && m.lastUserItemName[msg.UserID] == "" && !msg.IsCallback && (msg.Text != "" || msg.PhotoFileID != "") {
+		if isLink(msg.Text) && m.LinkInspector != nil {
+			return true, startLinkDraft(ctx, m, msg, "")
+		}
+		if msg.Text != "" {
+			if err := m.Limits.ValidateItemName(msg.Text); err != nil {
+				return true, rePrompt(m, msg.UserID, err, "", txtItemAdd)
+			}
+		}
+		if msg.PhotoFileID != "" {
+			m.lastUserItemPhoto[msg.UserID] = msg.PhotoFileID
+			if msg.Text == "" {
+				return true, m.MessageSender.SendMessage(msg.UserID, txtItemPhotoName)
+			}
+		}
 		m.lastUserItemName[msg.UserID] = msg.Text
 		return true, m.MessageSender.SendMessage(msg.UserID, txtItemUrl)
 	}
 	return false, nil
 }
 
-func checkNewItemUrlAdded(m *BotModel, msg Message) (bool, error) {
-	if m.lastUserCat[msg.UserID] != "" && m.lastUserItemName[msg.UserID] != "" {
+func checkNewItemUrlAdded(ctx context.Context, m *BotModel, msg Message) (bool, error) {
+	if m.lastUserCat[msg.UserID] != "" && m.lastUserItemName[msg.UserID] != "" && !msg.IsCallback {
+		if isLink(msg.Text) && m.LinkInspector != nil && msg.PhotoFileID == "" {
+			return true, startLinkDraft(ctx, m, msg, m.lastUserItemName[msg.UserID])
+		}
 		cat := m.lastUserCat[msg.UserID]
-		m.lastUserCat[msg.UserID] = ""
-		itemName := m.lastUserItemName[msg.UserID]
-		m.lastUserItemName[msg.UserID] = ""
-		_, err := m.UserStorage.AddWishItemToCategory(msg.UserID, cat, WishItem{
-			Name: itemName,
-			URL:  msg.Text,
-		})
+		photoFileID := m.lastUserItemPhoto[msg.UserID]
+		if msg.PhotoFileID != "" {
+			photoFileID = msg.PhotoFileID
+		}
+		item := WishItem{
+			Name:        m.lastUserItemName[msg.UserID],
+			URL:         strings.TrimSpace(msg.Text),
+			PhotoFileID: photoFileID,
+		}
+		if slices.Contains(noURLAnswers, strings.ToLower(item.URL)) {
+			item.URL = ""
+		}
+		if err := checkNewItem(ctx, m, msg.UserID, item); err != nil {
+			var invalid *ValidationError
+			if errors.As(err, &invalid) && invalid.Field == FieldURL {
+				return true, rePrompt(m, msg.UserID, err, "", txtItemUrl)
+			}
+			resetItemDialog(m, msg.UserID)
+			return true, rePrompt(m, msg.UserID, err, "", txtItemAdd)
+		}
+		resetItemDialog(m, msg.UserID)
+		cachePhoto(m, &item)
+		text := txtAddDone
+		if warning := duplicatesText(ctx, m, msg.UserID, item); warning != "" {
+			text += "\n\n" + warning
+		}
+		err := m.UserStorage.AddWishItemToCategory(ctx, msg.UserID, cat, item)
 		if err != nil {
 			return true, err
 		}
-		return true, m.MessageSender.ShowButtons(msg.UserID, txtAddDone, btnStart)
+		return true, m.MessageSender.ShowButtons(msg.UserID, text, btnStart)
 	}
 	return false, nil
 }
 
-func checkBotCommands(model *BotModel, msg Message) (bool, error) {
+// noURLAnswers skip the link step.
+var noURLAnswers = []string{"-", "нет", "no"}
+
+func resetItemDialog(m *BotModel, userId int64) {
+	m.lastUserCat[userId] = ""
+	m.lastUserItemName[userId] = ""
+	m.lastUserItemPhoto[userId] = ""
+}
+
+func cachePhoto(m *BotModel, item *WishItem) {
+	if item.PhotoFileID == "" || m.PhotoLoader == nil {
+		return
+	}
+	// The file_id alone is enough to show the photo, so a failed download is not fatal.
+	if data, err := m.PhotoLoader.LoadPhoto(item.PhotoFileID); err == nil {
+		item.PhotoData = data
+	}
+}
+
+func checkBotCommands(ctx context.Context, model *BotModel, msg Message) (bool, error) {
 	switch msg.Text {
 	case "/start":
-		if _, err := model.UserStorage.AddNewUser(msg.UserID); err != nil {
+		if err := registerUser(ctx, model, msg); err != nil {
 			return true, err
 		}
 		return true, model.MessageSender.ShowButtons(msg.UserID, txtStart, btnStart)
@@ -159,64 +508,164 @@ func checkBotCommands(model *BotModel, msg Message) (bool, error) {
 		model.lastUserCmd[msg.UserID] = "/add_cat"
 		return true, model.MessageSender.ShowButtons(msg.UserID, txtCatAdd, cancelBtn)
 	case "/add_item":
+		if err := model.Limits.CheckItemQuota(CountItems(ctx, model.UserStorage, msg.UserID), 1); err != nil {
+			return true, rePrompt(model, msg.UserID, err, "", "")
+		}
 		model.lastUserCmd[msg.UserID] = "/add_item"
-		var categoryButtons = getCategoryButtons(model.UserStorage.GetCategories(msg.UserID))
+		var categoryButtons = getCategoryButtons(model.UserStorage.GetCategories(ctx, msg.UserID), "/cat ")
 		return true, model.MessageSender.ShowButtons(msg.UserID, txtCatChoose, categoryButtons)
 	case "/show_cat":
-		categoriesString, err := getCategoryList(model, msg.UserID)
+		categoriesString, err := getCategoryList(ctx, model, msg.UserID)
 		if err != nil {
 			return true, model.MessageSender.SendMessage(msg.UserID, txtCatShowErr)
 		}
 		return true, model.MessageSender.ShowButtons(msg.UserID, categoriesString, btnStart)
 	case "/show_item":
-		list, err := getItemList(model, msg.UserID)
+		list, err := getItemList(ctx, model, msg.UserID, AudienceOwner)
 		if err != nil {
 			return false, err
 		}
+		if active, ok := model.UserStorage.GetActiveList(ctx, msg.UserID); ok {
+			list = "📋 " + active.Name + "\n" + list
+		}
+		if err := sendItemPhotos(ctx, model, msg.UserID); err != nil {
+			return true, err
+		}
 		return true, model.MessageSender.ShowButtons(msg.UserID, list, btnStart)
+	case "/share":
+		if model.ShareBaseURL == "" && model.BotUserName == "" {
+			return true, model.MessageSender.ShowButtons(msg.UserID, txtShareDisabled, btnStart)
+		}
+		if err := model.UserStorage.AddNewUser(ctx, msg.UserID); err != nil {
+			return true, err
+		}
+		token, err := model.UserStorage.GetShareToken(ctx, msg.UserID)
+		if err != nil {
+			return true, err
+		}
+		var text []string
+		if model.ShareBaseURL != "" {
+			text = append(text, fmt.Sprintf(txtShare, strings.TrimSuffix(model.ShareBaseURL, "/")+"/w/"+token))
+		}
+		if model.BotUserName != "" {
+			text = append(text, fmt.Sprintf(txtShareFollow, botLink(model, token)))
+		}
+		return true, model.MessageSender.ShowButtons(msg.UserID, strings.Join(text, "\n\n"), btnStart)
 	case "/cancel":
 		model.lastUserCmd[msg.UserID] = ""
 		model.lastUserCat[msg.UserID] = ""
 		model.lastUserItemName[msg.UserID] = ""
+		model.lastUserItemPhoto[msg.UserID] = ""
+		delete(model.drafts, msg.UserID)
+		delete(model.pendingImports, msg.UserID)
+		delete(model.eventDrafts, msg.UserID)
 		return true, model.MessageSender.ShowButtons(msg.UserID, txtChooseCmd, btnStart)
 	}
 	return false, nil
 }
 
-func getCategoryButtons(categoryList []string) []types.TgRowButtons {
+func getCategoryButtons(categoryList []string, cmdPrefix string) []types.TgRowButtons {
 	var categoryButtons = []types.TgRowButtons{}
 	for i, cat := range categoryList {
 		categoryButtons = append(categoryButtons, types.TgRowButtons{})
 		categoryButtons[i] = append(categoryButtons[i], types.TgInlineButton{
 			DisplayName: cat,
-			Value:       "/cat " + cat,
+			Value:       cmdPrefix + cat,
 		})
 	}
 	categoryButtons = append(categoryButtons, types.TgRowButtons{})
 	categoryButtons[len(categoryList)] = append(categoryButtons[len(categoryList)], types.TgInlineButton{
-		DisplayName: "Без категории",
-		Value:       "/cat default",
+		DisplayName: txtNoCategory,
+		Value:       cmdPrefix + "default",
 	})
 	return categoryButtons
 }
 
-func getCategoryList(model *BotModel, userId int64) (string, error) {
+func getCategoryList(ctx context.Context, model *BotModel, userId int64) (string, error) {
 	var result strings.Builder
 	result.WriteString(txtCatShow + "\n")
-	for i, cat := range model.UserStorage.GetCategories(userId) {
+	for i, cat := range model.UserStorage.GetCategories(ctx, userId) {
 		result.WriteString(fmt.Sprintf("%d. %s\n", i+1, cat))
 	}
 	return result.String(), nil
 }
 
-func getItemList(model *BotModel, userId int64) (string, error) {
+// getItemList renders the lists of userId as the audience may see them. The owner sees the
+// active list and also gets marks on items that are not public.
+func getItemList(ctx context.Context, model *BotModel, userId int64, audience Audience) (string, error) {
 	var result strings.Builder
 	result.WriteString(txtItemShow + "\n")
-	for cat, items := range model.UserStorage.GetWishListByCategory(userId) {
-		result.WriteString(fmt.Sprintf("Категория '%s'\n", cat))
-		for i, item := range items {
-			result.WriteString(fmt.Sprintf("%d. %s. Сайт: %s\n", i+1, item.Name, item.URL))
-		}
+	if audience == AudienceOwner {
+		list, _ := model.UserStorage.GetActiveList(ctx, userId)
+		writeItems(ctx, &result, model, list.ID, ReadWishList(ctx, model.UserStorage, list.ID, audience), audience)
+		return result.String(), nil
 	}
+	writeLists(ctx, &result, model, ReadWishLists(ctx, model.UserStorage, userId, audience))
 	return result.String(), nil
 }
+
+// writeLists renders the lists a friend sees, each as its audience may, naming them when there are several.
+func writeLists(ctx context.Context, result *strings.Builder, model *BotModel, lists []VisibleList) {
+	for _, list := range lists {
+		if len(lists) > 1 {
+			result.WriteString("📋 " + list.Name + "\n")
+		}
+		writeItems(ctx, result, model, list.ID, list.Items, list.Audience)
+	}
+}
+
+// getListText renders a single list, the one a share link points to.
+func getListText(ctx context.Context, model *BotModel, list WishList, audience Audience) string {
+	var result strings.Builder
+	result.WriteString(txtItemShow + "\n")
+	writeItems(ctx, &result, model, list.ID, ReadWishList(ctx, model.UserStorage, list.ID, audience), audience)
+	return result.String()
+}
+
+func writeItems(ctx context.Context, result *strings.Builder, model *BotModel, listId int64, wishList Categories, audience Audience) {
+	categories := model.UserStorage.GetListCategoryVisibility(ctx, listId)
+	for _, cat := range wishList {
+		result.WriteString(fmt.Sprintf("Категория '%s'\n", cat.Name))
+		n := 0
+		for _, item := range cat.Items {
+			if item.CurrentStatus() == ItemArchived {
+				continue
+			}
+			n++
+			result.WriteString(fmt.Sprintf("%d. %s. Сайт: %s", n, item.Name, item.URL))
+			if item.Price > 0 {
+				result.WriteString(". Цена: " + price.Format(item.Price, item.Currency))
+			}
+			if len(item.Tags) > 0 {
+				result.WriteString(" " + formatTags(item.Tags))
+			}
+			if mark, ok := priorityMarks[item.Priority]; ok {
+				result.WriteString(" " + mark)
+			}
+			if item.HasPhoto() {
+				result.WriteString(" 📷")
+			}
+			if v := item.Visibility.Effective(categories[cat.Name]); audience == AudienceOwner && v != VisibilityPublic {
+				result.WriteString(" " + strings.Fields(visibilityNames[v])[0])
+			}
+			if item.CurrentStatus() == ItemReceived {
+				result.WriteString(" ✅")
+			}
+			result.WriteString("\n")
+		}
+	}
+}
+
+func sendItemPhotos(ctx context.Context, model *BotModel, userId int64) error {
+	for _, cat := range model.UserStorage.GetWishListByCategory(ctx, userId) {
+		for _, item := range cat.Items {
+			if !item.Active() || !item.HasPhoto() {
+				continue
+			}
+			if err := model.MessageSender.SendPhoto(userId, item.Photo(), item.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	txtOrder         = "Порядок категорий в списке. ⬆️/⬇️ двигают категорию, нажмите на название, чтобы упорядочить хотелки в ней."
+	txtOrderCategory = "Хотелки категории «%s» в том порядке, в каком их видят друзья. Нажмите на хотелку, чтобы сменить приоритет: ❗ must-have → 💭 nice-to-have → без приоритета."
+	txtOrderBack     = "← Категории"
+)
+
+// priorityMarks are shown next to an item wherever the list is rendered.
+var priorityMarks = map[Priority]string{
+	PriorityHigh: "❗",
+	PriorityLow:  "💭",
+}
+
+// nextPriority cycles must-have → nice-to-have → none, the levels the ordering screen offers.
+func nextPriority(p Priority) Priority {
+	switch p {
+	case PriorityHigh:
+		return PriorityLow
+	case PriorityLow:
+		return PriorityNone
+	}
+	return PriorityHigh
+}
+
+// checkOrder lets the owner arrange categories and items and set their priority.
+func checkOrder(ctx context.Context, m *BotModel, msg Message) (bool, error) {
+	if msg.Text == "/order" {
+		return true, showOrder(ctx, m, msg.UserID)
+	}
+	cmd, arg, _ := strings.Cut(msg.Text, " ")
+	switch cmd {
+	case "/order_cat":
+		return true, showCategoryOrder(ctx, m, msg.UserID, arg)
+	case "/cat_up", "/cat_down":
+		return true, moveCategory(ctx, m, msg.UserID, arg, cmd == "/cat_up")
+	case "/item_up", "/item_down", "/prio":
+	default:
+		return false, nil
+	}
+	itemId, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	wishList := m.UserStorage.GetWishListByCategory(ctx, msg.UserID)
+	item, ok := wishList.Find(itemId)
+	if !ok {
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtReserveGone, btnStart)
+	}
+	catName := wishList.CategoryOf(itemId)
+	if cmd == "/prio" {
+		item.Priority = nextPriority(item.Priority)
+		if err := m.UserStorage.UpdateWishItem(ctx, msg.UserID, item); err != nil {
+			return true, err
+		}
+		return true, showCategoryOrder(ctx, m, msg.UserID, catName)
+	}
+	// Received items are not shown here, so the item swaps places with its visible neighbour.
+	items := wishList.Items(catName)
+	var visible []int
+	for i, it := range items {
+		if it.Active() || it.ID == itemId {
+			visible = append(visible, i)
+		}
+	}
+	k := slices.IndexFunc(visible, func(i int) bool { return items[i].ID == itemId })
+	if cmd == "/item_up" {
+		k--
+	} else {
+		k++
+	}
+	if k >= 0 && k < len(visible) {
+		if err := m.UserStorage.MoveWishItem(ctx, msg.UserID, itemId, catName, visible[k]); err != nil {
+			return true, err
+		}
+	}
+	return true, showCategoryOrder(ctx, m, msg.UserID, catName)
+}
+
+// moveCategory shifts a category by one. The default category always stays first,
+// so positions are counted among the named ones, as MoveUserCategory does.
+func moveCategory(ctx context.Context, m *BotModel, userId int64, catName string, up bool) error {
+	names := m.UserStorage.GetCategories(ctx, userId)
+	position := slices.Index(names, catName)
+	if position == -1 {
+		return m.MessageSender.ShowButtons(userId, txtPrivacyNoCat, btnStart)
+	}
+	if up {
+		position--
+	} else {
+		position++
+	}
+	if position >= 0 && position < len(names) {
+		if err := m.UserStorage.MoveUserCategory(ctx, userId, catName, position); err != nil {
+			return err
+		}
+	}
+	return showOrder(ctx, m, userId)
+}
+
+func showOrder(ctx context.Context, m *BotModel, userId int64) error {
+	buttons := []types.TgRowButtons{{types.TgInlineButton{DisplayName: txtNoCategory, Value: "/order_cat default"}}}
+	for _, name := range m.UserStorage.GetCategories(ctx, userId) {
+		buttons = append(buttons, types.TgRowButtons{
+			types.TgInlineButton{DisplayName: name, Value: "/order_cat " + name},
+			types.TgInlineButton{DisplayName: "⬆️", Value: "/cat_up " + name},
+			types.TgInlineButton{DisplayName: "⬇️", Value: "/cat_down " + name},
+		})
+	}
+	return m.MessageSender.ShowButtons(userId, txtOrder, append(buttons, btnStart...))
+}
+
+func showCategoryOrder(ctx context.Context, m *BotModel, userId int64, catName string) error {
+	items, ok := m.UserStorage.GetWishListByCategory(ctx, userId).Get(catName)
+	if !ok {
+		return m.MessageSender.ShowButtons(userId, txtPrivacyNoCat, btnStart)
+	}
+	buttons := make([]types.TgRowButtons, 0, len(items)+1)
+	for _, item := range items {
+		if !item.Active() {
+			continue
+		}
+		name := item.Name
+		if mark, ok := priorityMarks[item.Priority]; ok {
+			name = mark + " " + name
+		}
+		buttons = append(buttons, types.TgRowButtons{
+			types.TgInlineButton{DisplayName: name, Value: fmt.Sprintf("/prio %d", item.ID)},
+			types.TgInlineButton{DisplayName: "⬆️", Value: fmt.Sprintf("/item_up %d", item.ID)},
+			types.TgInlineButton{DisplayName: "⬇️", Value: fmt.Sprintf("/item_down %d", item.ID)},
+		})
+	}
+	buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{DisplayName: txtOrderBack, Value: "/order"}})
+	return m.MessageSender.ShowButtons(userId, fmt.Sprintf(txtOrderCategory, categoryTitle(catName)), buttons)
+}
@@ -0,0 +1,97 @@
+package messages_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func categoryOrder(wishList messages.Categories) []string {
+	var names []string
+	for _, cat := range wishList {
+		names = append(names, cat.Name)
+	}
+	return names
+}
+
+func TestBotModel_Order(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	send := func(text string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: ownerId, UserID: ownerId}))
+	}
+	err = storage.AddNewUser(ctx, ownerId)
+	require.NoError(t, err)
+	err = storage.ImportWishList(ctx, ownerId, messages.Categories{
+		{Name: "Книги", Items: []messages.WishItem{{Name: "Дюна"}, {Name: "Солярис"}, {Name: "Гиперион"}}},
+		{Name: "Игры", Items: []messages.WishItem{{Name: "Катан"}}},
+	})
+	require.NoError(t, err)
+	books := storage.GetWishListByCategory(ctx, ownerId).Items("Книги")
+
+	t.Run("Should render categories in a stable order", func(t *testing.T) {
+		send("/show_item")
+		first := sender.last().text
+		for i := 0; i < 10; i++ {
+			send("/show_item")
+			require.Equal(t, first, sender.last().text)
+		}
+		require.Less(t, strings.Index(first, "Книги"), strings.Index(first, "Игры"))
+	})
+
+	t.Run("Should move categories but keep the default one first", func(t *testing.T) {
+		send("/cat_down Книги")
+		require.Equal(t, []string{"default", "Игры", "Книги"}, categoryOrder(storage.GetWishListByCategory(ctx, ownerId)))
+		send("/cat_up Игры")
+		require.Equal(t, []string{"default", "Игры", "Книги"}, categoryOrder(storage.GetWishListByCategory(ctx, ownerId)), "The first named category can't go up")
+	})
+
+	t.Run("Should move items by one", func(t *testing.T) {
+		names := func() []string {
+			var result []string
+			for _, item := range storage.GetWishListByCategory(ctx, ownerId).Items("Книги") {
+				result = append(result, item.Name)
+			}
+			return result
+		}
+		send(fmt.Sprintf("/item_up %d", books[2].ID))
+		require.Equal(t, []string{"Дюна", "Гиперион", "Солярис"}, names())
+		send(fmt.Sprintf("/item_down %d", books[0].ID))
+		require.Equal(t, []string{"Гиперион", "Дюна", "Солярис"}, names())
+		send(fmt.Sprintf("/item_down %d", books[1].ID))
+		require.Equal(t, []string{"Гиперион", "Дюна", "Солярис"}, names(), "The last item can't go down")
+	})
+
+	t.Run("Should skip received items when moving", func(t *testing.T) {
+		send(fmt.Sprintf("/got %d", books[0].ID))
+		send(fmt.Sprintf("/item_up %d", books[1].ID))
+		var names []string
+		for _, item := range storage.GetWishListByCategory(ctx, ownerId).Items("Книги") {
+			if item.Active() {
+				names = append(names, item.Name)
+			}
+		}
+		require.Equal(t, []string{"Солярис", "Гиперион"}, names)
+	})
+
+	t.Run("Should cycle priority and mark it in the list", func(t *testing.T) {
+		prio := fmt.Sprintf("/prio %d", books[2].ID)
+		send(prio)
+		item, _ := storage.GetWishListByCategory(ctx, ownerId).Find(books[2].ID)
+		require.Equal(t, messages.PriorityHigh, item.Priority)
+		require.Equal(t, "❗ Гиперион", sender.last().buttons[1][0].DisplayName)
+		send(prio)
+		send("/show_item")
+		require.Contains(t, sender.last().text, "Гиперион. Сайт:  💭")
+		send(prio)
+		send("/show_item")
+		require.NotContains(t, sender.last().text, "💭")
+	})
+}
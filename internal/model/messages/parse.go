@@ -0,0 +1,119 @@
+package messages
+
+import (
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type Priority int
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityNormal
+	PriorityHigh
+)
+
+var priorityWords = map[string]Priority{
+	"низкий":        PriorityLow,
+	"low":           PriorityLow,
+	"nice-to-have":  PriorityLow,
+	"необязательно": PriorityLow,
+	"средний":       PriorityNormal,
+	"обычный":       PriorityNormal,
+	"normal":        PriorityNormal,
+	"высокий":       PriorityHigh,
+	"важно":         PriorityHigh,
+	"high":          PriorityHigh,
+	"must-have":     PriorityHigh,
+	"обязательно":   PriorityHigh,
+	"!":             PriorityHigh,
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "низкий"
+	case PriorityNormal:
+		return "средний"
+	case PriorityHigh:
+		return "высокий"
+	}
+	return ""
+}
+
+type ParsedItem struct {
+	Item     WishItem
+	Category string
+}
+
+const currencyPattern = `₽|руб(?:лей|ля|ль|\.)?|р\.|rub|rur|usd|eur|\$|€|£|₸`
+
+var (
+	reLink        = regexp.MustCompile(`https?://\S+`)
+	rePriceSuffix = regexp.MustCompile(`(?i)(^|[^\p{L}\p{N}])(\d{1,3}(?:[ \x{00a0}\x{202f}]\d{3})+|\d+)([.,]\d{1,2})?\s*(` + currencyPattern + `)(?:$|[^\p{L}\p{N}-])`)
+	rePricePrefix = regexp.MustCompile(`(\$|€|£)\s*(\d{1,3}(?:[ ,]\d{3})+|\d+)([.,]\d{1,2})?`)
+	reSpaces      = regexp.MustCompile(`\s+`)
+)
+
+// ParseItemText turns a free form message like
+// "Lego Technic 42100 https://ozon.ru/... 15 990 ₽ #игрушки #для_сына !высокий // на день рождения"
+// into an item. The first hashtag is the category, the rest are tags, and text after "//" is a note.
+// Numbers only count as a price when a currency is attached, so model numbers stay in the name.
+func ParseItemText(text string) (ParsedItem, bool) {
+	var result ParsedItem
+	if link := reLink.FindString(text); link != "" {
+		result.Item.URL = strings.TrimRight(link, ".,;)")
+		text = strings.Replace(text, link, " ", 1)
+	}
+	if before, note, ok := strings.Cut(text, "//"); ok {
+		result.Item.Note = strings.TrimSpace(note)
+		text = before
+	}
+	if match := rePriceSuffix.FindStringSubmatchIndex(text); match != nil {
+		amount, ok := price.Parse(text[match[4]:match[5]] + submatch(text, match, 3))
+		if ok {
+			result.Item.Price = amount
+			result.Item.Currency = price.NormalizeCurrency(text[match[8]:match[9]])
+			// RE2 has no lookaround, so the characters around the price are matched too. Keep them.
+			text = text[:match[3]] + " " + text[match[9]:]
+		}
+	} else if match := rePricePrefix.FindStringSubmatchIndex(text); match != nil {
+		amount, ok := price.Parse(text[match[4]:match[5]] + submatch(text, match, 3))
+		if ok {
+			result.Item.Price = amount
+			result.Item.Currency = price.NormalizeCurrency(text[match[2]:match[3]])
+			text = text[:match[0]] + " " + text[match[1]:]
+		}
+	}
+	var nameParts []string
+	for _, word := range strings.Fields(text) {
+		switch {
+		case strings.HasPrefix(word, "#") && len(word) > 1:
+			if result.Category == "" {
+				result.Category = strings.ReplaceAll(word[1:], "_", " ")
+			} else if tag := strings.ToLower(word[1:]); !slices.Contains(result.Item.Tags, tag) {
+				result.Item.Tags = append(result.Item.Tags, tag)
+			}
+		case strings.HasPrefix(word, "!") && len(word) > 1:
+			if p, ok := priorityWords[strings.ToLower(word[1:])]; ok {
+				result.Item.Priority = p
+			} else {
+				nameParts = append(nameParts, word)
+			}
+		default:
+			nameParts = append(nameParts, word)
+		}
+	}
+	result.Item.Name = strings.Trim(reSpaces.ReplaceAllString(strings.Join(nameParts, " "), " "), " ,-—:")
+	return result, result.Item.Name != "" || result.Item.URL != ""
+}
+
+func submatch(text string, match []int, group int) string {
+	if match[2*group] < 0 {
+		return ""
+	}
+	return text[match[2*group]:match[2*group+1]]
+}
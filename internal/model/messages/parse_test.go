@@ -0,0 +1,101 @@
+package messages
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseItemText(t *testing.T) {
+	t.Run("Should parse all parts of a full message", func(t *testing.T) {
+		parsed, ok := ParseItemText("Lego Technic 42100 https://ozon.ru/product/lego-42100/?sh=abc 15 990 ₽ #игрушки !высокий")
+		require.True(t, ok)
+		require.Equal(t, "Lego Technic 42100", parsed.Item.Name)
+		require.Equal(t, "https://ozon.ru/product/lego-42100/?sh=abc", parsed.Item.URL)
+		require.Equal(t, int64(1599000), parsed.Item.Price)
+		require.Equal(t, "RUB", parsed.Item.Currency)
+		require.Equal(t, "игрушки", parsed.Category)
+		require.Equal(t, PriorityHigh, parsed.Item.Priority)
+	})
+
+	t.Run("Should parse tags and a note", func(t *testing.T) {
+		parsed, ok := ParseItemText("Самокат https://example.com/scooter #спорт #Для_сына #детям #для_сына // синий, не электрический")
+		require.True(t, ok)
+		require.Equal(t, "Самокат", parsed.Item.Name)
+		require.Equal(t, "https://example.com/scooter", parsed.Item.URL)
+		require.Equal(t, "спорт", parsed.Category)
+		require.Equal(t, []string{"для_сына", "детям"}, parsed.Item.Tags)
+		require.Equal(t, "синий, не электрический", parsed.Item.Note)
+	})
+
+	t.Run("Should keep numbers without currency in the name", func(t *testing.T) {
+		parsed, ok := ParseItemText("iPhone 15 Pro 256")
+		require.True(t, ok)
+		require.Equal(t, "iPhone 15 Pro 256", parsed.Item.Name)
+		require.Zero(t, parsed.Item.Price)
+	})
+
+	t.Run("Should not take words starting with a currency for one", func(t *testing.T) {
+		for _, text := range []string{"Футболка 2 рубашка", "Монета 1 рубль-в-рубль", "Кошелёк 100 usdt"} {
+			parsed, ok := ParseItemText(text)
+			require.True(t, ok)
+			require.Equal(t, text, parsed.Item.Name)
+			require.Zero(t, parsed.Item.Price)
+		}
+	})
+
+	t.Run("Should not start a price inside a model number", func(t *testing.T) {
+		parsed, ok := ParseItemText("Lego 42100 100 ₽")
+		require.True(t, ok)
+		require.Equal(t, "Lego 42100", parsed.Item.Name)
+		require.Equal(t, int64(10000), parsed.Item.Price)
+
+		parsed, ok = ParseItemText("Наушники WH1000 25 990 ₽")
+		require.True(t, ok)
+		require.Equal(t, "Наушники WH1000", parsed.Item.Name)
+		require.Equal(t, int64(2599000), parsed.Item.Price)
+	})
+
+	t.Run("Should keep what follows a currency", func(t *testing.T) {
+		parsed, ok := ParseItemText("Чайник 2500₽#кухня")
+		require.True(t, ok)
+		require.Equal(t, "Чайник", parsed.Item.Name)
+		require.Equal(t, int64(250000), parsed.Item.Price)
+		require.Equal(t, "кухня", parsed.Category)
+	})
+
+	t.Run("Should parse currency written before amount", func(t *testing.T) {
+		parsed, ok := ParseItemText("Steam Deck $549.99")
+		require.True(t, ok)
+		require.Equal(t, "Steam Deck", parsed.Item.Name)
+		require.Equal(t, int64(54999), parsed.Item.Price)
+		require.Equal(t, "USD", parsed.Item.Currency)
+	})
+
+	t.Run("Should parse currency words and decimals", func(t *testing.T) {
+		parsed, ok := ParseItemText("Книга 799,50 руб. #книги_и_комиксы")
+		require.True(t, ok)
+		require.Equal(t, "Книга", parsed.Item.Name)
+		require.Equal(t, int64(79950), parsed.Item.Price)
+		require.Equal(t, "RUB", parsed.Item.Currency)
+		require.Equal(t, "книги и комиксы", parsed.Category)
+	})
+
+	t.Run("Should accept a bare link", func(t *testing.T) {
+		parsed, ok := ParseItemText("https://www.wildberries.ru/catalog/12345/detail.aspx")
+		require.True(t, ok)
+		require.Empty(t, parsed.Item.Name)
+		require.Equal(t, "https://www.wildberries.ru/catalog/12345/detail.aspx", parsed.Item.URL)
+	})
+
+	t.Run("Should leave unknown exclamations in the name", func(t *testing.T) {
+		parsed, ok := ParseItemText("Торт !срочно")
+		require.True(t, ok)
+		require.Equal(t, "Торт !срочно", parsed.Item.Name)
+		require.Equal(t, PriorityNone, parsed.Item.Priority)
+	})
+
+	t.Run("Shouldn't parse message with only tags", func(t *testing.T) {
+		_, ok := ParseItemText("#игрушки !высокий")
+		require.False(t, ok)
+	})
+}
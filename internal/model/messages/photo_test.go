@@ -0,0 +1,113 @@
+package messages_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeInspector struct{}
+
+func (fakeInspector) InspectLink(url string) (messages.WishItem, error) {
+	return messages.WishItem{Name: "Термос", URL: url}, nil
+}
+
+// fileLoader downloads photos from a file server the way the Telegram client does.
+type fileLoader struct {
+	baseURL string
+}
+
+func (l fileLoader) LoadPhoto(fileID string) ([]byte, error) {
+	resp, err := http.Get(l.baseURL + "/" + fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func TestBotModel_Photos(t *testing.T) {
+	ctx := context.Background()
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/photo-1" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("jpeg"))
+	}))
+	defer files.Close()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	model.PhotoLoader = fileLoader{baseURL: files.URL}
+	require.NoError(t, storage.AddNewUser(ctx, ownerId))
+	addPhotoItem := func(name, fileID string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/cat default", UserID: ownerId, IsCallback: true}))
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: name, PhotoFileID: fileID, UserID: ownerId}))
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "-", UserID: ownerId}))
+	}
+
+	t.Run("Should keep the downloaded photo with the item", func(t *testing.T) {
+		addPhotoItem("Кружка", "photo-1")
+		items := storage.GetWishListByCategory(ctx, ownerId).Items("default")
+		require.Len(t, items, 1)
+		require.Equal(t, "photo-1", items[0].PhotoFileID)
+		require.Equal(t, []byte("jpeg"), items[0].PhotoData)
+	})
+
+	t.Run("Should save the item when the photo can't be downloaded", func(t *testing.T) {
+		addPhotoItem("Плед", "photo-2")
+		items := storage.GetWishListByCategory(ctx, ownerId).Items("default")
+		require.Len(t, items, 2)
+		require.Equal(t, "photo-2", items[1].PhotoFileID)
+		require.Empty(t, items[1].PhotoData)
+	})
+
+	t.Run("Should send the photos with the list", func(t *testing.T) {
+		sender.photos = nil
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/show_item", UserID: ownerId}))
+		require.Equal(t, []types.TgPhoto{
+			{FileID: "photo-1", Data: []byte("jpeg")},
+			{FileID: "photo-2"},
+		}, sender.photos)
+		require.Contains(t, sender.last().text, "1. Кружка. Сайт:  📷")
+	})
+
+	t.Run("Should report a photo that can't be sent", func(t *testing.T) {
+		sender.photoErr = errors.New("blocked")
+		defer func() { sender.photoErr = nil }()
+		require.ErrorContains(t, model.OnMessage(ctx, messages.Message{Text: "/show_item", UserID: ownerId}), "blocked")
+	})
+
+	t.Run("Should keep a photo sent with a link as its caption", func(t *testing.T) {
+		model.LinkInspector = fakeInspector{}
+		defer func() { model.LinkInspector = nil }()
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/cat default", UserID: ownerId, IsCallback: true}))
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "https://example.com/thermos", PhotoFileID: "photo-3", UserID: ownerId}))
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/draft_save", UserID: ownerId, IsCallback: true}))
+		items := storage.GetWishListByCategory(ctx, ownerId).Items("default")
+		require.Len(t, items, 3)
+		require.Equal(t, "Термос", items[2].Name)
+		require.Equal(t, "photo-3", items[2].PhotoFileID)
+	})
+
+	t.Run("Should not send photos of received wishes", func(t *testing.T) {
+		items := storage.GetWishListByCategory(ctx, ownerId).Items("default")
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: fmt.Sprintf("/got %d", items[0].ID), UserID: ownerId}))
+		sender.photos = nil
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/show_item", UserID: ownerId}))
+		require.Equal(t, []types.TgPhoto{{FileID: "photo-2"}, {FileID: "photo-3"}}, sender.photos)
+	})
+}
@@ -0,0 +1,258 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Pledge is a friend's contribution to an item gifted together. The first friend to pledge
+// organises the collection.
+type Pledge struct {
+	OwnerID int64
+	ItemID  int64
+	UserID  int64
+	Amount  int64
+	// Public pledges show the friend's name and amount to the other participants.
+	Public bool
+}
+
+var pledgeSteps = []int64{50000, 100000, 200000, 500000}
+
+const (
+	txtPledgeNoPrice    = "У хотелки «%s» не указана цена, собрать на неё не получится"
+	txtPledgeOwn        = "Это ваша хотелка, на неё скидываются друзья"
+	txtPledgeReserved   = "«%s» уже кто-то забронировал"
+	txtPledgeAmount     = "Сколько вы готовы вложить? Например: 1500"
+	txtPledgeBadAmount  = "Не получилось разобрать сумму. Пример: 1500"
+	txtPledgeReached    = "🎉 На «%s» для %s собрано %s из %s!\n%s"
+	txtPledgeOrganizer  = "Вы организатор: договоритесь с участниками, как передать деньги и кто купит подарок."
+	txtPledgeContact    = "Организатор сбора — %s, свяжитесь с ним(ней), чтобы передать деньги."
+	txtPledgeCollecting = "На «%s» уже собирают вместе — присоединяйтесь через 🤝"
+)
+
+// checkPledge handles the private part of "собрать вместе": the collection card, pledging,
+// withdrawing and choosing whether other participants see the name.
+func checkPledge(ctx context.Context, m *BotModel, msg Message, lastCmd string) (bool, error) {
+	if args, ok := strings.CutPrefix(lastCmd, "/pledge_amount "); ok && !msg.IsCallback {
+		amount, _, ok := ParseBudget(msg.Text)
+		if !ok {
+			m.lastUserCmd[msg.UserID] = lastCmd
+			return true, m.MessageSender.ShowButtons(msg.UserID, txtPledgeBadAmount, cancelBtn)
+		}
+		ids, _ := parseIds(args)
+		return true, pledge(ctx, m, msg.UserID, ids, func(p *Pledge) { p.Amount = amount })
+	}
+	cmd, args, _ := strings.Cut(msg.Text, " ")
+	ids, ok := parseIds(args)
+	if !ok || len(ids) < 2 {
+		return false, nil
+	}
+	switch cmd {
+	case "/chip":
+		return true, showCollection(ctx, m, msg.UserID, ids[0], ids[1])
+	case "/pledge":
+		if len(ids) != 3 || ids[2] <= 0 {
+			return false, nil
+		}
+		return true, pledge(ctx, m, msg.UserID, ids, func(p *Pledge) { p.Amount = ids[2] })
+	case "/pledge_other":
+		m.lastUserCmd[msg.UserID] = fmt.Sprintf("/pledge_amount %d %d", ids[0], ids[1])
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtPledgeAmount, cancelBtn)
+	case "/pledge_public":
+		return true, pledge(ctx, m, msg.UserID, ids, func(p *Pledge) { p.Public = !p.Public })
+	case "/pledge_cancel":
+		return true, pledge(ctx, m, msg.UserID, ids, func(p *Pledge) { p.Amount = 0 })
+	}
+	return false, nil
+}
+
+// collectableItem checks that userId may chip in for the item and returns the refusal otherwise.
+func collectableItem(ctx context.Context, m *BotModel, userId, ownerId, itemId int64) (WishItem, string) {
+	if ownerId == userId {
+		return WishItem{}, txtPledgeOwn
+	}
+	item, ok := findItem(ReadWishListsFor(ctx, m.UserStorage, ownerId, userId), itemId)
+	switch {
+	case !ok:
+		return WishItem{}, txtReserveGone
+	case item.Price <= 0:
+		return WishItem{}, fmt.Sprintf(txtPledgeNoPrice, item.Name)
+	case item.ReservedBy != 0 && !hasPledged(m.UserStorage.GetPledges(ctx, ownerId, itemId), item.ReservedBy):
+		return WishItem{}, fmt.Sprintf(txtPledgeReserved, item.Name)
+	}
+	return item, ""
+}
+
+// hasPledged tells a reservation made by a finished collection from an ordinary one.
+func hasPledged(pledges []Pledge, userId int64) bool {
+	return slices.ContainsFunc(pledges, func(p Pledge) bool { return p.UserID == userId })
+}
+
+func pledge(ctx context.Context, m *BotModel, userId int64, ids []int64, change func(p *Pledge)) error {
+	ownerId, itemId := ids[0], ids[1]
+	item, refusal := collectableItem(ctx, m, userId, ownerId, itemId)
+	if refusal != "" {
+		return m.MessageSender.SendMessage(userId, refusal)
+	}
+	pledges := m.UserStorage.GetPledges(ctx, ownerId, itemId)
+	before := pledgedTotal(pledges)
+	p := Pledge{OwnerID: ownerId, ItemID: itemId, UserID: userId}
+	for _, existing := range pledges {
+		if existing.UserID == userId {
+			p = existing
+		}
+	}
+	own := p.Amount
+	change(&p)
+	if p.Amount > own {
+		// Nobody needs to give more than what's left to collect.
+		p.Amount = min(p.Amount, max(item.Price-(before-own), own))
+	}
+	if err := m.UserStorage.SetPledge(ctx, p); err != nil {
+		return err
+	}
+	reservedByCollection := item.ReservedBy != 0
+	pledges = m.UserStorage.GetPledges(ctx, ownerId, itemId)
+	after := pledgedTotal(pledges)
+	var notifyErr error
+	switch {
+	case before < item.Price && after >= item.Price:
+		notifyErr = collectionReached(ctx, m, item, pledges)
+	case reservedByCollection && after < item.Price:
+		// Somebody withdrew, the item is free again until the sum is collected.
+		item.ReservedBy = 0
+		if err := m.UserStorage.UpdateWishItem(ctx, ownerId, item); err != nil {
+			return err
+		}
+	case reservedByCollection && !hasPledged(pledges, item.ReservedBy):
+		// The organiser left, the next participant takes over the reservation.
+		item.ReservedBy = pledges[0].UserID
+		if err := m.UserStorage.UpdateWishItem(ctx, ownerId, item); err != nil {
+			return err
+		}
+	}
+	return errors.Join(notifyErr, showCollection(ctx, m, userId, ownerId, itemId))
+}
+
+// collectionReached reserves the item for the organiser, so nobody buys it separately,
+// and tells every participant who collects the money.
+func collectionReached(ctx context.Context, m *BotModel, item WishItem, pledges []Pledge) error {
+	organizer := pledges[0].UserID
+	item.ReservedBy = organizer
+	if err := m.UserStorage.UpdateWishItem(ctx, pledges[0].OwnerID, item); err != nil {
+		return err
+	}
+	total := price.Format(pledgedTotal(pledges), item.Currency)
+	target := price.Format(item.Price, item.Currency)
+	owner := OwnerName(ctx, m.UserStorage, pledges[0].OwnerID)
+	// The reached transition happens once, a participant who can't be told now never will be,
+	// so one failure mustn't keep the rest from knowing who the organiser is.
+	var errs []error
+	for _, p := range pledges {
+		note := fmt.Sprintf(txtPledgeContact, OwnerName(ctx, m.UserStorage, organizer))
+		if p.UserID == organizer {
+			note = txtPledgeOrganizer + "\n" + pledgeParticipants(ctx, m, pledges, item.Currency)
+		}
+		if err := m.MessageSender.SendMessage(p.UserID, fmt.Sprintf(txtPledgeReached, item.Name, owner, total, target, note)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func showCollection(ctx context.Context, m *BotModel, userId, ownerId, itemId int64) error {
+	item, refusal := collectableItem(ctx, m, userId, ownerId, itemId)
+	if refusal != "" {
+		return m.MessageSender.SendMessage(userId, refusal)
+	}
+	pledges := m.UserStorage.GetPledges(ctx, ownerId, itemId)
+	total := pledgedTotal(pledges)
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🤝 Собираем вместе на «%s» для %s\n", item.Name, OwnerName(ctx, m.UserStorage, ownerId)))
+	b.WriteString(fmt.Sprintf("%s %s из %s\n", progressBar(total, item.Price), price.Format(total, item.Currency), price.Format(item.Price, item.Currency)))
+	if len(pledges) > 0 {
+		b.WriteString(pledgeParticipants(ctx, m, pledges, item.Currency))
+	}
+	var mine *Pledge
+	for i := range pledges {
+		if pledges[i].UserID == userId {
+			mine = &pledges[i]
+		}
+	}
+	if mine != nil {
+		visibility := "видно только вам"
+		if mine.Public {
+			visibility = "видно участникам"
+		}
+		b.WriteString(fmt.Sprintf("\nВаш взнос: %s (%s)", price.Format(mine.Amount, item.Currency), visibility))
+	}
+	ids := fmt.Sprintf("%d %d", ownerId, itemId)
+	buttons := make([]types.TgRowButtons, 0)
+	if remaining := item.Price - total; remaining > 0 {
+		row := types.TgRowButtons{}
+		for _, step := range pledgeSteps {
+			if step < remaining && len(row) < 3 {
+				row = append(row, types.TgInlineButton{DisplayName: price.Format(step, item.Currency), Value: fmt.Sprintf("/pledge %s %d", ids, step)})
+			}
+		}
+		row = append(row, types.TgInlineButton{DisplayName: "Остаток " + price.Format(remaining, item.Currency), Value: fmt.Sprintf("/pledge %s %d", ids, remaining)})
+		buttons = append(buttons, row, types.TgRowButtons{types.TgInlineButton{DisplayName: "✏️ Другая сумма", Value: "/pledge_other " + ids}})
+	}
+	if mine != nil {
+		toggle := "👁 Показать моё имя"
+		if mine.Public {
+			toggle = "🙈 Скрыть моё имя"
+		}
+		buttons = append(buttons, types.TgRowButtons{
+			types.TgInlineButton{DisplayName: toggle, Value: "/pledge_public " + ids},
+			types.TgInlineButton{DisplayName: "❌ Забрать взнос", Value: "/pledge_cancel " + ids},
+		})
+	}
+	return m.MessageSender.ShowButtons(userId, b.String(), append(buttons, btnStart...))
+}
+
+// pledgeParticipants lists public pledges by name and sums up the anonymous ones.
+func pledgeParticipants(ctx context.Context, m *BotModel, pledges []Pledge, currency string) string {
+	var names []string
+	var hidden, hiddenSum int64
+	for _, p := range pledges {
+		if p.Public {
+			names = append(names, OwnerName(ctx, m.UserStorage, p.UserID)+" — "+price.Format(p.Amount, currency))
+		} else {
+			hidden++
+			hiddenSum += p.Amount
+		}
+	}
+	if hidden > 0 {
+		names = append(names, fmt.Sprintf("анонимно (%d) — %s", hidden, price.Format(hiddenSum, currency)))
+	}
+	return "Участники: " + strings.Join(names, "; ")
+}
+
+func pledgedTotal(pledges []Pledge) int64 {
+	var total int64
+	for _, p := range pledges {
+		if p.Amount > math.MaxInt64-total {
+			return math.MaxInt64
+		}
+		total += p.Amount
+	}
+	return total
+}
+
+func progressBar(done, target int64) string {
+	const width = 10
+	done = max(min(done, target), 0)
+	for target > math.MaxInt64/100 {
+		done, target = done/2, target/2
+	}
+	filled := int(done * width / target)
+	return strings.Repeat("▓", filled) + strings.Repeat("░", width-filled) + " " + strconv.FormatInt(done*100/target, 10) + "%"
+}
@@ -0,0 +1,178 @@
+package messages_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestBotModel_Pledges(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	for id, name := range map[int64]string{1: "Аня", 2: "Боря", 3: "Вика", 4: "Гоша"} {
+		err := storage.AddNewUser(ctx, id)
+		require.NoError(t, err)
+		err = storage.SetUserName(ctx, id, name)
+		require.NoError(t, err)
+	}
+	err = storage.AddWishItem(ctx, 1, messages.WishItem{Name: "Велосипед", Price: 3000000, Currency: "RUB"})
+	require.NoError(t, err)
+	itemId := storage.GetWishListByCategory(ctx, 1).Items("default")[0].ID
+	send := func(userId int64, format string, args ...any) {
+		text := fmt.Sprintf(format, args...)
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: userId, UserID: userId}))
+	}
+	reservedBy := func() int64 {
+		return storage.GetWishListByCategory(ctx, 1).Items("default")[0].ReservedBy
+	}
+
+	t.Run("Should not let the owner see the collection", func(t *testing.T) {
+		send(1, "/chip 1 %d", itemId)
+		require.Equal(t, "Это ваша хотелка, на неё скидываются друзья", sender.last().text)
+	})
+
+	t.Run("Should show progress without names by default", func(t *testing.T) {
+		send(2, "/pledge 1 %d 1000000", itemId)
+		send(3, "/pledge_other 1 %d", itemId)
+		send(3, "5 000")
+		text := sender.last().text
+		require.Contains(t, text, "▓▓▓▓▓░░░░░ 50% 15 000 ₽ из 30 000 ₽")
+		require.Contains(t, text, "Участники: анонимно (2) — 15 000 ₽")
+		require.Contains(t, text, "Ваш взнос: 5 000 ₽ (видно только вам)")
+	})
+
+	t.Run("Should show names of those who opted in", func(t *testing.T) {
+		send(3, "/pledge_public 1 %d", itemId)
+		require.Contains(t, sender.last().text, "Участники: Вика — 5 000 ₽; анонимно (1) — 10 000 ₽")
+	})
+
+	t.Run("Should notify participants when the target is reached", func(t *testing.T) {
+		sender.sent = nil
+		send(4, "/pledge 1 %d 1500000", itemId)
+		require.Len(t, sender.sent, 4, "Three notifications and the card")
+		require.Equal(t, int64(2), sender.sent[0].chatId)
+		require.Contains(t, sender.sent[0].text, "🎉 На «Велосипед» для Аня собрано 30 000 ₽ из 30 000 ₽!\nВы организатор")
+		require.Contains(t, sender.sent[1].text, "Организатор сбора — Боря")
+		require.Equal(t, int64(2), reservedBy(), "Collected item should be reserved for the organiser")
+	})
+
+	t.Run("Should free the item when the sum drops below the target", func(t *testing.T) {
+		send(4, "/pledge_cancel 1 %d", itemId)
+		require.Zero(t, reservedBy())
+		require.Contains(t, sender.last().text, "15 000 ₽ из 30 000 ₽")
+	})
+
+	t.Run("Should hand the reservation over when the organiser leaves", func(t *testing.T) {
+		send(4, "/pledge 1 %d 2500000", itemId)
+		require.Equal(t, int64(2), reservedBy())
+		require.Contains(t, sender.last().text, "Ваш взнос: 15 000 ₽", "The pledge should stop at the remaining sum")
+		item := storage.GetWishListByCategory(ctx, 1).Items("default")[0]
+		item.Price = 2000000
+		require.NoError(t, storage.UpdateWishItem(ctx, 1, item))
+		send(2, "/pledge_cancel 1 %d", itemId)
+		require.Equal(t, int64(3), reservedBy())
+	})
+}
+
+func TestBotModel_PledgeOversized(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	for _, id := range []int64{1, 2, 3} {
+		require.NoError(t, storage.AddNewUser(ctx, id))
+	}
+	require.NoError(t, storage.AddWishItem(ctx, 1, messages.WishItem{Name: "Книга", Price: 100000, Currency: "RUB"}))
+	itemId := storage.GetWishListByCategory(ctx, 1).Items("default")[0].ID
+	send := func(userId int64, text string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: userId, UserID: userId}))
+	}
+
+	t.Run("Should cap pledges at the remaining sum", func(t *testing.T) {
+		send(2, fmt.Sprintf("/pledge_other 1 %d", itemId))
+		send(2, "400")
+		send(2, fmt.Sprintf("/pledge 1 %d 9223372036854775807", itemId))
+		send(3, fmt.Sprintf("/pledge 1 %d 4611686018427387903", itemId))
+		require.Contains(t, sender.last().text, "▓▓▓▓▓▓▓▓▓▓ 100% 1 000 ₽ из 1 000 ₽")
+		var total int64
+		for _, p := range storage.GetPledges(ctx, 1, itemId) {
+			total += p.Amount
+		}
+		require.Equal(t, int64(100000), total)
+	})
+
+	t.Run("Should cap an amount typed in", func(t *testing.T) {
+		send(2, fmt.Sprintf("/pledge_cancel 1 %d", itemId))
+		send(3, fmt.Sprintf("/pledge_other 1 %d", itemId))
+		send(3, "50 000 000")
+		require.Contains(t, sender.last().text, "Ваш взнос: 1 000 ₽")
+	})
+}
+
+func TestBotModel_PledgeReserveConflict(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	err = storage.AddNewUser(ctx, 1)
+	require.NoError(t, err)
+	err = storage.AddWishItem(ctx, 1, messages.WishItem{Name: "Книга", Price: 100000})
+	require.NoError(t, err)
+	item := storage.GetWishListByCategory(ctx, 1).Items("default")[0]
+	group := func(userId int64, text string) messages.Message {
+		return messages.Message{Text: text, ChatID: -1, UserID: userId}
+	}
+
+	require.NoError(t, model.OnMessage(ctx, group(2, fmt.Sprintf("/reserve 1 %d", item.ID))))
+	require.NoError(t, model.OnMessage(ctx, messages.Message{Text: fmt.Sprintf("/pledge 1 %d 5000", item.ID), ChatID: 3, UserID: 3}))
+	require.Equal(t, "«Книга» уже кто-то забронировал", sender.last().text, "Reserved item can't be collected")
+
+	require.NoError(t, model.OnMessage(ctx, group(2, fmt.Sprintf("/reserve 1 %d", item.ID))))
+	require.NoError(t, model.OnMessage(ctx, messages.Message{Text: fmt.Sprintf("/pledge 1 %d 5000", item.ID), ChatID: 3, UserID: 3}))
+	require.NoError(t, model.OnMessage(ctx, group(2, fmt.Sprintf("/reserve 1 %d", item.ID))))
+	require.Equal(t, sent{chatId: 2, text: "На «Книга» уже собирают вместе — присоединяйтесь через 🤝"}, sender.last())
+}
+
+func TestBotModel_PledgeUnreachable(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	for _, id := range []int64{1, 2, 3, 4} {
+		require.NoError(t, storage.AddNewUser(ctx, id))
+	}
+	err = storage.AddWishItem(ctx, 1, messages.WishItem{Name: "Велосипед", Price: 3000000, Currency: "RUB"})
+	require.NoError(t, err)
+	itemId := storage.GetWishListByCategory(ctx, 1).Items("default")[0].ID
+	pledge := func(userId int64, amount string) error {
+		text := fmt.Sprintf("/pledge 1 %d %s", itemId, amount)
+		return model.OnMessage(ctx, messages.Message{Text: text, ChatID: userId, UserID: userId})
+	}
+	require.NoError(t, pledge(2, "1000000"))
+	require.NoError(t, pledge(3, "1000000"))
+	blocked := errors.New("bot was blocked by the user")
+	sender.fail = map[int64]error{2: blocked}
+	sender.sent = nil
+
+	require.ErrorIs(t, pledge(4, "1000000"), blocked)
+	var told []int64
+	for _, s := range sender.sent {
+		if strings.Contains(s.text, "🎉") {
+			told = append(told, s.chatId)
+		}
+	}
+	require.Equal(t, []int64{3, 4}, told, "Participants after the unreachable organiser should still be told")
+	require.Contains(t, sender.last().text, "Собираем вместе", "The pledger should still see the collection")
+	require.Equal(t, int64(2), storage.GetWishListByCategory(ctx, 1).Items("default")[0].ReservedBy)
+}
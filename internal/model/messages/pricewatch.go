@@ -0,0 +1,159 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PriceWatch asks to re-check the price of an item's link and to tell the owner and
+// followers when it drops. A zero Threshold means any drop.
+type PriceWatch struct {
+	OwnerID   int64
+	ItemID    int64
+	Threshold int64
+	Currency  string
+	// CheckedAt is when the link was fetched last, successfully or not.
+	CheckedAt time.Time
+}
+
+type PricePoint struct {
+	At       time.Time
+	Price    int64
+	Currency string
+}
+
+// Dropped says whether the price went from previous down to current and the drop is worth a notification.
+func (w PriceWatch) Dropped(previous, current PricePoint) bool {
+	if previous.Price == 0 || current.Price >= previous.Price {
+		return false
+	}
+	if previous.Currency != "" && previous.Currency != current.Currency {
+		return false
+	}
+	if w.Threshold == 0 {
+		return true
+	}
+	return (w.Currency == "" || w.Currency == current.Currency) && current.Price < w.Threshold
+}
+
+const (
+	maxPriceLines = 10
+
+	txtWatchNoURL    = "У хотелки «%s» нет ссылки, следить не за чем"
+	txtWatchOn       = "📉 Слежу за ценой «%s». %s"
+	txtWatchAnyDrop  = "Сообщу вам и подписчикам, когда она снизится."
+	txtWatchBelow    = "Сообщу вам и подписчикам, когда она станет ниже %s."
+	txtWatchOff      = "Больше не слежу за ценой «%s»"
+	txtWatchAskLimit = "Ниже какой цены сообщить? Например: 2500 или 30 USD"
+	txtWatchBadLimit = "Не получилось разобрать цену. Пример: 2500"
+	txtPricesTitle   = "История цены «%s»:"
+	txtPricesEmpty   = "Цену «%s» ещё не проверяли"
+	txtBtnWatch      = "📉 Следить за ценой"
+	txtBtnWatchLimit = "Порог цены"
+	txtBtnPrices     = "История цены"
+	txtBtnUnwatch    = "Не следить"
+)
+
+// checkPriceWatch lets the owner opt in and out of price tracking and look at the price history.
+func checkPriceWatch(ctx context.Context, m *BotModel, msg Message, lastCmd string) (bool, error) {
+	if arg, ok := strings.CutPrefix(lastCmd, "/watch_limit "); ok && !msg.IsCallback {
+		itemId, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return false, nil
+		}
+		amount, currency, ok := ParseBudget(msg.Text)
+		if !ok {
+			m.lastUserCmd[msg.UserID] = lastCmd
+			return true, m.MessageSender.ShowButtons(msg.UserID, txtWatchBadLimit, cancelBtn)
+		}
+		return true, watchPrice(ctx, m, msg.UserID, itemId, amount, currency)
+	}
+	cmd, arg, _ := strings.Cut(msg.Text, " ")
+	switch cmd {
+	case "/watch", "/watch_limit", "/unwatch", "/prices":
+	default:
+		return false, nil
+	}
+	itemId, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	switch cmd {
+	case "/watch":
+		return true, watchPrice(ctx, m, msg.UserID, itemId, 0, "")
+	case "/watch_limit":
+		m.lastUserCmd[msg.UserID] = msg.Text
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtWatchAskLimit, cancelBtn)
+	case "/unwatch":
+		item, ok := findVisibleItem(ctx, m, msg.UserID, itemId, AudienceOwner)
+		if !ok {
+			return true, m.MessageSender.ShowButtons(msg.UserID, txtReserveGone, btnStart)
+		}
+		if err := m.UserStorage.DeletePriceWatch(ctx, msg.UserID, itemId); err != nil && !errors.Is(err, ErrNotFound) {
+			return true, err
+		}
+		return true, m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtWatchOff, item.Name), btnStart)
+	}
+	return true, showPrices(ctx, m, msg.UserID, itemId)
+}
+
+func watchPrice(ctx context.Context, m *BotModel, userId int64, itemId int64, threshold int64, currency string) error {
+	item, ok := findVisibleItem(ctx, m, userId, itemId, AudienceOwner)
+	if !ok {
+		return m.MessageSender.ShowButtons(userId, txtReserveGone, btnStart)
+	}
+	if item.URL == "" {
+		return m.MessageSender.ShowButtons(userId, fmt.Sprintf(txtWatchNoURL, item.Name), btnStart)
+	}
+	watch, _ := m.UserStorage.GetPriceWatch(ctx, userId, itemId)
+	watch.OwnerID, watch.ItemID = userId, itemId
+	watch.Threshold, watch.Currency = threshold, currency
+	if err := m.UserStorage.SetPriceWatch(ctx, watch); err != nil {
+		return err
+	}
+	condition := txtWatchAnyDrop
+	if threshold > 0 {
+		condition = fmt.Sprintf(txtWatchBelow, price.Format(threshold, currency))
+	}
+	return m.MessageSender.ShowButtons(userId, fmt.Sprintf(txtWatchOn, item.Name, condition), append(watchButtons(itemId), btnStart...))
+}
+
+func watchButtons(itemId int64) []types.TgRowButtons {
+	return []types.TgRowButtons{{
+		types.TgInlineButton{DisplayName: txtBtnWatchLimit, Value: fmt.Sprintf("/watch_limit %d", itemId)},
+		types.TgInlineButton{DisplayName: txtBtnPrices, Value: fmt.Sprintf("/prices %d", itemId)},
+		types.TgInlineButton{DisplayName: txtBtnUnwatch, Value: fmt.Sprintf("/unwatch %d", itemId)},
+	}}
+}
+
+// showPrices lists the latest recorded prices, newest first, in the owner's time zone.
+func showPrices(ctx context.Context, m *BotModel, userId int64, itemId int64) error {
+	item, ok := findVisibleItem(ctx, m, userId, itemId, AudienceOwner)
+	if !ok {
+		return m.MessageSender.ShowButtons(userId, txtReserveGone, btnStart)
+	}
+	var buttons []types.TgRowButtons
+	if _, watching := m.UserStorage.GetPriceWatch(ctx, userId, itemId); watching {
+		buttons = watchButtons(itemId)
+	} else if item.URL != "" {
+		buttons = []types.TgRowButtons{{types.TgInlineButton{DisplayName: txtBtnWatch, Value: fmt.Sprintf("/watch %d", itemId)}}}
+	}
+	history := m.UserStorage.GetPriceHistory(ctx, itemId)
+	if len(history) == 0 {
+		return m.MessageSender.ShowButtons(userId, fmt.Sprintf(txtPricesEmpty, item.Name), append(buttons, btnStart...))
+	}
+	loc := clock.LoadZone(m.UserStorage.GetTimeZone(ctx, userId))
+	lines := []string{fmt.Sprintf(txtPricesTitle, item.Name)}
+	for i := len(history) - 1; i >= 0 && len(lines) <= maxPriceLines; i-- {
+		point := history[i]
+		lines = append(lines, point.At.In(loc).Format("02.01.2006")+" — "+price.Format(point.Price, point.Currency))
+	}
+	return m.MessageSender.ShowButtons(userId, strings.Join(lines, "\n"), append(buttons, btnStart...))
+}
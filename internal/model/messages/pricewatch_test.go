@@ -0,0 +1,96 @@
+package messages_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPriceWatch_Dropped(t *testing.T) {
+	rub := func(amount int64) messages.PricePoint { return messages.PricePoint{Price: amount, Currency: "RUB"} }
+
+	t.Run("Should report any drop without a threshold", func(t *testing.T) {
+		watch := messages.PriceWatch{}
+		require.True(t, watch.Dropped(rub(1000), rub(900)))
+		require.False(t, watch.Dropped(rub(900), rub(1000)))
+		require.False(t, watch.Dropped(rub(0), rub(900)), "There is nothing to compare with")
+	})
+
+	t.Run("Should report drops below the threshold only", func(t *testing.T) {
+		watch := messages.PriceWatch{Threshold: 800, Currency: "RUB"}
+		require.False(t, watch.Dropped(rub(1000), rub(900)))
+		require.True(t, watch.Dropped(rub(1000), rub(700)))
+	})
+
+	t.Run("Should not compare different currencies", func(t *testing.T) {
+		watch := messages.PriceWatch{}
+		require.False(t, watch.Dropped(rub(1000), messages.PricePoint{Price: 10, Currency: "USD"}))
+	})
+}
+
+func TestBotModel_PriceWatch(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	send := func(text string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: ownerId, UserID: ownerId}))
+	}
+	err = storage.AddNewUser(ctx, ownerId)
+	require.NoError(t, err)
+	err = storage.ImportWishList(ctx, ownerId, messages.Categories{
+		{Name: "default", Items: []messages.WishItem{{Name: "LEGO", URL: "https://example.com/lego"}, {Name: "Носки"}}},
+	})
+	require.NoError(t, err)
+	items := storage.GetWishListByCategory(ctx, ownerId).Items("default")
+	lego, socks := items[0], items[1]
+
+	t.Run("Should watch an item with a link", func(t *testing.T) {
+		send(fmt.Sprintf("/watch %d", lego.ID))
+		watch, ok := storage.GetPriceWatch(ctx, ownerId, lego.ID)
+		require.True(t, ok)
+		require.Zero(t, watch.Threshold)
+		require.Contains(t, sender.last().text, "когда она снизится")
+	})
+
+	t.Run("Should refuse items without a link", func(t *testing.T) {
+		send(fmt.Sprintf("/watch %d", socks.ID))
+		_, ok := storage.GetPriceWatch(ctx, ownerId, socks.ID)
+		require.False(t, ok)
+		require.Contains(t, sender.last().text, "нет ссылки")
+	})
+
+	t.Run("Should ask for a threshold", func(t *testing.T) {
+		send(fmt.Sprintf("/watch_limit %d", lego.ID))
+		send("дёшево")
+		require.Contains(t, sender.last().text, "Не получилось")
+		send("2 500")
+		watch, _ := storage.GetPriceWatch(ctx, ownerId, lego.ID)
+		require.Equal(t, int64(250000), watch.Threshold)
+		require.Equal(t, "RUB", watch.Currency)
+		require.Contains(t, sender.last().text, "ниже 2 500 ₽")
+	})
+
+	t.Run("Should show the history newest first", func(t *testing.T) {
+		day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		for i, amount := range []int64{300000, 280000} {
+			err := storage.AddPricePoint(ctx, lego.ID, messages.PricePoint{At: day.AddDate(0, 0, i), Price: amount, Currency: "RUB"})
+			require.NoError(t, err)
+		}
+		send(fmt.Sprintf("/prices %d", lego.ID))
+		require.Equal(t, "История цены «LEGO»:\n02.05.2024 — 2 800 ₽\n01.05.2024 — 3 000 ₽", sender.last().text)
+	})
+
+	t.Run("Should stop watching", func(t *testing.T) {
+		send(fmt.Sprintf("/unwatch %d", lego.ID))
+		_, ok := storage.GetPriceWatch(ctx, ownerId, lego.ID)
+		require.False(t, ok)
+		send(fmt.Sprintf("/prices %d", lego.ID))
+		require.Equal(t, fmt.Sprintf("/watch %d", lego.ID), sender.last().buttons[0][0].Value)
+	})
+}
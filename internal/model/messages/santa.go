@@ -0,0 +1,410 @@
+package messages
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"github.com/roman-clancy/ho4uha-bot/internal/santa"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SantaGame struct {
+	ID           int64
+	Token        string
+	OrganizerID  int64
+	Title        string
+	Budget       int64
+	Currency     string
+	Deadline     time.Time
+	Participants []int64
+	Exclusions   []santa.Pair
+	// Seed is kept so the draw can be reproduced for support requests.
+	Seed        int64
+	Assignments map[int64]int64
+}
+
+func (g SantaGame) Drawn() bool {
+	return len(g.Assignments) > 0
+}
+
+const (
+	txtSantaEmpty       = "Вы пока не участвуете в Тайном Санте. Создайте игру и пригласите коллег по ссылке."
+	txtSantaList        = "Ваши игры:"
+	txtSantaTitle       = "Как назовём игру? Например: Офис 2025"
+	txtSantaBudget      = "Введите бюджет подарка, например: 3000 или 50 usd"
+	txtSantaBadBudget   = "Не получилось разобрать сумму. Пример: 3000 ₽"
+	txtSantaDeadline    = "До какого числа обмениваемся подарками? Формат ДД.ММ.ГГГГ"
+	txtSantaBadDeadline = "Не получилось разобрать дату. Пример: 25.12.2025"
+	txtSantaExcludeA    = "Кто не должен дарить подарок своей паре? Выберите первого участника."
+	txtSantaExcludeB    = "С кем %s не должен(на) попасть друг на друга?"
+	txtSantaUnknown     = "Игра не найдена"
+	txtSantaNotOwner    = "Это может сделать только организатор"
+	txtSantaLocked      = "Жеребьёвка уже прошла, игру нельзя изменить"
+	txtSantaJoined      = "Вы в игре «%s»! Когда организатор проведёт жеребьёвку, я пришлю имя получателя и его вишлист."
+	txtSantaNewMember   = "%s присоединяется к игре «%s»"
+	txtSantaAlready     = "Вы уже участвуете в игре «%s»"
+	txtSantaTooFew      = "Для жеребьёвки нужно хотя бы 3 участника"
+	txtSantaImpossible  = "С такими исключениями жеребьёвка невозможна, уберите часть пар"
+	txtSantaDrawn       = "Жеребьёвка проведена, все участники получили имена в личные сообщения 🎅"
+	txtSantaDrawnPartly = "Жеребьёвка проведена, но не получилось написать: %s. Имя получателя есть в карточке игры, пусть заглянут в /santa"
+	txtSantaGiver       = "Жеребьёвка проведена. Вы дарите подарок — %s."
+	txtSantaFull        = "В игре уже %d участников, больше нельзя"
+	txtSantaAssignment  = "🎅 Тайный Санта «%s»: вы дарите подарок — %s."
+	txtSantaNoWishes    = "У %s пока нет вишлиста. Самое время узнать намёками, что порадует 😉"
+	txtSantaNotSet      = "не задан"
+)
+
+// checkSanta runs the Secret Santa flow: create a game, invite by link, set budget, deadline
+// and exclusions, then draw and privately tell everyone whom they are gifting.
+func checkSanta(ctx context.Context, m *BotModel, msg Message, lastCmd string) (bool, error) {
+	if !msg.IsCallback {
+		switch {
+		case lastCmd == "/santa_title":
+			return true, createSantaGame(ctx, m, msg)
+		case strings.HasPrefix(lastCmd, "/santa_budget "):
+			return true, setSantaBudget(ctx, m, msg, strings.TrimPrefix(lastCmd, "/santa_budget "))
+		case strings.HasPrefix(lastCmd, "/santa_deadline "):
+			return true, setSantaDeadline(ctx, m, msg, strings.TrimPrefix(lastCmd, "/santa_deadline "))
+		}
+	}
+	if token, ok := strings.CutPrefix(msg.Text, "/start s_"); ok {
+		return true, joinSantaGame(ctx, m, msg, token)
+	}
+	if msg.Text == "/santa" {
+		return true, showSantaGames(ctx, m, msg.UserID)
+	}
+	if msg.Text == "/santa_new" {
+		m.lastUserCmd[msg.UserID] = "/santa_title"
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtSantaTitle, cancelBtn)
+	}
+	cmd, args, _ := strings.Cut(msg.Text, " ")
+	if !slices.Contains([]string{"/santa_game", "/santa_budget", "/santa_deadline", "/santa_ex", "/santa_draw"}, cmd) {
+		return false, nil
+	}
+	ids, ok := parseIds(args)
+	if !ok || len(ids) == 0 {
+		return false, nil
+	}
+	game, ok := m.UserStorage.GetSantaGame(ctx, ids[0])
+	if !ok || !slices.Contains(game.Participants, msg.UserID) {
+		return true, m.MessageSender.SendMessage(msg.UserID, txtSantaUnknown)
+	}
+	if cmd == "/santa_game" {
+		return true, showSantaGame(ctx, m, msg.UserID, game)
+	}
+	if game.OrganizerID != msg.UserID {
+		return true, m.MessageSender.SendMessage(msg.UserID, txtSantaNotOwner)
+	}
+	if game.Drawn() {
+		return true, m.MessageSender.SendMessage(msg.UserID, txtSantaLocked)
+	}
+	switch cmd {
+	case "/santa_budget":
+		m.lastUserCmd[msg.UserID] = msg.Text
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtSantaBudget, cancelBtn)
+	case "/santa_deadline":
+		m.lastUserCmd[msg.UserID] = msg.Text
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtSantaDeadline, cancelBtn)
+	case "/santa_ex":
+		return true, editSantaExclusions(ctx, m, msg.UserID, game, ids[1:])
+	case "/santa_draw":
+		return true, drawSantaGame(ctx, m, msg.UserID, game)
+	}
+	return false, nil
+}
+
+func parseIds(args string) ([]int64, bool) {
+	fields := strings.Fields(args)
+	ids := make([]int64, 0, len(fields))
+	for _, f := range fields {
+		id, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+func createSantaGame(ctx context.Context, m *BotModel, msg Message) error {
+	title := strings.TrimSpace(msg.Text)
+	if title == "" {
+		m.lastUserCmd[msg.UserID] = "/santa_title"
+		return m.MessageSender.ShowButtons(msg.UserID, txtSantaTitle, cancelBtn)
+	}
+	if err := registerUser(ctx, m, msg); err != nil {
+		return err
+	}
+	game, err := m.UserStorage.CreateSantaGame(ctx, msg.UserID, title)
+	if err != nil {
+		return err
+	}
+	return showSantaGame(ctx, m, msg.UserID, game)
+}
+
+func joinSantaGame(ctx context.Context, m *BotModel, msg Message, token string) error {
+	if err := registerUser(ctx, m, msg); err != nil {
+		return err
+	}
+	game, ok := m.UserStorage.GetSantaGameByToken(ctx, token)
+	if !ok {
+		return m.MessageSender.ShowButtons(msg.UserID, txtSantaUnknown, btnStart)
+	}
+	if slices.Contains(game.Participants, msg.UserID) {
+		return m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtSantaAlready, game.Title), btnStart)
+	}
+	if game.Drawn() {
+		return m.MessageSender.ShowButtons(msg.UserID, txtSantaLocked, btnStart)
+	}
+	if len(game.Participants) >= santa.MaxParticipants {
+		return m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtSantaFull, santa.MaxParticipants), btnStart)
+	}
+	game.Participants = append(game.Participants, msg.UserID)
+	if err := m.UserStorage.UpdateSantaGame(ctx, game); err != nil {
+		return err
+	}
+	if err := m.MessageSender.SendMessage(game.OrganizerID, fmt.Sprintf(txtSantaNewMember, OwnerName(ctx, m.UserStorage, msg.UserID), game.Title)); err != nil {
+		return err
+	}
+	return m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtSantaJoined, game.Title), btnStart)
+}
+
+func showSantaGames(ctx context.Context, m *BotModel, userId int64) error {
+	buttons := []types.TgRowButtons{{types.TgInlineButton{DisplayName: "➕ Новая игра", Value: "/santa_new"}}}
+	games := m.UserStorage.GetSantaGames(ctx, userId)
+	if len(games) == 0 {
+		return m.MessageSender.ShowButtons(userId, txtSantaEmpty, append(buttons, btnStart...))
+	}
+	for _, game := range games {
+		buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{
+			DisplayName: "🎅 " + game.Title,
+			Value:       fmt.Sprintf("/santa_game %d", game.ID),
+		}})
+	}
+	return m.MessageSender.ShowButtons(userId, txtSantaList, append(buttons, btnStart...))
+}
+
+func showSantaGame(ctx context.Context, m *BotModel, userId int64, game SantaGame) error {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🎅 Тайный Санта «%s»\n", game.Title))
+	b.WriteString("Организатор: " + OwnerName(ctx, m.UserStorage, game.OrganizerID) + "\n")
+	b.WriteString("Бюджет: " + santaBudget(game) + "\n")
+	b.WriteString("Обмен подарками до: " + santaDeadline(game) + "\n")
+	names := make([]string, 0, len(game.Participants))
+	for _, id := range game.Participants {
+		names = append(names, OwnerName(ctx, m.UserStorage, id))
+	}
+	b.WriteString(fmt.Sprintf("Участники (%d): %s\n", len(names), strings.Join(names, ", ")))
+	if len(game.Exclusions) > 0 && userId == game.OrganizerID {
+		pairs := make([]string, 0, len(game.Exclusions))
+		for _, p := range game.Exclusions {
+			pairs = append(pairs, OwnerName(ctx, m.UserStorage, p[0])+" — "+OwnerName(ctx, m.UserStorage, p[1]))
+		}
+		b.WriteString("Не дарят друг другу: " + strings.Join(pairs, "; ") + "\n")
+	}
+	if game.Drawn() {
+		if receiver, ok := game.Assignments[userId]; ok {
+			b.WriteString(fmt.Sprintf(txtSantaGiver, OwnerName(ctx, m.UserStorage, receiver)))
+		} else {
+			b.WriteString("Жеребьёвка проведена.")
+		}
+		return m.MessageSender.ShowButtons(userId, b.String(), btnStart)
+	}
+	b.WriteString("Пригласить: " + santaLink(m, game))
+	if userId != game.OrganizerID {
+		return m.MessageSender.ShowButtons(userId, b.String(), btnStart)
+	}
+	buttons := []types.TgRowButtons{
+		{
+			types.TgInlineButton{DisplayName: "💰 Бюджет", Value: fmt.Sprintf("/santa_budget %d", game.ID)},
+			types.TgInlineButton{DisplayName: "📅 Срок", Value: fmt.Sprintf("/santa_deadline %d", game.ID)},
+		},
+		{
+			types.TgInlineButton{DisplayName: "🚫 Исключения", Value: fmt.Sprintf("/santa_ex %d", game.ID)},
+			types.TgInlineButton{DisplayName: "🎲 Жеребьёвка", Value: fmt.Sprintf("/santa_draw %d", game.ID)},
+		},
+	}
+	return m.MessageSender.ShowButtons(userId, b.String(), append(buttons, btnStart...))
+}
+
+func santaLink(m *BotModel, game SantaGame) string {
+	if m.BotUserName == "" {
+		return "/start s_" + game.Token
+	}
+	return "https://t.me/" + m.BotUserName + "?start=s_" + game.Token
+}
+
+func santaBudget(game SantaGame) string {
+	if game.Budget == 0 {
+		return txtSantaNotSet
+	}
+	return price.Format(game.Budget, game.Currency)
+}
+
+func santaDeadline(game SantaGame) string {
+	if game.Deadline.IsZero() {
+		return txtSantaNotSet
+	}
+	return game.Deadline.Format("02.01.2006")
+}
+
+func santaGameFromCmd(ctx context.Context, m *BotModel, userId int64, gameId string) (SantaGame, bool) {
+	id, err := strconv.ParseInt(gameId, 10, 64)
+	if err != nil {
+		return SantaGame{}, false
+	}
+	game, ok := m.UserStorage.GetSantaGame(ctx, id)
+	if !ok || game.OrganizerID != userId || game.Drawn() {
+		return SantaGame{}, false
+	}
+	return game, true
+}
+
+func setSantaBudget(ctx context.Context, m *BotModel, msg Message, gameId string) error {
+	game, ok := santaGameFromCmd(ctx, m, msg.UserID, gameId)
+	if !ok {
+		return m.MessageSender.SendMessage(msg.UserID, txtSantaUnknown)
+	}
+	amount, currency, ok := ParseBudget(msg.Text)
+	if !ok {
+		m.lastUserCmd[msg.UserID] = "/santa_budget " + gameId
+		return m.MessageSender.ShowButtons(msg.UserID, txtSantaBadBudget, cancelBtn)
+	}
+	game.Budget, game.Currency = amount, currency
+	if err := m.UserStorage.UpdateSantaGame(ctx, game); err != nil {
+		return err
+	}
+	return showSantaGame(ctx, m, msg.UserID, game)
+}
+
+// ParseBudget reads "3000", "3 000 ₽" or "50 usd". Rubles are assumed when no currency is given.
+func ParseBudget(text string) (int64, string, bool) {
+	fields := strings.Fields(text)
+	currency := "RUB"
+	if len(fields) > 1 && price.IsCurrency(fields[len(fields)-1]) {
+		currency = price.NormalizeCurrency(fields[len(fields)-1])
+		fields = fields[:len(fields)-1]
+	}
+	amount, ok := price.Parse(strings.Join(fields, " "))
+	if !ok || amount <= 0 {
+		return 0, "", false
+	}
+	return amount, currency, true
+}
+
+func setSantaDeadline(ctx context.Context, m *BotModel, msg Message, gameId string) error {
+	game, ok := santaGameFromCmd(ctx, m, msg.UserID, gameId)
+	if !ok {
+		return m.MessageSender.SendMessage(msg.UserID, txtSantaUnknown)
+	}
+	deadline, err := time.Parse("02.01.2006", strings.TrimSpace(msg.Text))
+	if err != nil {
+		m.lastUserCmd[msg.UserID] = "/santa_deadline " + gameId
+		return m.MessageSender.ShowButtons(msg.UserID, txtSantaBadDeadline, cancelBtn)
+	}
+	game.Deadline = deadline
+	if err := m.UserStorage.UpdateSantaGame(ctx, game); err != nil {
+		return err
+	}
+	return showSantaGame(ctx, m, msg.UserID, game)
+}
+
+// editSantaExclusions walks the organiser through two participant pickers, choosing a pair
+// that is already excluded removes it.
+func editSantaExclusions(ctx context.Context, m *BotModel, userId int64, game SantaGame, picked []int64) error {
+	if len(picked) < 2 {
+		text := txtSantaExcludeA
+		if len(picked) == 1 {
+			text = fmt.Sprintf(txtSantaExcludeB, OwnerName(ctx, m.UserStorage, picked[0]))
+		}
+		buttons := make([]types.TgRowButtons, 0, len(game.Participants))
+		for _, id := range game.Participants {
+			if slices.Contains(picked, id) {
+				continue
+			}
+			value := fmt.Sprintf("/santa_ex %d %d", game.ID, id)
+			if len(picked) == 1 {
+				value = fmt.Sprintf("/santa_ex %d %d %d", game.ID, picked[0], id)
+			}
+			buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{DisplayName: OwnerName(ctx, m.UserStorage, id), Value: value}})
+		}
+		return m.MessageSender.ShowButtons(userId, text, append(buttons, cancelBtn...))
+	}
+	a, b := picked[0], picked[1]
+	if a == b || !slices.Contains(game.Participants, a) || !slices.Contains(game.Participants, b) {
+		return m.MessageSender.SendMessage(userId, txtSantaUnknown)
+	}
+	if idx := slices.IndexFunc(game.Exclusions, func(p santa.Pair) bool { return p.Has(a, b) }); idx != -1 {
+		game.Exclusions = slices.Delete(game.Exclusions, idx, idx+1)
+	} else {
+		game.Exclusions = append(game.Exclusions, santa.Pair{a, b})
+	}
+	if err := m.UserStorage.UpdateSantaGame(ctx, game); err != nil {
+		return err
+	}
+	return showSantaGame(ctx, m, userId, game)
+}
+
+func drawSantaGame(ctx context.Context, m *BotModel, userId int64, game SantaGame) error {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return err
+	}
+	game.Seed = int64(binary.LittleEndian.Uint64(buf[:]))
+	assignments, err := santa.Draw(game.Participants, game.Exclusions, game.Seed)
+	switch {
+	case errors.Is(err, santa.ErrTooFewParticipants):
+		return m.MessageSender.SendMessage(userId, txtSantaTooFew)
+	case errors.Is(err, santa.ErrNoValidDraw):
+		return m.MessageSender.SendMessage(userId, txtSantaImpossible)
+	case errors.Is(err, santa.ErrTooManyParticipants):
+		return m.MessageSender.SendMessage(userId, fmt.Sprintf(txtSantaFull, santa.MaxParticipants))
+	case err != nil:
+		return err
+	}
+	game.Assignments = assignments
+	if err := m.UserStorage.UpdateSantaGame(ctx, game); err != nil {
+		return err
+	}
+	// The draw is saved, so everyone has to be told even when somebody can't be reached.
+	var errs []error
+	var missed []string
+	for _, giver := range game.Participants {
+		if err := sendSantaAssignment(ctx, m, game, giver); err != nil {
+			errs = append(errs, err)
+			missed = append(missed, OwnerName(ctx, m.UserStorage, giver))
+		}
+	}
+	text := txtSantaDrawn
+	if len(missed) > 0 {
+		text = fmt.Sprintf(txtSantaDrawnPartly, strings.Join(missed, ", "))
+	}
+	return errors.Join(append(errs, m.MessageSender.ShowButtons(userId, text, btnStart))...)
+}
+
+func sendSantaAssignment(ctx context.Context, m *BotModel, game SantaGame, giver int64) error {
+	receiver := game.Assignments[giver]
+	name := OwnerName(ctx, m.UserStorage, receiver)
+	text := fmt.Sprintf(txtSantaAssignment, game.Title, name)
+	if game.Budget > 0 {
+		text += "\nБюджет: " + santaBudget(game)
+	}
+	if !game.Deadline.IsZero() {
+		text += "\nОбмен подарками до: " + santaDeadline(game)
+	}
+	lists := ReadWishListsFor(ctx, m.UserStorage, receiver, giver)
+	if len(lists) == 0 {
+		return m.MessageSender.SendMessage(giver, text+"\n\n"+fmt.Sprintf(txtSantaNoWishes, name))
+	}
+	var list strings.Builder
+	list.WriteString(txtItemShow + "\n")
+	writeLists(ctx, &list, m, lists)
+	return m.MessageSender.SendMessage(giver, text+"\n\n"+list.String())
+}
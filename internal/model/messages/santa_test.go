@@ -0,0 +1,149 @@
+package messages_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBudget(t *testing.T) {
+	tests := []struct {
+		in       string
+		amount   int64
+		currency string
+	}{
+		{"3000", 300000, "RUB"},
+		{"3 000 ₽", 300000, "RUB"},
+		{"50 usd", 5000, "USD"},
+	}
+	for _, tt := range tests {
+		t.Run("Should parse "+tt.in, func(t *testing.T) {
+			amount, currency, ok := messages.ParseBudget(tt.in)
+			require.True(t, ok)
+			require.Equal(t, tt.amount, amount)
+			require.Equal(t, tt.currency, currency)
+		})
+	}
+	_, _, ok := messages.ParseBudget("много")
+	require.False(t, ok)
+}
+
+func TestBotModel_Santa(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	model.BotUserName = "ho4uha_bot"
+	private := func(userId int64, text string) messages.Message {
+		return messages.Message{Text: text, ChatID: userId, UserID: userId, FirstName: fmt.Sprintf("User%d", userId)}
+	}
+	send := func(userId int64, text string) {
+		require.NoError(t, model.OnMessage(ctx, private(userId, text)))
+	}
+
+	send(1, "/santa_new")
+	send(1, "Офис")
+	games := storage.GetSantaGames(ctx, 1)
+	require.Len(t, games, 1)
+	game := games[0]
+	require.Contains(t, sender.last().text, "https://t.me/ho4uha_bot?start=s_"+game.Token)
+
+	t.Run("Should refuse to draw with too few participants", func(t *testing.T) {
+		send(1, fmt.Sprintf("/santa_draw %d", game.ID))
+		require.Equal(t, "Для жеребьёвки нужно хотя бы 3 участника", sender.last().text)
+	})
+
+	for _, id := range []int64{2, 3, 4} {
+		send(id, "/start s_"+game.Token)
+	}
+	err = storage.AddWishItem(ctx, 2, messages.WishItem{Name: "Термокружка"})
+	require.NoError(t, err)
+
+	t.Run("Should let only the organiser change the game", func(t *testing.T) {
+		send(2, fmt.Sprintf("/santa_budget %d", game.ID))
+		require.Equal(t, "Это может сделать только организатор", sender.last().text)
+	})
+
+	t.Run("Should set budget, deadline and exclusions", func(t *testing.T) {
+		send(1, fmt.Sprintf("/santa_budget %d", game.ID))
+		send(1, "3000")
+		send(1, fmt.Sprintf("/santa_deadline %d", game.ID))
+		send(1, "25.12.2025")
+		send(1, fmt.Sprintf("/santa_ex %d 1 2", game.ID))
+		game, _ = storage.GetSantaGame(ctx, game.ID)
+		require.Equal(t, int64(300000), game.Budget)
+		require.Equal(t, time.Date(2025, 12, 25, 0, 0, 0, 0, time.UTC), game.Deadline)
+		require.Len(t, game.Exclusions, 1)
+		require.Contains(t, sender.last().text, "Не дарят друг другу: User1 — User2")
+	})
+
+	t.Run("Should privately send everyone their recipient", func(t *testing.T) {
+		sender.sent = nil
+		send(1, fmt.Sprintf("/santa_draw %d", game.ID))
+		game, _ = storage.GetSantaGame(ctx, game.ID)
+		require.True(t, game.Drawn())
+		require.NotEqual(t, int64(2), game.Assignments[1])
+		for _, s := range sender.sent[:4] {
+			require.Contains(t, s.text, "🎅 Тайный Санта «Офис»: вы дарите подарок")
+			require.Contains(t, s.text, "Бюджет: 3 000 ₽")
+			receiver := game.Assignments[s.chatId]
+			require.Contains(t, s.text, fmt.Sprintf("User%d", receiver))
+			if receiver == 2 {
+				require.True(t, strings.Contains(s.text, "Термокружка"), "Recipient's wishlist should be attached")
+			}
+		}
+	})
+
+	t.Run("Should lock the game after the draw", func(t *testing.T) {
+		send(5, "/start s_"+game.Token)
+		require.Equal(t, "Жеребьёвка уже прошла, игру нельзя изменить", sender.last().text)
+		send(1, fmt.Sprintf("/santa_draw %d", game.ID))
+		require.Equal(t, "Жеребьёвка уже прошла, игру нельзя изменить", sender.last().text)
+	})
+}
+
+func TestBotModel_SantaUnreachable(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	send := func(userId int64, text string) error {
+		return model.OnMessage(ctx, messages.Message{Text: text, ChatID: userId, UserID: userId, FirstName: fmt.Sprintf("User%d", userId)})
+	}
+	require.NoError(t, send(1, "/santa_new"))
+	require.NoError(t, send(1, "Офис"))
+	game := storage.GetSantaGames(ctx, 1)[0]
+	for _, id := range []int64{2, 3, 4} {
+		require.NoError(t, send(id, "/start s_"+game.Token))
+	}
+	blocked := errors.New("bot was blocked by the user")
+	sender.fail = map[int64]error{2: blocked}
+	sender.sent = nil
+
+	t.Run("Should tell everyone else their recipient", func(t *testing.T) {
+		require.ErrorIs(t, send(1, fmt.Sprintf("/santa_draw %d", game.ID)), blocked)
+		var told []int64
+		for _, s := range sender.sent {
+			if strings.Contains(s.text, "вы дарите подарок") {
+				told = append(told, s.chatId)
+			}
+		}
+		require.ElementsMatch(t, []int64{1, 3, 4}, told)
+		require.Contains(t, sender.last().text, "не получилось написать: User2")
+	})
+
+	t.Run("Should show the recipient in the game", func(t *testing.T) {
+		sender.fail = nil
+		game, _ = storage.GetSantaGame(ctx, game.ID)
+		require.NoError(t, send(2, fmt.Sprintf("/santa_game %d", game.ID)))
+		require.Contains(t, sender.last().text, fmt.Sprintf("Вы дарите подарок — User%d.", game.Assignments[2]))
+	})
+}
@@ -0,0 +1,174 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// FoundItem is a search hit with the place it was found in.
+type FoundItem struct {
+	WishItem
+	ListID   int64
+	Category string
+}
+
+// NormalizeSearch folds case and "ё", so "Ёлка" and "елка" match. SQL backends should index
+// the same normalized text to give the same results.
+func NormalizeSearch(s string) string {
+	return strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+}
+
+// SearchText is what a query is matched against: the name, note, tags and host of the link.
+func (i WishItem) SearchText() string {
+	parts := append([]string{i.Name, i.Note}, i.Tags...)
+	if u, err := url.Parse(i.URL); err == nil && u.Host != "" {
+		parts = append(parts, strings.TrimPrefix(u.Host, "www."))
+	}
+	return NormalizeSearch(strings.Join(parts, "\n"))
+}
+
+// MatchesSearch is true when every word of the query occurs in the item.
+func (i WishItem) MatchesSearch(query string) bool {
+	words := strings.Fields(NormalizeSearch(query))
+	if len(words) == 0 {
+		return false
+	}
+	text := i.SearchText()
+	for _, word := range words {
+		if !strings.Contains(text, strings.TrimPrefix(word, "#")) {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	searchPageSize = 5
+
+	txtFindAsk     = "Что ищем? Можно искать по названию, заметке, тегу или сайту."
+	txtFindEmpty   = "По запросу «%s» ничего не нашлось"
+	txtFindResults = "Нашлось %d по запросу «%s», показаны %d–%d:"
+	txtFindBack    = "⬅️ К результатам"
+)
+
+var itemStatusNames = map[ItemStatus]string{
+	ItemWanted:   "хочу",
+	ItemReserved: "кто-то уже дарит",
+	ItemReceived: "получено",
+	ItemArchived: "в архиве",
+}
+
+type search struct {
+	query  string
+	offset int
+}
+
+// checkFind searches the owner's items in all lists and shows them page by page.
+func checkFind(ctx context.Context, m *BotModel, msg Message, lastCmd string) (bool, error) {
+	if lastCmd == "/find" && !msg.IsCallback {
+		return true, showSearch(ctx, m, msg.UserID, search{query: msg.Text})
+	}
+	if msg.Text == "/find" {
+		m.lastUserCmd[msg.UserID] = "/find"
+		return true, m.MessageSender.ShowButtons(msg.UserID, txtFindAsk, cancelBtn)
+	}
+	cmd, arg, _ := strings.Cut(msg.Text, " ")
+	switch cmd {
+	case "/find":
+		return true, showSearch(ctx, m, msg.UserID, search{query: arg})
+	case "/find_page":
+		offset, err := strconv.Atoi(arg)
+		if err != nil {
+			return false, nil
+		}
+		// The query is kept here, callback data is too short for it.
+		return true, showSearch(ctx, m, msg.UserID, search{query: m.searches[msg.UserID].query, offset: offset})
+	case "/card":
+		itemId, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return false, nil
+		}
+		return true, showItemCard(ctx, m, msg.UserID, itemId)
+	}
+	return false, nil
+}
+
+func showSearch(ctx context.Context, m *BotModel, userId int64, s search) error {
+	s.query = strings.TrimSpace(s.query)
+	if s.query == "" {
+		m.lastUserCmd[userId] = "/find"
+		return m.MessageSender.ShowButtons(userId, txtFindAsk, cancelBtn)
+	}
+	m.searches[userId] = s
+	found, total := m.UserStorage.SearchWishItems(ctx, userId, s.query, s.offset, searchPageSize)
+	if total == 0 || len(found) == 0 {
+		return m.MessageSender.ShowButtons(userId, fmt.Sprintf(txtFindEmpty, s.query), btnStart)
+	}
+	buttons := make([]types.TgRowButtons, 0, len(found)+1)
+	for _, item := range found {
+		buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{
+			DisplayName: item.Name,
+			Value:       fmt.Sprintf("/card %d", item.ID),
+		}})
+	}
+	var nav types.TgRowButtons
+	if s.offset > 0 {
+		nav = append(nav, types.TgInlineButton{DisplayName: "◀️", Value: fmt.Sprintf("/find_page %d", max(s.offset-searchPageSize, 0))})
+	}
+	if s.offset+len(found) < total {
+		nav = append(nav, types.TgInlineButton{DisplayName: "▶️", Value: fmt.Sprintf("/find_page %d", s.offset+searchPageSize)})
+	}
+	if len(nav) > 0 {
+		buttons = append(buttons, nav)
+	}
+	text := fmt.Sprintf(txtFindResults, total, s.query, s.offset+1, s.offset+len(found))
+	return m.MessageSender.ShowButtons(userId, text, append(buttons, cancelBtn...))
+}
+
+func showItemCard(ctx context.Context, m *BotModel, userId int64, itemId int64) error {
+	for _, list := range m.UserStorage.GetLists(ctx, userId) {
+		wishList := m.UserStorage.GetListWishList(ctx, list.ID)
+		item, ok := wishList.Find(itemId)
+		if !ok {
+			continue
+		}
+		var b strings.Builder
+		b.WriteString("🎁 " + item.Name + "\n")
+		if item.Price > 0 {
+			b.WriteString("Цена: " + price.Format(item.Price, item.Currency) + "\n")
+		}
+		if item.URL != "" {
+			b.WriteString("Ссылка: " + item.URL + "\n")
+		}
+		if item.Note != "" {
+			b.WriteString("Заметка: " + item.Note + "\n")
+		}
+		if len(item.Tags) > 0 {
+			b.WriteString("Теги: " + formatTags(item.Tags) + "\n")
+		}
+		b.WriteString(fmt.Sprintf("Список: %s, категория: %s\n", list.Name, categoryTitle(wishList.CategoryOf(itemId))))
+		b.WriteString("Статус: " + itemStatusNames[item.CurrentStatus()])
+		buttons := []types.TgRowButtons{{types.TgInlineButton{
+			DisplayName: txtFindBack,
+			Value:       fmt.Sprintf("/find_page %d", m.searches[userId].offset),
+		}}}
+		if item.URL != "" {
+			buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{DisplayName: txtBtnPrices, Value: fmt.Sprintf("/prices %d", itemId)}})
+		}
+		return m.MessageSender.ShowButtons(userId, b.String(), append(buttons, btnStart...))
+	}
+	return m.MessageSender.ShowButtons(userId, txtReserveGone, btnStart)
+}
+
+func formatTags(tags []string) string {
+	marked := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		marked = append(marked, "#"+tag)
+	}
+	return strings.Join(marked, " ")
+}
@@ -0,0 +1,87 @@
+package messages_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWishItem_MatchesSearch(t *testing.T) {
+	item := messages.WishItem{
+		Name: "Ёлочные игрушки",
+		URL:  "https://www.ozon.ru/product/1",
+		Note: "стеклянные",
+		Tags: []string{"новый_год"},
+	}
+
+	t.Run("Should ignore case and ё", func(t *testing.T) {
+		require.True(t, item.MatchesSearch("ЕЛОЧНЫЕ"))
+	})
+
+	t.Run("Should match every word in any field", func(t *testing.T) {
+		require.True(t, item.MatchesSearch("игрушки стеклянные ozon"))
+		require.True(t, item.MatchesSearch("#новый_год"))
+		require.False(t, item.MatchesSearch("игрушки пластиковые"))
+	})
+
+	t.Run("Should not match an empty query", func(t *testing.T) {
+		require.False(t, item.MatchesSearch("  "))
+	})
+}
+
+func TestBotModel_Find(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	send := func(text string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: ownerId, UserID: ownerId}))
+	}
+	err = storage.AddNewUser(ctx, ownerId)
+	require.NoError(t, err)
+	var books []messages.WishItem
+	for i := 1; i <= 7; i++ {
+		books = append(books, messages.WishItem{Name: fmt.Sprintf("Книга %d", i)})
+	}
+	err = storage.ImportWishList(ctx, ownerId, messages.Categories{
+		{Name: "Книги", Items: books},
+		{Name: "Игры", Items: []messages.WishItem{{Name: "Катан", Note: "с дополнением", Tags: []string{"настолки"}}}},
+	})
+	require.NoError(t, err)
+
+	t.Run("Should ask for a query and show the first page", func(t *testing.T) {
+		send("/find")
+		send("книга")
+		last := sender.last()
+		require.Contains(t, last.text, "Нашлось 7")
+		require.Equal(t, "/card", last.buttons[0][0].Value[:5])
+		require.Equal(t, "▶️", last.buttons[5][0].DisplayName)
+	})
+
+	t.Run("Should page through results", func(t *testing.T) {
+		send("/find_page 5")
+		last := sender.last()
+		require.Contains(t, last.text, "показаны 6–7")
+		require.Equal(t, "Книга 6", last.buttons[0][0].DisplayName)
+		require.Equal(t, "◀️", last.buttons[2][0].DisplayName)
+	})
+
+	t.Run("Should show an item card", func(t *testing.T) {
+		send("/find #настолки")
+		send(sender.last().buttons[0][0].Value)
+		last := sender.last()
+		require.Contains(t, last.text, "Заметка: с дополнением")
+		require.Contains(t, last.text, "Теги: #настолки")
+		require.Contains(t, last.text, "категория: Игры")
+		require.Equal(t, "/find_page 0", last.buttons[0][0].Value)
+	})
+
+	t.Run("Should say when nothing is found", func(t *testing.T) {
+		send("/find самокат")
+		require.Contains(t, sender.last().text, "ничего не нашлось")
+	})
+}
@@ -0,0 +1,170 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RevisionKind string
+
+const (
+	RevisionItemUpdated     RevisionKind = "item_updated"
+	RevisionItemDeleted     RevisionKind = "item_deleted"
+	RevisionCategoryRenamed RevisionKind = "category_renamed"
+	RevisionCategoryDeleted RevisionKind = "category_deleted"
+	RevisionListDeleted     RevisionKind = "list_deleted"
+)
+
+// UndoWindow is how long the ↩️ button of a confirmation keeps working.
+const UndoWindow = 10 * time.Minute
+
+// Revision is an item or a category as it was before a write changed or removed it. Storage keeps
+// the latest revisions of every user, newest on top, so the write can be reverted.
+type Revision struct {
+	ID     int64
+	Kind   RevisionKind
+	At     time.Time
+	ListID int64
+	// Category is the name the category had, for item revisions the category the item was in.
+	Category string
+	// NewName is what the category was renamed to.
+	NewName string
+	// Position is the index of the item in its category or of the category in the list.
+	Position   int
+	Visibility Visibility
+	// Items are the item as it was, for a deleted category all of its items.
+	Items []WishItem
+	// List is the deleted list, Position is then its index among the lists of the user.
+	List *DeletedList
+}
+
+// DeletedList is what it takes to bring a deleted list back as it was.
+type DeletedList struct {
+	Name       string
+	ShareToken string
+	Followers  []int64
+	Categories []DeletedCategory
+}
+
+type DeletedCategory struct {
+	Name       string
+	Visibility Visibility
+	Items      []WishItem
+}
+
+// Touches says whether the revisions are about the same item or category, a newer one then
+// stands in the way of reverting the older.
+func (r Revision) Touches(other Revision) bool {
+	if r.ListID == other.ListID && (r.Kind == RevisionListDeleted || other.Kind == RevisionListDeleted) {
+		return true
+	}
+	if r.ListID == other.ListID && r.isCategory() && other.isCategory() &&
+		(r.NewName == other.Category || r.Category == other.NewName || r.Category == other.Category) {
+		return true
+	}
+	for _, item := range r.Items {
+		if slices.ContainsFunc(other.Items, func(o WishItem) bool { return o.ID == item.ID }) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Revision) isCategory() bool {
+	return r.Kind == RevisionCategoryRenamed || r.Kind == RevisionCategoryDeleted
+}
+
+func (r Revision) subject() string {
+	if r.List != nil {
+		return r.List.Name
+	}
+	if !r.isCategory() && len(r.Items) > 0 {
+		return r.Items[0].Name
+	}
+	return r.Category
+}
+
+const (
+	txtUndone          = "↩️ Отменено, «%s» снова как было"
+	txtUndoUnavailable = "Отменить уже нельзя"
+	txtConflict        = "Это уже изменилось с тех пор, отменить нельзя"
+)
+
+// WithUndo runs write in a transaction and returns the revision it pushed, which Undo reverts.
+// It is zero when write pushed none.
+func WithUndo(ctx context.Context, storage UserStorage, userId int64, write func(tx UserStorage) error) (int64, error) {
+	var revisionId int64
+	err := storage.WithTx(ctx, func(tx UserStorage) error {
+		before := latestRevision(ctx, tx, userId)
+		if err := write(tx); err != nil {
+			return err
+		}
+		if latest := latestRevision(ctx, tx, userId); latest != before {
+			revisionId = latest
+		}
+		return nil
+	})
+	return revisionId, err
+}
+
+func latestRevision(ctx context.Context, storage UserStorage, userId int64) int64 {
+	if revisions := storage.GetRevisions(ctx, userId); len(revisions) > 0 {
+		return revisions[0].ID
+	}
+	return 0
+}
+
+// Undo reverts the revision while it is younger than UndoWindow and returns what it reverted.
+func Undo(ctx context.Context, storage UserStorage, now time.Time, userId int64, revisionId int64) (Revision, error) {
+	var revision Revision
+	err := storage.WithTx(ctx, func(tx UserStorage) error {
+		revisions := tx.GetRevisions(ctx, userId)
+		i := slices.IndexFunc(revisions, func(r Revision) bool { return r.ID == revisionId })
+		if i < 0 || now.Sub(revisions[i].At) > UndoWindow {
+			return ErrUndoUnavailable
+		}
+		revision = revisions[i]
+		return tx.RevertRevision(ctx, userId, revisionId)
+	})
+	return revision, err
+}
+
+// undoButtons is the ↩️ button of a confirmation, none when there is nothing to undo.
+func undoButtons(revisionId int64) []types.TgRowButtons {
+	if revisionId == 0 {
+		return nil
+	}
+	return []types.TgRowButtons{
+		{types.TgInlineButton{DisplayName: "↩️ Отменить", Value: fmt.Sprintf("/undo %d", revisionId)}},
+	}
+}
+
+// updateUndoable saves the item and returns the button that reverts the save.
+func updateUndoable(ctx context.Context, storage UserStorage, userId int64, item WishItem) ([]types.TgRowButtons, error) {
+	revisionId, err := WithUndo(ctx, storage, userId, func(tx UserStorage) error {
+		return tx.UpdateWishItem(ctx, userId, item)
+	})
+	return undoButtons(revisionId), err
+}
+
+// checkUndo reverts the write a confirmation offered to undo, while the button is still fresh.
+func checkUndo(ctx context.Context, m *BotModel, msg Message) (bool, error) {
+	rawId, ok := strings.CutPrefix(msg.Text, "/undo ")
+	if !ok {
+		return false, nil
+	}
+	revisionId, err := strconv.ParseInt(rawId, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	revision, err := Undo(ctx, m.UserStorage, m.Clock.Now(), msg.UserID, revisionId)
+	if err != nil {
+		return true, err
+	}
+	return true, m.MessageSender.ShowButtons(msg.UserID, fmt.Sprintf(txtUndone, revision.subject()), btnStart)
+}
@@ -0,0 +1,116 @@
+package messages_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBotModel_Undo(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	storage.Clock = clk
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	model.Clock = clk
+	send := func(userId int64, text string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: userId, UserID: userId}))
+	}
+	require.NoError(t, storage.AddNewUser(ctx, ownerId))
+	require.NoError(t, storage.ImportWishList(ctx, ownerId, messages.Categories{
+		{Name: "default", Items: []messages.WishItem{{Name: "Шарф"}, {Name: "Книга"}}},
+	}))
+	items := storage.GetWishListByCategory(ctx, ownerId).Items("default")
+	scarf, book := items[0], items[1]
+	status := func(itemId int64) messages.ItemStatus {
+		item, _ := storage.GetWishListByCategory(ctx, ownerId).Find(itemId)
+		return item.CurrentStatus()
+	}
+
+	t.Run("Should undo marking a wish received", func(t *testing.T) {
+		send(ownerId, fmt.Sprintf("/got %d", scarf.ID))
+		undo := sender.last().buttons[0][0]
+		require.Equal(t, "↩️ Отменить", undo.DisplayName)
+
+		send(ownerId, undo.Value)
+		require.Equal(t, "↩️ Отменено, «Шарф» снова как было", sender.last().text)
+		require.Equal(t, messages.ItemWanted, status(scarf.ID))
+
+		send(ownerId, undo.Value)
+		require.Equal(t, "Отменить уже нельзя", sender.last().text, "The same action should not be undone twice")
+	})
+
+	t.Run("Should refuse to undo after the window", func(t *testing.T) {
+		send(ownerId, fmt.Sprintf("/got %d", book.ID))
+		undo := sender.last().buttons[0][0]
+		clk.Advance(messages.UndoWindow + time.Second)
+		send(ownerId, undo.Value)
+		require.Equal(t, "Отменить уже нельзя", sender.last().text)
+		require.Equal(t, messages.ItemReceived, status(book.ID))
+	})
+
+	t.Run("Should not undo over a later change", func(t *testing.T) {
+		send(ownerId, fmt.Sprintf("/archive_item %d", book.ID))
+		undo := sender.sent[len(sender.sent)-2].buttons[0][0]
+		require.NoError(t, storage.UpdateWishItem(ctx, ownerId, messages.WishItem{ID: book.ID, Name: "Книга", Status: messages.ItemArchived, Note: "с автографом"}))
+		send(ownerId, undo.Value)
+		require.Equal(t, "Это уже изменилось с тех пор, отменить нельзя", sender.last().text)
+		require.Equal(t, messages.ItemArchived, status(book.ID))
+	})
+
+	t.Run("Should not pass thanks for a wish no longer received", func(t *testing.T) {
+		require.NoError(t, storage.AddWishItem(ctx, ownerId, messages.WishItem{Name: "Велосипед", ReservedBy: guestId}))
+		bike := storage.GetWishListByCategory(ctx, ownerId).Items("default")[2]
+		send(ownerId, fmt.Sprintf("/got %d", bike.ID))
+		require.Contains(t, sender.last().text, "благодарности")
+		send(ownerId, sender.last().buttons[0][0].Value)
+		require.Equal(t, messages.ItemReserved, status(bike.ID))
+		send(ownerId, "Спасибо!")
+		for _, sent := range sender.sent {
+			require.NotEqual(t, guestId, sent.chatId)
+		}
+
+		send(ownerId, fmt.Sprintf("/got %d", bike.ID))
+		require.NoError(t, storage.RevertRevision(ctx, ownerId, storage.GetRevisions(ctx, ownerId)[0].ID))
+		send(ownerId, "Спасибо!")
+		for _, sent := range sender.sent {
+			require.NotEqual(t, guestId, sent.chatId, "A wish taken back elsewhere has nobody to thank either")
+		}
+	})
+
+	t.Run("Should undo deleting a list", func(t *testing.T) {
+		home, err := storage.CreateList(ctx, ownerId, "Для дома")
+		require.NoError(t, err)
+		require.NoError(t, storage.SetActiveList(ctx, ownerId, home.ID))
+		require.NoError(t, storage.AddUserCategory(ctx, ownerId, "Кухня"))
+		require.NoError(t, storage.AddWishItemToCategory(ctx, ownerId, "Кухня", messages.WishItem{Name: "Чайник"}))
+		token, err := storage.GetListShareToken(ctx, home.ID)
+		require.NoError(t, err)
+		require.NoError(t, storage.AddNewUser(ctx, guestId))
+		require.NoError(t, storage.AddListFollower(ctx, home.ID, guestId))
+		before := storage.GetListWishList(ctx, home.ID)
+
+		send(ownerId, fmt.Sprintf("/list_del %d", home.ID))
+		confirmation := sender.sent[len(sender.sent)-2]
+		require.Equal(t, "Список «Для дома» удалён", confirmation.text)
+		undo := confirmation.buttons[0][0]
+		require.Equal(t, "↩️ Отменить", undo.DisplayName)
+		require.Len(t, storage.GetLists(ctx, ownerId), 1)
+
+		send(ownerId, undo.Value)
+		require.Equal(t, "↩️ Отменено, «Для дома» снова как было", sender.last().text)
+		restored, ok := storage.GetListByShareToken(ctx, token)
+		require.True(t, ok, "The shared link should work again")
+		require.Equal(t, home.ID, restored.ID)
+		require.Equal(t, before, storage.GetListWishList(ctx, home.ID))
+		require.Equal(t, []int64{guestId}, storage.GetListFollowers(ctx, home.ID))
+	})
+}
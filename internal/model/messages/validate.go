@@ -0,0 +1,261 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type ValidationField string
+
+const (
+	FieldCategory ValidationField = "category"
+	FieldListName ValidationField = "list"
+	FieldItemName ValidationField = "name"
+	FieldURL      ValidationField = "url"
+	FieldNote     ValidationField = "note"
+	FieldTags     ValidationField = "tags"
+	FieldItems    ValidationField = "items"
+)
+
+type ValidationReason string
+
+const (
+	ReasonEmpty     ValidationReason = "empty"
+	ReasonTooLong   ValidationReason = "too_long"
+	ReasonCommand   ValidationReason = "command"
+	ReasonReserved  ValidationReason = "reserved"
+	ReasonDuplicate ValidationReason = "duplicate"
+	ReasonScheme    ValidationReason = "scheme"
+	ReasonTooMany   ValidationReason = "too_many"
+	// ReasonQuota means the user has stored as much as allowed.
+	ReasonQuota ValidationReason = "quota"
+)
+
+// ValidationError is returned for user input that must not be saved. Limit is the bound
+// that was exceeded, for the reasons that have one.
+type ValidationError struct {
+	Field  ValidationField
+	Reason ValidationReason
+	Limit  int
+}
+
+func (e *ValidationError) Error() string {
+	if e.Limit > 0 {
+		return fmt.Sprintf("invalid %s: %s (limit %d)", e.Field, e.Reason, e.Limit)
+	}
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+var fieldNames = map[ValidationField]string{
+	FieldCategory: "название категории",
+	FieldListName: "название списка",
+	FieldItemName: "название",
+	FieldURL:      "ссылка",
+	FieldNote:     "заметка",
+}
+
+// Text explains the problem to the user in the words the bot uses.
+func (e *ValidationError) Text() string {
+	name := fieldNames[e.Field]
+	switch {
+	case e.Field == FieldItemName && e.Reason == ReasonEmpty:
+		return "нет ни названия, ни ссылки"
+	case e.Field == FieldURL && e.Reason == ReasonScheme:
+		return "ссылка должна начинаться с http:// или https://"
+	case e.Field == FieldItems:
+		return fmt.Sprintf("больше %d хотелок сохранить нельзя, уберите ненужные или отправьте их в архив", e.Limit)
+	case e.Field == FieldCategory && e.Reason == ReasonQuota:
+		return fmt.Sprintf("больше %d категорий в списке создать нельзя", e.Limit)
+	case e.Field == FieldTags:
+		return fmt.Sprintf("больше %d тегов у хотелки быть не может", e.Limit)
+	case e.Reason == ReasonEmpty:
+		return name + " не может быть пустым"
+	case e.Reason == ReasonTooLong:
+		return fmt.Sprintf("%s длиннее %d символов", name, e.Limit)
+	case e.Reason == ReasonCommand:
+		return name + " не может начинаться с «/»"
+	case e.Reason == ReasonReserved:
+		return "такое " + name + " занято ботом"
+	case e.Reason == ReasonDuplicate:
+		return "категория с таким названием уже есть"
+	}
+	return name + " не подходит"
+}
+
+// ValidationText is the explanation of a validation error, empty for any other error.
+func ValidationText(err error) string {
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		return invalid.Text()
+	}
+	return ""
+}
+
+// Limits bound what a user can store. Lengths are counted in characters, quotas per user
+// for items and per list for categories.
+type Limits struct {
+	MaxCategoryName int
+	MaxListName     int
+	MaxItemName     int
+	MaxURL          int
+	MaxNote         int
+	MaxTags         int
+	MaxCategories   int
+	MaxItems        int
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxCategoryName: 64,
+		MaxListName:     64,
+		MaxItemName:     256,
+		MaxURL:          2048,
+		MaxNote:         1000,
+		MaxTags:         10,
+		MaxCategories:   50,
+		MaxItems:        500,
+	}
+}
+
+// ValidateCategoryName checks a new name against the names of the other categories of the list.
+func (l Limits) ValidateCategoryName(name string, existing []string) error {
+	if err := l.validateTitle(FieldCategory, name, l.MaxCategoryName); err != nil {
+		return err
+	}
+	if name == "default" || name == txtNoCategory {
+		return &ValidationError{Field: FieldCategory, Reason: ReasonReserved}
+	}
+	for _, other := range existing {
+		if strings.EqualFold(other, name) {
+			return &ValidationError{Field: FieldCategory, Reason: ReasonDuplicate}
+		}
+	}
+	return nil
+}
+
+func (l Limits) ValidateListName(name string) error {
+	return l.validateTitle(FieldListName, name, l.MaxListName)
+}
+
+// ValidateItem checks the fields a user types in. An item needs a name or a link.
+func (l Limits) ValidateItem(item WishItem) error {
+	if item.Name == "" && item.URL == "" {
+		return &ValidationError{Field: FieldItemName, Reason: ReasonEmpty}
+	}
+	if item.Name != "" {
+		if err := l.ValidateItemName(item.Name); err != nil {
+			return err
+		}
+	}
+	if err := l.ValidateURL(item.URL); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(item.Note) > l.MaxNote {
+		return &ValidationError{Field: FieldNote, Reason: ReasonTooLong, Limit: l.MaxNote}
+	}
+	if len(item.Tags) > l.MaxTags {
+		return &ValidationError{Field: FieldTags, Reason: ReasonTooMany, Limit: l.MaxTags}
+	}
+	return nil
+}
+
+func (l Limits) ValidateItemName(name string) error {
+	return l.validateTitle(FieldItemName, name, l.MaxItemName)
+}
+
+// ValidateURL accepts an empty link and absolute http and https ones.
+func (l Limits) ValidateURL(rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	if len(rawURL) > l.MaxURL {
+		return &ValidationError{Field: FieldURL, Reason: ReasonTooLong, Limit: l.MaxURL}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ValidationError{Field: FieldURL, Reason: ReasonScheme}
+	}
+	return nil
+}
+
+// CheckItemQuota says whether count more items fit next to the ones the user already has.
+func (l Limits) CheckItemQuota(existing, count int) error {
+	if existing+count > l.MaxItems {
+		return &ValidationError{Field: FieldItems, Reason: ReasonQuota, Limit: l.MaxItems}
+	}
+	return nil
+}
+
+// CheckCategoryQuota says whether count more categories fit into a list with existing ones.
+func (l Limits) CheckCategoryQuota(existing, count int) error {
+	if existing+count > l.MaxCategories {
+		return &ValidationError{Field: FieldCategory, Reason: ReasonQuota, Limit: l.MaxCategories}
+	}
+	return nil
+}
+
+func (l Limits) validateTitle(field ValidationField, value string, limit int) error {
+	switch {
+	case strings.TrimSpace(value) == "":
+		return &ValidationError{Field: field, Reason: ReasonEmpty}
+	case strings.HasPrefix(value, "/"):
+		return &ValidationError{Field: field, Reason: ReasonCommand}
+	case utf8.RuneCountInString(value) > limit:
+		return &ValidationError{Field: field, Reason: ReasonTooLong, Limit: limit}
+	}
+	return nil
+}
+
+// CountItems is what the item quota is checked against: every item of every list.
+func CountItems(ctx context.Context, storage WishListsReader, userId int64) int {
+	n := 0
+	for _, list := range storage.GetLists(ctx, userId) {
+		n += storage.GetListWishList(ctx, list.ID).Count()
+	}
+	return n
+}
+
+// checkNewItem validates an item about to be added together with the quota of the user.
+func checkNewItem(ctx context.Context, m *BotModel, userId int64, item WishItem) error {
+	if err := m.Limits.ValidateItem(item); err != nil {
+		return err
+	}
+	return m.Limits.CheckItemQuota(CountItems(ctx, m.UserStorage, userId), 1)
+}
+
+// checkNewCategory validates a category about to be added to the active list.
+func checkNewCategory(ctx context.Context, m *BotModel, userId int64, name string) error {
+	existing := m.UserStorage.GetCategories(ctx, userId)
+	if err := m.Limits.ValidateCategoryName(name, existing); err != nil {
+		return err
+	}
+	return m.Limits.CheckCategoryQuota(len(existing), 1)
+}
+
+// rePrompt shows what is wrong and asks again: the command stays pending, so the next message
+// is another attempt. Quota errors end the dialog, as trying again would not help.
+func rePrompt(m *BotModel, userId int64, err error, lastCmd string, prompt string) error {
+	text := ValidationText(err)
+	if text == "" {
+		return err
+	}
+	text = "⚠️ " + capitalize(text)
+	var invalid *ValidationError
+	if errors.As(err, &invalid) && invalid.Reason == ReasonQuota {
+		return m.MessageSender.ShowButtons(userId, text, btnStart)
+	}
+	if lastCmd != "" {
+		m.lastUserCmd[userId] = lastCmd
+	}
+	return m.MessageSender.ShowButtons(userId, text+"\n"+prompt, cancelBtn)
+}
+
+func capitalize(text string) string {
+	first, size := utf8.DecodeRuneInString(text)
+	return string(unicode.ToUpper(first)) + text[size:]
+}
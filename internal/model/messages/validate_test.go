@@ -0,0 +1,97 @@
+package messages_test
+
+import (
+	"context"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func requireInvalid(t *testing.T, err error, field messages.ValidationField, reason messages.ValidationReason) {
+	var invalid *messages.ValidationError
+	require.ErrorAs(t, err, &invalid)
+	require.Equal(t, field, invalid.Field)
+	require.Equal(t, reason, invalid.Reason)
+}
+
+func TestLimits(t *testing.T) {
+	limits := messages.DefaultLimits()
+
+	t.Run("Should validate category names", func(t *testing.T) {
+		require.NoError(t, limits.ValidateCategoryName("Книги", []string{"Игры"}))
+		requireInvalid(t, limits.ValidateCategoryName("  ", nil), messages.FieldCategory, messages.ReasonEmpty)
+		requireInvalid(t, limits.ValidateCategoryName("/show_item", nil), messages.FieldCategory, messages.ReasonCommand)
+		requireInvalid(t, limits.ValidateCategoryName(strings.Repeat("я", 4000), nil), messages.FieldCategory, messages.ReasonTooLong)
+		requireInvalid(t, limits.ValidateCategoryName("default", nil), messages.FieldCategory, messages.ReasonReserved)
+		requireInvalid(t, limits.ValidateCategoryName("игры", []string{"Игры"}), messages.FieldCategory, messages.ReasonDuplicate)
+	})
+
+	t.Run("Should validate items", func(t *testing.T) {
+		require.NoError(t, limits.ValidateItem(messages.WishItem{URL: "https://example.com"}))
+		requireInvalid(t, limits.ValidateItem(messages.WishItem{}), messages.FieldItemName, messages.ReasonEmpty)
+		requireInvalid(t, limits.ValidateItem(messages.WishItem{Name: "x", URL: "ftp://example.com"}), messages.FieldURL, messages.ReasonScheme)
+		requireInvalid(t, limits.ValidateItem(messages.WishItem{Name: "x", URL: "example.com"}), messages.FieldURL, messages.ReasonScheme)
+		requireInvalid(t, limits.ValidateItem(messages.WishItem{Name: "x", URL: "https://example.com/" + strings.Repeat("a", 2048)}), messages.FieldURL, messages.ReasonTooLong)
+		requireInvalid(t, limits.ValidateItem(messages.WishItem{Name: "x", Note: strings.Repeat("a", 1001)}), messages.FieldNote, messages.ReasonTooLong)
+	})
+
+	t.Run("Should check quotas", func(t *testing.T) {
+		require.NoError(t, limits.CheckItemQuota(499, 1))
+		requireInvalid(t, limits.CheckItemQuota(499, 2), messages.FieldItems, messages.ReasonQuota)
+		requireInvalid(t, limits.CheckCategoryQuota(50, 1), messages.FieldCategory, messages.ReasonQuota)
+	})
+}
+
+func TestBotModel_Validation(t *testing.T) {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	send := func(text string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: ownerId, UserID: ownerId}))
+	}
+	err = storage.AddNewUser(ctx, ownerId)
+	require.NoError(t, err)
+
+	t.Run("Should ask for a category name again", func(t *testing.T) {
+		send("/add_cat")
+		send(strings.Repeat("я", 4000))
+		require.Equal(t, "⚠️ Название категории длиннее 64 символов\nВведите название категории", sender.last().text)
+		send("/show_item")
+		require.Contains(t, sender.last().text, "не может начинаться с «/»")
+		send("Книги")
+		require.Equal(t, []string{"Книги"}, storage.GetCategories(ctx, ownerId))
+		send("/add_cat")
+		send("КНИГИ")
+		require.Contains(t, sender.last().text, "уже есть")
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/cancel", ChatID: ownerId, UserID: ownerId, IsCallback: true}))
+		require.Equal(t, []string{"Книги"}, storage.GetCategories(ctx, ownerId))
+	})
+
+	t.Run("Should ask for a link again", func(t *testing.T) {
+		send("/add_item")
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/cat Книги", ChatID: ownerId, UserID: ownerId, IsCallback: true}))
+		send("Дюна")
+		send("где-то в интернете")
+		require.Contains(t, sender.last().text, "Ссылка должна начинаться с http:// или https://")
+		require.Empty(t, storage.GetWishListByCategory(ctx, ownerId).Items("Книги"))
+		send("-")
+		items := storage.GetWishListByCategory(ctx, ownerId).Items("Книги")
+		require.Len(t, items, 1)
+		require.Equal(t, "Дюна", items[0].Name)
+		require.Empty(t, items[0].URL)
+	})
+
+	t.Run("Should stop adding when the quota is used up", func(t *testing.T) {
+		model.Limits.MaxItems = 1
+		send("/add_item")
+		require.Equal(t, "⚠️ Больше 1 хотелок сохранить нельзя, уберите ненужные или отправьте их в архив", sender.last().text)
+		send("/add Солярис https://example.com/solaris")
+		send("/draft_save")
+		require.Contains(t, sender.last().text, "больше 1 хотелок")
+		require.Equal(t, 1, storage.GetWishListByCategory(ctx, ownerId).Count())
+	})
+}
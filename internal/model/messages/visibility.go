@@ -0,0 +1,313 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/types"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Visibility says who may see a category or an item. An item without its own visibility
+// follows its category, a category without one is public, as lists were before visibility existed.
+type Visibility string
+
+const (
+	VisibilityInherit Visibility = ""
+	VisibilityPrivate Visibility = "private"
+	VisibilityFriends Visibility = "friends"
+	VisibilityLink    Visibility = "link"
+	VisibilityPublic  Visibility = "public"
+)
+
+var visibilityNames = map[Visibility]string{
+	VisibilityPrivate: "🔒 Только я",
+	VisibilityFriends: "👥 Подписчики",
+	VisibilityLink:    "🔗 По ссылке",
+	VisibilityPublic:  "🌍 Все",
+}
+
+// Audience is who is going to read a list, ordered from the least to the most trusted.
+type Audience int
+
+const (
+	// AudiencePublic is anyone at all, for example the members of a group chat.
+	AudiencePublic Audience = iota
+	// AudienceLinkHolder opened the share link.
+	AudienceLinkHolder
+	// AudienceFollower subscribed to the list through the share link.
+	AudienceFollower
+	AudienceOwner
+)
+
+func ParseVisibility(s string) (Visibility, bool) {
+	v := Visibility(s)
+	_, ok := visibilityNames[v]
+	return v, ok || v == VisibilityInherit
+}
+
+// VisibleTo treats an unset visibility as public.
+func (v Visibility) VisibleTo(a Audience) bool {
+	switch v {
+	case VisibilityPrivate:
+		return a >= AudienceOwner
+	case VisibilityFriends:
+		return a >= AudienceFollower
+	case VisibilityLink:
+		return a >= AudienceLinkHolder
+	}
+	return true
+}
+
+// Effective resolves an item's visibility against the one of its category.
+func (v Visibility) Effective(category Visibility) Visibility {
+	if v != VisibilityInherit {
+		return v
+	}
+	if category != VisibilityInherit {
+		return category
+	}
+	return VisibilityPublic
+}
+
+type WishListReader interface {
+	GetListWishList(ctx context.Context, listId int64) Categories
+	GetListCategoryVisibility(ctx context.Context, listId int64) map[string]Visibility
+}
+
+// ReadWishList is the authorization layer: every view of a list shown to someone other than
+// its owner must be built from its result. Received and archived wishes are gone for them too.
+// Categories left empty are dropped as well, so not even the name of a hidden category leaks.
+func ReadWishList(ctx context.Context, storage WishListReader, listId int64, audience Audience) Categories {
+	wishList := storage.GetListWishList(ctx, listId)
+	if audience == AudienceOwner {
+		return wishList
+	}
+	categories := storage.GetListCategoryVisibility(ctx, listId)
+	result := make(Categories, 0, len(wishList))
+	for _, cat := range wishList {
+		visible := make([]WishItem, 0, len(cat.Items))
+		for _, item := range cat.Items {
+			if item.Active() && item.Visibility.Effective(categories[cat.Name]).VisibleTo(audience) {
+				visible = append(visible, item)
+			}
+		}
+		if len(visible) > 0 {
+			result = append(result, WishCategory{Name: cat.Name, Items: visible})
+		}
+	}
+	return result
+}
+
+type WishListsReader interface {
+	WishListReader
+	GetLists(ctx context.Context, userId int64) []WishList
+}
+
+type VisibleList struct {
+	WishList
+	Audience Audience
+	Items    Categories
+}
+
+// ReadWishLists reads every list of the owner through ReadWishList and skips those
+// the audience sees nothing of.
+func ReadWishLists(ctx context.Context, storage WishListsReader, ownerId int64, audience Audience) []VisibleList {
+	var result []VisibleList
+	for _, list := range storage.GetLists(ctx, ownerId) {
+		items := ReadWishList(ctx, storage, list.ID, audience)
+		if items.Count() > 0 {
+			result = append(result, VisibleList{WishList: list, Audience: audience, Items: items})
+		}
+	}
+	return result
+}
+
+type ViewerReader interface {
+	WishListsReader
+	FollowerReader
+}
+
+// ReadWishListsFor reads every list of the owner as viewerId sees it privately, each list
+// with the audience AudienceFor picks for it.
+func ReadWishListsFor(ctx context.Context, storage ViewerReader, ownerId, viewerId int64) []VisibleList {
+	var result []VisibleList
+	for _, list := range storage.GetLists(ctx, ownerId) {
+		audience := AudienceFor(ctx, storage, list, viewerId)
+		items := ReadWishList(ctx, storage, list.ID, audience)
+		if items.Count() > 0 {
+			result = append(result, VisibleList{WishList: list, Audience: audience, Items: items})
+		}
+	}
+	return result
+}
+
+// findVisibleItem looks the item up in all lists of the owner the audience may see.
+func findVisibleItem(ctx context.Context, m *BotModel, ownerId, itemId int64, audience Audience) (WishItem, bool) {
+	return findItem(ReadWishLists(ctx, m.UserStorage, ownerId, audience), itemId)
+}
+
+func findItem(lists []VisibleList, itemId int64) (WishItem, bool) {
+	for _, list := range lists {
+		if item, ok := list.Items.Find(itemId); ok {
+			return item, true
+		}
+	}
+	return WishItem{}, false
+}
+
+type FollowerReader interface {
+	GetListFollowers(ctx context.Context, listId int64) []int64
+}
+
+// AudienceFor picks the audience of a list shown privately to viewerId. A follower opened
+// the share link of one list, to the other lists of the owner they are the public.
+func AudienceFor(ctx context.Context, storage FollowerReader, list WishList, viewerId int64) Audience {
+	switch {
+	case list.OwnerID == viewerId:
+		return AudienceOwner
+	case slices.Contains(storage.GetListFollowers(ctx, list.ID), viewerId):
+		return AudienceFollower
+	}
+	return AudiencePublic
+}
+
+// FollowerListsReader is what FollowedLists needs.
+type FollowerListsReader interface {
+	GetLists(ctx context.Context, userId int64) []WishList
+	FollowerReader
+}
+
+// FollowedLists are the lists of the owner followerId subscribed to.
+func FollowedLists(ctx context.Context, storage FollowerListsReader, ownerId, followerId int64) []WishList {
+	var result []WishList
+	for _, list := range storage.GetLists(ctx, ownerId) {
+		if slices.Contains(storage.GetListFollowers(ctx, list.ID), followerId) {
+			result = append(result, list)
+		}
+	}
+	return result
+}
+
+const (
+	txtPrivacy         = "Кто видит ваш список? Выберите категорию, чтобы настроить её и отдельные хотелки."
+	txtPrivacyCategory = "Кто видит категорию «%s»? Ниже можно настроить отдельные хотелки."
+	txtPrivacyItem     = "Кто видит «%s»?"
+	txtPrivacyInherit  = "↩️ Как у категории"
+	txtPrivacySaved    = "Сохранено: %s"
+	txtPrivacyNoCat    = "Категория не найдена"
+)
+
+// checkPrivacy lets the owner set visibility of categories and items.
+func checkPrivacy(ctx context.Context, m *BotModel, msg Message) (bool, error) {
+	cmd, arg, _ := strings.Cut(msg.Text, " ")
+	switch cmd {
+	case "/privacy":
+		return true, showPrivacy(ctx, m, msg.UserID)
+	case "/privacy_cat":
+		return true, showCategoryPrivacy(ctx, m, msg.UserID, arg)
+	case "/privacy_item":
+		return true, showItemPrivacy(ctx, m, msg.UserID, arg)
+	case "/vis_cat":
+		level, catName, _ := strings.Cut(arg, " ")
+		v, ok := ParseVisibility(level)
+		if !ok || v == VisibilityInherit {
+			return false, nil
+		}
+		if err := m.UserStorage.SetCategoryVisibility(ctx, msg.UserID, catName, v); err != nil {
+			return true, err
+		}
+		if err := m.MessageSender.SendMessage(msg.UserID, fmt.Sprintf(txtPrivacySaved, visibilityNames[v])); err != nil {
+			return true, err
+		}
+		return true, showCategoryPrivacy(ctx, m, msg.UserID, catName)
+	case "/vis_item":
+		level, rawId, _ := strings.Cut(arg, " ")
+		v, ok := ParseVisibility(level)
+		itemId, err := strconv.ParseInt(rawId, 10, 64)
+		if !ok || err != nil {
+			return false, nil
+		}
+		wishList := m.UserStorage.GetWishListByCategory(ctx, msg.UserID)
+		item, ok := wishList.Find(itemId)
+		if !ok {
+			return true, m.MessageSender.SendMessage(msg.UserID, txtReserveGone)
+		}
+		item.Visibility = v
+		if err := m.UserStorage.UpdateWishItem(ctx, msg.UserID, item); err != nil {
+			return true, err
+		}
+		return true, showCategoryPrivacy(ctx, m, msg.UserID, wishList.CategoryOf(itemId))
+	}
+	return false, nil
+}
+
+func showPrivacy(ctx context.Context, m *BotModel, userId int64) error {
+	wishList := m.UserStorage.GetWishListByCategory(ctx, userId)
+	levels := m.UserStorage.GetCategoryVisibility(ctx, userId)
+	buttons := make([]types.TgRowButtons, 0, len(wishList))
+	for _, cat := range wishList {
+		buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{
+			DisplayName: categoryTitle(cat.Name) + " — " + visibilityNames[levels[cat.Name].Effective(VisibilityInherit)],
+			Value:       "/privacy_cat " + cat.Name,
+		}})
+	}
+	return m.MessageSender.ShowButtons(userId, txtPrivacy, append(buttons, btnStart...))
+}
+
+func showCategoryPrivacy(ctx context.Context, m *BotModel, userId int64, catName string) error {
+	items, ok := m.UserStorage.GetWishListByCategory(ctx, userId).Get(catName)
+	if !ok {
+		return m.MessageSender.SendMessage(userId, txtPrivacyNoCat)
+	}
+	category := m.UserStorage.GetCategoryVisibility(ctx, userId)[catName]
+	buttons := visibilityButtons(category.Effective(VisibilityInherit), func(v Visibility) string {
+		return fmt.Sprintf("/vis_cat %s %s", v, catName)
+	})
+	for _, item := range items {
+		buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{
+			DisplayName: item.Name + " — " + visibilityNames[item.Visibility.Effective(category)],
+			Value:       fmt.Sprintf("/privacy_item %d", item.ID),
+		}})
+	}
+	return m.MessageSender.ShowButtons(userId, fmt.Sprintf(txtPrivacyCategory, categoryTitle(catName)), append(buttons, btnStart...))
+}
+
+func showItemPrivacy(ctx context.Context, m *BotModel, userId int64, rawId string) error {
+	itemId, err := strconv.ParseInt(rawId, 10, 64)
+	if err != nil {
+		return nil
+	}
+	item, ok := m.UserStorage.GetWishListByCategory(ctx, userId).Find(itemId)
+	if !ok {
+		return m.MessageSender.SendMessage(userId, txtReserveGone)
+	}
+	buttons := visibilityButtons(item.Visibility, func(v Visibility) string {
+		return fmt.Sprintf("/vis_item %s %d", v, itemId)
+	})
+	buttons = append(buttons, types.TgRowButtons{types.TgInlineButton{
+		DisplayName: txtPrivacyInherit,
+		Value:       fmt.Sprintf("/vis_item %s %d", VisibilityInherit, itemId),
+	}})
+	return m.MessageSender.ShowButtons(userId, fmt.Sprintf(txtPrivacyItem, item.Name), append(buttons, cancelBtn...))
+}
+
+func visibilityButtons(current Visibility, value func(v Visibility) string) []types.TgRowButtons {
+	row := make(types.TgRowButtons, 0, len(visibilityNames))
+	for _, v := range []Visibility{VisibilityPrivate, VisibilityFriends, VisibilityLink, VisibilityPublic} {
+		name := visibilityNames[v]
+		if v == current {
+			name = "✅ " + name
+		}
+		row = append(row, types.TgInlineButton{DisplayName: name, Value: value(v)})
+	}
+	return []types.TgRowButtons{row[:2], row[2:]}
+}
+
+func categoryTitle(name string) string {
+	if name == "default" {
+		return txtNoCategory
+	}
+	return name
+}
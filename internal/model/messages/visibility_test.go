@@ -0,0 +1,205 @@
+package messages_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"slices"
+	"testing"
+)
+
+// newPrivacyStorage gives owner 1 one item for every way of hiding it. Follower 2 subscribed,
+// user 3 is a stranger.
+func newPrivacyStorage(t *testing.T) *inmemory.Storage {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	for _, id := range []int64{1, 2, 3} {
+		err := storage.AddNewUser(ctx, id)
+		require.NoError(t, err)
+	}
+	err = storage.SetUserName(ctx, 1, "Аня")
+	require.NoError(t, err)
+	list, _ := storage.GetActiveList(ctx, 1)
+	err = storage.AddListFollower(ctx, list.ID, 2)
+	require.NoError(t, err)
+	err = storage.ImportWishList(ctx, 1, messages.Categories{
+		{Name: "default", Items: []messages.WishItem{
+			{Name: "Публичное"},
+			{Name: "Личное", Visibility: messages.VisibilityPrivate, Price: 100000},
+			{Name: "ДляДрузей", Visibility: messages.VisibilityFriends},
+			{Name: "ПоСсылке", Visibility: messages.VisibilityLink},
+		}},
+		{Name: "Секреты", Items: []messages.WishItem{
+			{Name: "ИзСекретов"},
+			{Name: "ОткрытыйСекрет", Visibility: messages.VisibilityPublic},
+		}},
+	})
+	require.NoError(t, err)
+	err = storage.SetCategoryVisibility(ctx, 1, "Секреты", messages.VisibilityPrivate)
+	require.NoError(t, err)
+	return storage
+}
+
+func visibleNames(wishList messages.Categories) []string {
+	var names []string
+	for _, cat := range wishList {
+		for _, item := range cat.Items {
+			names = append(names, item.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestReadWishList(t *testing.T) {
+	ctx := context.Background()
+	storage := newPrivacyStorage(t)
+	list, _ := storage.GetActiveList(ctx, 1)
+	tests := []struct {
+		name     string
+		audience messages.Audience
+		want     []string
+	}{
+		{"public", messages.AudiencePublic, []string{"ОткрытыйСекрет", "Публичное"}},
+		{"link holders", messages.AudienceLinkHolder, []string{"ОткрытыйСекрет", "ПоСсылке", "Публичное"}},
+		{"followers", messages.AudienceFollower, []string{"ДляДрузей", "ОткрытыйСекрет", "ПоСсылке", "Публичное"}},
+		{"owner", messages.AudienceOwner, []string{"ДляДрузей", "ИзСекретов", "Личное", "ОткрытыйСекрет", "ПоСсылке", "Публичное"}},
+	}
+	for _, tt := range tests {
+		t.Run("Should show "+tt.name+" only what they may see", func(t *testing.T) {
+			require.Equal(t, tt.want, visibleNames(messages.ReadWishList(ctx, storage, list.ID, tt.audience)))
+		})
+	}
+
+	t.Run("Should drop categories left empty", func(t *testing.T) {
+		err := storage.AddUserCategory(ctx, 1, "Тайное")
+		require.NoError(t, err)
+		err = storage.AddWishItemToCategory(ctx, 1, "Тайное", messages.WishItem{Name: "Х", Visibility: messages.VisibilityPrivate})
+		require.NoError(t, err)
+		require.NotContains(t, messages.ReadWishList(ctx, storage, list.ID, messages.AudiencePublic), "Тайное")
+	})
+
+	t.Run("Should pick audience by relation to the owner", func(t *testing.T) {
+		require.Equal(t, messages.AudienceOwner, messages.AudienceFor(ctx, storage, list, 1))
+		require.Equal(t, messages.AudienceFollower, messages.AudienceFor(ctx, storage, list, 2))
+		require.Equal(t, messages.AudiencePublic, messages.AudienceFor(ctx, storage, list, 3))
+	})
+}
+
+func requireNoLeak(t *testing.T, text string, hidden ...string) {
+	for _, name := range hidden {
+		require.NotContains(t, text, name)
+	}
+}
+
+func TestBotModel_VisibilityOnReadPaths(t *testing.T) {
+	ctx := context.Background()
+	storage := newPrivacyStorage(t)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	hiddenFromFollowers := []string{"Личное", "ИзСекретов"}
+	hiddenFromPublic := append([]string{"ДляДрузей", "ПоСсылке"}, hiddenFromFollowers...)
+
+	t.Run("Should hide non-public items in group chats", func(t *testing.T) {
+		msg := messages.Message{Text: "/show_item", ChatID: -1, UserID: 2, ReplyToUserID: 1}
+		require.NoError(t, model.OnMessage(ctx, msg))
+		last := sender.last()
+		require.Contains(t, last.text, "Публичное")
+		requireNoLeak(t, last.text, hiddenFromPublic...)
+		require.Len(t, last.buttons, 2, "Only visible items should get buttons")
+	})
+
+	t.Run("Should show followers their part of the list", func(t *testing.T) {
+		token, err := storage.GetShareToken(ctx, 1)
+		require.NoError(t, err)
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/start w_" + token, ChatID: 2, UserID: 2}))
+		text := sender.last().text
+		require.Contains(t, text, "ДляДрузей")
+		requireNoLeak(t, text, hiddenFromFollowers...)
+	})
+
+	t.Run("Should not let friends act on hidden items", func(t *testing.T) {
+		hidden := storage.GetWishListByCategory(ctx, 1).Items("default")[1]
+		require.Equal(t, "Личное", hidden.Name)
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: fmt.Sprintf("/reserve 1 %d", hidden.ID), ChatID: -1, UserID: 2}))
+		require.Equal(t, "Этой хотелки уже нет в списке", sender.last().text)
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: fmt.Sprintf("/chip 1 %d", hidden.ID), ChatID: 2, UserID: 2}))
+		require.Equal(t, "Этой хотелки уже нет в списке", sender.last().text)
+		require.Zero(t, storage.GetWishListByCategory(ctx, 1).Items("default")[1].ReservedBy)
+	})
+
+	t.Run("Should mark hidden items in the owner's own list", func(t *testing.T) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/show_item", ChatID: 1, UserID: 1}))
+		text := sender.last().text
+		require.Contains(t, text, "Личное. Сайт: . Цена: 1 000 🔒")
+		require.Contains(t, text, "ИзСекретов. Сайт:  🔒")
+	})
+}
+
+func TestBotModel_Privacy(t *testing.T) {
+	ctx := context.Background()
+	storage := newPrivacyStorage(t)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	list, _ := storage.GetActiveList(ctx, 1)
+	send := func(text string) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: text, ChatID: 1, UserID: 1}))
+	}
+
+	t.Run("Should set category visibility", func(t *testing.T) {
+		send("/vis_cat friends Секреты")
+		require.Equal(t, messages.VisibilityFriends, storage.GetCategoryVisibility(ctx, 1)["Секреты"])
+		require.Contains(t, visibleNames(messages.ReadWishList(ctx, storage, list.ID, messages.AudienceFollower)), "ИзСекретов")
+	})
+
+	t.Run("Should set and reset item visibility", func(t *testing.T) {
+		item := storage.GetWishListByCategory(ctx, 1).Items("default")[0]
+		send(fmt.Sprintf("/vis_item private %d", item.ID))
+		require.Equal(t, messages.VisibilityPrivate, storage.GetWishListByCategory(ctx, 1).Items("default")[0].Visibility)
+		send(fmt.Sprintf("/vis_item  %d", item.ID))
+		require.Equal(t, messages.VisibilityInherit, storage.GetWishListByCategory(ctx, 1).Items("default")[0].Visibility)
+	})
+
+	t.Run("Should reject unknown levels", func(t *testing.T) {
+		send("/vis_cat everyone Секреты")
+		require.Equal(t, messages.VisibilityFriends, storage.GetCategoryVisibility(ctx, 1)["Секреты"])
+	})
+}
+
+func TestBotModel_FollowIsPerList(t *testing.T) {
+	ctx := context.Background()
+	storage := newPrivacyStorage(t)
+	sender := &fakeSender{}
+	model := messages.New(storage, sender)
+	home, _ := storage.GetActiveList(ctx, 1)
+	kids, err := storage.CreateList(ctx, 1, "Для ребёнка")
+	require.NoError(t, err)
+	require.NoError(t, storage.SetActiveList(ctx, 1, kids.ID))
+	require.NoError(t, storage.AddWishItem(ctx, 1, messages.WishItem{Name: "Самокат", Visibility: messages.VisibilityFriends}))
+	require.NoError(t, storage.SetActiveList(ctx, 1, home.ID))
+	scooter := messages.ReadWishList(ctx, storage, kids.ID, messages.AudienceOwner).Items("default")[0]
+
+	t.Run("Should treat a follower of one list as a stranger to another", func(t *testing.T) {
+		require.Equal(t, messages.AudienceFollower, messages.AudienceFor(ctx, storage, home, 2))
+		require.Equal(t, messages.AudiencePublic, messages.AudienceFor(ctx, storage, kids, 2))
+	})
+
+	t.Run("Should not show a follower the lists they didn't follow", func(t *testing.T) {
+		token, err := storage.GetListShareToken(ctx, home.ID)
+		require.NoError(t, err)
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: "/start w_" + token, ChatID: 2, UserID: 2}))
+		text := sender.last().text
+		require.Contains(t, text, "ДляДрузей")
+		requireNoLeak(t, text, "Самокат")
+	})
+
+	t.Run("Should not let a follower act on items of another list", func(t *testing.T) {
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: fmt.Sprintf("/chip 1 %d", scooter.ID), ChatID: 2, UserID: 2}))
+		require.Equal(t, "Этой хотелки уже нет в списке", sender.last().text)
+		require.NoError(t, model.OnMessage(ctx, messages.Message{Text: fmt.Sprintf("/reserve 1 %d", scooter.ID), ChatID: -1, UserID: 2}))
+		require.Equal(t, "Этой хотелки уже нет в списке", sender.last().text)
+	})
+}
@@ -0,0 +1,137 @@
+package price
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var currencyAliases = map[string]string{
+	"₽":      "RUB",
+	"р":      "RUB",
+	"р.":     "RUB",
+	"руб":    "RUB",
+	"руб.":   "RUB",
+	"рубль":  "RUB",
+	"рубля":  "RUB",
+	"рублей": "RUB",
+	"rub":    "RUB",
+	"rur":    "RUB",
+	"$":      "USD",
+	"usd":    "USD",
+	"€":      "EUR",
+	"eur":    "EUR",
+	"£":      "GBP",
+	"gbp":    "GBP",
+	"₸":      "KZT",
+	"kzt":    "KZT",
+}
+
+var currencySymbols = map[string]string{
+	"RUB": "₽",
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"KZT": "₸",
+}
+
+// Parse converts a human or machine written amount ("15 990", "1,299.99", "1 299,99")
+// into minor units (kopecks, cents).
+func Parse(s string) (int64, bool) {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '\'' {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return 0, false
+	}
+	intPart, fracPart := s, ""
+	lastComma, lastDot := strings.LastIndex(s, ","), strings.LastIndex(s, ".")
+	switch {
+	case lastComma >= 0 && lastDot >= 0:
+		sep := max(lastComma, lastDot)
+		intPart, fracPart = s[:sep], s[sep+1:]
+		intPart = strings.NewReplacer(",", "", ".", "").Replace(intPart)
+	case lastComma >= 0:
+		intPart, fracPart = splitDecimal(s, ",")
+	case lastDot >= 0:
+		intPart, fracPart = splitDecimal(s, ".")
+	}
+	if intPart == "" || len(fracPart) > 2 || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, false
+	}
+	units, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	minor := int64(0)
+	if fracPart != "" {
+		fracPart += strings.Repeat("0", 2-len(fracPart))
+		minor, _ = strconv.ParseInt(fracPart, 10, 64)
+	}
+	return units*100 + minor, true
+}
+
+func splitDecimal(s, sep string) (string, string) {
+	parts := strings.Split(s, sep)
+	last := parts[len(parts)-1]
+	if len(parts) == 2 && len(last) <= 2 {
+		return parts[0], last
+	}
+	return strings.Join(parts, ""), ""
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeCurrency maps a currency symbol, abbreviation or ISO code to the ISO code.
+func NormalizeCurrency(s string) string {
+	s = strings.TrimSpace(s)
+	if code, ok := currencyAliases[strings.ToLower(s)]; ok {
+		return code
+	}
+	if len(s) == 3 {
+		return strings.ToUpper(s)
+	}
+	return ""
+}
+
+func IsCurrency(s string) bool {
+	_, ok := currencyAliases[strings.ToLower(strings.TrimSpace(s))]
+	return ok
+}
+
+// Format renders minor units the way users write prices: "15 990 ₽", "19,99 $".
+func Format(amount int64, currency string) string {
+	var b strings.Builder
+	if amount < 0 {
+		b.WriteString("-")
+		amount = -amount
+	}
+	digits := strconv.FormatInt(amount/100, 10)
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(" ")
+		}
+		b.WriteRune(d)
+	}
+	if cents := amount % 100; cents != 0 {
+		b.WriteString("," + strconv.FormatInt(cents/10, 10) + strconv.FormatInt(cents%10, 10))
+	}
+	if currency != "" {
+		symbol, ok := currencySymbols[currency]
+		if !ok {
+			symbol = currency
+		}
+		b.WriteString(" " + symbol)
+	}
+	return b.String()
+}
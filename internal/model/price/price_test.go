@@ -0,0 +1,53 @@
+package price
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected int64
+	}{
+		{"15990", 1599000},
+		{"15 990", 1599000},
+		{"15 990", 1599000},
+		{"15.990", 1599000},
+		{"1,299.99", 129999},
+		{"1 299,99", 129999},
+		{"1.299,9", 129990},
+		{"19.99", 1999},
+		{"19,5", 1950},
+		{"1,000,000", 100000000},
+	}
+	for _, c := range cases {
+		t.Run(c.in, func(t *testing.T) {
+			actual, ok := Parse(c.in)
+			require.Truef(t, ok, "Should parse '%s'", c.in)
+			require.Equal(t, c.expected, actual)
+		})
+	}
+
+	t.Run("Shouldn't parse garbage", func(t *testing.T) {
+		for _, in := range []string{"", "abc", "12a", "1.2.3,456", "-"} {
+			_, ok := Parse(in)
+			require.Falsef(t, ok, "Shouldn't parse '%s'", in)
+		}
+	})
+}
+
+func TestNormalizeCurrency(t *testing.T) {
+	require.Equal(t, "RUB", NormalizeCurrency("₽"))
+	require.Equal(t, "RUB", NormalizeCurrency("руб."))
+	require.Equal(t, "USD", NormalizeCurrency("$"))
+	require.Equal(t, "CNY", NormalizeCurrency("cny"))
+	require.Equal(t, "", NormalizeCurrency("рублей много"))
+}
+
+func TestFormat(t *testing.T) {
+	require.Equal(t, "15 990 ₽", Format(1599000, "RUB"))
+	require.Equal(t, "1 299,99 $", Format(129999, "USD"))
+	require.Equal(t, "999,05 CNY", Format(99905, "CNY"))
+	require.Equal(t, "100", Format(10000, ""))
+}
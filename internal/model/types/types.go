@@ -6,3 +6,9 @@ type TgInlineButton struct {
 }
 
 type TgRowButtons []TgInlineButton
+
+type TgPhoto struct {
+	FileID string
+	Data   []byte
+	URL    string
+}
@@ -0,0 +1,230 @@
+package pricewatch
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/linkmeta"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const JobKind = "price_watch"
+
+type Options struct {
+	// Spec is how often the scheduler looks for watches to check, see scheduler.ParseSpec.
+	Spec string
+	// CheckEvery is how often a single link is fetched.
+	CheckEvery time.Duration
+	// HostInterval is the pause between two fetches from the same host. Watches of a busy host
+	// wait for the next run instead.
+	HostInterval time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Spec:         "@every 10m",
+		CheckEvery:   6 * time.Hour,
+		HostInterval: time.Minute,
+	}
+}
+
+type Storage interface {
+	GetPriceWatches(ctx context.Context) []messages.PriceWatch
+	SetPriceWatch(ctx context.Context, watch messages.PriceWatch) error
+	DeletePriceWatch(ctx context.Context, ownerId int64, itemId int64) error
+	AddPricePoint(ctx context.Context, itemId int64, point messages.PricePoint) error
+	GetPriceHistory(ctx context.Context, itemId int64) []messages.PricePoint
+	WithTx(ctx context.Context, f func(tx messages.UserStorage) error) error
+	GetUserName(ctx context.Context, userId int64) string
+	GetListFollowers(ctx context.Context, listId int64) []int64
+	IsFollowMuted(ctx context.Context, ownerId int64, followerId int64) bool
+	messages.WishListsReader
+}
+
+// Extractor reads the price from a page, linkmeta.Extractor with its JSON-LD, meta tag
+// and per-site parsers is the one the bot uses.
+type Extractor interface {
+	Extract(ctx context.Context, rawURL string) (linkmeta.Metadata, error)
+}
+
+type Sender interface {
+	SendMessage(userId int64, text string) error
+}
+
+type Service struct {
+	storage   Storage
+	extractor Extractor
+	sender    Sender
+	scheduler *scheduler.Scheduler
+	clock     clock.Clock
+	opts      Options
+	onError   func(watch messages.PriceWatch, err error)
+
+	mu        sync.Mutex
+	lastFetch map[string]time.Time
+}
+
+func New(storage Storage, extractor Extractor, sender Sender, sched *scheduler.Scheduler, clk clock.Clock, opts Options) *Service {
+	s := &Service{
+		storage:   storage,
+		extractor: extractor,
+		sender:    sender,
+		scheduler: sched,
+		clock:     clk,
+		opts:      opts,
+		onError:   func(messages.PriceWatch, error) {},
+		lastFetch: make(map[string]time.Time),
+	}
+	sched.Handle(JobKind, s.handle)
+	return s
+}
+
+// OnError is called when a link could not be fetched or had no price, the watch is tried again after CheckEvery.
+// It is also called for every owner or follower a price drop could not be sent to.
+func (s *Service) OnError(f func(watch messages.PriceWatch, err error)) {
+	s.onError = f
+}
+
+// Start schedules the recurring check, calling it again only replaces the job.
+func (s *Service) Start() error {
+	return s.scheduler.ScheduleRecurring(JobKind, JobKind, s.opts.Spec, "", "")
+}
+
+func (s *Service) handle(ctx context.Context, _ scheduler.Job) error {
+	return s.CheckDue(ctx)
+}
+
+// CheckDue fetches every watched link that was not checked for CheckEvery and whose host is not rate limited.
+func (s *Service) CheckDue(ctx context.Context) error {
+	for _, watch := range s.storage.GetPriceWatches(ctx) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		now := s.clock.Now()
+		if !watch.CheckedAt.IsZero() && now.Sub(watch.CheckedAt) < s.opts.CheckEvery {
+			continue
+		}
+		item, ok := findItem(ctx, s.storage, watch.OwnerID, watch.ItemID)
+		if !ok || item.URL == "" {
+			if err := s.storage.DeletePriceWatch(ctx, watch.OwnerID, watch.ItemID); err != nil {
+				return err
+			}
+			continue
+		}
+		if !item.Active() {
+			continue
+		}
+		if !s.allow(hostOf(item.URL), now) {
+			continue
+		}
+		watch.CheckedAt = now
+		if err := s.storage.SetPriceWatch(ctx, watch); err != nil {
+			return err
+		}
+		meta, err := s.extractor.Extract(ctx, item.URL)
+		if err == nil && meta.Price == 0 {
+			err = fmt.Errorf("pricewatch: no price on %s", item.URL)
+		}
+		if err != nil {
+			s.onError(watch, err)
+			continue
+		}
+		if err := s.record(ctx, watch, item, messages.PricePoint{At: now, Price: meta.Price, Currency: meta.Currency}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record stores the price when it changed and announces a drop. The price saved on the item
+// is the baseline until the first check, afterwards it follows the page.
+func (s *Service) record(ctx context.Context, watch messages.PriceWatch, item messages.WishItem, current messages.PricePoint) error {
+	previous := messages.PricePoint{Price: item.Price, Currency: item.Currency}
+	history := s.storage.GetPriceHistory(ctx, item.ID)
+	if len(history) > 0 {
+		previous = history[len(history)-1]
+	}
+	if len(history) > 0 && previous.Price == current.Price && previous.Currency == current.Currency {
+		return nil
+	}
+	if err := s.storage.AddPricePoint(ctx, item.ID, current); err != nil {
+		return err
+	}
+	// The page took a while to fetch, the owner may have edited the item meanwhile.
+	err := s.storage.WithTx(ctx, func(tx messages.UserStorage) error {
+		var ok bool
+		if item, ok = findItem(ctx, tx, watch.OwnerID, item.ID); !ok {
+			return nil
+		}
+		item.Price, item.Currency = current.Price, current.Currency
+		return tx.UpdateWishItem(ctx, watch.OwnerID, item)
+	})
+	if err != nil || item.ID == 0 || !watch.Dropped(previous, current) {
+		return err
+	}
+	s.notify(ctx, watch, item, previous, current)
+	return nil
+}
+
+// notify tells the owner and the followers allowed to see the item.
+func (s *Service) notify(ctx context.Context, watch messages.PriceWatch, item messages.WishItem, previous, current messages.PricePoint) {
+	ownerId := watch.OwnerID
+	change := price.Format(previous.Price, previous.Currency) + " → " + price.Format(current.Price, current.Currency)
+	text := fmt.Sprintf("📉 «%s» подешевело: %s\n%s", item.Name, change, item.URL)
+	if err := s.sender.SendMessage(ownerId, text); err != nil {
+		s.onError(watch, err)
+	}
+	text = fmt.Sprintf("📉 Хотелка %s «%s» подешевела: %s\n%s", messages.OwnerName(ctx, s.storage, ownerId), item.Name, change, item.URL)
+	for _, follower := range s.followers(ctx, ownerId, item.ID) {
+		if s.storage.IsFollowMuted(ctx, ownerId, follower) {
+			continue
+		}
+		if err := s.sender.SendMessage(follower, text); err != nil {
+			s.onError(watch, fmt.Errorf("follower %d: %w", follower, err))
+		}
+	}
+}
+
+func findItem(ctx context.Context, storage messages.WishListsReader, ownerId, itemId int64) (messages.WishItem, bool) {
+	for _, list := range messages.ReadWishLists(ctx, storage, ownerId, messages.AudienceOwner) {
+		if item, ok := list.Items.Find(itemId); ok {
+			return item, true
+		}
+	}
+	return messages.WishItem{}, false
+}
+
+// followers are those following the list of the item, when followers may see the item.
+func (s *Service) followers(ctx context.Context, ownerId, itemId int64) []int64 {
+	for _, list := range messages.ReadWishLists(ctx, s.storage, ownerId, messages.AudienceFollower) {
+		if _, ok := list.Items.Find(itemId); ok {
+			return s.storage.GetListFollowers(ctx, list.ID)
+		}
+	}
+	return nil
+}
+
+// allow reserves a fetch from host unless the previous one was less than HostInterval ago.
+func (s *Service) allow(host string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.lastFetch[host]; ok && now.Sub(last) < s.opts.HostInterval {
+		return false
+	}
+	s.lastFetch[host] = now
+	return true
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
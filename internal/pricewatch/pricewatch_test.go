@@ -0,0 +1,284 @@
+package pricewatch
+
+import (
+	"context"
+	"errors"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/fetcher"
+	"github.com/roman-clancy/ho4uha-bot/internal/linkmeta"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	ownerId    = int64(1)
+	followerId = int64(2)
+)
+
+type sentMessage struct {
+	userId int64
+	text   string
+}
+
+type fakeSender struct {
+	sent []sentMessage
+	fail map[int64]error
+}
+
+func (f *fakeSender) SendMessage(userId int64, text string) error {
+	if err := f.fail[userId]; err != nil {
+		return err
+	}
+	f.sent = append(f.sent, sentMessage{userId: userId, text: text})
+	return nil
+}
+
+// shop serves fixtures from testdata, the page behind a path can be swapped to change the price.
+type shop struct {
+	mu    sync.Mutex
+	pages map[string]string
+	// served runs while the service waits for a page.
+	served func()
+}
+
+func (s *shop) set(path, fixture string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[path] = fixture
+}
+
+func (s *shop) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	fixture, ok := s.pages[r.URL.Path]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if s.served != nil {
+		s.served()
+	}
+	http.ServeFile(w, r, filepath.Join("testdata", fixture))
+}
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+type env struct {
+	storage *inmemory.Storage
+	clock   *clock.Fake
+	sender  *fakeSender
+	shop    *shop
+	url     string
+	service *Service
+	sched   *scheduler.Scheduler
+	failed  []error
+}
+
+func newEnv(t *testing.T) *env {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	for _, id := range []int64{ownerId, followerId} {
+		err := storage.AddNewUser(ctx, id)
+		require.NoError(t, err)
+	}
+	err = storage.SetUserName(ctx, ownerId, "Аня")
+	require.NoError(t, err)
+	list, _ := storage.GetActiveList(ctx, ownerId)
+	err = storage.AddListFollower(ctx, list.ID, followerId)
+	require.NoError(t, err)
+	e := &env{storage: storage, clock: clock.NewFake(start), sender: &fakeSender{}, shop: &shop{pages: make(map[string]string)}}
+	server := httptest.NewServer(e.shop)
+	t.Cleanup(server.Close)
+	e.url = server.URL
+	opts := fetcher.DefaultOptions()
+	opts.AllowPrivate = true
+	e.sched = scheduler.New(storage, e.clock)
+	e.service = New(storage, linkmeta.New(fetcher.New(opts)), e.sender, e.sched, e.clock, DefaultOptions())
+	e.service.OnError(func(_ messages.PriceWatch, err error) { e.failed = append(e.failed, err) })
+	return e
+}
+
+// watch adds an item linking to path and watches it.
+func (e *env) watch(t *testing.T, path string, item messages.WishItem, threshold int64) messages.WishItem {
+	ctx := context.Background()
+	item.URL = e.url + path
+	err := e.storage.AddWishItem(ctx, ownerId, item)
+	require.NoError(t, err)
+	for _, cat := range e.storage.GetWishListByCategory(ctx, ownerId) {
+		for _, it := range cat.Items {
+			if it.URL == item.URL {
+				item = it
+			}
+		}
+	}
+	err = e.storage.SetPriceWatch(ctx, messages.PriceWatch{OwnerID: ownerId, ItemID: item.ID, Threshold: threshold, Currency: "RUB"})
+	require.NoError(t, err)
+	return item
+}
+
+func (e *env) check(t *testing.T) {
+	require.NoError(t, e.service.CheckDue(context.Background()))
+	e.clock.Advance(DefaultOptions().CheckEvery)
+}
+
+func TestService_CheckDue(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Should record prices and tell owner and followers about a drop", func(t *testing.T) {
+		e := newEnv(t)
+		e.shop.set("/lego", "lego-15990.html")
+		item := e.watch(t, "/lego", messages.WishItem{Name: "LEGO", Price: 1599000, Currency: "RUB"}, 0)
+		e.check(t)
+		require.Empty(t, e.sender.sent)
+		e.check(t)
+		require.Len(t, e.storage.GetPriceHistory(ctx, item.ID), 1, "An unchanged price is stored once")
+
+		e.shop.set("/lego", "lego-12990.html")
+		e.check(t)
+		require.Len(t, e.sender.sent, 2)
+		require.Equal(t, ownerId, e.sender.sent[0].userId)
+		require.Contains(t, e.sender.sent[0].text, "15 990 ₽ → 12 990 ₽")
+		require.Equal(t, followerId, e.sender.sent[1].userId)
+		require.Contains(t, e.sender.sent[1].text, "Хотелка Аня «LEGO»")
+		updated, _ := e.storage.GetWishListByCategory(ctx, ownerId).Find(item.ID)
+		require.Equal(t, int64(1299000), updated.Price)
+		require.Len(t, e.storage.GetPriceHistory(ctx, item.ID), 2)
+	})
+
+	t.Run("Should stay silent until the price is below the threshold", func(t *testing.T) {
+		e := newEnv(t)
+		e.shop.set("/lego", "lego-12990.html")
+		e.watch(t, "/lego", messages.WishItem{Name: "LEGO", Price: 1599000, Currency: "RUB"}, 1200000)
+		e.check(t)
+		require.Empty(t, e.sender.sent)
+		e.shop.set("/lego", "lego-11990.html")
+		e.check(t)
+		require.Len(t, e.sender.sent, 2)
+	})
+
+	t.Run("Should read prices from meta tags", func(t *testing.T) {
+		e := newEnv(t)
+		e.shop.set("/grinder", "grinder.html")
+		item := e.watch(t, "/grinder", messages.WishItem{Name: "Кофемолка"}, 0)
+		e.check(t)
+		require.Empty(t, e.sender.sent, "There is nothing to compare the first price with")
+		require.Equal(t, []messages.PricePoint{{At: start, Price: 499950, Currency: "RUB"}}, e.storage.GetPriceHistory(ctx, item.ID))
+	})
+
+	t.Run("Should not tell followers about a private item", func(t *testing.T) {
+		e := newEnv(t)
+		e.shop.set("/lego", "lego-12990.html")
+		e.watch(t, "/lego", messages.WishItem{Name: "LEGO", Price: 1599000, Currency: "RUB", Visibility: messages.VisibilityPrivate}, 0)
+		e.check(t)
+		require.Len(t, e.sender.sent, 1)
+		require.Equal(t, ownerId, e.sender.sent[0].userId)
+	})
+
+	t.Run("Should tell only the followers of the item's list", func(t *testing.T) {
+		e := newEnv(t)
+		home, _ := e.storage.GetActiveList(ctx, ownerId)
+		kids, err := e.storage.CreateList(ctx, ownerId, "Для ребёнка")
+		require.NoError(t, err)
+		require.NoError(t, e.storage.SetActiveList(ctx, ownerId, kids.ID))
+		e.shop.set("/lego", "lego-12990.html")
+		e.watch(t, "/lego", messages.WishItem{Name: "LEGO", Price: 1599000, Currency: "RUB"}, 0)
+		require.NoError(t, e.storage.SetActiveList(ctx, ownerId, home.ID))
+		e.check(t)
+		require.Len(t, e.sender.sent, 1)
+		require.Equal(t, ownerId, e.sender.sent[0].userId)
+	})
+
+	t.Run("Should keep edits made while the page was fetched", func(t *testing.T) {
+		e := newEnv(t)
+		e.shop.set("/lego", "lego-15990.html")
+		item := e.watch(t, "/lego", messages.WishItem{Name: "LEGO", Price: 1599000, Currency: "RUB"}, 0)
+		e.check(t)
+		e.shop.set("/lego", "lego-12990.html")
+		e.shop.served = func() {
+			edited := item
+			edited.Name, edited.ReservedBy = "LEGO Technic", followerId
+			require.NoError(t, e.storage.UpdateWishItem(ctx, ownerId, edited))
+		}
+		e.check(t)
+		updated, _ := e.storage.GetWishListByCategory(ctx, ownerId).Find(item.ID)
+		require.Equal(t, "LEGO Technic", updated.Name)
+		require.Equal(t, followerId, updated.ReservedBy)
+		require.Equal(t, int64(1299000), updated.Price)
+		require.Contains(t, e.sender.sent[0].text, "«LEGO Technic»")
+	})
+
+	t.Run("Should tell the other followers when one can't be reached", func(t *testing.T) {
+		e := newEnv(t)
+		const otherId = int64(3)
+		require.NoError(t, e.storage.AddNewUser(ctx, otherId))
+		list, _ := e.storage.GetActiveList(ctx, ownerId)
+		require.NoError(t, e.storage.AddListFollower(ctx, list.ID, otherId))
+		blocked := errors.New("bot was blocked by the user")
+		e.sender.fail = map[int64]error{followerId: blocked}
+		e.shop.set("/lego", "lego-15990.html")
+		e.watch(t, "/lego", messages.WishItem{Name: "LEGO", Price: 1599000, Currency: "RUB"}, 0)
+		e.check(t)
+		e.shop.set("/lego", "lego-12990.html")
+		e.check(t)
+		require.Len(t, e.sender.sent, 2)
+		require.Equal(t, otherId, e.sender.sent[1].userId)
+		require.Len(t, e.failed, 1)
+		require.ErrorIs(t, e.failed[0], blocked)
+	})
+
+	t.Run("Should fetch from one host once per interval", func(t *testing.T) {
+		e := newEnv(t)
+		e.shop.set("/lego", "lego-15990.html")
+		e.shop.set("/grinder", "grinder.html")
+		lego := e.watch(t, "/lego", messages.WishItem{Name: "LEGO"}, 0)
+		grinder := e.watch(t, "/grinder", messages.WishItem{Name: "Кофемолка"}, 0)
+		require.NoError(t, e.service.CheckDue(context.Background()))
+		require.Len(t, e.storage.GetPriceHistory(ctx, lego.ID), 1)
+		require.Empty(t, e.storage.GetPriceHistory(ctx, grinder.ID))
+		e.clock.Advance(DefaultOptions().HostInterval)
+		require.NoError(t, e.service.CheckDue(context.Background()))
+		require.Len(t, e.storage.GetPriceHistory(ctx, grinder.ID), 1)
+	})
+
+	t.Run("Should report pages without a price and retry later", func(t *testing.T) {
+		e := newEnv(t)
+		e.shop.set("/sold", "no-price.html")
+		item := e.watch(t, "/sold", messages.WishItem{Name: "LEGO"}, 0)
+		e.check(t)
+		require.Len(t, e.failed, 1)
+		watch, ok := e.storage.GetPriceWatch(ctx, ownerId, item.ID)
+		require.True(t, ok)
+		require.Equal(t, start, watch.CheckedAt)
+		require.NoError(t, e.service.CheckDue(context.Background()))
+		require.Len(t, e.failed, 2)
+	})
+
+	t.Run("Should drop watches of deleted items", func(t *testing.T) {
+		e := newEnv(t)
+		item := e.watch(t, "/lego", messages.WishItem{Name: "LEGO"}, 0)
+		err := e.storage.DeleteWishItem(ctx, ownerId, item.ID)
+		require.NoError(t, err)
+		e.check(t)
+		require.Empty(t, e.storage.GetPriceWatches(ctx))
+	})
+}
+
+func TestService_Start(t *testing.T) {
+	e := newEnv(t)
+	e.shop.set("/lego", "lego-15990.html")
+	item := e.watch(t, "/lego", messages.WishItem{Name: "LEGO"}, 0)
+	require.NoError(t, e.service.Start())
+	e.clock.Advance(10 * time.Minute)
+	done, err := e.sched.RunDue(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, done)
+	require.Len(t, e.storage.GetPriceHistory(context.Background(), item.ID), 1)
+}
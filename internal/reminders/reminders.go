@@ -0,0 +1,180 @@
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"slices"
+	"time"
+)
+
+const (
+	JobKind    = "event_reminder"
+	remindHour = 10
+)
+
+var kindEmoji = map[messages.EventKind]string{
+	messages.EventBirthday: "🎂",
+	messages.EventNewYear:  "🎄",
+	messages.EventWedding:  "💍",
+	messages.EventOther:    "📅",
+}
+
+type Storage interface {
+	GetEvents(ctx context.Context, userId int64) []messages.Event
+	GetFollowers(ctx context.Context, ownerId int64) []int64
+	GetTimeZone(ctx context.Context, userId int64) string
+	GetUserName(ctx context.Context, userId int64) string
+	messages.FollowerListsReader
+}
+
+type Sender interface {
+	SendMessage(userId int64, text string) error
+}
+
+type Linker interface {
+	ShareLink(ctx context.Context, listId int64) (string, error)
+}
+
+type Service struct {
+	storage   Storage
+	sender    Sender
+	linker    Linker
+	scheduler *scheduler.Scheduler
+	clock     clock.Clock
+}
+
+type payload struct {
+	Owner    int64  `json:"owner"`
+	Event    int64  `json:"event"`
+	Follower int64  `json:"follower"`
+	Date     string `json:"date"`
+}
+
+func New(storage Storage, sender Sender, linker Linker, sched *scheduler.Scheduler, clk clock.Clock) *Service {
+	s := &Service{
+		storage:   storage,
+		sender:    sender,
+		linker:    linker,
+		scheduler: sched,
+		clock:     clk,
+	}
+	sched.Handle(JobKind, s.handle)
+	return s
+}
+
+// PlanOwner schedules the next reminder of every event of the owner for every follower.
+// Job IDs are derived from the occurrence, so planning again only replaces the same jobs.
+func (s *Service) PlanOwner(ctx context.Context, ownerId int64) error {
+	now := s.clock.Now()
+	followers := s.storage.GetFollowers(ctx, ownerId)
+	for _, event := range s.storage.GetEvents(ctx, ownerId) {
+		for _, follower := range followers {
+			if err := s.plan(ctx, ownerId, event, follower, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Service) plan(ctx context.Context, ownerId int64, event messages.Event, followerId int64, after time.Time) error {
+	loc := clock.LoadZone(s.storage.GetTimeZone(ctx, followerId))
+	fireAt, occurrence, ok := NextReminder(event, loc, after)
+	if !ok {
+		return nil
+	}
+	p := payload{Owner: ownerId, Event: event.ID, Follower: followerId, Date: occurrence.Format(time.DateOnly)}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	id := fmt.Sprintf("%s:%d:%d:%d:%s", JobKind, ownerId, event.ID, followerId, p.Date)
+	return s.scheduler.Schedule(scheduler.Job{
+		ID:      id,
+		Kind:    JobKind,
+		RunAt:   fireAt,
+		Payload: string(data),
+		Key:     id,
+	})
+}
+
+func (s *Service) handle(ctx context.Context, job scheduler.Job) error {
+	var p payload
+	if err := json.Unmarshal([]byte(job.Payload), &p); err != nil {
+		return err
+	}
+	events := s.storage.GetEvents(ctx, p.Owner)
+	idx := slices.IndexFunc(events, func(e messages.Event) bool { return e.ID == p.Event })
+	lists := messages.FollowedLists(ctx, s.storage, p.Owner, p.Follower)
+	if idx == -1 || len(lists) == 0 {
+		return nil
+	}
+	event := events[idx]
+	loc := clock.LoadZone(s.storage.GetTimeZone(ctx, p.Follower))
+	// The event date may have been edited since the job was planned.
+	if _, occurrence, ok := NextReminder(event, loc, job.RunAt.Add(-time.Second)); !ok || occurrence.Format(time.DateOnly) != p.Date {
+		return nil
+	}
+	link, err := s.linker.ShareLink(ctx, lists[0].ID)
+	if err != nil {
+		return err
+	}
+	if err := s.sender.SendMessage(p.Follower, reminderText(event, messages.OwnerName(ctx, s.storage, p.Owner), link)); err != nil {
+		return err
+	}
+	return s.plan(ctx, p.Owner, event, p.Follower, job.RunAt)
+}
+
+// NextReminder finds the first reminder moment after the given time: 10:00 in loc,
+// RemindDaysBefore days before the occurrence. Yearly events on 29.02 fall on 28.02 in common years.
+func NextReminder(event messages.Event, loc *time.Location, after time.Time) (time.Time, time.Time, bool) {
+	// Reminding before an early January date fires in December, so once this year's reminder is
+	// past the next one can be for the occurrence two years on.
+	year := after.In(loc).Year()
+	years := []int{year, year + 1, year + 2}
+	if event.Year != 0 {
+		years = []int{event.Year}
+	}
+	for _, year := range years {
+		day := event.Day
+		if last := daysIn(event.Month, year); day > last {
+			day = last
+		}
+		occurrence := time.Date(year, event.Month, day, 0, 0, 0, 0, loc)
+		fireAt := time.Date(year, event.Month, day-event.RemindDaysBefore, remindHour, 0, 0, 0, loc)
+		if fireAt.After(after) {
+			return fireAt, occurrence, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+func daysIn(month time.Month, year int) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func reminderText(event messages.Event, ownerName, link string) string {
+	when := "Сегодня"
+	if event.RemindDaysBefore > 0 {
+		when = fmt.Sprintf("Через %d %s", event.RemindDaysBefore, pluralDays(event.RemindDaysBefore))
+	}
+	text := fmt.Sprintf("%s %s — %s: %s (%s).", kindEmoji[event.Kind], when, event.DisplayTitle(), ownerName, fmt.Sprintf("%02d.%02d", event.Day, event.Month))
+	if link != "" {
+		text += "\nЗагляните в вишлист: " + link
+	}
+	return text
+}
+
+func pluralDays(n int) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "день"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "дня"
+	}
+	return "дней"
+}
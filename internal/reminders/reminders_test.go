@@ -0,0 +1,197 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const (
+	ownerId    = int64(1)
+	followerId = int64(2)
+)
+
+type sentMessage struct {
+	userId int64
+	text   string
+}
+
+type fakeSender struct {
+	sent []sentMessage
+}
+
+func (f *fakeSender) SendMessage(userId int64, text string) error {
+	f.sent = append(f.sent, sentMessage{userId: userId, text: text})
+	return nil
+}
+
+type fakeLinker struct{}
+
+func (fakeLinker) ShareLink(_ context.Context, listId int64) (string, error) {
+	return fmt.Sprintf("https://t.me/ho4uha_bot?start=w_%d", listId), nil
+}
+
+type env struct {
+	storage *inmemory.Storage
+	clock   *clock.Fake
+	sender  *fakeSender
+	sched   *scheduler.Scheduler
+	service *Service
+}
+
+func newEnv(t *testing.T, now time.Time) *env {
+	ctx := context.Background()
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	for _, id := range []int64{ownerId, followerId} {
+		err := storage.AddNewUser(ctx, id)
+		require.NoError(t, err)
+	}
+	err = storage.SetUserName(ctx, ownerId, "Аня")
+	require.NoError(t, err)
+	list, _ := storage.GetActiveList(ctx, ownerId)
+	err = storage.AddListFollower(ctx, list.ID, followerId)
+	require.NoError(t, err)
+	e := &env{storage: storage, clock: clock.NewFake(now), sender: &fakeSender{}}
+	e.restart()
+	return e
+}
+
+// restart builds the scheduler and the service again on top of the same storage, like a bot restart does.
+func (e *env) restart() {
+	e.sched = scheduler.New(e.storage, e.clock)
+	e.service = New(e.storage, e.sender, fakeLinker{}, e.sched, e.clock)
+}
+
+func (e *env) addEvent(t *testing.T, event messages.Event) {
+	ctx := context.Background()
+	err := e.storage.AddEvent(ctx, ownerId, event)
+	require.NoError(t, err)
+	require.NoError(t, e.service.PlanOwner(ctx, ownerId))
+}
+
+func (e *env) runAt(t *testing.T, at time.Time) int {
+	e.clock.Set(at)
+	done, err := e.sched.RunDue(context.Background())
+	require.NoError(t, err)
+	return done
+}
+
+func TestService_Birthday(t *testing.T) {
+	e := newEnv(t, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC))
+	e.addEvent(t, messages.Event{Kind: messages.EventBirthday, Month: time.December, Day: 25, RemindDaysBefore: 7})
+
+	t.Run("Should wait until 10:00 of follower's local time", func(t *testing.T) {
+		require.Equal(t, 0, e.runAt(t, time.Date(2024, 12, 18, 6, 59, 0, 0, time.UTC)))
+		require.Empty(t, e.sender.sent)
+	})
+
+	t.Run("Should remind follower with a link to the wishlist", func(t *testing.T) {
+		require.Equal(t, 1, e.runAt(t, time.Date(2024, 12, 18, 7, 0, 0, 0, time.UTC)))
+		require.Equal(t, []sentMessage{{
+			userId: followerId,
+			text:   "🎂 Через 7 дней — День рождения: Аня (25.12).\nЗагляните в вишлист: https://t.me/ho4uha_bot?start=w_1",
+		}}, e.sender.sent)
+	})
+
+	t.Run("Should not remind twice even if planned again", func(t *testing.T) {
+		require.NoError(t, e.service.PlanOwner(context.Background(), ownerId))
+		require.Equal(t, 0, e.runAt(t, time.Date(2024, 12, 26, 0, 0, 0, 0, time.UTC)))
+		require.Len(t, e.sender.sent, 1)
+	})
+
+	t.Run("Should remind again next year", func(t *testing.T) {
+		require.Equal(t, 1, e.runAt(t, time.Date(2025, 12, 18, 7, 0, 0, 0, time.UTC)))
+		require.Len(t, e.sender.sent, 2)
+	})
+}
+
+func TestService_NewYear(t *testing.T) {
+	e := newEnv(t, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC))
+	e.addEvent(t, messages.Event{Kind: messages.EventBirthday, Month: time.January, Day: 1, RemindDaysBefore: 7})
+
+	require.Equal(t, 1, e.runAt(t, time.Date(2024, 12, 25, 7, 0, 0, 0, time.UTC)))
+	require.Equal(t, 0, e.runAt(t, time.Date(2025, 12, 24, 7, 0, 0, 0, time.UTC)))
+	require.Equal(t, 1, e.runAt(t, time.Date(2025, 12, 25, 7, 0, 0, 0, time.UTC)))
+	require.Len(t, e.sender.sent, 2)
+}
+
+func TestService_FollowerTimeZone(t *testing.T) {
+	e := newEnv(t, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC))
+	err := e.storage.SetTimeZone(context.Background(), followerId, "Asia/Vladivostok")
+	require.NoError(t, err)
+	e.addEvent(t, messages.Event{Kind: messages.EventNewYear, Month: time.January, Day: 1, RemindDaysBefore: 1})
+
+	require.Equal(t, 0, e.runAt(t, time.Date(2024, 12, 30, 23, 59, 0, 0, time.UTC)))
+	require.Equal(t, 1, e.runAt(t, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)), "10:00 in Vladivostok is 00:00 UTC")
+	require.Contains(t, e.sender.sent[0].text, "Через 1 день — Новый год")
+}
+
+func TestService_SurvivesRestart(t *testing.T) {
+	e := newEnv(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	e.addEvent(t, messages.Event{Kind: messages.EventBirthday, Month: time.March, Day: 10, RemindDaysBefore: 3})
+	e.restart()
+	require.Equal(t, 1, e.runAt(t, time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)), "Missed reminder should run after restart")
+	require.Len(t, e.sender.sent, 1)
+}
+
+func TestService_SkipsStaleJobs(t *testing.T) {
+	ctx := context.Background()
+	e := newEnv(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	e.addEvent(t, messages.Event{Kind: messages.EventBirthday, Month: time.March, Day: 10, RemindDaysBefore: 3})
+	events := e.storage.GetEvents(ctx, ownerId)
+	err := e.storage.DeleteEvent(ctx, ownerId, events[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, 1, e.runAt(t, time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)))
+	require.Empty(t, e.sender.sent, "Deleted event shouldn't be reminded")
+}
+
+func TestNextReminder(t *testing.T) {
+	moscow := clock.LoadZone("Europe/Moscow")
+
+	t.Run("Should move 29.02 to 28.02 in common years", func(t *testing.T) {
+		event := messages.Event{Month: time.February, Day: 29, RemindDaysBefore: 7}
+		fireAt, occurrence, ok := NextReminder(event, moscow, time.Date(2025, 1, 1, 0, 0, 0, 0, moscow))
+		require.True(t, ok)
+		require.Equal(t, "2025-02-28", occurrence.Format(time.DateOnly))
+		require.Equal(t, time.Date(2025, 2, 21, 10, 0, 0, 0, moscow), fireAt)
+	})
+
+	t.Run("Should cross year boundary when reminding before 1st of January", func(t *testing.T) {
+		event := messages.Event{Month: time.January, Day: 3, RemindDaysBefore: 5}
+		fireAt, occurrence, ok := NextReminder(event, moscow, time.Date(2024, 12, 1, 0, 0, 0, 0, moscow))
+		require.True(t, ok)
+		require.Equal(t, "2025-01-03", occurrence.Format(time.DateOnly))
+		require.Equal(t, time.Date(2024, 12, 29, 10, 0, 0, 0, moscow), fireAt)
+	})
+
+	t.Run("Should plan next year's reminder from the last days of December", func(t *testing.T) {
+		event := messages.Event{Month: time.January, Day: 1, RemindDaysBefore: 7}
+		fireAt, occurrence, ok := NextReminder(event, moscow, time.Date(2024, 12, 25, 10, 0, 0, 0, moscow))
+		require.True(t, ok)
+		require.Equal(t, "2026-01-01", occurrence.Format(time.DateOnly))
+		require.Equal(t, time.Date(2025, 12, 25, 10, 0, 0, 0, moscow), fireAt)
+
+		_, occurrence, ok = NextReminder(event, moscow, time.Date(2024, 12, 31, 23, 0, 0, 0, moscow))
+		require.True(t, ok)
+		require.Equal(t, "2026-01-01", occurrence.Format(time.DateOnly))
+	})
+
+	t.Run("Shouldn't plan one-off events in the past", func(t *testing.T) {
+		event := messages.Event{Month: time.June, Day: 1, Year: 2023, RemindDaysBefore: 7}
+		_, _, ok := NextReminder(event, moscow, time.Date(2024, 1, 1, 0, 0, 0, 0, moscow))
+		require.False(t, ok)
+	})
+}
+
+func TestPluralDays(t *testing.T) {
+	for n, expected := range map[int]string{1: "день", 2: "дня", 5: "дней", 11: "дней", 14: "дней", 21: "день", 22: "дня", 112: "дней"} {
+		require.Equalf(t, expected, pluralDays(n), "n = %d", n)
+	}
+}
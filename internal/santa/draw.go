@@ -0,0 +1,97 @@
+package santa
+
+import (
+	"errors"
+	"math/rand"
+	"slices"
+)
+
+const (
+	MaxParticipants = 200
+	// maxSteps bounds the search, exclusions that leave almost no valid draw could make it
+	// try every permutation. Such a game is reported as impossible.
+	maxSteps = 100_000
+)
+
+var (
+	ErrTooFewParticipants  = errors.New("santa: at least 3 participants are needed")
+	ErrTooManyParticipants = errors.New("santa: too many participants")
+	ErrNoValidDraw         = errors.New("santa: exclusions leave no valid draw")
+)
+
+// Pair is an exclusion: its members never draw each other, in either direction.
+type Pair [2]int64
+
+func (p Pair) Has(a, b int64) bool {
+	return (p[0] == a && p[1] == b) || (p[0] == b && p[1] == a)
+}
+
+// Draw assigns every participant a recipient other than themselves and their excluded partners.
+// The result depends only on the participants, exclusions and seed, so a draw can be replayed.
+func Draw(participants []int64, exclusions []Pair, seed int64) (map[int64]int64, error) {
+	if len(participants) < 3 {
+		return nil, ErrTooFewParticipants
+	}
+	givers := slices.Clone(participants)
+	slices.Sort(givers)
+	givers = slices.Compact(givers)
+	if len(givers) < 3 {
+		return nil, ErrTooFewParticipants
+	}
+	if len(givers) > MaxParticipants {
+		return nil, ErrTooManyParticipants
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	rnd.Shuffle(len(givers), func(i, j int) { givers[i], givers[j] = givers[j], givers[i] })
+
+	allowed := func(giver, receiver int64) bool {
+		if giver == receiver {
+			return false
+		}
+		return !slices.ContainsFunc(exclusions, func(p Pair) bool { return p.Has(giver, receiver) })
+	}
+	candidates := make([][]int64, len(givers))
+	for i, giver := range givers {
+		for _, receiver := range givers {
+			if allowed(giver, receiver) {
+				candidates[i] = append(candidates[i], receiver)
+			}
+		}
+		if len(candidates[i]) == 0 {
+			return nil, ErrNoValidDraw
+		}
+		rnd.Shuffle(len(candidates[i]), func(a, b int) {
+			candidates[i][a], candidates[i][b] = candidates[i][b], candidates[i][a]
+		})
+	}
+
+	result := make(map[int64]int64, len(givers))
+	taken := make(map[int64]bool, len(givers))
+	steps := 0
+	var assign func(i int) bool
+	assign = func(i int) bool {
+		if i == len(givers) {
+			return true
+		}
+		for _, receiver := range candidates[i] {
+			if taken[receiver] {
+				continue
+			}
+			if steps++; steps > maxSteps {
+				return false
+			}
+			taken[receiver] = true
+			result[givers[i]] = receiver
+			if assign(i + 1) {
+				return true
+			}
+			taken[receiver] = false
+		}
+		delete(result, givers[i])
+		return false
+	}
+	if !assign(0) {
+		return nil, ErrNoValidDraw
+	}
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package santa
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func requireValid(t *testing.T, participants []int64, exclusions []Pair, result map[int64]int64) {
+	require.Len(t, result, len(participants))
+	receivers := make(map[int64]bool)
+	for _, giver := range participants {
+		receiver, ok := result[giver]
+		require.True(t, ok, "Everyone should give a gift")
+		require.NotEqual(t, giver, receiver, "Nobody should draw themselves")
+		require.False(t, receivers[receiver], "Everyone should receive exactly one gift")
+		receivers[receiver] = true
+		for _, p := range exclusions {
+			require.False(t, p.Has(giver, receiver), "Excluded pair %v was drawn", p)
+		}
+	}
+}
+
+func TestDraw(t *testing.T) {
+	participants := []int64{10, 20, 30, 40, 50, 60}
+	exclusions := []Pair{{10, 20}, {30, 40}}
+
+	t.Run("Should produce a derangement that respects exclusions", func(t *testing.T) {
+		for seed := int64(0); seed < 200; seed++ {
+			result, err := Draw(participants, exclusions, seed)
+			require.NoError(t, err)
+			requireValid(t, participants, exclusions, result)
+		}
+	})
+
+	t.Run("Should be reproducible from the seed", func(t *testing.T) {
+		first, err := Draw(participants, exclusions, 42)
+		require.NoError(t, err)
+		shuffled := []int64{60, 10, 50, 20, 40, 30}
+		again, err := Draw(shuffled, exclusions, 42)
+		require.NoError(t, err)
+		require.Equal(t, first, again, "Order of participants shouldn't matter")
+	})
+
+	t.Run("Should depend on the seed", func(t *testing.T) {
+		seen := make(map[int64]bool)
+		for seed := int64(0); seed < 50; seed++ {
+			result, err := Draw(participants, nil, seed)
+			require.NoError(t, err)
+			seen[result[10]] = true
+		}
+		require.Greater(t, len(seen), 1)
+	})
+
+	t.Run("Should need at least three participants", func(t *testing.T) {
+		_, err := Draw([]int64{1, 2}, nil, 1)
+		require.ErrorIs(t, err, ErrTooFewParticipants)
+		_, err = Draw([]int64{1, 2, 2}, nil, 1)
+		require.ErrorIs(t, err, ErrTooFewParticipants)
+	})
+
+	t.Run("Should fail when exclusions make the draw impossible", func(t *testing.T) {
+		_, err := Draw([]int64{1, 2, 3}, []Pair{{1, 2}, {1, 3}}, 1)
+		require.ErrorIs(t, err, ErrNoValidDraw)
+		// 1 can only give to 4 here, the draw has to find that single option.
+		_, err = Draw([]int64{1, 2, 3, 4}, []Pair{{1, 2}, {3, 4}, {1, 3}}, 1)
+		require.NoError(t, err)
+		_, err = Draw([]int64{1, 2, 3}, []Pair{{1, 2}}, 1)
+		require.ErrorIs(t, err, ErrNoValidDraw, "1 and 2 would both have to give to 3")
+	})
+
+	t.Run("Should give up on a draw that is too hard to find", func(t *testing.T) {
+		// 1-5 may only give to 6-9, five givers for four receivers, but that takes trying
+		// nearly every way to assign the others first.
+		var crowd []int64
+		var exclusions []Pair
+		for id := int64(1); id <= 40; id++ {
+			crowd = append(crowd, id)
+		}
+		for a := int64(1); a <= 5; a++ {
+			for b := a + 1; b <= 40; b++ {
+				if b < 6 || b > 9 {
+					exclusions = append(exclusions, Pair{a, b})
+				}
+			}
+		}
+		_, err := Draw(crowd, exclusions, 1)
+		require.ErrorIs(t, err, ErrNoValidDraw)
+	})
+
+	t.Run("Should limit the number of participants", func(t *testing.T) {
+		crowd := make([]int64, MaxParticipants+1)
+		for i := range crowd {
+			crowd[i] = int64(i + 1)
+		}
+		_, err := Draw(crowd, nil, 1)
+		require.ErrorIs(t, err, ErrTooManyParticipants)
+	})
+}
@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Spec interface {
+	// Next returns the first activation strictly after the given time.
+	Next(after time.Time) time.Time
+}
+
+type everySpec time.Duration
+
+func (e everySpec) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+// cronSpec is a classic five field cron line: minute hour day-of-month month day-of-week.
+type cronSpec struct {
+	minutes, hours, days, months, weekdays uint64
+	anyDay, anyWeekday                     bool
+	loc                                    *time.Location
+}
+
+var shortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// ParseSpec understands "@every 90m", the @hourly/@daily/@weekly/@monthly/@yearly shortcuts
+// and five field cron expressions with lists, ranges and steps. Cron fields are read in loc.
+func ParseSpec(spec string, loc *time.Location) (Spec, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		duration, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || duration < time.Second {
+			return nil, fmt.Errorf("scheduler: invalid interval %q", d)
+		}
+		return everySpec(duration), nil
+	}
+	if expanded, ok := shortcuts[spec]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("scheduler: cron spec %q needs 5 fields", spec)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	c := &cronSpec{loc: loc}
+	var err error
+	bounds := []struct {
+		dst      *uint64
+		min, max int
+	}{{&c.minutes, 0, 59}, {&c.hours, 0, 23}, {&c.days, 1, 31}, {&c.months, 1, 12}, {&c.weekdays, 0, 7}}
+	for i, b := range bounds {
+		if *b.dst, err = parseField(fields[i], b.min, b.max); err != nil {
+			return nil, fmt.Errorf("scheduler: cron spec %q: %w", spec, err)
+		}
+	}
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	c.anyDay, c.anyWeekday = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var result uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+		}
+		lo, hi := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			result |= 1 << uint(v)
+		}
+	}
+	return result, nil
+}
+
+func (c *cronSpec) Next(after time.Time) time.Time {
+	t := after.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	// Five years of minutes is enough to find any valid date, including 29 February.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc)
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both day fields are restricted, matching either is enough.
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	day := c.days&(1<<uint(t.Day())) != 0
+	weekday := c.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
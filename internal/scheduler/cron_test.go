@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	from := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC) // Monday
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 90m", from.Add(90 * time.Minute)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 12, 45, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC)},
+		{"0 10 * * 5", time.Date(2024, 1, 5, 7, 0, 0, 0, time.UTC)},
+		{"0 10 * * 1-5", time.Date(2024, 1, 2, 7, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 28, 21, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 1, 14, 21, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run("Should schedule "+tt.spec, func(t *testing.T) {
+			spec, err := ParseSpec(tt.spec, moscow)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, spec.Next(from).UTC())
+		})
+	}
+
+	t.Run("Should reject malformed specs", func(t *testing.T) {
+		for _, bad := range []string{"", "* * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *", "@every 0s", "@every soon"} {
+			_, err := ParseSpec(bad, moscow)
+			require.Error(t, err, bad)
+		}
+	})
+}
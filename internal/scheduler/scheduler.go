@@ -0,0 +1,244 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"sort"
+	"time"
+)
+
+type Job struct {
+	// ID identifies the job in the store, scheduling a job with an existing ID replaces it.
+	ID      string
+	Kind    string
+	RunAt   time.Time
+	Payload string
+	// Spec makes the job recurring, see ParseSpec. Cron fields are read in Zone.
+	Spec string
+	Zone string
+	// Key marks a unit of work that must not be repeated once it succeeded.
+	// Recurring jobs get a key per occurrence automatically.
+	Key string
+	// ScheduledAt is the nominal time of the current occurrence, RunAt moves forward on retries.
+	ScheduledAt time.Time
+	Attempts    int
+	LastError   string
+}
+
+type JobStore interface {
+	SaveJob(job Job) error
+	DeleteJob(id string) error
+	GetDueJobs(now time.Time) ([]Job, error)
+	MarkJobDone(key string, at time.Time) error
+	IsJobDone(key string) (bool, error)
+	ForgetDoneJobs(before time.Time) error
+}
+
+type Handler func(ctx context.Context, job Job) error
+
+type RetryPolicy struct {
+	Base        time.Duration
+	Max         time.Duration
+	MaxAttempts int
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Base: time.Minute, Max: time.Hour, MaxAttempts: 10}
+}
+
+// Delay doubles the wait after every failed attempt, starting from Base and never exceeding Max.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.Base
+	for i := 1; i < attempts && delay < p.Max; i++ {
+		delay *= 2
+	}
+	return min(delay, p.Max)
+}
+
+// doneRetention is how long idempotency keys of finished jobs are remembered.
+const doneRetention = 30 * 24 * time.Hour
+
+type Scheduler struct {
+	store    JobStore
+	clock    clock.Clock
+	handlers map[string]Handler
+	interval time.Duration
+	retry    RetryPolicy
+	onError  func(job Job, err error)
+}
+
+func New(store JobStore, clk clock.Clock) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		clock:    clk,
+		handlers: make(map[string]Handler),
+		interval: time.Minute,
+		retry:    DefaultRetryPolicy(),
+		onError:  func(Job, error) {},
+	}
+}
+
+func (s *Scheduler) Handle(kind string, h Handler) {
+	s.handlers[kind] = h
+}
+
+// OnError is called for every failed run. The job is retried with backoff until the retry policy gives up.
+// Store errors while Run polls come with an empty job.
+func (s *Scheduler) OnError(f func(job Job, err error)) {
+	s.onError = f
+}
+
+func (s *Scheduler) SetRetryPolicy(p RetryPolicy) {
+	s.retry = p
+}
+
+// Schedule stores a one-off job. Jobs whose Key already succeeded are silently skipped.
+func (s *Scheduler) Schedule(job Job) error {
+	if _, ok := s.handlers[job.Kind]; !ok {
+		return fmt.Errorf("scheduler: no handler for job kind %q", job.Kind)
+	}
+	if job.Spec != "" {
+		if _, err := ParseSpec(job.Spec, clock.LoadZone(job.Zone)); err != nil {
+			return err
+		}
+	}
+	if job.ScheduledAt.IsZero() {
+		job.ScheduledAt = job.RunAt
+	}
+	if key := occurrenceKey(job); key != "" {
+		done, err := s.store.IsJobDone(key)
+		if err != nil || done {
+			return err
+		}
+	}
+	return s.store.SaveJob(job)
+}
+
+// ScheduleRecurring stores a job that runs on every activation of spec in the given zone.
+func (s *Scheduler) ScheduleRecurring(id, kind, spec, zone, payload string) error {
+	parsed, err := ParseSpec(spec, clock.LoadZone(zone))
+	if err != nil {
+		return err
+	}
+	return s.Schedule(Job{ID: id, Kind: kind, RunAt: parsed.Next(s.clock.Now()), Payload: payload, Spec: spec, Zone: zone})
+}
+
+func (s *Scheduler) Cancel(id string) error {
+	return s.store.DeleteJob(id)
+}
+
+// RunDue executes every job whose time has come and returns how many of them succeeded.
+func (s *Scheduler) RunDue(ctx context.Context) (int, error) {
+	now := s.clock.Now()
+	jobs, err := s.store.GetDueJobs(now)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].RunAt.Before(jobs[j].RunAt) })
+	done := 0
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return done, ctx.Err()
+		}
+		key := occurrenceKey(job)
+		if key != "" {
+			// The previous run succeeded but crashed before the job was advanced.
+			finished, err := s.store.IsJobDone(key)
+			if err != nil {
+				return done, err
+			}
+			if finished {
+				if err := s.advance(job, now); err != nil {
+					return done, err
+				}
+				continue
+			}
+		}
+		handler, ok := s.handlers[job.Kind]
+		if !ok {
+			err = fmt.Errorf("scheduler: no handler for job kind %q", job.Kind)
+		} else {
+			err = handler(ctx, job)
+		}
+		if err != nil {
+			s.onError(job, err)
+			if err := s.fail(job, err, now); err != nil {
+				return done, err
+			}
+			continue
+		}
+		// Marking the key before advancing means a crash in between never repeats the work,
+		// while a crash before marking runs it again: execution is at least once.
+		if key != "" {
+			if err := s.store.MarkJobDone(key, now); err != nil {
+				return done, err
+			}
+		}
+		if err := s.advance(job, now); err != nil {
+			return done, err
+		}
+		done++
+	}
+	return done, nil
+}
+
+func (s *Scheduler) fail(job Job, err error, now time.Time) error {
+	job.Attempts++
+	job.LastError = err.Error()
+	if s.retry.MaxAttempts > 0 && job.Attempts >= s.retry.MaxAttempts {
+		s.onError(job, fmt.Errorf("scheduler: job %q gave up after %d attempts", job.ID, job.Attempts))
+		return s.advance(job, now)
+	}
+	job.RunAt = now.Add(s.retry.Delay(job.Attempts))
+	return s.store.SaveJob(job)
+}
+
+// advance removes a finished one-off job or moves a recurring one to its next activation.
+// Activations missed while the bot was down are not replayed.
+func (s *Scheduler) advance(job Job, now time.Time) error {
+	if job.Spec == "" {
+		return s.store.DeleteJob(job.ID)
+	}
+	spec, err := ParseSpec(job.Spec, clock.LoadZone(job.Zone))
+	if err != nil {
+		return err
+	}
+	next := spec.Next(now)
+	if next.IsZero() {
+		return s.store.DeleteJob(job.ID)
+	}
+	job.RunAt, job.ScheduledAt = next, next
+	job.Attempts, job.LastError = 0, ""
+	return s.store.SaveJob(job)
+}
+
+func occurrenceKey(job Job) string {
+	if job.Spec == "" {
+		return job.Key
+	}
+	key := job.Key
+	if key == "" {
+		key = job.ID
+	}
+	return fmt.Sprintf("%s@%d", key, job.ScheduledAt.Unix())
+}
+
+// Run polls for due jobs until ctx is cancelled. Jobs missed while the bot was down run on the first tick.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RunDue(ctx); err != nil && ctx.Err() == nil {
+			s.onError(Job{}, err)
+		}
+		if err := s.store.ForgetDoneJobs(s.clock.Now().Add(-doneRetention)); err != nil {
+			s.onError(Job{}, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	jobs map[string]Job
+	done map[string]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{jobs: make(map[string]Job), done: make(map[string]time.Time)}
+}
+
+func (m *memoryStore) MarkJobDone(key string, at time.Time) error {
+	m.done[key] = at
+	return nil
+}
+
+func (m *memoryStore) IsJobDone(key string) (bool, error) {
+	_, ok := m.done[key]
+	return ok, nil
+}
+
+func (m *memoryStore) ForgetDoneJobs(before time.Time) error {
+	for key, at := range m.done {
+		if at.Before(before) {
+			delete(m.done, key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) SaveJob(job Job) error {
+	m.jobs[job.ID] = job
+	return nil
+}
+
+func (m *memoryStore) DeleteJob(id string) error {
+	delete(m.jobs, id)
+	return nil
+}
+
+func (m *memoryStore) GetDueJobs(now time.Time) ([]Job, error) {
+	var result []Job
+	for _, job := range m.jobs {
+		if !job.RunAt.After(now) {
+			result = append(result, job)
+		}
+	}
+	return result, nil
+}
+
+// brokenStore fails every read the polling loop makes.
+type brokenStore struct {
+	*memoryStore
+}
+
+func (brokenStore) GetDueJobs(time.Time) ([]Job, error) {
+	return nil, errors.New("disk full")
+}
+
+func (brokenStore) ForgetDoneJobs(time.Time) error {
+	return errors.New("disk gone")
+}
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestScheduler_RunDue(t *testing.T) {
+	store := newMemoryStore()
+	clk := clock.NewFake(start)
+	s := New(store, clk)
+	var ran []string
+	s.Handle("test", func(_ context.Context, job Job) error {
+		ran = append(ran, job.ID)
+		return nil
+	})
+
+	t.Run("Should refuse jobs without handler", func(t *testing.T) {
+		require.Error(t, s.Schedule(Job{ID: "x", Kind: "unknown", RunAt: start}))
+	})
+
+	require.NoError(t, s.Schedule(Job{ID: "late", Kind: "test", RunAt: start.Add(2 * time.Hour)}))
+	require.NoError(t, s.Schedule(Job{ID: "second", Kind: "test", RunAt: start.Add(time.Hour)}))
+	require.NoError(t, s.Schedule(Job{ID: "first", Kind: "test", RunAt: start.Add(30 * time.Minute)}))
+
+	t.Run("Should run only due jobs in time order", func(t *testing.T) {
+		clk.Advance(time.Hour)
+		done, err := s.RunDue(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 2, done)
+		require.Equal(t, []string{"first", "second"}, ran)
+		require.Len(t, store.jobs, 1)
+	})
+
+	t.Run("Should forget cancelled jobs", func(t *testing.T) {
+		require.NoError(t, s.Cancel("late"))
+		clk.Advance(2 * time.Hour)
+		done, err := s.RunDue(context.Background())
+		require.NoError(t, err)
+		require.Zero(t, done)
+	})
+}
+
+func TestScheduler_Retry(t *testing.T) {
+	store := newMemoryStore()
+	clk := clock.NewFake(start)
+	s := New(store, clk)
+	attempts := 0
+	var reported error
+	s.Handle("flaky", func(context.Context, Job) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("telegram is down")
+		}
+		return nil
+	})
+	s.OnError(func(job Job, err error) { reported = err })
+	require.NoError(t, s.Schedule(Job{ID: "job", Kind: "flaky", RunAt: start}))
+
+	done, err := s.RunDue(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, done)
+	require.EqualError(t, reported, "telegram is down")
+	require.Contains(t, store.jobs, "job", "Failed job should stay in the store")
+	require.Equal(t, 1, store.jobs["job"].Attempts)
+	require.Equal(t, start.Add(time.Minute), store.jobs["job"].RunAt, "Retry should be delayed by backoff")
+
+	done, err = s.RunDue(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, done, "Job should not be retried before backoff passes")
+
+	clk.Advance(time.Minute)
+	done, err = s.RunDue(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, done)
+	require.Empty(t, store.jobs)
+}
+
+func TestScheduler_GiveUp(t *testing.T) {
+	store := newMemoryStore()
+	clk := clock.NewFake(start)
+	s := New(store, clk)
+	s.SetRetryPolicy(RetryPolicy{Base: time.Minute, Max: time.Hour, MaxAttempts: 3})
+	attempts := 0
+	s.Handle("broken", func(context.Context, Job) error {
+		attempts++
+		return errors.New("boom")
+	})
+	require.NoError(t, s.Schedule(Job{ID: "job", Kind: "broken", RunAt: start}))
+
+	for i := 0; i < 5; i++ {
+		_, err := s.RunDue(context.Background())
+		require.NoError(t, err)
+		clk.Advance(time.Hour)
+	}
+	require.Equal(t, 3, attempts)
+	require.Empty(t, store.jobs, "Job should be dropped after the last attempt")
+}
+
+func TestScheduler_RunReportsStoreErrors(t *testing.T) {
+	s := New(brokenStore{newMemoryStore()}, clock.NewFake(start))
+	errs := make(chan error, 2)
+	s.OnError(func(_ Job, err error) { errs <- err })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	require.EqualError(t, <-errs, "disk full")
+	require.EqualError(t, <-errs, "disk gone")
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{Base: time.Minute, Max: 10 * time.Minute}
+	require.Equal(t, time.Minute, p.Delay(1))
+	require.Equal(t, 2*time.Minute, p.Delay(2))
+	require.Equal(t, 8*time.Minute, p.Delay(4))
+	require.Equal(t, 10*time.Minute, p.Delay(10))
+}
+
+func TestScheduler_Idempotency(t *testing.T) {
+	store := newMemoryStore()
+	clk := clock.NewFake(start)
+	s := New(store, clk)
+	runs := 0
+	s.Handle("send", func(context.Context, Job) error {
+		runs++
+		return nil
+	})
+	job := Job{ID: "job", Kind: "send", RunAt: start, Key: "greeting"}
+
+	t.Run("Should skip work that already succeeded", func(t *testing.T) {
+		require.NoError(t, s.Schedule(job))
+		_, err := s.RunDue(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, s.Schedule(job))
+		require.Empty(t, store.jobs)
+		require.Equal(t, 1, runs)
+	})
+
+	t.Run("Should not repeat a job left behind by a crash", func(t *testing.T) {
+		store.jobs["job"] = job
+		done, err := s.RunDue(context.Background())
+		require.NoError(t, err)
+		require.Zero(t, done)
+		require.Equal(t, 1, runs)
+		require.Empty(t, store.jobs)
+	})
+}
+
+func TestScheduler_Recurring(t *testing.T) {
+	store := newMemoryStore()
+	clk := clock.NewFake(start)
+	s := New(store, clk)
+	var ran []time.Time
+	s.Handle("digest", func(_ context.Context, job Job) error {
+		ran = append(ran, job.ScheduledAt)
+		return nil
+	})
+
+	t.Run("Should refuse invalid specs", func(t *testing.T) {
+		require.Error(t, s.ScheduleRecurring("bad", "digest", "61 * * * *", "", ""))
+	})
+
+	require.NoError(t, s.ScheduleRecurring("daily", "digest", "0 9 * * *", "Europe/Moscow", ""))
+	firstRun := time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC)
+	require.Equal(t, firstRun, store.jobs["daily"].RunAt.UTC())
+
+	t.Run("Should move to the next activation after a run", func(t *testing.T) {
+		clk.Set(firstRun)
+		done, err := s.RunDue(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, done)
+		require.Equal(t, firstRun.AddDate(0, 0, 1), store.jobs["daily"].RunAt.UTC())
+	})
+
+	t.Run("Should not replay activations missed while down", func(t *testing.T) {
+		clk.Set(firstRun.AddDate(0, 0, 5).Add(time.Hour))
+		done, err := s.RunDue(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, done)
+		require.Len(t, ran, 2)
+		require.Equal(t, firstRun.AddDate(0, 0, 6), store.jobs["daily"].RunAt.UTC())
+	})
+}
@@ -0,0 +1,374 @@
+package eventlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotName  = "snapshot.json"
+	segmentPrefix = "events-"
+	segmentSuffix = ".jsonl"
+)
+
+type Options struct {
+	// SnapshotEvery is how many events are logged between two snapshots, zero turns them off.
+	// Startup replays at most that many events on top of the latest snapshot.
+	SnapshotEvery int
+}
+
+func DefaultOptions() Options {
+	return Options{SnapshotEvery: 1000}
+}
+
+// Storage keeps the data in an inmemory.Storage and appends every change to a log in a directory.
+// The log is split into segments, a new one is started with every snapshot and old ones are kept
+// as the audit trail, see ReadLog. Open rebuilds the data from the latest snapshot and the events
+// logged after it.
+type Storage struct {
+	*inmemory.Storage
+	journal *journal
+	// pending collects the events of a transaction view until the transaction commits.
+	pending *[]Event
+}
+
+// journal is the open log. It is only used while the lock of the in-memory storage is held.
+type journal struct {
+	dir     string
+	clock   clock.Clock
+	opts    Options
+	onError func(err error)
+
+	file *os.File
+	size int64
+	seq  int64
+	// sinceSnapshot counts the events logged after the latest snapshot.
+	sinceSnapshot int
+	// token is the last share or invite token made by the storage, see newToken.
+	token string
+}
+
+type snapshotFile struct {
+	Seq   int64             `json:"seq"`
+	At    time.Time         `json:"at"`
+	State inmemory.Snapshot `json:"state"`
+}
+
+type segment struct {
+	start int64
+	path  string
+}
+
+func Open(dir string, clk clock.Clock, opts Options) (*Storage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	snapshot, err := readSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+	mem, err := inmemory.Restore(snapshot.State)
+	if err != nil {
+		return nil, fmt.Errorf("restore snapshot: %w", err)
+	}
+	segments, err := readSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{dir: dir, clock: clk, opts: opts, seq: snapshot.Seq}
+	ctx := context.Background()
+	replayed := clock.NewFake(time.Time{})
+	mem.Clock = replayed
+	for i, seg := range segments {
+		if i+1 < len(segments) && segments[i+1].start <= j.seq+1 {
+			continue
+		}
+		size, err := readSegment(seg.path, func(e Event) error {
+			if e.Seq <= j.seq {
+				return nil
+			}
+			if e.Seq != j.seq+1 {
+				return fmt.Errorf("event %d follows %d", e.Seq, j.seq)
+			}
+			replayed.Set(e.At)
+			if err := apply(ctx, mem, e); err != nil {
+				return fmt.Errorf("replay event %d: %w", e.Seq, err)
+			}
+			j.seq = e.Seq
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", seg.path, err)
+		}
+		if i == len(segments)-1 {
+			// A write cut short by a crash leaves a partial line behind, it was never committed.
+			if err := os.Truncate(seg.path, size); err != nil {
+				return nil, err
+			}
+			j.size = size
+		}
+	}
+	j.sinceSnapshot = int(j.seq - snapshot.Seq)
+	start := j.seq + 1
+	if len(segments) > 0 {
+		start = segments[len(segments)-1].start
+	}
+	if err := j.openSegment(start); err != nil {
+		return nil, err
+	}
+	mem.Tokens = j.newToken
+	mem.Clock = clk
+	return &Storage{Storage: mem, journal: j}, nil
+}
+
+// OnError is called when a snapshot can't be written. The events are logged anyway, so nothing
+// is lost, only the next startup takes longer.
+func (s *Storage) OnError(f func(err error)) {
+	s.journal.onError = f
+}
+
+// Close writes a snapshot and closes the log.
+func (s *Storage) Close() error {
+	return s.Storage.WithTx(context.Background(), func(tx messages.UserStorage) error {
+		err := s.journal.snapshot(tx.(*inmemory.Storage).Snapshot())
+		return errors.Join(err, s.journal.file.Close())
+	})
+}
+
+// Snapshot writes a snapshot of the current data unless nothing was logged since the latest one.
+func (s *Storage) Snapshot(ctx context.Context) error {
+	return s.WithTx(ctx, func(tx messages.UserStorage) error {
+		if s.journal.sinceSnapshot == 0 {
+			return nil
+		}
+		return s.journal.snapshot(tx.(*Storage).Storage.Snapshot())
+	})
+}
+
+// WithTx logs the events of f in one write before the in-memory transaction commits, so a failed
+// write rolls the data back. The in-memory transaction ignores ctx for that reason, it can't be
+// allowed to roll back once the events are logged.
+func (s *Storage) WithTx(ctx context.Context, f func(tx messages.UserStorage) error) error {
+	if s.pending != nil {
+		return f(s)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Storage.WithTx(context.WithoutCancel(ctx), func(tx messages.UserStorage) error {
+		var pending []Event
+		view := &Storage{Storage: tx.(*inmemory.Storage), journal: s.journal, pending: &pending}
+		if err := f(view); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.journal.append(pending); err != nil {
+			return err
+		}
+		if s.journal.opts.SnapshotEvery > 0 && s.journal.sinceSnapshot >= s.journal.opts.SnapshotEvery {
+			if err := s.journal.snapshot(view.Storage.Snapshot()); err != nil && s.journal.onError != nil {
+				s.journal.onError(err)
+			}
+		}
+		return nil
+	})
+}
+
+// record runs write on the in-memory data and logs the events it returns, in a transaction
+// of its own when there is no running one.
+func (s *Storage) record(ctx context.Context, write func(mem *inmemory.Storage) ([]Event, error)) error {
+	if s.pending == nil {
+		return s.WithTx(ctx, func(tx messages.UserStorage) error {
+			return tx.(*Storage).record(ctx, write)
+		})
+	}
+	events, err := write(s.Storage)
+	if err != nil {
+		return err
+	}
+	*s.pending = append(*s.pending, events...)
+	return nil
+}
+
+func (j *journal) newToken() (string, error) {
+	token, err := inmemory.NewToken()
+	j.token = token
+	return token, err
+}
+
+func (j *journal) append(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	seq, now := j.seq, j.clock.Now()
+	for _, e := range events {
+		seq++
+		e.Seq, e.At = seq, now
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if _, err := j.file.Write(buf.Bytes()); err != nil {
+		return errors.Join(err, j.file.Truncate(j.size))
+	}
+	if err := j.file.Sync(); err != nil {
+		return errors.Join(err, j.file.Truncate(j.size))
+	}
+	j.size += int64(buf.Len())
+	j.seq = seq
+	j.sinceSnapshot += len(events)
+	return nil
+}
+
+// snapshot replaces the snapshot file and starts a new segment.
+func (j *journal) snapshot(state inmemory.Snapshot) error {
+	data, err := json.Marshal(snapshotFile{Seq: j.seq, At: j.clock.Now(), State: state})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(j.dir, snapshotName)
+	if err := writeFile(path+".tmp", data); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	j.sinceSnapshot = 0
+	if j.size == 0 {
+		return nil
+	}
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	return j.openSegment(j.seq + 1)
+}
+
+func (j *journal) openSegment(start int64) error {
+	file, err := os.OpenFile(segmentPath(j.dir, start), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Join(err, file.Close())
+	}
+	j.file, j.size = file, info.Size()
+	return nil
+}
+
+func writeFile(path string, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		return errors.Join(err, file.Close())
+	}
+	if err := file.Sync(); err != nil {
+		return errors.Join(err, file.Close())
+	}
+	return file.Close()
+}
+
+func readSnapshot(dir string) (snapshotFile, error) {
+	var snapshot snapshotFile
+	data, err := os.ReadFile(filepath.Join(dir, snapshotName))
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("read snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+func segmentPath(dir string, start int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%020d%s", segmentPrefix, start, segmentSuffix))
+}
+
+// readSegments lists the segments of the log in order.
+func readSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		start, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		result = append(result, segment{start: start, path: filepath.Join(dir, name)})
+	}
+	slices.SortFunc(result, func(a, b segment) int { return int(a.start - b.start) })
+	return result, nil
+}
+
+// readSegment calls f for every complete line of the segment and returns their total length.
+func readSegment(path string, f func(e Event) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var size int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return size, fmt.Errorf("line at %d: %w", size, err)
+		}
+		if err := f(e); err != nil {
+			return size, err
+		}
+		size += int64(len(line))
+	}
+}
+
+// ReadLog calls f for every event logged in dir, oldest first, snapshots don't hide any.
+func ReadLog(dir string, f func(e Event) error) error {
+	segments, err := readSegments(dir)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if _, err := readSegment(seg.path, f); err != nil {
+			return fmt.Errorf("%s: %w", seg.path, err)
+		}
+	}
+	return nil
+}
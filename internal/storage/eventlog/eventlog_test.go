@@ -0,0 +1,178 @@
+package eventlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	ownerId  = int64(1)
+	friendId = int64(2)
+)
+
+var now = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func open(t *testing.T, dir string, opts Options) *Storage {
+	storage, err := Open(dir, clock.NewFake(now), opts)
+	require.NoError(t, err)
+	return storage
+}
+
+// fill makes a bit of everything, reopened storages must end up with the same data.
+func fill(t *testing.T, storage *Storage) {
+	ctx := context.Background()
+	require.NoError(t, storage.AddNewUser(ctx, ownerId))
+	require.NoError(t, storage.AddNewUser(ctx, friendId))
+	require.NoError(t, storage.AddUserCategory(ctx, ownerId, "Books"))
+	for _, name := range []string{"Dune", "Solaris"} {
+		require.NoError(t, storage.AddWishItemToCategory(ctx, ownerId, "Books", messages.WishItem{Name: name}))
+	}
+	require.NoError(t, storage.AddWishItem(ctx, ownerId, messages.WishItem{Name: "Socks", URL: "https://shop.example/socks?utm_source=tg"}))
+	require.NoError(t, storage.UpdateWishItem(ctx, ownerId, messages.WishItem{ID: 1, Name: "Dune", ReservedBy: friendId}))
+	list, _ := storage.GetActiveList(ctx, ownerId)
+	require.NoError(t, storage.AddListFollower(ctx, list.ID, friendId))
+	_, err := storage.GetShareToken(ctx, ownerId)
+	require.NoError(t, err)
+	_, err = storage.CreateSantaGame(ctx, ownerId, "Office")
+	require.NoError(t, err)
+	require.NoError(t, storage.SaveJob(scheduler.Job{ID: "digest:1", Kind: "digest", RunAt: now.Add(time.Hour)}))
+	require.NoError(t, storage.MarkJobDone("digest:1@1", now))
+}
+
+func dump(t *testing.T, storage *Storage) string {
+	data, err := json.Marshal(storage.Storage.Snapshot())
+	require.NoError(t, err)
+	return string(data)
+}
+
+func readKinds(t *testing.T, dir string) []Kind {
+	var kinds []Kind
+	var seq int64
+	err := ReadLog(dir, func(e Event) error {
+		seq++
+		require.Equal(t, seq, e.Seq, "Events should be numbered without gaps")
+		kinds = append(kinds, e.Kind)
+		return nil
+	})
+	require.NoError(t, err)
+	return kinds
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should rebuild the data from the log", func(t *testing.T) {
+		dir := t.TempDir()
+		storage := open(t, dir, Options{})
+		fill(t, storage)
+		expected := dump(t, storage)
+
+		reopened := open(t, dir, Options{})
+		require.JSONEq(t, expected, dump(t, reopened))
+		token, err := reopened.GetShareToken(ctx, ownerId)
+		require.NoError(t, err)
+		list, ok := storage.GetListByShareToken(ctx, token)
+		require.True(t, ok, "Shared links should keep working")
+		require.Equal(t, ownerId, list.OwnerID)
+		require.Equal(t, []Kind{
+			UserCreated, UserCreated, CategoryAdded, ItemAdded, ItemAdded, ItemAdded, ItemReserved,
+			FollowerAdded, ShareTokenCreated, SantaGameCreated, JobSaved, JobDone,
+		}, readKinds(t, dir))
+	})
+
+	t.Run("Should start from the latest snapshot and keep the whole log", func(t *testing.T) {
+		dir := t.TempDir()
+		storage := open(t, dir, Options{SnapshotEvery: 5})
+		fill(t, storage)
+		require.FileExists(t, filepath.Join(dir, snapshotName))
+		segments, err := readSegments(dir)
+		require.NoError(t, err)
+		require.Len(t, segments, 3)
+
+		reopened := open(t, dir, Options{SnapshotEvery: 5})
+		require.JSONEq(t, dump(t, storage), dump(t, reopened))
+		require.NoError(t, reopened.AddUserCategory(ctx, ownerId, "Games"))
+		require.Len(t, readKinds(t, dir), 13)
+	})
+
+	t.Run("Should replay the tail when the snapshot is older than the log", func(t *testing.T) {
+		dir := t.TempDir()
+		storage := open(t, dir, Options{})
+		require.NoError(t, storage.AddNewUser(ctx, ownerId))
+		require.NoError(t, storage.Snapshot(ctx))
+		require.NoError(t, storage.AddUserCategory(ctx, ownerId, "Books"))
+		require.NoError(t, storage.Close())
+
+		reopened := open(t, dir, Options{})
+		require.Equal(t, []string{"Books"}, reopened.GetCategories(ctx, ownerId))
+	})
+
+	t.Run("Should replay undone writes", func(t *testing.T) {
+		dir := t.TempDir()
+		storage := open(t, dir, Options{})
+		fill(t, storage)
+		require.NoError(t, storage.DeleteUserCategory(ctx, ownerId, "Books"))
+		revisions := storage.GetRevisions(ctx, ownerId)
+		require.NoError(t, storage.RevertRevision(ctx, ownerId, revisions[0].ID))
+		require.NoError(t, storage.DeleteWishItem(ctx, ownerId, 2))
+
+		reopened := open(t, dir, Options{})
+		require.JSONEq(t, dump(t, storage), dump(t, reopened))
+		require.Equal(t, now, reopened.GetRevisions(ctx, ownerId)[0].At)
+	})
+
+	t.Run("Should not log a rolled back transaction", func(t *testing.T) {
+		dir := t.TempDir()
+		storage := open(t, dir, Options{})
+		require.NoError(t, storage.AddNewUser(ctx, ownerId))
+		errFailed := errors.New("failed")
+		err := storage.WithTx(ctx, func(tx messages.UserStorage) error {
+			require.NoError(t, tx.AddUserCategory(ctx, ownerId, "Books"))
+			return errFailed
+		})
+		require.ErrorIs(t, err, errFailed)
+		require.Equal(t, []Kind{UserCreated}, readKinds(t, dir))
+
+		err = storage.WithTx(ctx, func(tx messages.UserStorage) error {
+			if err := tx.AddUserCategory(ctx, ownerId, "Books"); err != nil {
+				return err
+			}
+			return tx.AddWishItemToCategory(ctx, ownerId, "Books", messages.WishItem{Name: "Dune"})
+		})
+		require.NoError(t, err)
+		require.Equal(t, []Kind{UserCreated, CategoryAdded, ItemAdded}, readKinds(t, dir))
+	})
+
+	t.Run("Should not log failed writes", func(t *testing.T) {
+		dir := t.TempDir()
+		storage := open(t, dir, Options{})
+		err := storage.AddUserCategory(ctx, ownerId, "Books")
+		require.ErrorIs(t, err, messages.ErrUserNotFound)
+		require.Empty(t, readKinds(t, dir))
+	})
+
+	t.Run("Should drop a line cut short by a crash", func(t *testing.T) {
+		dir := t.TempDir()
+		storage := open(t, dir, Options{})
+		require.NoError(t, storage.AddNewUser(ctx, ownerId))
+		file, err := os.OpenFile(segmentPath(dir, 1), os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = file.WriteString(`{"seq":2,"kind":"categ`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		reopened := open(t, dir, Options{})
+		require.NoError(t, reopened.AddUserCategory(ctx, ownerId, "Books"))
+		require.Equal(t, []Kind{UserCreated, CategoryAdded}, readKinds(t, dir))
+		require.Equal(t, []string{"Books"}, open(t, dir, Options{}).GetCategories(ctx, ownerId))
+	})
+}
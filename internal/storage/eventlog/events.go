@@ -0,0 +1,177 @@
+package eventlog
+
+import (
+	"context"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"time"
+)
+
+type Kind string
+
+const (
+	UserCreated           Kind = "user_created"
+	UserNamed             Kind = "user_named"
+	TimeZoneSet           Kind = "time_zone_set"
+	CategoryAdded         Kind = "category_added"
+	CategoryRenamed       Kind = "category_renamed"
+	CategoryDeleted       Kind = "category_deleted"
+	CategoryMoved         Kind = "category_moved"
+	CategoryVisibilitySet Kind = "category_visibility_set"
+	ItemAdded             Kind = "item_added"
+	ItemUpdated           Kind = "item_updated"
+	ItemReserved          Kind = "item_reserved"
+	ItemDeleted           Kind = "item_deleted"
+	ItemMoved             Kind = "item_moved"
+	ListImported          Kind = "list_imported"
+	RevisionReverted      Kind = "revision_reverted"
+	ListCreated           Kind = "list_created"
+	ListActivated         Kind = "list_activated"
+	ListRenamed           Kind = "list_renamed"
+	ListDeleted           Kind = "list_deleted"
+	ShareTokenCreated     Kind = "share_token_created"
+	EventAdded            Kind = "event_added"
+	EventDeleted          Kind = "event_deleted"
+	FollowerAdded         Kind = "follower_added"
+	FollowerRemoved       Kind = "follower_removed"
+	FollowMuted           Kind = "follow_muted"
+	ChangesCleared        Kind = "changes_cleared"
+	SantaGameCreated      Kind = "santa_game_created"
+	SantaGameUpdated      Kind = "santa_game_updated"
+	PledgeSet             Kind = "pledge_set"
+	PriceWatchSet         Kind = "price_watch_set"
+	PriceWatchDeleted     Kind = "price_watch_deleted"
+	PriceRecorded         Kind = "price_recorded"
+	JobSaved              Kind = "job_saved"
+	JobDeleted            Kind = "job_deleted"
+	JobDone               Kind = "job_done"
+	DoneJobsForgotten     Kind = "done_jobs_forgotten"
+)
+
+// Event is a line of the log. Only the fields the kind needs are set; IDs the storage assigns
+// are logged for the audit trail, replay gets the same ones by repeating the calls in order.
+// Revisions the calls push are stamped with At on replay.
+type Event struct {
+	Seq        int64                `json:"seq"`
+	At         time.Time            `json:"at"`
+	Kind       Kind                 `json:"kind"`
+	UserID     int64                `json:"user_id,omitempty"`
+	FollowerID int64                `json:"follower_id,omitempty"`
+	ListID     int64                `json:"list_id,omitempty"`
+	ItemID     int64                `json:"item_id,omitempty"`
+	EventID    int64                `json:"event_id,omitempty"`
+	RevisionID int64                `json:"revision_id,omitempty"`
+	Category   string               `json:"category,omitempty"`
+	Name       string               `json:"name,omitempty"`
+	Position   int                  `json:"position,omitempty"`
+	Muted      bool                 `json:"muted,omitempty"`
+	Token      string               `json:"token,omitempty"`
+	Visibility messages.Visibility  `json:"visibility,omitempty"`
+	Time       *time.Time           `json:"time,omitempty"`
+	Item       *messages.WishItem   `json:"item,omitempty"`
+	Categories messages.Categories  `json:"categories,omitempty"`
+	Date       *messages.Event      `json:"date,omitempty"`
+	Game       *messages.SantaGame  `json:"game,omitempty"`
+	Pledge     *messages.Pledge     `json:"pledge,omitempty"`
+	Watch      *messages.PriceWatch `json:"watch,omitempty"`
+	Point      *messages.PricePoint `json:"point,omitempty"`
+	Job        *scheduler.Job       `json:"job,omitempty"`
+}
+
+// apply repeats the call the event was logged for.
+func apply(ctx context.Context, mem *inmemory.Storage, e Event) error {
+	switch e.Kind {
+	case UserCreated:
+		return mem.AddNewUser(ctx, e.UserID)
+	case UserNamed:
+		return mem.SetUserName(ctx, e.UserID, e.Name)
+	case TimeZoneSet:
+		return mem.SetTimeZone(ctx, e.UserID, e.Name)
+	case CategoryAdded:
+		return mem.AddUserCategory(ctx, e.UserID, e.Category)
+	case CategoryRenamed:
+		return mem.RenameUserCategory(ctx, e.UserID, e.Category, e.Name)
+	case CategoryDeleted:
+		return mem.DeleteUserCategory(ctx, e.UserID, e.Category)
+	case CategoryMoved:
+		return mem.MoveUserCategory(ctx, e.UserID, e.Category, e.Position)
+	case CategoryVisibilitySet:
+		return mem.SetCategoryVisibility(ctx, e.UserID, e.Category, e.Visibility)
+	case ItemAdded:
+		item := *e.Item
+		item.ID = 0
+		return mem.AddWishItemToCategory(ctx, e.UserID, e.Category, item)
+	case ItemUpdated, ItemReserved:
+		return mem.UpdateWishItem(ctx, e.UserID, *e.Item)
+	case ItemDeleted:
+		return mem.DeleteWishItem(ctx, e.UserID, e.ItemID)
+	case ItemMoved:
+		return mem.MoveWishItem(ctx, e.UserID, e.ItemID, e.Category, e.Position)
+	case RevisionReverted:
+		return mem.RevertRevision(ctx, e.UserID, e.RevisionID)
+	case ListImported:
+		return mem.ImportWishList(ctx, e.UserID, e.Categories)
+	case ListCreated:
+		_, err := mem.CreateList(ctx, e.UserID, e.Name)
+		return err
+	case ListActivated:
+		return mem.SetActiveList(ctx, e.UserID, e.ListID)
+	case ListRenamed:
+		return mem.RenameList(ctx, e.UserID, e.ListID, e.Name)
+	case ListDeleted:
+		return mem.DeleteList(ctx, e.UserID, e.ListID)
+	case ShareTokenCreated:
+		return withToken(mem, e.Token, func() error {
+			_, err := mem.GetListShareToken(ctx, e.ListID)
+			return err
+		})
+	case EventAdded:
+		date := *e.Date
+		date.ID = 0
+		return mem.AddEvent(ctx, e.UserID, date)
+	case EventDeleted:
+		return mem.DeleteEvent(ctx, e.UserID, e.EventID)
+	case FollowerAdded:
+		return mem.AddListFollower(ctx, e.ListID, e.FollowerID)
+	case FollowerRemoved:
+		return mem.RemoveFollower(ctx, e.UserID, e.FollowerID)
+	case FollowMuted:
+		return mem.SetFollowMuted(ctx, e.UserID, e.FollowerID, e.Muted)
+	case ChangesCleared:
+		return mem.ClearChanges(ctx, e.UserID, e.ItemID)
+	case SantaGameCreated:
+		return withToken(mem, e.Game.Token, func() error {
+			_, err := mem.CreateSantaGame(ctx, e.Game.OrganizerID, e.Game.Title)
+			return err
+		})
+	case SantaGameUpdated:
+		return mem.UpdateSantaGame(ctx, *e.Game)
+	case PledgeSet:
+		return mem.SetPledge(ctx, *e.Pledge)
+	case PriceWatchSet:
+		return mem.SetPriceWatch(ctx, *e.Watch)
+	case PriceWatchDeleted:
+		return mem.DeletePriceWatch(ctx, e.UserID, e.ItemID)
+	case PriceRecorded:
+		return mem.AddPricePoint(ctx, e.ItemID, *e.Point)
+	case JobSaved:
+		return mem.SaveJob(*e.Job)
+	case JobDeleted:
+		return mem.DeleteJob(e.Name)
+	case JobDone:
+		return mem.MarkJobDone(e.Name, *e.Time)
+	case DoneJobsForgotten:
+		return mem.ForgetDoneJobs(*e.Time)
+	}
+	return fmt.Errorf("unknown event kind %q", e.Kind)
+}
+
+// withToken makes f get token when it asks for a new one, so replay restores tokens the links were shared with.
+func withToken(mem *inmemory.Storage, token string, f func() error) error {
+	tokens := mem.Tokens
+	defer func() { mem.Tokens = tokens }()
+	mem.Tokens = func() (string, error) { return token, nil }
+	return f()
+}
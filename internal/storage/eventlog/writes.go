@@ -0,0 +1,289 @@
+package eventlog
+
+import (
+	"context"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"time"
+)
+
+// The methods below shadow every write of inmemory.Storage, reads go to it directly.
+
+// logged returns the event for record once the call it describes succeeded.
+func logged(e Event, err error) ([]Event, error) {
+	if err != nil {
+		return nil, err
+	}
+	return []Event{e}, nil
+}
+
+func (s *Storage) AddNewUser(ctx context.Context, userId int64) error {
+	if _, ok := s.GetActiveList(ctx, userId); ok {
+		return nil
+	}
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		if _, ok := mem.GetActiveList(ctx, userId); ok {
+			return nil, nil
+		}
+		return logged(Event{Kind: UserCreated, UserID: userId}, mem.AddNewUser(ctx, userId))
+	})
+}
+
+func (s *Storage) AddUserCategory(ctx context.Context, userId int64, catName string) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: CategoryAdded, UserID: userId, Category: catName}, mem.AddUserCategory(ctx, userId, catName))
+	})
+}
+
+func (s *Storage) AddWishItem(ctx context.Context, userId int64, item messages.WishItem) error {
+	return s.AddWishItemToCategory(ctx, userId, "default", item)
+}
+
+func (s *Storage) AddWishItemToCategory(ctx context.Context, userId int64, catName string, item messages.WishItem) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: ItemAdded, UserID: userId, Category: catName, Item: &item}, mem.AddWishItemToCategory(ctx, userId, catName, item))
+	})
+}
+
+func (s *Storage) ImportWishList(ctx context.Context, userId int64, wishList messages.Categories) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: ListImported, UserID: userId, Categories: wishList}, mem.ImportWishList(ctx, userId, wishList))
+	})
+}
+
+// UpdateWishItem logs ItemReserved when a friend takes a free item, ItemUpdated otherwise.
+func (s *Storage) UpdateWishItem(ctx context.Context, userId int64, item messages.WishItem) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		kind := ItemUpdated
+		if previous, ok := findItem(ctx, mem, userId, item.ID); ok && previous.ReservedBy == 0 && item.ReservedBy != 0 {
+			kind = ItemReserved
+		}
+		return logged(Event{Kind: kind, UserID: userId, ItemID: item.ID, Item: &item}, mem.UpdateWishItem(ctx, userId, item))
+	})
+}
+
+func findItem(ctx context.Context, mem *inmemory.Storage, userId int64, itemId int64) (messages.WishItem, bool) {
+	for _, list := range mem.GetLists(ctx, userId) {
+		if item, ok := mem.GetListWishList(ctx, list.ID).Find(itemId); ok {
+			return item, true
+		}
+	}
+	return messages.WishItem{}, false
+}
+
+func (s *Storage) RevertRevision(ctx context.Context, userId int64, revisionId int64) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		e := Event{Kind: RevisionReverted, UserID: userId, RevisionID: revisionId}
+		return logged(e, mem.RevertRevision(ctx, userId, revisionId))
+	})
+}
+
+func (s *Storage) DeleteWishItem(ctx context.Context, userId int64, itemId int64) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: ItemDeleted, UserID: userId, ItemID: itemId}, mem.DeleteWishItem(ctx, userId, itemId))
+	})
+}
+
+func (s *Storage) MoveWishItem(ctx context.Context, userId int64, itemId int64, catName string, position int) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		e := Event{Kind: ItemMoved, UserID: userId, ItemID: itemId, Category: catName, Position: position}
+		return logged(e, mem.MoveWishItem(ctx, userId, itemId, catName, position))
+	})
+}
+
+func (s *Storage) RenameUserCategory(ctx context.Context, userId int64, catName string, newName string) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		e := Event{Kind: CategoryRenamed, UserID: userId, Category: catName, Name: newName}
+		return logged(e, mem.RenameUserCategory(ctx, userId, catName, newName))
+	})
+}
+
+func (s *Storage) DeleteUserCategory(ctx context.Context, userId int64, catName string) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: CategoryDeleted, UserID: userId, Category: catName}, mem.DeleteUserCategory(ctx, userId, catName))
+	})
+}
+
+func (s *Storage) MoveUserCategory(ctx context.Context, userId int64, catName string, position int) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		e := Event{Kind: CategoryMoved, UserID: userId, Category: catName, Position: position}
+		return logged(e, mem.MoveUserCategory(ctx, userId, catName, position))
+	})
+}
+
+func (s *Storage) SetCategoryVisibility(ctx context.Context, userId int64, catName string, visibility messages.Visibility) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		e := Event{Kind: CategoryVisibilitySet, UserID: userId, Category: catName, Visibility: visibility}
+		return logged(e, mem.SetCategoryVisibility(ctx, userId, catName, visibility))
+	})
+}
+
+func (s *Storage) GetShareToken(ctx context.Context, userId int64) (string, error) {
+	list, ok := s.GetActiveList(ctx, userId)
+	if !ok {
+		return "", nil
+	}
+	return s.GetListShareToken(ctx, list.ID)
+}
+
+// GetListShareToken logs ShareTokenCreated the first time the list is shared.
+func (s *Storage) GetListShareToken(ctx context.Context, listId int64) (string, error) {
+	var token string
+	err := s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		s.journal.token = ""
+		var err error
+		token, err = mem.GetListShareToken(ctx, listId)
+		if err != nil || s.journal.token == "" {
+			return nil, err
+		}
+		list, _ := mem.GetList(ctx, listId)
+		return []Event{{Kind: ShareTokenCreated, UserID: list.OwnerID, ListID: listId, Token: token}}, nil
+	})
+	return token, err
+}
+
+func (s *Storage) SetUserName(ctx context.Context, userId int64, name string) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: UserNamed, UserID: userId, Name: name}, mem.SetUserName(ctx, userId, name))
+	})
+}
+
+func (s *Storage) SetTimeZone(ctx context.Context, userId int64, timeZone string) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: TimeZoneSet, UserID: userId, Name: timeZone}, mem.SetTimeZone(ctx, userId, timeZone))
+	})
+}
+
+func (s *Storage) AddEvent(ctx context.Context, userId int64, event messages.Event) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: EventAdded, UserID: userId, Date: &event}, mem.AddEvent(ctx, userId, event))
+	})
+}
+
+func (s *Storage) DeleteEvent(ctx context.Context, userId int64, eventId int64) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: EventDeleted, UserID: userId, EventID: eventId}, mem.DeleteEvent(ctx, userId, eventId))
+	})
+}
+
+func (s *Storage) AddListFollower(ctx context.Context, listId int64, followerId int64) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		e := Event{Kind: FollowerAdded, ListID: listId, FollowerID: followerId}
+		return logged(e, mem.AddListFollower(ctx, listId, followerId))
+	})
+}
+
+func (s *Storage) RemoveFollower(ctx context.Context, ownerId int64, followerId int64) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		e := Event{Kind: FollowerRemoved, UserID: ownerId, FollowerID: followerId}
+		return logged(e, mem.RemoveFollower(ctx, ownerId, followerId))
+	})
+}
+
+func (s *Storage) SetFollowMuted(ctx context.Context, ownerId int64, followerId int64, muted bool) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		e := Event{Kind: FollowMuted, UserID: ownerId, FollowerID: followerId, Muted: muted}
+		return logged(e, mem.SetFollowMuted(ctx, ownerId, followerId, muted))
+	})
+}
+
+// ClearChanges keeps upToId in ItemID, change IDs are not logged anywhere else.
+func (s *Storage) ClearChanges(ctx context.Context, ownerId int64, upToId int64) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: ChangesCleared, UserID: ownerId, ItemID: upToId}, mem.ClearChanges(ctx, ownerId, upToId))
+	})
+}
+
+func (s *Storage) CreateSantaGame(ctx context.Context, organizerId int64, title string) (messages.SantaGame, error) {
+	var game messages.SantaGame
+	err := s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		var err error
+		game, err = mem.CreateSantaGame(ctx, organizerId, title)
+		return logged(Event{Kind: SantaGameCreated, UserID: organizerId, Game: &game}, err)
+	})
+	return game, err
+}
+
+func (s *Storage) UpdateSantaGame(ctx context.Context, game messages.SantaGame) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: SantaGameUpdated, Game: &game}, mem.UpdateSantaGame(ctx, game))
+	})
+}
+
+func (s *Storage) SetPledge(ctx context.Context, pledge messages.Pledge) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: PledgeSet, UserID: pledge.OwnerID, ItemID: pledge.ItemID, Pledge: &pledge}, mem.SetPledge(ctx, pledge))
+	})
+}
+
+func (s *Storage) CreateList(ctx context.Context, userId int64, name string) (messages.WishList, error) {
+	var list messages.WishList
+	err := s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		var err error
+		list, err = mem.CreateList(ctx, userId, name)
+		return logged(Event{Kind: ListCreated, UserID: userId, ListID: list.ID, Name: name}, err)
+	})
+	return list, err
+}
+
+func (s *Storage) SetActiveList(ctx context.Context, userId int64, listId int64) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: ListActivated, UserID: userId, ListID: listId}, mem.SetActiveList(ctx, userId, listId))
+	})
+}
+
+func (s *Storage) RenameList(ctx context.Context, userId int64, listId int64, name string) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: ListRenamed, UserID: userId, ListID: listId, Name: name}, mem.RenameList(ctx, userId, listId, name))
+	})
+}
+
+func (s *Storage) DeleteList(ctx context.Context, userId int64, listId int64) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: ListDeleted, UserID: userId, ListID: listId}, mem.DeleteList(ctx, userId, listId))
+	})
+}
+
+func (s *Storage) SetPriceWatch(ctx context.Context, watch messages.PriceWatch) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		e := Event{Kind: PriceWatchSet, UserID: watch.OwnerID, ItemID: watch.ItemID, Watch: &watch}
+		return logged(e, mem.SetPriceWatch(ctx, watch))
+	})
+}
+
+func (s *Storage) DeletePriceWatch(ctx context.Context, ownerId int64, itemId int64) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: PriceWatchDeleted, UserID: ownerId, ItemID: itemId}, mem.DeletePriceWatch(ctx, ownerId, itemId))
+	})
+}
+
+func (s *Storage) AddPricePoint(ctx context.Context, itemId int64, point messages.PricePoint) error {
+	return s.record(ctx, func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: PriceRecorded, ItemID: itemId, Point: &point}, mem.AddPricePoint(ctx, itemId, point))
+	})
+}
+
+func (s *Storage) SaveJob(job scheduler.Job) error {
+	return s.record(context.Background(), func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: JobSaved, Job: &job}, mem.SaveJob(job))
+	})
+}
+
+func (s *Storage) DeleteJob(id string) error {
+	return s.record(context.Background(), func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: JobDeleted, Name: id}, mem.DeleteJob(id))
+	})
+}
+
+func (s *Storage) MarkJobDone(key string, at time.Time) error {
+	return s.record(context.Background(), func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: JobDone, Name: key, Time: &at}, mem.MarkJobDone(key, at))
+	})
+}
+
+func (s *Storage) ForgetDoneJobs(before time.Time) error {
+	return s.record(context.Background(), func(mem *inmemory.Storage) ([]Event, error) {
+		return logged(Event{Kind: DoneJobsForgotten, Time: &before}, mem.ForgetDoneJobs(before))
+	})
+}
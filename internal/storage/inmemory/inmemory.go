@@ -1,98 +1,1154 @@
 package inmemory
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/links"
 	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
 type UserData struct {
 	userId     int64
+	lists      []*List
+	activeList int64
+	name       string
+	timeZone   string
+	events     []messages.Event
+	muted      []int64
+	changes    []messages.Change
+	revisions  []messages.Revision
+}
+
+// maxPricePoints bounds the price history kept per item.
+const maxPricePoints = 100
+
+// maxChanges bounds the change log of a user whose digest is never collected.
+const maxChanges = 200
+
+type List struct {
+	id         int64
+	ownerId    int64
+	name       string
+	shareToken string
 	categories []*Category
+	// followers opened the share link of this list, they don't see the other lists of the owner.
+	followers []int64
+}
+
+func (l *List) toWishList() messages.WishList {
+	return messages.WishList{ID: l.id, OwnerID: l.ownerId, Name: l.name}
+}
+
+// active is the list owner commands work with. Every user has at least one list.
+func (d *UserData) active() *List {
+	for _, list := range d.lists {
+		if list.id == d.activeList {
+			return list
+		}
+	}
+	return d.lists[0]
 }
 
 type Category struct {
-	name  string
-	items []messages.WishItem
+	name       string
+	items      []messages.WishItem
+	visibility messages.Visibility
 }
 
+// Storage keeps everything in memory. Its calls never wait, so only WithTx looks at the context.
 type Storage struct {
-	users map[int64]*UserData
+	mu        sync.RWMutex
+	listeners []func(messages.Change)
+	*state
+	// tx collects the changes made through a transaction view until the transaction commits.
+	tx *[]messages.Change
+	// undo is how a transaction view takes back its writes, see WithTx.
+	undo *undo
+	// Tokens makes share and invite tokens, random ones when it is nil.
+	Tokens func() (string, error)
+	// Clock stamps revisions, the real one is used when it is nil.
+	Clock clock.Clock
+}
+
+// state is the data, shared by the storage and its transaction views.
+type state struct {
+	users          map[int64]*UserData
+	shareTokens    map[string]int64
+	lists          map[int64]*List
+	jobs           map[string]scheduler.Job
+	doneJobs       map[string]time.Time
+	santaGames     map[int64]*messages.SantaGame
+	santaTokens    map[string]int64
+	pledges        []messages.Pledge
+	priceWatches   []messages.PriceWatch
+	priceHistory   map[int64][]messages.PricePoint
+	lastGameId     int64
+	lastListId     int64
+	lastItemId     int64
+	lastEventId    int64
+	lastChangeId   int64
+	lastRevisionId int64
 }
 
 func New() (*Storage, error) {
-	return &Storage{
-		users: make(map[int64]*UserData),
-	}, nil
+	return &Storage{state: &state{
+		users:        make(map[int64]*UserData),
+		shareTokens:  make(map[string]int64),
+		lists:        make(map[int64]*List),
+		jobs:         make(map[string]scheduler.Job),
+		doneJobs:     make(map[string]time.Time),
+		santaGames:   make(map[int64]*messages.SantaGame),
+		santaTokens:  make(map[string]int64),
+		priceHistory: make(map[int64][]messages.PricePoint),
+	}}, nil
 }
 
-func (s *Storage) AddNewUser(userId int64) (bool, error) {
-	_, ok := s.users[userId]
-	if !ok {
-		userData := &UserData{
-			userId:     userId,
-			categories: make([]*Category, 0),
-		}
-		userData.categories = append(userData.categories,
-			&Category{
-				name:  "default",
-				items: make([]messages.WishItem, 0),
-			})
+// AddNewUser registers the user, a known user is left as is.
+func (s *Storage) AddNewUser(ctx context.Context, userId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userId]; !ok {
+		s.saveUser(userId)
+		userData := &UserData{userId: userId}
+		s.addList(userData, messages.DefaultListName)
 		s.users[userId] = userData
-		return true, nil
 	}
-	return false, nil
+	return nil
+}
+
+func (s *Storage) AddUserCategory(ctx context.Context, userId int64, catName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.user(userId)
+	if err != nil {
+		return err
+	}
+	if cat, _ := s.findCategory(userId, catName); cat != nil {
+		return messages.ErrDuplicate
+	}
+	data.active().categories = append(data.active().categories, &Category{
+		name:  catName,
+		items: make([]messages.WishItem, 0),
+	})
+	return nil
+}
+
+func (s *Storage) AddWishItemToCategory(ctx context.Context, userId int64, catName string, item messages.WishItem) error {
+	var changes []messages.Change
+	defer s.notify(&changes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cat, err := s.findCategory(userId, catName)
+	if err != nil {
+		return err
+	}
+	s.lastItemId++
+	item.ID = s.lastItemId
+	item.URL = links.Canonical(item.URL)
+	cat.items = append(cat.items, item)
+	changes = append(changes, s.record(s.users[userId], cat, messages.ChangeItemAdded, item))
+	return nil
+}
+
+func (s *Storage) AddWishItem(ctx context.Context, userId int64, item messages.WishItem) error {
+	return s.AddWishItemToCategory(ctx, userId, "default", item)
+}
+
+func (s *Storage) GetWishListByCategory(ctx context.Context, userId int64) messages.Categories {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	userData, ok := s.users[userId]
+	if ok {
+		return copyCategories(userData.active().categories)
+	}
+	return nil
+}
+
+func copyCategories(categories []*Category) messages.Categories {
+	result := make(messages.Categories, 0, len(categories))
+	for _, category := range categories {
+		var a = make([]messages.WishItem, len(category.items))
+		copy(a, category.items)
+		result = append(result, messages.WishCategory{Name: category.name, Items: a})
+	}
+	return result
+}
+
+// GetWishListByStatus returns the items of the active list that are in one of the statuses.
+// Categories without such items are left out.
+func (s *Storage) GetWishListByStatus(ctx context.Context, userId int64, statuses ...messages.ItemStatus) messages.Categories {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.users[userId]
+	if !ok {
+		return nil
+	}
+	result := make(messages.Categories, 0)
+	for _, category := range data.active().categories {
+		var items []messages.WishItem
+		for _, item := range category.items {
+			if slices.Contains(statuses, item.CurrentStatus()) {
+				items = append(items, item)
+			}
+		}
+		if len(items) > 0 {
+			result = append(result, messages.WishCategory{Name: category.name, Items: items})
+		}
+	}
+	return result
+}
+
+// SearchWishItems scans all lists in order, a backend with an index would use the
+// normalized WishItem.SearchText instead.
+func (s *Storage) SearchWishItems(ctx context.Context, userId int64, query string, offset, limit int) ([]messages.FoundItem, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.users[userId]
+	if !ok {
+		return nil, 0
+	}
+	var found []messages.FoundItem
+	total := 0
+	for _, list := range data.lists {
+		for _, category := range list.categories {
+			for _, item := range category.items {
+				if !item.MatchesSearch(query) {
+					continue
+				}
+				if total >= offset && len(found) < limit {
+					found = append(found, messages.FoundItem{WishItem: item, ListID: list.id, Category: category.name})
+				}
+				total++
+			}
+		}
+	}
+	return found, total
 }
 
-func (s *Storage) AddUserCategory(userId int64, catName string) (bool, error) {
+func (s *Storage) GetCategories(ctx context.Context, userId int64) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	data, ok := s.users[userId]
+	result := make([]string, 0, 10)
 	if ok {
-		data.categories = append(data.categories, &Category{
-			name:  catName,
-			items: make([]messages.WishItem, 0),
+		for _, cat := range data.active().categories {
+			if cat.name != "default" {
+				result = append(result, cat.name)
+			}
+		}
+	}
+	return result
+}
+
+func (s *Storage) ImportWishList(ctx context.Context, userId int64, wishList messages.Categories) error {
+	var changes []messages.Change
+	defer s.notify(&changes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.user(userId)
+	if err != nil {
+		return err
+	}
+	for _, cat := range wishList {
+		idx := slices.IndexFunc(data.active().categories, func(category *Category) bool {
+			return strings.EqualFold(category.name, cat.Name)
 		})
-		return true, nil
+		if idx == -1 {
+			data.active().categories = append(data.active().categories, &Category{
+				name:  cat.Name,
+				items: make([]messages.WishItem, 0, len(cat.Items)),
+			})
+			idx = len(data.active().categories) - 1
+		}
+		for _, item := range cat.Items {
+			s.lastItemId++
+			item.ID = s.lastItemId
+			item.URL = links.Canonical(item.URL)
+			data.active().categories[idx].items = append(data.active().categories[idx].items, item)
+			changes = append(changes, s.record(data, data.active().categories[idx], messages.ChangeItemAdded, item))
+		}
+	}
+	return nil
+}
+
+func (s *Storage) GetShareToken(ctx context.Context, userId int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.users[userId]
+	if !ok {
+		return "", nil
+	}
+	return s.listShareToken(data.active())
+}
+
+func (s *Storage) listShareToken(list *List) (string, error) {
+	if list.shareToken == "" {
+		s.saveUser(list.ownerId)
+		token, err := s.token()
+		if err != nil {
+			return "", err
+		}
+		list.shareToken = token
+		s.shareTokens[token] = list.id
+	}
+	return list.shareToken, nil
+}
+
+func (s *Storage) GetListByShareToken(ctx context.Context, token string) (messages.WishList, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, ok := s.lists[s.shareTokens[token]]
+	if !ok {
+		return messages.WishList{}, false
+	}
+	return list.toWishList(), true
+}
+
+func (s *Storage) UpdateWishItem(ctx context.Context, userId int64, item messages.WishItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cat, idx, err := s.findItem(userId, item.ID)
+	if err != nil {
+		return err
+	}
+	s.saveRevision(userId, cat, messages.Revision{Kind: messages.RevisionItemUpdated, Position: idx, Items: cat.items[idx : idx+1]})
+	item.URL = links.Canonical(item.URL)
+	cat.items[idx] = item
+	return nil
+}
+
+func (s *Storage) DeleteWishItem(ctx context.Context, userId int64, itemId int64) error {
+	var changes []messages.Change
+	defer s.notify(&changes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cat, idx, err := s.findItem(userId, itemId)
+	if err != nil {
+		return err
+	}
+	changes = append(changes, s.record(s.users[userId], cat, messages.ChangeItemRemoved, cat.items[idx]))
+	s.saveRevision(userId, cat, messages.Revision{Kind: messages.RevisionItemDeleted, Position: idx, Items: cat.items[idx : idx+1]})
+	cat.items = slices.Delete(cat.items, idx, idx+1)
+	return nil
+}
+
+// MoveWishItem puts the item at position inside catName, which may be its current category.
+// Positions outside of the list are clamped to its ends.
+func (s *Storage) MoveWishItem(ctx context.Context, userId int64, itemId int64, catName string, position int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cat, idx, err := s.findItem(userId, itemId)
+	if err != nil {
+		return err
+	}
+	target, err := s.findCategory(userId, catName)
+	if err != nil {
+		return err
+	}
+	item := cat.items[idx]
+	cat.items = slices.Delete(cat.items, idx, idx+1)
+	position = min(max(position, 0), len(target.items))
+	target.items = slices.Insert(target.items, position, item)
+	return nil
+}
+
+// RenameUserCategory refuses the default category, which is not the user's own.
+func (s *Storage) RenameUserCategory(ctx context.Context, userId int64, catName string, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cat, err := s.ownCategory(userId, catName)
+	if err != nil {
+		return err
+	}
+	if other, _ := s.findCategory(userId, newName); other != nil {
+		return messages.ErrDuplicate
+	}
+	s.saveRevision(userId, cat, messages.Revision{Kind: messages.RevisionCategoryRenamed, NewName: newName})
+	cat.name = newName
+	return nil
+}
+
+// DeleteUserCategory keeps the items of the removed category by moving them to the default one.
+func (s *Storage) DeleteUserCategory(ctx context.Context, userId int64, catName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cat, err := s.ownCategory(userId, catName)
+	if err != nil {
+		return err
+	}
+	data := s.users[userId]
+	s.saveRevision(userId, cat, messages.Revision{Kind: messages.RevisionCategoryDeleted, Items: cat.items})
+	if defaultCat, _ := s.findCategory(userId, "default"); defaultCat != nil {
+		for _, item := range cat.items {
+			// Items keep the visibility they had, a private category must not become public by deletion.
+			item.Visibility = item.Visibility.Effective(cat.visibility)
+			if item.Visibility == defaultCat.visibility.Effective(messages.VisibilityInherit) {
+				item.Visibility = messages.VisibilityInherit
+			}
+			defaultCat.items = append(defaultCat.items, item)
+		}
+	}
+	data.active().categories = slices.DeleteFunc(data.active().categories, func(c *Category) bool { return c == cat })
+	return nil
+}
+
+// MoveUserCategory sets the position among the user's own categories, the way GetCategories lists them.
+func (s *Storage) MoveUserCategory(ctx context.Context, userId int64, catName string, position int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cat, err := s.ownCategory(userId, catName)
+	if err != nil {
+		return err
+	}
+	data := s.users[userId]
+	data.active().categories = slices.DeleteFunc(data.active().categories, func(c *Category) bool { return c == cat })
+	position = max(position, 0)
+	named := 0
+	insertAt := len(data.active().categories)
+	for i, c := range data.active().categories {
+		if c.name == "default" {
+			continue
+		}
+		if named == position {
+			insertAt = i
+			break
+		}
+		named++
+	}
+	data.active().categories = slices.Insert(data.active().categories, insertAt, cat)
+	return nil
+}
+
+// user returns the data of the user for a write, a transaction saves it beforehand.
+func (s *Storage) user(userId int64) (*UserData, error) {
+	data, ok := s.users[userId]
+	if !ok {
+		return nil, messages.ErrUserNotFound
+	}
+	s.saveUser(userId)
+	return data, nil
+}
+
+func (s *Storage) findCategory(userId int64, catName string) (*Category, error) {
+	data, err := s.user(userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, cat := range data.active().categories {
+		if cat.name == catName {
+			return cat, nil
+		}
+	}
+	return nil, messages.ErrCategoryNotFound
+}
+
+// ownCategory is findCategory for the categories the user created, the default one is not among them.
+func (s *Storage) ownCategory(userId int64, catName string) (*Category, error) {
+	if catName == "default" {
+		return nil, messages.ErrCategoryNotFound
+	}
+	return s.findCategory(userId, catName)
+}
+
+func (s *Storage) findItem(userId int64, itemId int64) (*Category, int, error) {
+	data, err := s.user(userId)
+	if err != nil {
+		return nil, -1, err
+	}
+	// Item IDs are unique across lists, so friends can act on an item of any list.
+	for _, list := range data.lists {
+		for _, cat := range list.categories {
+			for i, item := range cat.items {
+				if item.ID == itemId {
+					return cat, i, nil
+				}
+			}
+		}
+	}
+	return nil, -1, messages.ErrItemNotFound
+}
+
+func (s *Storage) SetUserName(ctx context.Context, userId int64, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.user(userId)
+	if err != nil {
+		return err
 	}
-	return false, nil
+	data.name = name
+	return nil
+}
+
+func (s *Storage) GetUserName(ctx context.Context, userId int64) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if data, ok := s.users[userId]; ok {
+		return data.name
+	}
+	return ""
+}
+
+func (s *Storage) SetTimeZone(ctx context.Context, userId int64, timeZone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.user(userId)
+	if err != nil {
+		return err
+	}
+	data.timeZone = timeZone
+	return nil
 }
 
-func (s *Storage) AddWishItemToCategory(userId int64, catName string, item messages.WishItem) (bool, error) {
+func (s *Storage) GetTimeZone(ctx context.Context, userId int64) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if data, ok := s.users[userId]; ok {
-		for _, cat := range data.categories {
-			if cat.name == catName {
-				cat.items = append(cat.items, item)
+		return data.timeZone
+	}
+	return ""
+}
+
+func (s *Storage) AddEvent(ctx context.Context, userId int64, event messages.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.user(userId)
+	if err != nil {
+		return err
+	}
+	s.lastEventId++
+	event.ID = s.lastEventId
+	data.events = append(data.events, event)
+	return nil
+}
+
+func (s *Storage) GetEvents(ctx context.Context, userId int64) []messages.Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if data, ok := s.users[userId]; ok {
+		return slices.Clone(data.events)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteEvent(ctx context.Context, userId int64, eventId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.user(userId)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(data.events, func(event messages.Event) bool {
+		return event.ID == eventId
+	})
+	if idx == -1 {
+		return messages.ErrNotFound
+	}
+	data.events = slices.Delete(data.events, idx, idx+1)
+	return nil
+}
+
+func (s *Storage) AddListFollower(ctx context.Context, listId int64, followerId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, ok := s.lists[listId]
+	if !ok {
+		return messages.ErrListNotFound
+	}
+	if slices.Contains(list.followers, followerId) {
+		return messages.ErrDuplicate
+	}
+	s.saveUser(list.ownerId)
+	list.followers = append(list.followers, followerId)
+	return nil
+}
+
+func (s *Storage) GetListFollowers(ctx context.Context, listId int64) []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if list, ok := s.lists[listId]; ok {
+		return slices.Clone(list.followers)
+	}
+	return nil
+}
+
+// GetFollowers returns who follows any list of the owner.
+func (s *Storage) GetFollowers(ctx context.Context, ownerId int64) []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if data, ok := s.users[ownerId]; ok {
+		return data.followers()
+	}
+	return nil
+}
+
+func (d *UserData) followers() []int64 {
+	var result []int64
+	for _, list := range d.lists {
+		for _, id := range list.followers {
+			if !slices.Contains(result, id) {
+				result = append(result, id)
 			}
 		}
-		return true, nil
 	}
-	return false, nil
+	return result
 }
 
-func (s *Storage) AddWishItem(userId int64, item messages.WishItem) (bool, error) {
-	return s.AddWishItemToCategory(userId, "default", item)
+func (s *Storage) RemoveFollower(ctx context.Context, ownerId int64, followerId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.follower(ownerId, followerId)
+	if err != nil {
+		return err
+	}
+	for _, list := range data.lists {
+		list.followers = slices.DeleteFunc(list.followers, func(id int64) bool { return id == followerId })
+	}
+	data.muted = slices.DeleteFunc(data.muted, func(id int64) bool { return id == followerId })
+	return nil
 }
 
-func (s *Storage) GetWishListByCategory(userId int64) map[string][]messages.WishItem {
-	userData, ok := s.users[userId]
-	if ok {
-		result := make(map[string][]messages.WishItem)
-		for _, category := range userData.categories {
-			var a = make([]messages.WishItem, len(category.items))
-			copy(a, category.items)
-			result[category.name] = a
+func (s *Storage) GetFollowing(ctx context.Context, followerId int64) []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]int64, 0)
+	for ownerId, data := range s.users {
+		if slices.Contains(data.followers(), followerId) {
+			result = append(result, ownerId)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+func (s *Storage) SetFollowMuted(ctx context.Context, ownerId int64, followerId int64, muted bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.follower(ownerId, followerId)
+	if err != nil {
+		return err
+	}
+	data.muted = slices.DeleteFunc(data.muted, func(id int64) bool { return id == followerId })
+	if muted {
+		data.muted = append(data.muted, followerId)
+	}
+	return nil
+}
+
+// follower returns the data of the owner when followerId follows them.
+func (s *Storage) follower(ownerId int64, followerId int64) (*UserData, error) {
+	data, err := s.user(ownerId)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(data.followers(), followerId) {
+		return nil, messages.ErrFollowerNotFound
+	}
+	return data, nil
+}
+
+func (s *Storage) IsFollowMuted(ctx context.Context, ownerId int64, followerId int64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.users[ownerId]
+	return ok && slices.Contains(data.muted, followerId)
+}
+
+// OnChange subscribes f to the change stream. Listeners are called after the lock is released,
+// so they may use the storage themselves.
+func (s *Storage) OnChange(f func(messages.Change)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, f)
+}
+
+func (s *Storage) GetChanges(ctx context.Context, ownerId int64) []messages.Change {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if data, ok := s.users[ownerId]; ok {
+		return slices.Clone(data.changes)
+	}
+	return nil
+}
+
+// ClearChanges drops the changes up to and including upToId, later ones wait for the next digest.
+func (s *Storage) ClearChanges(ctx context.Context, ownerId int64, upToId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.user(ownerId)
+	if err != nil {
+		return err
+	}
+	data.changes = slices.DeleteFunc(data.changes, func(c messages.Change) bool { return c.ID <= upToId })
+	return nil
+}
+
+func (s *Storage) record(data *UserData, cat *Category, kind messages.ChangeKind, item messages.WishItem) messages.Change {
+	s.lastChangeId++
+	change := messages.Change{
+		ID:         s.lastChangeId,
+		OwnerID:    data.userId,
+		ListID:     categoryList(data, cat),
+		Kind:       kind,
+		ItemID:     item.ID,
+		ItemName:   item.Name,
+		Visibility: item.Visibility.Effective(cat.visibility),
+	}
+	data.changes = append(data.changes, change)
+	if len(data.changes) > maxChanges {
+		data.changes = slices.Delete(data.changes, 0, len(data.changes)-maxChanges)
+	}
+	return change
+}
+
+func categoryList(data *UserData, cat *Category) int64 {
+	for _, list := range data.lists {
+		if slices.Contains(list.categories, cat) {
+			return list.id
+		}
+	}
+	return 0
+}
+
+// notify is deferred before the lock is taken, so it runs once the mutation is unlocked.
+// Inside a transaction the changes wait for the commit instead.
+func (s *Storage) notify(changes *[]messages.Change) {
+	if s.tx != nil {
+		*s.tx = append(*s.tx, *changes...)
+		return
+	}
+	if len(*changes) == 0 {
+		return
+	}
+	s.mu.RLock()
+	listeners := slices.Clone(s.listeners)
+	s.mu.RUnlock()
+	for _, change := range *changes {
+		for _, f := range listeners {
+			f(change)
+		}
+	}
+}
+
+func (s *Storage) SaveJob(job scheduler.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveJob(job.ID)
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *Storage) DeleteJob(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveJob(id)
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *Storage) GetDueJobs(now time.Time) ([]scheduler.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]scheduler.Job, 0)
+	for _, job := range s.jobs {
+		if !job.RunAt.After(now) {
+			result = append(result, job)
+		}
+	}
+	return result, nil
+}
+
+func (s *Storage) MarkJobDone(key string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveDoneJob(key)
+	s.doneJobs[key] = at
+	return nil
+}
+
+func (s *Storage) IsJobDone(key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.doneJobs[key]
+	return ok, nil
+}
+
+func (s *Storage) ForgetDoneJobs(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, at := range s.doneJobs {
+		if at.Before(before) {
+			s.saveDoneJob(key)
+			delete(s.doneJobs, key)
 		}
-		return result
 	}
 	return nil
 }
 
-func (s *Storage) GetCategories(userId int64) []string {
+func (s *Storage) CreateSantaGame(ctx context.Context, organizerId int64, title string) (messages.SantaGame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, err := s.token()
+	if err != nil {
+		return messages.SantaGame{}, err
+	}
+	s.lastGameId++
+	s.saveGame(s.lastGameId)
+	game := &messages.SantaGame{ID: s.lastGameId, Token: token, OrganizerID: organizerId, Title: title, Participants: []int64{organizerId}}
+	s.santaGames[game.ID] = game
+	s.santaTokens[token] = game.ID
+	return cloneGame(game), nil
+}
+
+func (s *Storage) GetSantaGame(ctx context.Context, gameId int64) (messages.SantaGame, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	game, ok := s.santaGames[gameId]
+	if !ok {
+		return messages.SantaGame{}, false
+	}
+	return cloneGame(game), true
+}
+
+func (s *Storage) GetSantaGameByToken(ctx context.Context, token string) (messages.SantaGame, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	game, ok := s.santaGames[s.santaTokens[token]]
+	if !ok {
+		return messages.SantaGame{}, false
+	}
+	return cloneGame(game), true
+}
+
+func (s *Storage) GetSantaGames(ctx context.Context, userId int64) []messages.SantaGame {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]messages.SantaGame, 0)
+	for _, game := range s.santaGames {
+		if slices.Contains(game.Participants, userId) {
+			result = append(result, cloneGame(game))
+		}
+	}
+	slices.SortFunc(result, func(a, b messages.SantaGame) int { return int(a.ID - b.ID) })
+	return result
+}
+
+// UpdateSantaGame replaces everything but the token, which is fixed when the game is created.
+func (s *Storage) UpdateSantaGame(ctx context.Context, game messages.SantaGame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.santaGames[game.ID]
+	if !ok {
+		return messages.ErrNotFound
+	}
+	s.saveGame(game.ID)
+	game.Token = stored.Token
+	*stored = cloneGame(&game)
+	return nil
+}
+
+func cloneGame(game *messages.SantaGame) messages.SantaGame {
+	result := *game
+	result.Participants = slices.Clone(game.Participants)
+	result.Exclusions = slices.Clone(game.Exclusions)
+	result.Assignments = maps.Clone(game.Assignments)
+	return result
+}
+
+func (s *Storage) token() (string, error) {
+	if s.Tokens != nil {
+		return s.Tokens()
+	}
+	return NewToken()
+}
+
+// NewToken makes a random token, Storage.Tokens defaults to it.
+func NewToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// SetPledge adds, changes or, with a zero amount, withdraws the pledge of a friend.
+// Pledges keep the order they were first made in, withdrawing a pledge never made does nothing.
+func (s *Storage) SetPledge(ctx context.Context, pledge messages.Pledge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.user(pledge.OwnerID); err != nil {
+		return err
+	}
+	s.savePledges()
+	idx := slices.IndexFunc(s.pledges, func(p messages.Pledge) bool {
+		return p.OwnerID == pledge.OwnerID && p.ItemID == pledge.ItemID && p.UserID == pledge.UserID
+	})
+	switch {
+	case pledge.Amount <= 0 && idx == -1:
+	case pledge.Amount <= 0:
+		s.pledges = slices.Delete(s.pledges, idx, idx+1)
+	case idx == -1:
+		s.pledges = append(s.pledges, pledge)
+	default:
+		s.pledges[idx] = pledge
+	}
+	return nil
+}
+
+func (s *Storage) GetPledges(ctx context.Context, ownerId int64, itemId int64) []messages.Pledge {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]messages.Pledge, 0)
+	for _, p := range s.pledges {
+		if p.OwnerID == ownerId && p.ItemID == itemId {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func (s *Storage) SetCategoryVisibility(ctx context.Context, userId int64, catName string, visibility messages.Visibility) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cat, err := s.findCategory(userId, catName)
+	if err != nil {
+		return err
+	}
+	cat.visibility = visibility
+	return nil
+}
+
+func (s *Storage) GetCategoryVisibility(ctx context.Context, userId int64) map[string]messages.Visibility {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]messages.Visibility)
+	if data, ok := s.users[userId]; ok {
+		for _, cat := range data.active().categories {
+			if cat.visibility != messages.VisibilityInherit {
+				result[cat.name] = cat.visibility
+			}
+		}
+	}
+	return result
+}
+
+func (s *Storage) addList(data *UserData, name string) *List {
+	s.lastListId++
+	list := &List{
+		id:         s.lastListId,
+		ownerId:    data.userId,
+		name:       name,
+		categories: []*Category{{name: "default", items: make([]messages.WishItem, 0)}},
+	}
+	data.lists = append(data.lists, list)
+	s.lists[list.id] = list
+	return list
+}
+
+// ownList returns the list only when it belongs to userId.
+func (s *Storage) ownList(userId int64, listId int64) (*UserData, *List, error) {
+	data, err := s.user(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, ok := s.lists[listId]
+	if !ok || list.ownerId != userId {
+		return nil, nil, messages.ErrListNotFound
+	}
+	return data, list, nil
+}
+
+func (s *Storage) CreateList(ctx context.Context, userId int64, name string) (messages.WishList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.user(userId)
+	if err != nil {
+		return messages.WishList{}, err
+	}
+	return s.addList(data, name).toWishList(), nil
+}
+
+func (s *Storage) GetLists(ctx context.Context, userId int64) []messages.WishList {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	data, ok := s.users[userId]
-	result := make([]string, 0, 10)
-	if ok {
-		for _, cat := range data.categories {
-			if cat.name != "default" {
-				result = append(result, cat.name)
+	if !ok {
+		return nil
+	}
+	result := make([]messages.WishList, 0, len(data.lists))
+	for _, list := range data.lists {
+		result = append(result, list.toWishList())
+	}
+	return result
+}
+
+func (s *Storage) GetList(ctx context.Context, listId int64) (messages.WishList, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, ok := s.lists[listId]
+	if !ok {
+		return messages.WishList{}, false
+	}
+	return list.toWishList(), true
+}
+
+func (s *Storage) GetActiveList(ctx context.Context, userId int64) (messages.WishList, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.users[userId]
+	if !ok {
+		return messages.WishList{}, false
+	}
+	return data.active().toWishList(), true
+}
+
+func (s *Storage) SetActiveList(ctx context.Context, userId int64, listId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, list, err := s.ownList(userId, listId)
+	if err != nil {
+		return err
+	}
+	data.activeList = list.id
+	return nil
+}
+
+func (s *Storage) RenameList(ctx context.Context, userId int64, listId int64, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, list, err := s.ownList(userId, listId)
+	if err != nil {
+		return err
+	}
+	list.name = name
+	return nil
+}
+
+// DeleteList removes a list with its items and share link. The last list of a user stays.
+func (s *Storage) DeleteList(ctx context.Context, userId int64, listId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, list, err := s.ownList(userId, listId)
+	if err != nil {
+		return err
+	}
+	if len(data.lists) == 1 {
+		return messages.ErrLastList
+	}
+	s.saveListRevision(data, list)
+	data.lists = slices.DeleteFunc(data.lists, func(l *List) bool { return l.id == listId })
+	delete(s.lists, listId)
+	delete(s.shareTokens, list.shareToken)
+	if data.activeList == listId {
+		data.activeList = data.lists[0].id
+	}
+	return nil
+}
+
+func (s *Storage) GetListShareToken(ctx context.Context, listId int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, ok := s.lists[listId]
+	if !ok {
+		return "", nil
+	}
+	return s.listShareToken(list)
+}
+
+func (s *Storage) GetListWishList(ctx context.Context, listId int64) messages.Categories {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list, ok := s.lists[listId]
+	if !ok {
+		return nil
+	}
+	return copyCategories(list.categories)
+}
+
+func (s *Storage) GetListCategoryVisibility(ctx context.Context, listId int64) map[string]messages.Visibility {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]messages.Visibility)
+	if list, ok := s.lists[listId]; ok {
+		for _, cat := range list.categories {
+			if cat.visibility != messages.VisibilityInherit {
+				result[cat.name] = cat.visibility
 			}
 		}
 	}
 	return result
 }
+
+func (s *Storage) SetPriceWatch(ctx context.Context, watch messages.PriceWatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, _, err := s.findItem(watch.OwnerID, watch.ItemID); err != nil {
+		return err
+	}
+	s.savePriceWatches()
+	idx := slices.IndexFunc(s.priceWatches, func(w messages.PriceWatch) bool {
+		return w.OwnerID == watch.OwnerID && w.ItemID == watch.ItemID
+	})
+	if idx == -1 {
+		s.priceWatches = append(s.priceWatches, watch)
+	} else {
+		s.priceWatches[idx] = watch
+	}
+	return nil
+}
+
+func (s *Storage) GetPriceWatch(ctx context.Context, ownerId int64, itemId int64) (messages.PriceWatch, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, w := range s.priceWatches {
+		if w.OwnerID == ownerId && w.ItemID == itemId {
+			return w, true
+		}
+	}
+	return messages.PriceWatch{}, false
+}
+
+func (s *Storage) GetPriceWatches(ctx context.Context) []messages.PriceWatch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.priceWatches)
+}
+
+func (s *Storage) DeletePriceWatch(ctx context.Context, ownerId int64, itemId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := slices.IndexFunc(s.priceWatches, func(w messages.PriceWatch) bool {
+		return w.OwnerID == ownerId && w.ItemID == itemId
+	})
+	if idx == -1 {
+		return messages.ErrNotFound
+	}
+	s.savePriceWatches()
+	s.priceWatches = slices.Delete(s.priceWatches, idx, idx+1)
+	return nil
+}
+
+func (s *Storage) AddPricePoint(ctx context.Context, itemId int64, point messages.PricePoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.savePriceHistory(itemId)
+	history := append(s.priceHistory[itemId], point)
+	if len(history) > maxPricePoints {
+		history = slices.Clone(history[len(history)-maxPricePoints:])
+	}
+	s.priceHistory[itemId] = history
+	return nil
+}
+
+func (s *Storage) GetPriceHistory(ctx context.Context, itemId int64) []messages.PricePoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.priceHistory[itemId])
+}
@@ -1,10 +1,13 @@
 package inmemory
 
 import (
+	"context"
 	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
 	"github.com/stretchr/testify/require"
 	"slices"
 	"testing"
+	"time"
 )
 
 func (s *Storage) getUserData(userId int64) *UserData {
@@ -12,13 +15,13 @@ func (s *Storage) getUserData(userId int64) *UserData {
 }
 
 func TestStorage_AddNewUser(t *testing.T) {
+	ctx := context.Background()
 	storage, err := New()
 	require.NoError(t, err)
 
 	t.Run("Should add new user", func(t *testing.T) {
 		userId := int64(1)
-		inserted, err := storage.AddNewUser(userId)
-		require.True(t, inserted)
+		err := storage.AddNewUser(ctx, userId)
 		require.NoError(t, err)
 		data := storage.getUserData(userId)
 		require.Equalf(t, userId, data.userId, "Should store user with id = %d", userId)
@@ -27,48 +30,45 @@ func TestStorage_AddNewUser(t *testing.T) {
 	t.Run("Should add new user with default category", func(t *testing.T) {
 		userId := int64(2)
 		expectedCategoryCnt := 1
-		inserted, err := storage.AddNewUser(userId)
-		require.True(t, inserted, "New user should be marked as 'inserted'")
+		err := storage.AddNewUser(ctx, userId)
 		require.NoError(t, err)
 
 		data := storage.getUserData(userId)
 		require.Equalf(t, userId, data.userId, "Should store user with id = %d", userId)
-		require.Equalf(t, expectedCategoryCnt, len(data.categories), "New user should have %d category", expectedCategoryCnt)
-		require.Equalf(t, "default", data.categories[0].name, "Category should have '%s' name", "default")
+		require.Equalf(t, expectedCategoryCnt, len(data.active().categories), "New user should have %d category", expectedCategoryCnt)
+		require.Equalf(t, "default", data.active().categories[0].name, "Category should have '%s' name", "default")
 	})
 
 	t.Run("Should not add new user twice", func(t *testing.T) {
 		userId := int64(3)
-		inserted, err := storage.AddNewUser(userId)
-		require.True(t, inserted)
+		err := storage.AddNewUser(ctx, userId)
 		require.NoError(t, err)
-		inserted, err = storage.AddNewUser(userId)
-		require.Falsef(t, inserted, "Insert user with existing Id should return 'false' flag")
+		err = storage.AddNewUser(ctx, userId)
+		require.NoError(t, err, "Adding a known user again should do nothing")
 		data := storage.getUserData(userId)
 		require.Equalf(t, userId, data.userId, "Should store user with id = %d", userId)
 	})
 }
 
 func TestStorage_AddUserCategory(t *testing.T) {
+	ctx := context.Background()
 	storage, err := New()
 	userId := int64(1)
-	inserted, err := storage.AddNewUser(userId)
-	require.True(t, inserted)
+	err = storage.AddNewUser(ctx, userId)
 	require.NoError(t, err)
 	t.Run("Should add new category with empty wishlist", func(t *testing.T) {
 		newCategoryName := "Board Games"
 		expectedCategorySize := 2
-		added, err := storage.AddUserCategory(userId, newCategoryName)
+		err := storage.AddUserCategory(ctx, userId, newCategoryName)
 		require.NoError(t, err, "Adding new category shouldn't cause error")
-		require.True(t, added, "Adding new category should return 'true' flag")
 		data := storage.getUserData(userId)
-		categoriesSize := len(data.categories)
+		categoriesSize := len(data.active().categories)
 		require.Equalf(t, expectedCategorySize, categoriesSize, "Expected categories new size is %d", expectedCategorySize)
-		newCategoryIndex := slices.IndexFunc(data.categories, func(category *Category) bool {
+		newCategoryIndex := slices.IndexFunc(data.active().categories, func(category *Category) bool {
 			return category.name == newCategoryName
 		})
 		require.NotEqualf(t, -1, newCategoryIndex, "IndexFunc should find new category")
-		category := data.categories[newCategoryIndex]
+		category := data.active().categories[newCategoryIndex]
 		require.Equalf(t, newCategoryName, category.name, "New category name should be %s, got %s", newCategoryName, category.name)
 		wishlistSize := len(category.items)
 		require.Equalf(t, 0, wishlistSize, "New category should have empty wishlist, got %d", wishlistSize)
@@ -77,18 +77,17 @@ func TestStorage_AddUserCategory(t *testing.T) {
 	t.Run("Shouldn't add new category when user doesn't exists", func(t *testing.T) {
 		newCategoryName := "Board Games"
 		notExistingUserId := int64(2)
-		added, err := storage.AddUserCategory(notExistingUserId, newCategoryName)
-		require.NoError(t, err, "Adding new category shouldn't cause error")
-		require.Falsef(t, added, "Adding new category should return 'false' flag when user doesn't exists")
+		err := storage.AddUserCategory(ctx, notExistingUserId, newCategoryName)
+		require.ErrorIs(t, err, messages.ErrUserNotFound)
 	})
 }
 
 func TestStorage_AddWishItem(t *testing.T) {
+	ctx := context.Background()
 	storage, err := New()
 	userId := int64(1)
 	notExistingUserId := int64(2)
-	inserted, err := storage.AddNewUser(userId)
-	require.True(t, inserted)
+	err = storage.AddNewUser(ctx, userId)
 	require.NoError(t, err)
 	t.Run("Should add new wish item to default wishlist", func(t *testing.T) {
 		wishItemName := "Wish Item Name"
@@ -97,11 +96,10 @@ func TestStorage_AddWishItem(t *testing.T) {
 			Name: wishItemName,
 			URL:  wishItemUrl,
 		}
-		added, err := storage.AddWishItem(userId, newItem)
+		err := storage.AddWishItem(ctx, userId, newItem)
 		require.NoErrorf(t, err, "Add new wish item shouldn't cause error")
-		require.True(t, added, "Add new wish item should return 'true' flag")
 		data := storage.getUserData(userId)
-		defaultCategory := data.categories[0]
+		defaultCategory := data.active().categories[0]
 		expectedWishlistSize := 1
 		require.Equalf(t, expectedWishlistSize, len(defaultCategory.items), "Default category should have wishlist with size = %d")
 		wishItem := defaultCategory.items[0]
@@ -116,25 +114,21 @@ func TestStorage_AddWishItem(t *testing.T) {
 			Name: wishItemName,
 			URL:  wishItemUrl,
 		}
-		added, err := storage.AddWishItem(notExistingUserId, newItem)
-		require.NoErrorf(t, err, "Add new wish item shouldn't cause error")
-		require.Falsef(t, added, "Add new wish item should return 'false' flag when user doesn't exists")
+		err := storage.AddWishItem(ctx, notExistingUserId, newItem)
+		require.ErrorIs(t, err, messages.ErrUserNotFound)
 	})
 }
 
 func TestStorage_AddWishItemToCategory(t *testing.T) {
+	ctx := context.Background()
 	storage, err := New()
 	userId := int64(1)
-	// notExistingUserId := int64(2)
 	categoryName := "Table Games"
-	// notExistingCategory := "Not exists"
 
-	inserted, err := storage.AddNewUser(userId)
-	require.True(t, inserted)
+	err = storage.AddNewUser(ctx, userId)
 	require.NoError(t, err)
 
-	inserted, err = storage.AddUserCategory(userId, categoryName)
-	require.True(t, inserted)
+	err = storage.AddUserCategory(ctx, userId, categoryName)
 	require.NoError(t, err)
 
 	t.Run("Should add new wish item to specific category", func(t *testing.T) {
@@ -144,15 +138,14 @@ func TestStorage_AddWishItemToCategory(t *testing.T) {
 			Name: wishItemName,
 			URL:  wishItemUrl,
 		}
-		added, err := storage.AddWishItemToCategory(userId, categoryName, newItem)
+		err := storage.AddWishItemToCategory(ctx, userId, categoryName, newItem)
 		require.NoErrorf(t, err, "Add new wish item shouldn't cause error")
-		require.True(t, added, "Add new wish item should return 'true' flag")
 		data := storage.getUserData(userId)
-		idx := slices.IndexFunc(data.categories, func(category *Category) bool {
+		idx := slices.IndexFunc(data.active().categories, func(category *Category) bool {
 			return category.name == categoryName
 		})
 		require.NotEqualf(t, -1, idx, "Should find category '%s'", categoryName)
-		category := data.categories[idx]
+		category := data.active().categories[idx]
 		expectedWishlistSize := 1
 		require.Equalf(t, expectedWishlistSize, len(category.items), "Category should have wishlist with size = %d")
 		wishItem := category.items[0]
@@ -160,16 +153,692 @@ func TestStorage_AddWishItemToCategory(t *testing.T) {
 		require.Equalf(t, wishItemUrl, wishItem.URL, "New item should have URL = %s, got %s", wishItemUrl, wishItem.URL)
 	})
 
+	t.Run("Shouldn't drop the item when the category doesn't exist", func(t *testing.T) {
+		err := storage.AddWishItemToCategory(ctx, userId, "Not exists", messages.WishItem{Name: "Lost"})
+		require.ErrorIs(t, err, messages.ErrCategoryNotFound)
+		require.ErrorIs(t, err, messages.ErrNotFound)
+		require.Equal(t, 1, storage.GetWishListByCategory(ctx, userId).Count())
+	})
+
+	t.Run("Shouldn't add a category twice", func(t *testing.T) {
+		err := storage.AddUserCategory(ctx, userId, categoryName)
+		require.ErrorIs(t, err, messages.ErrDuplicate)
+		require.Equal(t, []string{categoryName}, storage.GetCategories(ctx, userId))
+	})
 }
 
 func TestStorage_GetWishListByCategory(t *testing.T) {
+	ctx := context.Background()
 	storage, err := New()
 	userId := int64(1)
-	inserted, err := storage.AddNewUser(userId)
-	require.True(t, inserted)
+	err = storage.AddNewUser(ctx, userId)
 	require.NoError(t, err)
 
 	t.Run("", func(t *testing.T) {
-		storage.GetWishListByCategory(userId)
+		storage.GetWishListByCategory(ctx, userId)
+	})
+}
+
+func TestStorage_ImportWishList(t *testing.T) {
+	ctx := context.Background()
+	storage, err := New()
+	require.NoError(t, err)
+	userId := int64(1)
+	err = storage.AddNewUser(ctx, userId)
+	require.NoError(t, err)
+	err = storage.AddUserCategory(ctx, userId, "Books")
+	require.NoError(t, err)
+
+	t.Run("Should add items to existing and new categories at once", func(t *testing.T) {
+		err := storage.ImportWishList(ctx, userId, messages.Categories{
+			{Name: "default", Items: []messages.WishItem{{Name: "Socks"}}},
+			{Name: "Books", Items: []messages.WishItem{{Name: "Dune"}, {Name: "Solaris"}}},
+			{Name: "Games", Items: []messages.WishItem{{Name: "Catan"}}},
+		})
+		require.NoError(t, err)
+		wishList := storage.GetWishListByCategory(ctx, userId)
+		require.Len(t, wishList, 3)
+		require.Len(t, wishList.Items("default"), 1)
+		require.Len(t, wishList.Items("Books"), 2)
+		require.Equal(t, "Catan", wishList.Items("Games")[0].Name)
+	})
+
+	t.Run("Shouldn't import for user that doesn't exist", func(t *testing.T) {
+		err := storage.ImportWishList(ctx, int64(2), messages.Categories{{Name: "default", Items: []messages.WishItem{{Name: "Socks"}}}})
+		require.ErrorIs(t, err, messages.ErrUserNotFound)
+	})
+}
+
+func TestStorage_GetShareToken(t *testing.T) {
+	ctx := context.Background()
+	storage, err := New()
+	require.NoError(t, err)
+	userId := int64(1)
+	err = storage.AddNewUser(ctx, userId)
+	require.NoError(t, err)
+
+	t.Run("Should create token once and resolve it back to the user", func(t *testing.T) {
+		token, err := storage.GetShareToken(ctx, userId)
+		require.NoError(t, err)
+		require.NotEmpty(t, token)
+		again, err := storage.GetShareToken(ctx, userId)
+		require.NoError(t, err)
+		require.Equal(t, token, again, "Token should be stable for the same user")
+		list, ok := storage.GetListByShareToken(ctx, token)
+		require.True(t, ok)
+		require.Equal(t, userId, list.OwnerID)
+		require.Equal(t, messages.DefaultListName, list.Name)
+	})
+
+	t.Run("Shouldn't create token for user that doesn't exist", func(t *testing.T) {
+		token, err := storage.GetShareToken(ctx, int64(2))
+		require.NoError(t, err)
+		require.Empty(t, token)
+	})
+
+	t.Run("Shouldn't resolve unknown token", func(t *testing.T) {
+		_, ok := storage.GetListByShareToken(ctx, "unknown")
+		require.False(t, ok)
+	})
+}
+
+func newStorageWithItems(t *testing.T, userId int64) *Storage {
+	ctx := context.Background()
+	storage, err := New()
+	require.NoError(t, err)
+	err = storage.AddNewUser(ctx, userId)
+	require.NoError(t, err)
+	err = storage.ImportWishList(ctx, userId, messages.Categories{
+		{Name: "default", Items: []messages.WishItem{{Name: "Socks"}}},
+	})
+	require.NoError(t, err)
+	for _, cat := range []string{"Books", "Games", "Music"} {
+		err = storage.AddUserCategory(ctx, userId, cat)
+		require.NoError(t, err)
+	}
+	for _, name := range []string{"Dune", "Solaris", "Hyperion"} {
+		err = storage.AddWishItemToCategory(ctx, userId, "Books", messages.WishItem{Name: name})
+		require.NoError(t, err)
+	}
+	return storage
+}
+
+func itemNames(items []messages.WishItem) []string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func findItemId(t *testing.T, storage *Storage, userId int64, name string) int64 {
+	for _, cat := range storage.GetWishListByCategory(context.Background(), userId) {
+		for _, item := range cat.Items {
+			if item.Name == name {
+				return item.ID
+			}
+		}
+	}
+	t.Fatalf("item %s not found", name)
+	return 0
+}
+
+func TestStorage_ItemIds(t *testing.T) {
+	userId := int64(1)
+	storage := newStorageWithItems(t, userId)
+	seen := map[int64]bool{}
+	for _, cat := range storage.GetWishListByCategory(context.Background(), userId) {
+		for _, item := range cat.Items {
+			require.NotZerof(t, item.ID, "Item '%s' should get an id", item.Name)
+			require.Falsef(t, seen[item.ID], "Item id %d should be unique", item.ID)
+			seen[item.ID] = true
+		}
+	}
+}
+
+func TestStorage_UpdateWishItem(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+	storage := newStorageWithItems(t, userId)
+
+	t.Run("Should replace item with the same id", func(t *testing.T) {
+		id := findItemId(t, storage, userId, "Dune")
+		err := storage.UpdateWishItem(ctx, userId, messages.WishItem{ID: id, Name: "Dune Messiah", Price: 50000})
+		require.NoError(t, err)
+		books := storage.GetWishListByCategory(ctx, userId).Items("Books")
+		require.Equal(t, "Dune Messiah", books[0].Name)
+		require.Equal(t, int64(50000), books[0].Price)
+	})
+
+	t.Run("Shouldn't update item of another user", func(t *testing.T) {
+		id := findItemId(t, storage, userId, "Solaris")
+		err := storage.UpdateWishItem(ctx, int64(2), messages.WishItem{ID: id, Name: "Stolen"})
+		require.ErrorIs(t, err, messages.ErrUserNotFound)
+	})
+}
+
+func TestStorage_DeleteWishItem(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+	storage := newStorageWithItems(t, userId)
+	id := findItemId(t, storage, userId, "Solaris")
+
+	err := storage.DeleteWishItem(ctx, userId, id)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Dune", "Hyperion"}, itemNames(storage.GetWishListByCategory(ctx, userId).Items("Books")))
+
+	err = storage.DeleteWishItem(ctx, userId, id)
+	require.ErrorIs(t, err, messages.ErrItemNotFound)
+}
+
+func TestStorage_MoveWishItem(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+	storage := newStorageWithItems(t, userId)
+
+	t.Run("Should reorder items inside category", func(t *testing.T) {
+		err := storage.MoveWishItem(ctx, userId, findItemId(t, storage, userId, "Hyperion"), "Books", 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"Hyperion", "Dune", "Solaris"}, itemNames(storage.GetWishListByCategory(ctx, userId).Items("Books")))
+	})
+
+	t.Run("Should move item to another category and clamp position", func(t *testing.T) {
+		err := storage.MoveWishItem(ctx, userId, findItemId(t, storage, userId, "Dune"), "default", 100)
+		require.NoError(t, err)
+		wishList := storage.GetWishListByCategory(ctx, userId)
+		require.Equal(t, []string{"Socks", "Dune"}, itemNames(wishList.Items("default")))
+		require.Equal(t, []string{"Hyperion", "Solaris"}, itemNames(wishList.Items("Books")))
+	})
+
+	t.Run("Shouldn't move item to missing category", func(t *testing.T) {
+		err := storage.MoveWishItem(ctx, userId, findItemId(t, storage, userId, "Solaris"), "Missing", 0)
+		require.ErrorIs(t, err, messages.ErrCategoryNotFound)
+		require.Equal(t, []string{"Hyperion", "Solaris"}, itemNames(storage.GetWishListByCategory(ctx, userId).Items("Books")))
+	})
+}
+
+func TestStorage_Categories(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+
+	t.Run("Should rename category unless the name is taken", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		err := storage.RenameUserCategory(ctx, userId, "Books", "Reading")
+		require.NoError(t, err)
+		require.Equal(t, []string{"Reading", "Games", "Music"}, storage.GetCategories(ctx, userId))
+		err = storage.RenameUserCategory(ctx, userId, "Games", "Music")
+		require.ErrorIs(t, err, messages.ErrDuplicate)
+		err = storage.RenameUserCategory(ctx, userId, "default", "Other")
+		require.ErrorIs(t, err, messages.ErrCategoryNotFound)
+	})
+
+	t.Run("Should delete category and keep its items in default", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		err := storage.DeleteUserCategory(ctx, userId, "Books")
+		require.NoError(t, err)
+		require.Equal(t, []string{"Games", "Music"}, storage.GetCategories(ctx, userId))
+		require.Equal(t, []string{"Socks", "Dune", "Solaris", "Hyperion"}, itemNames(storage.GetWishListByCategory(ctx, userId).Items("default")))
+		err = storage.DeleteUserCategory(ctx, userId, "default")
+		require.ErrorIs(t, err, messages.ErrCategoryNotFound)
+	})
+
+	t.Run("Should reorder categories", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		err := storage.MoveUserCategory(ctx, userId, "Music", 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"Music", "Books", "Games"}, storage.GetCategories(ctx, userId))
+		err = storage.MoveUserCategory(ctx, userId, "Music", 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{"Books", "Games", "Music"}, storage.GetCategories(ctx, userId))
+		err = storage.MoveUserCategory(ctx, userId, "Games", 1)
+		require.NoError(t, err)
+		require.Equal(t, []string{"Books", "Games", "Music"}, storage.GetCategories(ctx, userId))
+	})
+}
+
+func TestStorage_Events(t *testing.T) {
+	ctx := context.Background()
+	storage, err := New()
+	require.NoError(t, err)
+	userId := int64(1)
+	err = storage.AddNewUser(ctx, userId)
+	require.NoError(t, err)
+
+	t.Run("Should add events with ids and delete them", func(t *testing.T) {
+		for _, day := range []int{1, 2} {
+			err := storage.AddEvent(ctx, userId, messages.Event{Kind: messages.EventBirthday, Month: time.May, Day: day})
+			require.NoError(t, err)
+		}
+		events := storage.GetEvents(ctx, userId)
+		require.Len(t, events, 2)
+		require.NotEqual(t, events[0].ID, events[1].ID)
+		err := storage.DeleteEvent(ctx, userId, events[0].ID)
+		require.NoError(t, err)
+		require.Equal(t, []messages.Event{events[1]}, storage.GetEvents(ctx, userId))
+	})
+
+	t.Run("Shouldn't add event for user that doesn't exist", func(t *testing.T) {
+		err := storage.AddEvent(ctx, int64(2), messages.Event{Kind: messages.EventBirthday, Month: time.May, Day: 1})
+		require.ErrorIs(t, err, messages.ErrUserNotFound)
+	})
+}
+
+func TestStorage_ListFollowers(t *testing.T) {
+	ctx := context.Background()
+	storage, err := New()
+	require.NoError(t, err)
+	ownerId := int64(1)
+	err = storage.AddNewUser(ctx, ownerId)
+	require.NoError(t, err)
+	home, _ := storage.GetActiveList(ctx, ownerId)
+	kids, err := storage.CreateList(ctx, ownerId, "Для ребёнка")
+	require.NoError(t, err)
+
+	t.Run("Should follow a single list", func(t *testing.T) {
+		err := storage.AddListFollower(ctx, kids.ID, 2)
+		require.NoError(t, err)
+		err = storage.AddListFollower(ctx, kids.ID, 2)
+		require.ErrorIs(t, err, messages.ErrDuplicate)
+		require.Equal(t, []int64{2}, storage.GetListFollowers(ctx, kids.ID))
+		require.Empty(t, storage.GetListFollowers(ctx, home.ID))
+		require.Equal(t, []int64{2}, storage.GetFollowers(ctx, ownerId))
+	})
+
+	t.Run("Shouldn't follow a list that doesn't exist", func(t *testing.T) {
+		err := storage.AddListFollower(ctx, 100, 2)
+		require.ErrorIs(t, err, messages.ErrListNotFound)
+	})
+
+	t.Run("Should drop followers with the list", func(t *testing.T) {
+		require.NoError(t, storage.DeleteList(ctx, ownerId, kids.ID))
+		require.Empty(t, storage.GetFollowers(ctx, ownerId))
+	})
+}
+
+func TestStorage_Jobs(t *testing.T) {
+	storage, err := New()
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.SaveJob(scheduler.Job{ID: "due", Kind: "k", RunAt: now}))
+	require.NoError(t, storage.SaveJob(scheduler.Job{ID: "later", Kind: "k", RunAt: now.Add(time.Minute)}))
+
+	due, err := storage.GetDueJobs(now)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, "due", due[0].ID)
+
+	require.NoError(t, storage.DeleteJob("due"))
+	due, err = storage.GetDueJobs(now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, "later", due[0].ID)
+}
+
+func TestStorage_DoneJobs(t *testing.T) {
+	storage, err := New()
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.MarkJobDone("old", now.Add(-time.Hour)))
+	require.NoError(t, storage.MarkJobDone("fresh", now))
+
+	done, err := storage.IsJobDone("old")
+	require.NoError(t, err)
+	require.True(t, done)
+
+	require.NoError(t, storage.ForgetDoneJobs(now))
+	done, err = storage.IsJobDone("old")
+	require.NoError(t, err)
+	require.False(t, done, "Keys older than the cutoff should be forgotten")
+	done, err = storage.IsJobDone("fresh")
+	require.NoError(t, err)
+	require.True(t, done)
+}
+
+func TestStorage_FollowMute(t *testing.T) {
+	ctx := context.Background()
+	storage, err := New()
+	require.NoError(t, err)
+	ownerId := int64(1)
+	err = storage.AddNewUser(ctx, ownerId)
+	require.NoError(t, err)
+
+	t.Run("Should not mute strangers", func(t *testing.T) {
+		err := storage.SetFollowMuted(ctx, ownerId, 2, true)
+		require.ErrorIs(t, err, messages.ErrFollowerNotFound)
+	})
+
+	list, _ := storage.GetActiveList(ctx, ownerId)
+	err = storage.AddListFollower(ctx, list.ID, 2)
+	require.NoError(t, err)
+	require.Equal(t, []int64{ownerId}, storage.GetFollowing(ctx, 2))
+
+	t.Run("Should mute and unmute follower", func(t *testing.T) {
+		err := storage.SetFollowMuted(ctx, ownerId, 2, true)
+		require.NoError(t, err)
+		require.True(t, storage.IsFollowMuted(ctx, ownerId, 2))
+		err = storage.SetFollowMuted(ctx, ownerId, 2, false)
+		require.NoError(t, err)
+		require.False(t, storage.IsFollowMuted(ctx, ownerId, 2))
+	})
+
+	t.Run("Should forget mute on unfollow", func(t *testing.T) {
+		err := storage.SetFollowMuted(ctx, ownerId, 2, true)
+		require.NoError(t, err)
+		err = storage.RemoveFollower(ctx, ownerId, 2)
+		require.NoError(t, err)
+		require.Empty(t, storage.GetFollowers(ctx, ownerId))
+		require.Empty(t, storage.GetFollowing(ctx, 2))
+		err = storage.AddListFollower(ctx, list.ID, 2)
+		require.NoError(t, err)
+		require.False(t, storage.IsFollowMuted(ctx, ownerId, 2))
+	})
+}
+
+func TestStorage_Changes(t *testing.T) {
+	ctx := context.Background()
+	storage, err := New()
+	require.NoError(t, err)
+	ownerId := int64(1)
+	err = storage.AddNewUser(ctx, ownerId)
+	require.NoError(t, err)
+	var streamed []messages.Change
+	storage.OnChange(func(change messages.Change) {
+		// Listeners run outside of the lock and may read the storage.
+		require.NotEmpty(t, storage.GetChanges(ctx, change.OwnerID))
+		streamed = append(streamed, change)
+	})
+
+	err = storage.AddWishItem(ctx, ownerId, messages.WishItem{Name: "Книга"})
+	require.NoError(t, err)
+	err = storage.ImportWishList(ctx, ownerId, messages.Categories{{Name: "Игры", Items: []messages.WishItem{{Name: "Лего"}}}})
+	require.NoError(t, err)
+	id := findItemId(t, storage, ownerId, "Книга")
+	err = storage.DeleteWishItem(ctx, ownerId, id)
+	require.NoError(t, err)
+
+	changes := storage.GetChanges(ctx, ownerId)
+	require.Equal(t, changes, streamed)
+	require.Equal(t, []messages.ChangeKind{messages.ChangeItemAdded, messages.ChangeItemAdded, messages.ChangeItemRemoved},
+		[]messages.ChangeKind{changes[0].Kind, changes[1].Kind, changes[2].Kind})
+	require.Equal(t, "Книга", changes[2].ItemName)
+
+	err = storage.ClearChanges(ctx, ownerId, changes[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, changes[2:], storage.GetChanges(ctx, ownerId))
+}
+
+func TestStorage_SantaGames(t *testing.T) {
+	ctx := context.Background()
+	storage, err := New()
+	require.NoError(t, err)
+	game, err := storage.CreateSantaGame(ctx, 1, "Офис")
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, game.Participants, "Organiser should take part")
+	require.NotEmpty(t, game.Token)
+
+	t.Run("Should find game by invite token", func(t *testing.T) {
+		found, ok := storage.GetSantaGameByToken(ctx, game.Token)
+		require.True(t, ok)
+		require.Equal(t, game.ID, found.ID)
+		_, ok = storage.GetSantaGameByToken(ctx, "unknown")
+		require.False(t, ok)
+	})
+
+	t.Run("Should keep stored game apart from returned copies", func(t *testing.T) {
+		game.Participants = append(game.Participants, 2)
+		game.Token = "changed"
+		err := storage.UpdateSantaGame(ctx, game)
+		require.NoError(t, err)
+		game.Participants[0] = 100
+		stored, _ := storage.GetSantaGame(ctx, game.ID)
+		require.Equal(t, []int64{1, 2}, stored.Participants)
+		require.NotEqual(t, "changed", stored.Token, "Token shouldn't change")
+	})
+
+	t.Run("Should list games of a participant", func(t *testing.T) {
+		_, err := storage.CreateSantaGame(ctx, 3, "Семья")
+		require.NoError(t, err)
+		require.Len(t, storage.GetSantaGames(ctx, 2), 1)
+		require.Len(t, storage.GetSantaGames(ctx, 3), 1)
+		require.Empty(t, storage.GetSantaGames(ctx, 4))
+	})
+}
+
+func TestStorage_Pledges(t *testing.T) {
+	ctx := context.Background()
+	storage, err := New()
+	require.NoError(t, err)
+	err = storage.AddNewUser(ctx, 1)
+	require.NoError(t, err)
+
+	t.Run("Should ignore pledges for unknown owners", func(t *testing.T) {
+		err := storage.SetPledge(ctx, messages.Pledge{OwnerID: 5, ItemID: 1, UserID: 2, Amount: 100})
+		require.ErrorIs(t, err, messages.ErrUserNotFound)
+	})
+
+	for _, userId := range []int64{2, 3} {
+		err := storage.SetPledge(ctx, messages.Pledge{OwnerID: 1, ItemID: 1, UserID: userId, Amount: 100})
+		require.NoError(t, err)
+	}
+
+	t.Run("Should update in place and keep order", func(t *testing.T) {
+		err := storage.SetPledge(ctx, messages.Pledge{OwnerID: 1, ItemID: 1, UserID: 2, Amount: 500, Public: true})
+		require.NoError(t, err)
+		pledges := storage.GetPledges(ctx, 1, 1)
+		require.Len(t, pledges, 2)
+		require.Equal(t, messages.Pledge{OwnerID: 1, ItemID: 1, UserID: 2, Amount: 500, Public: true}, pledges[0])
+		require.Empty(t, storage.GetPledges(ctx, 1, 2))
+	})
+
+	t.Run("Should withdraw zero pledges", func(t *testing.T) {
+		err := storage.SetPledge(ctx, messages.Pledge{OwnerID: 1, ItemID: 1, UserID: 2})
+		require.NoError(t, err)
+		pledges := storage.GetPledges(ctx, 1, 1)
+		require.Len(t, pledges, 1)
+		require.Equal(t, int64(3), pledges[0].UserID)
+	})
+}
+
+func TestStorage_CategoryVisibility(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+	storage := newStorageWithItems(t, userId)
+
+	t.Run("Should refuse unknown categories", func(t *testing.T) {
+		err := storage.SetCategoryVisibility(ctx, userId, "Unknown", messages.VisibilityPrivate)
+		require.ErrorIs(t, err, messages.ErrCategoryNotFound)
+	})
+
+	t.Run("Should store visibility and report only the set ones", func(t *testing.T) {
+		err := storage.SetCategoryVisibility(ctx, userId, "Books", messages.VisibilityPrivate)
+		require.NoError(t, err)
+		require.Equal(t, map[string]messages.Visibility{"Books": messages.VisibilityPrivate}, storage.GetCategoryVisibility(ctx, userId))
+	})
+
+	t.Run("Should keep items hidden when their category is deleted", func(t *testing.T) {
+		err := storage.AddWishItemToCategory(ctx, userId, "Books", messages.WishItem{Name: "Diary"})
+		require.NoError(t, err)
+		err = storage.DeleteUserCategory(ctx, userId, "Books")
+		require.NoError(t, err)
+		for _, item := range storage.GetWishListByCategory(ctx, userId).Items("default") {
+			if item.Name == "Diary" {
+				require.Equal(t, messages.VisibilityPrivate, item.Visibility)
+			}
+			if item.Name == "Socks" {
+				require.Equal(t, messages.VisibilityInherit, item.Visibility)
+			}
+		}
+	})
+
+	t.Run("Should record effective visibility in changes", func(t *testing.T) {
+		err := storage.SetCategoryVisibility(ctx, userId, "Games", messages.VisibilityFriends)
+		require.NoError(t, err)
+		err = storage.AddWishItemToCategory(ctx, userId, "Games", messages.WishItem{Name: "Chess"})
+		require.NoError(t, err)
+		changes := storage.GetChanges(ctx, userId)
+		require.Equal(t, messages.VisibilityFriends, changes[len(changes)-1].Visibility)
+	})
+}
+
+func TestStorage_Lists(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+	storage := newStorageWithItems(t, userId)
+	first, ok := storage.GetActiveList(ctx, userId)
+	require.True(t, ok)
+	require.Equal(t, messages.DefaultListName, first.Name)
+
+	t.Run("Should keep categories of lists apart", func(t *testing.T) {
+		home, err := storage.CreateList(ctx, userId, "Для дома")
+		require.NoError(t, err)
+		err = storage.SetActiveList(ctx, userId, home.ID)
+		require.NoError(t, err)
+		err = storage.AddWishItem(ctx, userId, messages.WishItem{Name: "Плед"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"Плед"}, listItemNames(storage.GetWishListByCategory(ctx, userId)))
+		require.NotContains(t, listItemNames(storage.GetListWishList(ctx, first.ID)), "Плед")
+		require.Equal(t, []messages.WishList{first, home}, storage.GetLists(ctx, userId))
+	})
+
+	t.Run("Should give every list its own share token", func(t *testing.T) {
+		homeToken, err := storage.GetShareToken(ctx, userId)
+		require.NoError(t, err)
+		firstToken, err := storage.GetListShareToken(ctx, first.ID)
+		require.NoError(t, err)
+		require.NotEqual(t, homeToken, firstToken)
+		list, ok := storage.GetListByShareToken(ctx, firstToken)
+		require.True(t, ok)
+		require.Equal(t, first, list)
+	})
+
+	t.Run("Should update items of inactive lists", func(t *testing.T) {
+		item := storage.GetListWishList(ctx, first.ID).Items("default")[0]
+		item.ReservedBy = 2
+		err := storage.UpdateWishItem(ctx, userId, item)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), storage.GetListWishList(ctx, first.ID).Items("default")[0].ReservedBy)
+	})
+
+	t.Run("Should not touch lists of other users", func(t *testing.T) {
+		err := storage.AddNewUser(ctx, 2)
+		require.NoError(t, err)
+		err = storage.SetActiveList(ctx, 2, first.ID)
+		require.ErrorIs(t, err, messages.ErrListNotFound)
+		err = storage.RenameList(ctx, 2, first.ID, "Чужой")
+		require.ErrorIs(t, err, messages.ErrListNotFound)
+		err = storage.DeleteList(ctx, 2, first.ID)
+		require.ErrorIs(t, err, messages.ErrListNotFound)
+	})
+
+	t.Run("Should delete a list with its link but never the last one", func(t *testing.T) {
+		active, _ := storage.GetActiveList(ctx, userId)
+		token, err := storage.GetShareToken(ctx, userId)
+		require.NoError(t, err)
+		err = storage.DeleteList(ctx, userId, active.ID)
+		require.NoError(t, err)
+		_, ok := storage.GetListByShareToken(ctx, token)
+		require.False(t, ok)
+		current, _ := storage.GetActiveList(ctx, userId)
+		require.Equal(t, first.ID, current.ID, "Active list should fall back to the remaining one")
+		err = storage.DeleteList(ctx, userId, first.ID)
+		require.ErrorIs(t, err, messages.ErrLastList, "The last list should stay")
+	})
+}
+
+func listItemNames(wishList messages.Categories) []string {
+	var names []string
+	for _, cat := range wishList {
+		for _, item := range cat.Items {
+			names = append(names, item.Name)
+		}
+	}
+	return names
+}
+
+func TestStorage_GetWishListByStatus(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+	storage := newStorageWithItems(t, userId)
+	err := storage.AddWishItemToCategory(ctx, userId, "Books", messages.WishItem{Name: "Dune", ReservedBy: 2})
+	require.NoError(t, err)
+	err = storage.AddWishItem(ctx, userId, messages.WishItem{Name: "Kettle", Status: messages.ItemReceived})
+	require.NoError(t, err)
+
+	t.Run("Should return only items in the statuses", func(t *testing.T) {
+		require.Equal(t, []string{"Dune"}, listItemNames(storage.GetWishListByStatus(ctx, userId, messages.ItemReserved)))
+		received := storage.GetWishListByStatus(ctx, userId, messages.ItemReceived, messages.ItemArchived)
+		require.Len(t, received, 1, "Categories without matches should be left out")
+		require.Equal(t, []string{"Kettle"}, listItemNames(received))
+	})
+
+	t.Run("Should return nothing for unknown users", func(t *testing.T) {
+		require.Nil(t, storage.GetWishListByStatus(ctx, int64(42), messages.ItemWanted))
+	})
+}
+
+func TestStorage_Order(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+	storage, err := New()
+	require.NoError(t, err)
+	err = storage.AddNewUser(ctx, userId)
+	require.NoError(t, err)
+	for _, name := range []string{"Zoo", "Books", "Music"} {
+		err := storage.AddUserCategory(ctx, userId, name)
+		require.NoError(t, err)
+	}
+
+	t.Run("Should return categories in their positions, the default one first", func(t *testing.T) {
+		var names []string
+		for _, cat := range storage.GetWishListByCategory(ctx, userId) {
+			names = append(names, cat.Name)
+		}
+		require.Equal(t, []string{"default", "Zoo", "Books", "Music"}, names)
+		require.Equal(t, []string{"Zoo", "Books", "Music"}, storage.GetCategories(ctx, userId))
+	})
+}
+
+func TestStorage_SearchWishItems(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+	storage, err := New()
+	require.NoError(t, err)
+	err = storage.AddNewUser(ctx, userId)
+	require.NoError(t, err)
+	err = storage.ImportWishList(ctx, userId, messages.Categories{
+		{Name: "Книги", Items: []messages.WishItem{{Name: "Ёжик в тумане"}, {Name: "Дюна", Tags: []string{"фантастика"}}}},
+	})
+	require.NoError(t, err)
+	second, err := storage.CreateList(ctx, userId, "Дети")
+	require.NoError(t, err)
+	err = storage.SetActiveList(ctx, userId, second.ID)
+	require.NoError(t, err)
+	err = storage.ImportWishList(ctx, userId, messages.Categories{
+		{Name: "default", Items: []messages.WishItem{{Name: "Ежик плюшевый", URL: "https://www.ozon.ru/toy"}}},
+	})
+	require.NoError(t, err)
+
+	t.Run("Should find items in all lists", func(t *testing.T) {
+		found, total := storage.SearchWishItems(ctx, userId, "ежик", 0, 10)
+		require.Equal(t, 2, total)
+		require.Equal(t, "Ёжик в тумане", found[0].Name)
+		require.Equal(t, "Книги", found[0].Category)
+		require.Equal(t, second.ID, found[1].ListID)
+	})
+
+	t.Run("Should page results but count all of them", func(t *testing.T) {
+		found, total := storage.SearchWishItems(ctx, userId, "ежик", 1, 1)
+		require.Equal(t, 2, total)
+		require.Len(t, found, 1)
+		require.Equal(t, "Ежик плюшевый", found[0].Name)
+	})
+
+	t.Run("Should match tags and the shop", func(t *testing.T) {
+		_, total := storage.SearchWishItems(ctx, userId, "#фантастика", 0, 10)
+		require.Equal(t, 1, total)
+		_, total = storage.SearchWishItems(ctx, userId, "ozon", 0, 10)
+		require.Equal(t, 1, total)
+		_, total = storage.SearchWishItems(ctx, userId, "www", 0, 10)
+		require.Equal(t, 0, total)
 	})
 }
@@ -0,0 +1,168 @@
+package inmemory
+
+import (
+	"context"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"slices"
+	"time"
+)
+
+// maxRevisions bounds the undo stack of a user.
+const maxRevisions = 20
+
+// saveRevision pushes what cat or one of its items is before a write changes it. The list, the
+// category name and, for category revisions, the position are filled in from cat.
+func (s *Storage) saveRevision(userId int64, cat *Category, revision messages.Revision) {
+	data := s.users[userId]
+	for _, list := range data.lists {
+		if i := slices.Index(list.categories, cat); i >= 0 {
+			revision.ListID = list.id
+			if revision.Kind == messages.RevisionCategoryRenamed || revision.Kind == messages.RevisionCategoryDeleted {
+				revision.Position = i
+			}
+		}
+	}
+	revision.Category = cat.name
+	revision.Visibility = cat.visibility
+	revision.Items = slices.Clone(revision.Items)
+	s.pushRevision(data, revision)
+}
+
+// saveListRevision pushes the list about to be deleted.
+func (s *Storage) saveListRevision(data *UserData, list *List) {
+	deleted := &messages.DeletedList{Name: list.name, ShareToken: list.shareToken, Followers: slices.Clone(list.followers)}
+	for _, cat := range list.categories {
+		deleted.Categories = append(deleted.Categories, messages.DeletedCategory{Name: cat.name, Visibility: cat.visibility, Items: slices.Clone(cat.items)})
+	}
+	position := slices.Index(data.lists, list)
+	s.pushRevision(data, messages.Revision{Kind: messages.RevisionListDeleted, ListID: list.id, Position: position, List: deleted})
+}
+
+func (s *Storage) pushRevision(data *UserData, revision messages.Revision) {
+	s.lastRevisionId++
+	revision.ID = s.lastRevisionId
+	revision.At = s.now()
+	data.revisions = append(data.revisions, revision)
+	if len(data.revisions) > maxRevisions {
+		data.revisions = slices.Delete(data.revisions, 0, len(data.revisions)-maxRevisions)
+	}
+}
+
+func (s *Storage) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock.Now()
+	}
+	return time.Now()
+}
+
+func (s *Storage) GetRevisions(ctx context.Context, userId int64) []messages.Revision {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]messages.Revision, 0)
+	if data, ok := s.users[userId]; ok {
+		result = append(result, data.revisions...)
+	}
+	slices.Reverse(result)
+	return result
+}
+
+// RevertRevision brings a deleted item back to its place, or to the default category when its
+// own is gone, a deleted category with the items that still exist and a deleted list as it was.
+func (s *Storage) RevertRevision(ctx context.Context, userId int64, revisionId int64) error {
+	var changes []messages.Change
+	defer s.notify(&changes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.user(userId)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(data.revisions, func(r messages.Revision) bool { return r.ID == revisionId })
+	if i < 0 {
+		return messages.ErrNotFound
+	}
+	revision := data.revisions[i]
+	for _, newer := range data.revisions[i+1:] {
+		if revision.Touches(newer) {
+			return messages.ErrConflict
+		}
+	}
+	list, ok := s.lists[revision.ListID]
+	switch {
+	case revision.Kind == messages.RevisionListDeleted && ok:
+		return messages.ErrDuplicate
+	case revision.Kind == messages.RevisionListDeleted:
+		s.restoreList(data, revision)
+	case !ok || list.ownerId != userId:
+		return messages.ErrListNotFound
+	}
+	switch revision.Kind {
+	case messages.RevisionItemUpdated:
+		cat, idx, err := s.findItem(userId, revision.Items[0].ID)
+		if err != nil {
+			return err
+		}
+		cat.items[idx] = revision.Items[0]
+	case messages.RevisionItemDeleted:
+		item := revision.Items[0]
+		if _, _, err := s.findItem(userId, item.ID); err == nil {
+			return messages.ErrConflict
+		}
+		cat := listCategory(list, revision.Category)
+		if cat == nil {
+			cat = listCategory(list, "default")
+		}
+		cat.items = slices.Insert(cat.items, min(revision.Position, len(cat.items)), item)
+		changes = append(changes, s.record(data, cat, messages.ChangeItemAdded, item))
+	case messages.RevisionCategoryRenamed:
+		cat := listCategory(list, revision.NewName)
+		if cat == nil {
+			return messages.ErrCategoryNotFound
+		}
+		if listCategory(list, revision.Category) != nil {
+			return messages.ErrDuplicate
+		}
+		cat.name = revision.Category
+	case messages.RevisionCategoryDeleted:
+		if listCategory(list, revision.Category) != nil {
+			return messages.ErrDuplicate
+		}
+		cat := &Category{name: revision.Category, items: make([]messages.WishItem, 0), visibility: revision.Visibility}
+		for _, item := range revision.Items {
+			// Items moved to the default category come back, the ones deleted since stay deleted.
+			if from, idx, err := s.findItem(userId, item.ID); err == nil {
+				from.items = slices.Delete(from.items, idx, idx+1)
+				cat.items = append(cat.items, item)
+			}
+		}
+		list.categories = slices.Insert(list.categories, min(revision.Position, len(list.categories)), cat)
+	}
+	data.revisions = slices.Delete(data.revisions, i, i+1)
+	return nil
+}
+
+func (s *Storage) restoreList(data *UserData, revision messages.Revision) {
+	deleted := revision.List
+	list := &List{id: revision.ListID, ownerId: data.userId, name: deleted.Name, shareToken: deleted.ShareToken, followers: slices.Clone(deleted.Followers)}
+	for _, cat := range deleted.Categories {
+		items := slices.Clone(cat.Items)
+		if items == nil {
+			items = make([]messages.WishItem, 0)
+		}
+		list.categories = append(list.categories, &Category{name: cat.Name, items: items, visibility: cat.Visibility})
+	}
+	data.lists = slices.Insert(data.lists, min(revision.Position, len(data.lists)), list)
+	s.lists[list.id] = list
+	if list.shareToken != "" {
+		s.shareTokens[list.shareToken] = list.id
+	}
+}
+
+func listCategory(list *List, name string) *Category {
+	for _, cat := range list.categories {
+		if cat.name == name {
+			return cat
+		}
+	}
+	return nil
+}
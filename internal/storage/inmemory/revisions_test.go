@@ -0,0 +1,75 @@
+package inmemory
+
+import (
+	"context"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestStorage_RevertRevision(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+	latest := func(storage *Storage) messages.Revision {
+		return storage.GetRevisions(ctx, userId)[0]
+	}
+
+	t.Run("Should put a deleted item back in its place", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		require.NoError(t, storage.DeleteWishItem(ctx, userId, 3))
+		revision := latest(storage)
+		require.Equal(t, messages.RevisionItemDeleted, revision.Kind)
+
+		require.NoError(t, storage.RevertRevision(ctx, userId, revision.ID))
+		require.Equal(t, []string{"Dune", "Solaris", "Hyperion"}, itemNames(storage.GetWishListByCategory(ctx, userId).Items("Books")))
+		require.Empty(t, storage.GetRevisions(ctx, userId), "A reverted revision should be dropped")
+		changes := storage.GetChanges(ctx, userId)
+		require.Equal(t, messages.ChangeItemAdded, changes[len(changes)-1].Kind, "Followers should hear the item is back")
+	})
+
+	t.Run("Should restore the previous state of an item", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		require.NoError(t, storage.UpdateWishItem(ctx, userId, messages.WishItem{ID: 2, Name: "Dune Messiah"}))
+		require.NoError(t, storage.RevertRevision(ctx, userId, latest(storage).ID))
+		item, _ := storage.GetWishListByCategory(ctx, userId).Find(2)
+		require.Equal(t, "Dune", item.Name)
+	})
+
+	t.Run("Should bring back a deleted category with its items", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		require.NoError(t, storage.SetCategoryVisibility(ctx, userId, "Books", messages.VisibilityPrivate))
+		require.NoError(t, storage.DeleteUserCategory(ctx, userId, "Books"))
+		require.NoError(t, storage.DeleteWishItem(ctx, userId, 4))
+
+		err := storage.RevertRevision(ctx, userId, latest(storage).ID-1)
+		require.ErrorIs(t, err, messages.ErrConflict, "Hyperion was deleted after the category")
+		require.NoError(t, storage.RevertRevision(ctx, userId, latest(storage).ID))
+		require.NoError(t, storage.RevertRevision(ctx, userId, latest(storage).ID))
+		wishList := storage.GetWishListByCategory(ctx, userId)
+		require.Equal(t, []string{"Socks"}, itemNames(wishList.Items("default")))
+		require.Equal(t, []string{"Dune", "Solaris", "Hyperion"}, itemNames(wishList.Items("Books")))
+		require.Equal(t, []string{"Books", "Games", "Music"}, storage.GetCategories(ctx, userId))
+		require.Equal(t, messages.VisibilityPrivate, storage.GetCategoryVisibility(ctx, userId)["Books"])
+	})
+
+	t.Run("Should rename a category back", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		require.NoError(t, storage.RenameUserCategory(ctx, userId, "Books", "Reading"))
+		revision := latest(storage)
+		require.NoError(t, storage.AddUserCategory(ctx, userId, "Books"))
+		require.ErrorIs(t, storage.RevertRevision(ctx, userId, revision.ID), messages.ErrDuplicate)
+		require.NoError(t, storage.DeleteUserCategory(ctx, userId, "Books"))
+		require.ErrorIs(t, storage.RevertRevision(ctx, userId, revision.ID), messages.ErrConflict)
+	})
+
+	t.Run("Should keep a bounded stack", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		for i := 0; i < maxRevisions+5; i++ {
+			require.NoError(t, storage.UpdateWishItem(ctx, userId, messages.WishItem{ID: 1, Name: "Socks"}))
+		}
+		revisions := storage.GetRevisions(ctx, userId)
+		require.Len(t, revisions, maxRevisions)
+		require.Greater(t, revisions[0].ID, revisions[1].ID, "The newest revision should come first")
+		require.ErrorIs(t, storage.RevertRevision(ctx, userId, 1), messages.ErrNotFound)
+	})
+}
@@ -0,0 +1,168 @@
+package inmemory
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Snapshot is everything the storage holds in a form encoding/json can write, Restore reads it back.
+type Snapshot struct {
+	Users          []UserSnapshot                  `json:"users"`
+	Jobs           []scheduler.Job                 `json:"jobs,omitempty"`
+	DoneJobs       map[string]time.Time            `json:"done_jobs,omitempty"`
+	SantaGames     []messages.SantaGame            `json:"santa_games,omitempty"`
+	Pledges        []messages.Pledge               `json:"pledges,omitempty"`
+	PriceWatches   []messages.PriceWatch           `json:"price_watches,omitempty"`
+	PriceHistory   map[int64][]messages.PricePoint `json:"price_history,omitempty"`
+	LastGameID     int64                           `json:"last_game_id"`
+	LastListID     int64                           `json:"last_list_id"`
+	LastItemID     int64                           `json:"last_item_id"`
+	LastEventID    int64                           `json:"last_event_id"`
+	LastChangeID   int64                           `json:"last_change_id"`
+	LastRevisionID int64                           `json:"last_revision_id"`
+}
+
+type UserSnapshot struct {
+	ID         int64               `json:"id"`
+	Name       string              `json:"name,omitempty"`
+	TimeZone   string              `json:"time_zone,omitempty"`
+	ActiveList int64               `json:"active_list"`
+	Lists      []ListSnapshot      `json:"lists"`
+	Events     []messages.Event    `json:"events,omitempty"`
+	Muted      []int64             `json:"muted,omitempty"`
+	Changes    []messages.Change   `json:"changes,omitempty"`
+	Revisions  []messages.Revision `json:"revisions,omitempty"`
+}
+
+type ListSnapshot struct {
+	ID         int64              `json:"id"`
+	Name       string             `json:"name,omitempty"`
+	ShareToken string             `json:"share_token,omitempty"`
+	Categories []CategorySnapshot `json:"categories"`
+	Followers  []int64            `json:"followers,omitempty"`
+}
+
+type CategorySnapshot struct {
+	Name       string              `json:"name"`
+	Visibility messages.Visibility `json:"visibility,omitempty"`
+	Items      []messages.WishItem `json:"items"`
+}
+
+// Snapshot copies the whole storage, users, jobs and games come sorted by ID.
+func (s *Storage) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := s.state.clone()
+	result := Snapshot{
+		DoneJobs:       st.doneJobs,
+		Pledges:        st.pledges,
+		PriceWatches:   st.priceWatches,
+		PriceHistory:   st.priceHistory,
+		LastGameID:     st.lastGameId,
+		LastListID:     st.lastListId,
+		LastItemID:     st.lastItemId,
+		LastEventID:    st.lastEventId,
+		LastChangeID:   st.lastChangeId,
+		LastRevisionID: st.lastRevisionId,
+	}
+	ids := make([]int64, 0, len(st.users))
+	for id := range st.users {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		data := st.users[id]
+		user := UserSnapshot{
+			ID:         data.userId,
+			Name:       data.name,
+			TimeZone:   data.timeZone,
+			ActiveList: data.activeList,
+			Events:     data.events,
+			Muted:      data.muted,
+			Changes:    data.changes,
+			Revisions:  data.revisions,
+		}
+		for _, list := range data.lists {
+			copied := ListSnapshot{ID: list.id, Name: list.name, ShareToken: list.shareToken, Followers: list.followers}
+			for _, cat := range list.categories {
+				copied.Categories = append(copied.Categories, CategorySnapshot{Name: cat.name, Visibility: cat.visibility, Items: cat.items})
+			}
+			user.Lists = append(user.Lists, copied)
+		}
+		result.Users = append(result.Users, user)
+	}
+	for _, job := range st.jobs {
+		result.Jobs = append(result.Jobs, job)
+	}
+	slices.SortFunc(result.Jobs, func(a, b scheduler.Job) int { return cmp.Compare(a.ID, b.ID) })
+	for _, game := range st.santaGames {
+		result.SantaGames = append(result.SantaGames, *game)
+	}
+	slices.SortFunc(result.SantaGames, func(a, b messages.SantaGame) int { return cmp.Compare(a.ID, b.ID) })
+	return result
+}
+
+// Restore builds a storage holding what the snapshot was taken of.
+func Restore(snapshot Snapshot) (*Storage, error) {
+	s, err := New()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range snapshot.Users {
+		if len(user.Lists) == 0 {
+			return nil, fmt.Errorf("user %d has no lists", user.ID)
+		}
+		data := &UserData{
+			userId:     user.ID,
+			activeList: user.ActiveList,
+			name:       user.Name,
+			timeZone:   user.TimeZone,
+			events:     slices.Clone(user.Events),
+			muted:      slices.Clone(user.Muted),
+			changes:    slices.Clone(user.Changes),
+			revisions:  slices.Clone(user.Revisions),
+		}
+		for _, list := range user.Lists {
+			restored := &List{id: list.ID, ownerId: user.ID, name: list.Name, shareToken: list.ShareToken, followers: slices.Clone(list.Followers)}
+			for _, cat := range list.Categories {
+				items := slices.Clone(cat.Items)
+				if items == nil {
+					items = make([]messages.WishItem, 0)
+				}
+				restored.categories = append(restored.categories, &Category{name: cat.Name, items: items, visibility: cat.Visibility})
+			}
+			data.lists = append(data.lists, restored)
+			s.lists[list.ID] = restored
+			if list.ShareToken != "" {
+				s.shareTokens[list.ShareToken] = list.ID
+			}
+		}
+		s.users[user.ID] = data
+	}
+	for _, job := range snapshot.Jobs {
+		s.jobs[job.ID] = job
+	}
+	maps.Copy(s.doneJobs, snapshot.DoneJobs)
+	for _, game := range snapshot.SantaGames {
+		restored := cloneGame(&game)
+		s.santaGames[game.ID] = &restored
+		s.santaTokens[game.Token] = game.ID
+	}
+	s.pledges = slices.Clone(snapshot.Pledges)
+	s.priceWatches = slices.Clone(snapshot.PriceWatches)
+	for id, history := range snapshot.PriceHistory {
+		s.priceHistory[id] = slices.Clone(history)
+	}
+	s.lastGameId = snapshot.LastGameID
+	s.lastListId = snapshot.LastListID
+	s.lastItemId = snapshot.LastItemID
+	s.lastEventId = snapshot.LastEventID
+	s.lastChangeId = snapshot.LastChangeID
+	s.lastRevisionId = snapshot.LastRevisionID
+	return s, nil
+}
@@ -0,0 +1,49 @@
+package inmemory
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+
+	t.Run("Should restore what the snapshot was taken of", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		list, _ := storage.GetActiveList(ctx, userId)
+		require.NoError(t, storage.AddListFollower(ctx, list.ID, 2))
+		token, err := storage.GetShareToken(ctx, userId)
+		require.NoError(t, err)
+		game, err := storage.CreateSantaGame(ctx, userId, "Office")
+		require.NoError(t, err)
+		require.NoError(t, storage.SaveJob(scheduler.Job{ID: "digest:1", RunAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}))
+
+		data, err := json.Marshal(storage.Snapshot())
+		require.NoError(t, err)
+		var snapshot Snapshot
+		require.NoError(t, json.Unmarshal(data, &snapshot))
+		restored, err := Restore(snapshot)
+		require.NoError(t, err)
+
+		require.Equal(t, storage.GetWishListByCategory(ctx, userId), restored.GetWishListByCategory(ctx, userId))
+		require.Equal(t, []int64{2}, restored.GetFollowers(ctx, userId))
+		list, ok := restored.GetListByShareToken(ctx, token)
+		require.True(t, ok)
+		require.Equal(t, userId, list.OwnerID)
+		_, ok = restored.GetSantaGameByToken(ctx, game.Token)
+		require.True(t, ok)
+		restoredData, err := json.Marshal(restored.Snapshot())
+		require.NoError(t, err)
+		require.JSONEq(t, string(data), string(restoredData))
+
+		require.NoError(t, restored.AddWishItem(ctx, userId, messages.WishItem{Name: "Plaid"}))
+		_, ok = restored.GetWishListByCategory(ctx, userId).Find(5)
+		require.True(t, ok, "IDs should continue after the restored ones")
+	})
+}
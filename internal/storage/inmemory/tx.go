@@ -0,0 +1,226 @@
+package inmemory
+
+import (
+	"context"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"maps"
+	"slices"
+)
+
+// WithTx holds the lock for the whole of f, which works on a view of the same data guarded by
+// a lock of its own. When f fails or ctx is done by the end, the writes of f are undone, and
+// listeners only hear about the changes of committed transactions. WithTx called on the view
+// joins the running transaction.
+func (s *Storage) WithTx(ctx context.Context, f func(tx messages.UserStorage) error) error {
+	if s.tx != nil {
+		return f(s)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var changes []messages.Change
+	defer s.notify(&changes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	undo := &undo{users: make(map[int64]bool)}
+	ids := *s.state
+	committed := false
+	defer func() {
+		if !committed {
+			for i := len(undo.steps) - 1; i >= 0; i-- {
+				undo.steps[i]()
+			}
+			s.lastGameId, s.lastListId, s.lastItemId = ids.lastGameId, ids.lastListId, ids.lastItemId
+			s.lastEventId, s.lastChangeId, s.lastRevisionId = ids.lastEventId, ids.lastChangeId, ids.lastRevisionId
+			changes = nil
+		}
+	}()
+	if err := f(&Storage{state: s.state, tx: &changes, undo: undo, Tokens: s.Tokens, Clock: s.Clock}); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// undo collects how to restore what a transaction wrote. Every write saves the part of the data
+// it is about to change, a user with their lists is saved once per transaction.
+type undo struct {
+	steps []func()
+	users map[int64]bool
+}
+
+func (s *Storage) onRollback(step func()) {
+	s.undo.steps = append(s.undo.steps, step)
+}
+
+// saveUser keeps a copy of the user and their lists, a rollback puts it back or, for a user
+// added by the transaction, removes them.
+func (s *Storage) saveUser(userId int64) {
+	if s.undo == nil || s.undo.users[userId] {
+		return
+	}
+	s.undo.users[userId] = true
+	saved, existed := s.users[userId]
+	if existed {
+		saved = cloneUser(saved)
+	}
+	s.onRollback(func() {
+		for token, id := range s.shareTokens {
+			if list, ok := s.lists[id]; ok && list.ownerId == userId {
+				delete(s.shareTokens, token)
+			}
+		}
+		for id, list := range s.lists {
+			if list.ownerId == userId {
+				delete(s.lists, id)
+			}
+		}
+		if !existed {
+			delete(s.users, userId)
+			return
+		}
+		s.users[userId] = saved
+		for _, list := range saved.lists {
+			s.lists[list.id] = list
+			if list.shareToken != "" {
+				s.shareTokens[list.shareToken] = list.id
+			}
+		}
+	})
+}
+
+func (s *Storage) saveJob(id string) {
+	if s.undo == nil {
+		return
+	}
+	job, ok := s.jobs[id]
+	s.onRollback(func() {
+		if ok {
+			s.jobs[id] = job
+		} else {
+			delete(s.jobs, id)
+		}
+	})
+}
+
+func (s *Storage) saveDoneJob(key string) {
+	if s.undo == nil {
+		return
+	}
+	at, ok := s.doneJobs[key]
+	s.onRollback(func() {
+		if ok {
+			s.doneJobs[key] = at
+		} else {
+			delete(s.doneJobs, key)
+		}
+	})
+}
+
+func (s *Storage) saveGame(gameId int64) {
+	if s.undo == nil {
+		return
+	}
+	game, ok := s.santaGames[gameId]
+	var saved messages.SantaGame
+	if ok {
+		saved = cloneGame(game)
+	}
+	s.onRollback(func() {
+		if ok {
+			s.santaGames[gameId] = &saved
+			return
+		}
+		if game, created := s.santaGames[gameId]; created {
+			delete(s.santaTokens, game.Token)
+			delete(s.santaGames, gameId)
+		}
+	})
+}
+
+func (s *Storage) savePledges() {
+	if s.undo == nil {
+		return
+	}
+	pledges := slices.Clone(s.pledges)
+	s.onRollback(func() { s.pledges = pledges })
+}
+
+func (s *Storage) savePriceWatches() {
+	if s.undo == nil {
+		return
+	}
+	watches := slices.Clone(s.priceWatches)
+	s.onRollback(func() { s.priceWatches = watches })
+}
+
+func (s *Storage) savePriceHistory(itemId int64) {
+	if s.undo == nil {
+		return
+	}
+	history, ok := s.priceHistory[itemId]
+	s.onRollback(func() {
+		if ok {
+			s.priceHistory[itemId] = history
+		} else {
+			delete(s.priceHistory, itemId)
+		}
+	})
+}
+
+func (st *state) clone() *state {
+	c := *st
+	c.users = make(map[int64]*UserData, len(st.users))
+	c.lists = make(map[int64]*List, len(st.lists))
+	for id, data := range st.users {
+		user := cloneUser(data)
+		for _, list := range user.lists {
+			c.lists[list.id] = list
+		}
+		c.users[id] = user
+	}
+	c.shareTokens = maps.Clone(st.shareTokens)
+	c.jobs = maps.Clone(st.jobs)
+	c.doneJobs = maps.Clone(st.doneJobs)
+	c.santaGames = make(map[int64]*messages.SantaGame, len(st.santaGames))
+	for id, game := range st.santaGames {
+		copied := cloneGame(game)
+		c.santaGames[id] = &copied
+	}
+	c.santaTokens = maps.Clone(st.santaTokens)
+	c.pledges = slices.Clone(st.pledges)
+	c.priceWatches = slices.Clone(st.priceWatches)
+	c.priceHistory = make(map[int64][]messages.PricePoint, len(st.priceHistory))
+	for id, history := range st.priceHistory {
+		c.priceHistory[id] = slices.Clone(history)
+	}
+	return &c
+}
+
+func cloneUser(data *UserData) *UserData {
+	user := *data
+	user.lists = make([]*List, 0, len(data.lists))
+	for _, list := range data.lists {
+		user.lists = append(user.lists, cloneList(list))
+	}
+	user.events = slices.Clone(data.events)
+	user.muted = slices.Clone(data.muted)
+	user.changes = slices.Clone(data.changes)
+	user.revisions = slices.Clone(data.revisions)
+	return &user
+}
+
+func cloneList(list *List) *List {
+	copied := *list
+	copied.categories = make([]*Category, 0, len(list.categories))
+	for _, cat := range list.categories {
+		category := *cat
+		category.items = slices.Clone(cat.items)
+		copied.categories = append(copied.categories, &category)
+	}
+	copied.followers = slices.Clone(list.followers)
+	return &copied
+}
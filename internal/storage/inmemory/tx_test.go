@@ -0,0 +1,133 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/scheduler"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestStorage_WithTx(t *testing.T) {
+	ctx := context.Background()
+	userId := int64(1)
+	errFailed := errors.New("failed")
+
+	t.Run("Should keep the changes of a successful transaction", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		var heard []messages.Change
+		storage.OnChange(func(change messages.Change) { heard = append(heard, change) })
+		err := storage.WithTx(ctx, func(tx messages.UserStorage) error {
+			if err := tx.AddUserCategory(ctx, userId, "Films"); err != nil {
+				return err
+			}
+			require.Empty(t, heard, "Listeners should wait for the commit")
+			return tx.AddWishItemToCategory(ctx, userId, "Films", messages.WishItem{Name: "Alien"})
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"Alien"}, itemNames(storage.GetWishListByCategory(ctx, userId).Items("Films")))
+		require.Len(t, heard, 1)
+	})
+
+	t.Run("Should roll back when the transaction fails", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		before := storage.GetWishListByCategory(ctx, userId)
+		var heard []messages.Change
+		storage.OnChange(func(change messages.Change) { heard = append(heard, change) })
+		err := storage.WithTx(ctx, func(tx messages.UserStorage) error {
+			if err := tx.DeleteUserCategory(ctx, userId, "Books"); err != nil {
+				return err
+			}
+			if err := tx.AddWishItem(ctx, userId, messages.WishItem{Name: "Plaid"}); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		require.ErrorIs(t, err, errFailed)
+		require.Equal(t, before, storage.GetWishListByCategory(ctx, userId))
+		require.Empty(t, heard)
+
+		err = storage.AddWishItem(ctx, userId, messages.WishItem{Name: "Plaid"})
+		require.NoError(t, err)
+		item, _ := storage.GetWishListByCategory(ctx, userId).Find(5)
+		require.Equal(t, "Plaid", item.Name, "IDs taken by a rolled back transaction should be reused")
+	})
+
+	t.Run("Should roll back when the context is done", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		cancelled, cancel := context.WithCancel(ctx)
+		err := storage.WithTx(cancelled, func(tx messages.UserStorage) error {
+			cancel()
+			return tx.AddUserCategory(ctx, userId, "Films")
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.NotContains(t, storage.GetCategories(ctx, userId), "Films")
+	})
+
+	t.Run("Should join the running transaction", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		err := storage.WithTx(ctx, func(tx messages.UserStorage) error {
+			err := tx.WithTx(ctx, func(inner messages.UserStorage) error {
+				return inner.AddUserCategory(ctx, userId, "Films")
+			})
+			require.NoError(t, err)
+			require.Contains(t, tx.GetCategories(ctx, userId), "Films")
+			return errFailed
+		})
+		require.ErrorIs(t, err, errFailed)
+		require.NotContains(t, storage.GetCategories(ctx, userId), "Films")
+	})
+
+	t.Run("Should undo every kind of write", func(t *testing.T) {
+		storage := newStorageWithItems(t, userId)
+		at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		list, _ := storage.GetActiveList(ctx, userId)
+		token, err := storage.GetListShareToken(ctx, list.ID)
+		require.NoError(t, err)
+		require.NoError(t, storage.SaveJob(scheduler.Job{ID: "digest:1", RunAt: at}))
+		require.NoError(t, storage.MarkJobDone("reminder:1", at))
+		game, err := storage.CreateSantaGame(ctx, userId, "Офис")
+		require.NoError(t, err)
+		require.NoError(t, storage.SetPledge(ctx, messages.Pledge{OwnerID: userId, ItemID: 1, UserID: 2, Amount: 100}))
+		require.NoError(t, storage.SetPriceWatch(ctx, messages.PriceWatch{OwnerID: userId, ItemID: 1}))
+		require.NoError(t, storage.AddPricePoint(ctx, 1, messages.PricePoint{At: at, Price: 100}))
+		before := storage.Snapshot()
+
+		var kidsToken, familyToken string
+		err = storage.WithTx(ctx, func(tx messages.UserStorage) error {
+			view := tx.(*Storage)
+			require.NoError(t, view.AddNewUser(ctx, 2))
+			require.NoError(t, view.AddListFollower(ctx, list.ID, 2))
+			kids, err := view.CreateList(ctx, userId, "Kids")
+			require.NoError(t, err)
+			kidsToken, err = view.GetListShareToken(ctx, kids.ID)
+			require.NoError(t, err)
+			require.NoError(t, view.DeleteList(ctx, userId, list.ID))
+			require.NoError(t, view.SaveJob(scheduler.Job{ID: "digest:1", RunAt: at.Add(time.Hour)}))
+			require.NoError(t, view.SaveJob(scheduler.Job{ID: "digest:2", RunAt: at}))
+			require.NoError(t, view.ForgetDoneJobs(at.Add(time.Hour)))
+			require.NoError(t, view.MarkJobDone("reminder:2", at))
+			game.Participants = append(game.Participants, 2)
+			require.NoError(t, view.UpdateSantaGame(ctx, game))
+			family, err := view.CreateSantaGame(ctx, 2, "Семья")
+			require.NoError(t, err)
+			familyToken = family.Token
+			require.NoError(t, view.SetPledge(ctx, messages.Pledge{OwnerID: userId, ItemID: 1, UserID: 2, Amount: 200}))
+			require.NoError(t, view.DeletePriceWatch(ctx, userId, 1))
+			require.NoError(t, view.AddPricePoint(ctx, 1, messages.PricePoint{At: at, Price: 90}))
+			require.NoError(t, view.AddPricePoint(ctx, 2, messages.PricePoint{At: at, Price: 90}))
+			return errFailed
+		})
+		require.ErrorIs(t, err, errFailed)
+		require.Equal(t, before, storage.Snapshot())
+		restored, ok := storage.GetListByShareToken(ctx, token)
+		require.True(t, ok)
+		require.Equal(t, list.ID, restored.ID)
+		_, ok = storage.GetListByShareToken(ctx, kidsToken)
+		require.False(t, ok)
+		_, ok = storage.GetSantaGameByToken(ctx, familyToken)
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,178 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/price"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+type WishlistReader interface {
+	messages.WishListReader
+	GetListByShareToken(ctx context.Context, token string) (messages.WishList, bool)
+}
+
+// Page is also the JSON representation. It deliberately has no field for who reserved an item.
+type Page struct {
+	Title      string     `json:"title,omitempty"`
+	Categories []Category `json:"categories"`
+}
+
+type Category struct {
+	Name  string `json:"name"`
+	Items []Item `json:"items"`
+}
+
+type Item struct {
+	Name     string `json:"name"`
+	URL      string `json:"url,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Price    int64  `json:"price,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	Reserved bool   `json:"reserved"`
+}
+
+type Server struct {
+	storage WishlistReader
+	mux     *http.ServeMux
+}
+
+func New(storage WishlistReader) *Server {
+	s := &Server{
+		storage: storage,
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/w/", s.handleWishlist)
+	return s
+}
+
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleWishlist(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, "/w/")
+	token, asJSON := strings.CutSuffix(token, ".json")
+	list, ok := s.storage.GetListByShareToken(ctx, token)
+	if token == "" || strings.Contains(token, "/") || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	page := NewPage(messages.ReadWishList(ctx, s.storage, list.ID, messages.AudienceLinkHolder))
+	page.Title = list.Name
+	var body bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	if asJSON {
+		contentType = "application/json; charset=utf-8"
+		if err := json.NewEncoder(&body).Encode(page); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	} else if err := pageTemplate.Execute(&body, page); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(body.Bytes())
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func NewPage(wishList messages.Categories) Page {
+	page := Page{Categories: make([]Category, 0, len(wishList))}
+	for _, cat := range wishList {
+		if len(cat.Items) == 0 {
+			continue
+		}
+		category := Category{Name: cat.Name, Items: make([]Item, 0, len(cat.Items))}
+		for _, item := range cat.Items {
+			category.Items = append(category.Items, Item{
+				Name:     item.Name,
+				URL:      item.URL,
+				ImageURL: item.ImageURL,
+				Price:    item.Price,
+				Currency: item.Currency,
+				Reserved: item.ReservedBy != 0,
+			})
+		}
+		page.Categories = append(page.Categories, category)
+	}
+	return page
+}
+
+var pageTemplate = template.Must(template.New("wishlist").Funcs(template.FuncMap{
+	"title": func(name string) string {
+		if name == "default" {
+			return "Без категории"
+		}
+		return name
+	},
+	"price": price.Format,
+}).Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{or .Title "Вишлист"}}</title>
+<style>
+body { font-family: -apple-system, sans-serif; max-width: 720px; margin: 2em auto; padding: 0 1em; color: #222; }
+ul { list-style: none; padding: 0; }
+li { display: flex; gap: .8em; align-items: center; padding: .5em 0; border-bottom: 1px solid #eee; }
+li img { width: 64px; height: 64px; object-fit: cover; border-radius: 6px; }
+.price { color: #555; white-space: nowrap; }
+.reserved { opacity: .5; }
+.reserved .status { color: #2a7; }
+</style>
+</head>
+<body>
+<h1>{{or .Title "Вишлист"}}</h1>
+{{range .Categories}}<h2>{{title .Name}}</h2>
+<ul>
+{{range .Items}}<li{{if .Reserved}} class="reserved"{{end}}>
+{{if .ImageURL}}<img src="{{.ImageURL}}" alt="" loading="lazy">{{end}}
+<span>{{if .URL}}<a href="{{.URL}}" rel="noopener noreferrer nofollow" target="_blank">{{.Name}}</a>{{else}}{{.Name}}{{end}}</span>
+{{if .Price}}<span class="price">{{price .Price .Currency}}</span>{{end}}
+{{if .Reserved}}<span class="status">🎁 Уже дарят</span>{{end}}
+</li>
+{{end}}</ul>
+{{else}}<p>Список пока пуст.</p>
+{{end}}</body>
+</html>
+`))
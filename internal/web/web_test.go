@@ -0,0 +1,186 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+type fakeReader struct {
+	tokens     map[string]int64
+	wishLists  map[int64]messages.Categories
+	visibility map[int64]map[string]messages.Visibility
+}
+
+// Lists are keyed by their ID, every list has a name of "Список <ID>".
+func (f *fakeReader) GetListByShareToken(_ context.Context, token string) (messages.WishList, bool) {
+	listId, ok := f.tokens[token]
+	return messages.WishList{ID: listId, Name: "Список " + strconv.FormatInt(listId, 10)}, ok
+}
+
+func (f *fakeReader) GetListWishList(_ context.Context, listId int64) messages.Categories {
+	return f.wishLists[listId]
+}
+
+func (f *fakeReader) GetListCategoryVisibility(_ context.Context, listId int64) map[string]messages.Visibility {
+	return f.visibility[listId]
+}
+
+const reserverId = int64(987654321)
+
+func newTestServer() (*Server, *fakeReader) {
+	reader := &fakeReader{
+		tokens: map[string]int64{"abc": 1},
+		wishLists: map[int64]messages.Categories{
+			1: {
+				{Name: "default", Items: []messages.WishItem{{Name: "Носки"}}},
+				{Name: "Книги", Items: []messages.WishItem{
+					{Name: "Дюна", URL: "https://example.com/dune", Price: 120000, Currency: "RUB", ReservedBy: reserverId},
+					{Name: "<script>alert(1)</script>"},
+				}},
+				{Name: "Пусто"},
+			},
+		},
+	}
+	return New(reader), reader
+}
+
+func get(s http.Handler, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServer_HTML(t *testing.T) {
+	server, _ := newTestServer()
+
+	t.Run("Should render shared wishlist", func(t *testing.T) {
+		rec := get(server, "/w/abc", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+		body := rec.Body.String()
+		require.Contains(t, body, "<h2>Без категории</h2>")
+		require.Contains(t, body, `<a href="https://example.com/dune" rel="noopener noreferrer nofollow" target="_blank">Дюна</a>`)
+		require.Contains(t, body, "1 200 ₽")
+		require.Contains(t, body, "Уже дарят")
+		require.NotContains(t, body, "Пусто", "Empty categories should be hidden")
+		require.NotContains(t, body, "<script>")
+	})
+
+	t.Run("Should never expose who reserved an item", func(t *testing.T) {
+		for _, path := range []string{"/w/abc", "/w/abc.json"} {
+			rec := get(server, path, nil)
+			require.NotContains(t, rec.Body.String(), strconv.FormatInt(reserverId, 10))
+		}
+	})
+
+	t.Run("Should answer 404 for unknown token", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, get(server, "/w/unknown", nil).Code)
+		require.Equal(t, http.StatusNotFound, get(server, "/w/", nil).Code)
+		require.Equal(t, http.StatusNotFound, get(server, "/w/abc/extra", nil).Code)
+	})
+
+	t.Run("Should reject writes", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/w/abc", nil)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
+
+func TestServer_JSON(t *testing.T) {
+	server, _ := newTestServer()
+	rec := get(server, "/w/abc.json", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	var page Page
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Equal(t, Page{Title: "Список 1", Categories: []Category{
+		{Name: "default", Items: []Item{{Name: "Носки"}}},
+		{Name: "Книги", Items: []Item{
+			{Name: "Дюна", URL: "https://example.com/dune", Price: 120000, Currency: "RUB", Reserved: true},
+			{Name: "<script>alert(1)</script>"},
+		}},
+	}}, page)
+}
+
+func TestServer_ETag(t *testing.T) {
+	server, reader := newTestServer()
+	first := get(server, "/w/abc", nil)
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	t.Run("Should answer 304 when page didn't change", func(t *testing.T) {
+		rec := get(server, "/w/abc", http.Header{"If-None-Match": {etag}})
+		require.Equal(t, http.StatusNotModified, rec.Code)
+		require.Empty(t, rec.Body.String())
+	})
+
+	t.Run("Should use different tags for HTML and JSON", func(t *testing.T) {
+		require.NotEqual(t, etag, get(server, "/w/abc.json", nil).Header().Get("ETag"))
+	})
+
+	t.Run("Should change tag when wishlist changes", func(t *testing.T) {
+		reader.wishLists[1][0].Items = append(reader.wishLists[1][0].Items, messages.WishItem{Name: "Шарф"})
+		rec := get(server, "/w/abc", http.Header{"If-None-Match": {etag}})
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NotEqual(t, etag, rec.Header().Get("ETag"))
+	})
+}
+
+func TestServer_Visibility(t *testing.T) {
+	reader := &fakeReader{
+		tokens: map[string]int64{"abc": 1},
+		wishLists: map[int64]messages.Categories{
+			1: {
+				{Name: "default", Items: []messages.WishItem{
+					{Name: "Носки"},
+					{Name: "Дневник", Visibility: messages.VisibilityPrivate},
+					{Name: "Билеты", Visibility: messages.VisibilityLink},
+				}},
+				{Name: "Сюрприз для друзей", Items: []messages.WishItem{{Name: "Кольцо"}}},
+				{Name: "Открытое", Items: []messages.WishItem{{Name: "Шарф", Visibility: messages.VisibilityFriends}}},
+			},
+		},
+		visibility: map[int64]map[string]messages.Visibility{
+			1: {"Сюрприз для друзей": messages.VisibilityFriends},
+		},
+	}
+	server := New(reader)
+
+	for _, path := range []string{"/w/abc", "/w/abc.json"} {
+		t.Run("Should hide items link holders may not see at "+path, func(t *testing.T) {
+			rec := get(server, path, nil)
+			require.Equal(t, http.StatusOK, rec.Code)
+			body := rec.Body.String()
+			require.Contains(t, body, "Носки")
+			require.Contains(t, body, "Билеты")
+			for _, hidden := range []string{"Дневник", "Кольцо", "Сюрприз для друзей", "Шарф", "Открытое"} {
+				require.NotContains(t, body, hidden)
+			}
+		})
+	}
+}
+
+func TestServer_Lists(t *testing.T) {
+	server, reader := newTestServer()
+	reader.tokens["home"] = 2
+	reader.wishLists[2] = messages.Categories{{Name: "default", Items: []messages.WishItem{{Name: "Плед"}}}}
+
+	t.Run("Should show only the list the token points to", func(t *testing.T) {
+		body := get(server, "/w/home", nil).Body.String()
+		require.Contains(t, body, "<h1>Список 2</h1>")
+		require.Contains(t, body, "Плед")
+		require.NotContains(t, body, "Носки")
+		require.NotContains(t, get(server, "/w/abc", nil).Body.String(), "Плед")
+	})
+}
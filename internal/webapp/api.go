@@ -0,0 +1,449 @@
+package webapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/roman-clancy/ho4uha-bot/internal/model/messages"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	authScheme     = "tma "
+	maxRequestSize = 64 << 10
+	maxInitDataAge = 24 * time.Hour
+)
+
+type ctxKey struct{}
+
+type API struct {
+	storage  messages.UserStorage
+	botToken string
+	now      func() time.Time
+	limits   messages.Limits
+}
+
+func New(storage messages.UserStorage, botToken string) *API {
+	return &API{
+		storage:  storage,
+		botToken: botToken,
+		now:      time.Now,
+		limits:   messages.DefaultLimits(),
+	}
+}
+
+type categoryJSON struct {
+	Name       string              `json:"name"`
+	Visibility messages.Visibility `json:"visibility,omitempty"`
+	Items      []itemJSON          `json:"items"`
+}
+
+// itemJSON is the owner's view of an item, so it carries no reservation details at all.
+type itemJSON struct {
+	ID       int64             `json:"id"`
+	Name     string            `json:"name"`
+	URL      string            `json:"url,omitempty"`
+	ImageURL string            `json:"image_url,omitempty"`
+	Price    int64             `json:"price,omitempty"`
+	Currency string            `json:"currency,omitempty"`
+	Priority messages.Priority `json:"priority,omitempty"`
+	Note     string            `json:"note,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	// Visibility is empty when the item follows its category.
+	Visibility messages.Visibility `json:"visibility,omitempty"`
+	// Status is empty while the item is wanted, reserved or not.
+	Status messages.ItemStatus `json:"status,omitempty"`
+}
+
+type itemRequest struct {
+	Category   *string              `json:"category"`
+	Name       *string              `json:"name"`
+	URL        *string              `json:"url"`
+	ImageURL   *string              `json:"image_url"`
+	Price      *int64               `json:"price"`
+	Currency   *string              `json:"currency"`
+	Priority   *messages.Priority   `json:"priority"`
+	Visibility *messages.Visibility `json:"visibility"`
+	Note       *string              `json:"note"`
+	Tags       []string             `json:"tags"`
+}
+
+type categoryRequest struct {
+	Name string `json:"name"`
+}
+
+// undoJSON answers a write that POST /api/undo/{undo} reverts within messages.UndoWindow.
+type undoJSON struct {
+	Name string `json:"name,omitempty"`
+	Undo int64  `json:"undo"`
+}
+
+type moveRequest struct {
+	Category string `json:"category"`
+	Position int    `json:"position"`
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	initData, ok := strings.CutPrefix(r.Header.Get("Authorization"), authScheme)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "missing init data")
+		return
+	}
+	data, err := ValidateInitData(initData, a.botToken, maxInitDataAge, a.now())
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err := a.storage.AddNewUser(r.Context(), data.User.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, data.User.ID))
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	a.route(w, r)
+}
+
+func userID(r *http.Request) int64 {
+	return r.Context().Value(ctxKey{}).(int64)
+}
+
+func (a *API) route(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.EscapedPath())
+	switch {
+	case len(parts) == 2 && parts[1] == "wishlist" && r.Method == http.MethodGet:
+		a.getWishlist(w, r)
+	case len(parts) == 2 && parts[1] == "categories" && r.Method == http.MethodPost:
+		a.addCategory(w, r)
+	case len(parts) == 3 && parts[1] == "categories" && r.Method == http.MethodPatch:
+		a.renameCategory(w, r, parts[2])
+	case len(parts) == 3 && parts[1] == "categories" && r.Method == http.MethodDelete:
+		a.deleteCategory(w, r, parts[2])
+	case len(parts) == 4 && parts[1] == "categories" && parts[3] == "move" && r.Method == http.MethodPost:
+		a.moveCategory(w, r, parts[2])
+	case len(parts) == 2 && parts[1] == "items" && r.Method == http.MethodPost:
+		a.addItem(w, r)
+	case len(parts) == 3 && parts[1] == "items" && r.Method == http.MethodPatch:
+		a.updateItem(w, r, parts[2])
+	case len(parts) == 3 && parts[1] == "items" && r.Method == http.MethodDelete:
+		a.deleteItem(w, r, parts[2])
+	case len(parts) == 4 && parts[1] == "items" && parts[3] == "move" && r.Method == http.MethodPost:
+		a.moveItem(w, r, parts[2])
+	case len(parts) == 3 && parts[1] == "undo" && r.Method == http.MethodPost:
+		a.undo(w, r, parts[2])
+	default:
+		writeError(w, http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+// splitPath expects paths under /api/ and unescapes every segment, so category names may contain slashes.
+func splitPath(escaped string) []string {
+	raw := strings.Split(strings.Trim(escaped, "/"), "/")
+	parts := make([]string, 0, len(raw))
+	for _, p := range raw {
+		unescaped, err := url.PathUnescape(p)
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, unescaped)
+	}
+	if len(parts) == 0 || parts[0] != "api" {
+		return nil
+	}
+	return parts
+}
+
+func (a *API) getWishlist(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userId := userID(r)
+	wishList := a.storage.GetWishListByCategory(ctx, userId)
+	visibility := a.storage.GetCategoryVisibility(ctx, userId)
+	result := make([]categoryJSON, 0, len(wishList))
+	for _, cat := range wishList {
+		category := categoryJSON{Name: cat.Name, Visibility: visibility[cat.Name], Items: make([]itemJSON, 0, len(cat.Items))}
+		for _, item := range cat.Items {
+			category.Items = append(category.Items, toItemJSON(item))
+		}
+		result = append(result, category)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"categories": result})
+}
+
+func toItemJSON(item messages.WishItem) itemJSON {
+	return itemJSON{
+		ID:         item.ID,
+		Name:       item.Name,
+		URL:        item.URL,
+		ImageURL:   item.ImageURL,
+		Price:      item.Price,
+		Currency:   item.Currency,
+		Priority:   item.Priority,
+		Note:       item.Note,
+		Tags:       item.Tags,
+		Visibility: item.Visibility,
+		Status:     item.Status,
+	}
+}
+
+func (a *API) addCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req categoryRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	existing := a.storage.GetCategories(ctx, userID(r))
+	if err := a.limits.ValidateCategoryName(req.Name, existing); err != nil {
+		writeFailure(w, err)
+		return
+	}
+	if err := a.limits.CheckCategoryQuota(len(existing), 1); err != nil {
+		writeFailure(w, err)
+		return
+	}
+	respond(w, a.storage.AddUserCategory(ctx, userID(r), req.Name), http.StatusCreated, req)
+}
+
+func (a *API) renameCategory(w http.ResponseWriter, r *http.Request, name string) {
+	ctx := r.Context()
+	var req categoryRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	others := slices.DeleteFunc(a.storage.GetCategories(ctx, userID(r)), func(other string) bool { return other == name })
+	if err := a.limits.ValidateCategoryName(req.Name, others); err != nil {
+		writeFailure(w, err)
+		return
+	}
+	revisionId, err := messages.WithUndo(ctx, a.storage, userID(r), func(tx messages.UserStorage) error {
+		return tx.RenameUserCategory(ctx, userID(r), name, req.Name)
+	})
+	respond(w, err, http.StatusOK, undoJSON{Name: req.Name, Undo: revisionId})
+}
+
+func (a *API) deleteCategory(w http.ResponseWriter, r *http.Request, name string) {
+	ctx := r.Context()
+	revisionId, err := messages.WithUndo(ctx, a.storage, userID(r), func(tx messages.UserStorage) error {
+		return tx.DeleteUserCategory(ctx, userID(r), name)
+	})
+	respond(w, err, http.StatusOK, undoJSON{Undo: revisionId})
+}
+
+func (a *API) moveCategory(w http.ResponseWriter, r *http.Request, name string) {
+	var req moveRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	respond(w, a.storage.MoveUserCategory(r.Context(), userID(r), name, req.Position), http.StatusNoContent, nil)
+}
+
+func (a *API) addItem(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req itemRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	item := applyItemRequest(messages.WishItem{}, req)
+	if err := a.limits.ValidateItem(item); err != nil {
+		writeFailure(w, err)
+		return
+	}
+	if err := a.limits.CheckItemQuota(messages.CountItems(ctx, a.storage, userID(r)), 1); err != nil {
+		writeFailure(w, err)
+		return
+	}
+	if _, ok := messages.ParseVisibility(string(item.Visibility)); !ok {
+		writeError(w, http.StatusBadRequest, "invalid visibility")
+		return
+	}
+	category := "default"
+	if req.Category != nil && *req.Category != "" {
+		category = *req.Category
+	}
+	var created messages.WishItem
+	err := a.storage.WithTx(ctx, func(tx messages.UserStorage) error {
+		if err := tx.AddWishItemToCategory(ctx, userID(r), category, item); err != nil {
+			return err
+		}
+		created = newestItem(tx.GetWishListByCategory(ctx, userID(r)))
+		return nil
+	})
+	respond(w, err, http.StatusCreated, toItemJSON(created))
+}
+
+// newestItem finds the item just added, item ids only grow.
+func newestItem(wishList messages.Categories) messages.WishItem {
+	var newest messages.WishItem
+	for _, cat := range wishList {
+		for _, item := range cat.Items {
+			if item.ID > newest.ID {
+				newest = item
+			}
+		}
+	}
+	return newest
+}
+
+func (a *API) updateItem(w http.ResponseWriter, r *http.Request, rawId string) {
+	ctx := r.Context()
+	var req itemRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	item, err := a.findItem(ctx, userID(r), rawId)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "item not found")
+		return
+	}
+	item = applyItemRequest(item, req)
+	if err := a.limits.ValidateItem(item); err != nil {
+		writeFailure(w, err)
+		return
+	}
+	if _, ok := messages.ParseVisibility(string(item.Visibility)); !ok {
+		writeError(w, http.StatusBadRequest, "invalid visibility")
+		return
+	}
+	respond(w, a.storage.UpdateWishItem(ctx, userID(r), item), http.StatusOK, toItemJSON(item))
+}
+
+func (a *API) deleteItem(w http.ResponseWriter, r *http.Request, rawId string) {
+	ctx := r.Context()
+	item, err := a.findItem(ctx, userID(r), rawId)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "item not found")
+		return
+	}
+	revisionId, err := messages.WithUndo(ctx, a.storage, userID(r), func(tx messages.UserStorage) error {
+		return tx.DeleteWishItem(ctx, userID(r), item.ID)
+	})
+	respond(w, err, http.StatusOK, undoJSON{Undo: revisionId})
+}
+
+func (a *API) undo(w http.ResponseWriter, r *http.Request, rawId string) {
+	revisionId, err := strconv.ParseInt(rawId, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "nothing to undo")
+		return
+	}
+	_, err = messages.Undo(r.Context(), a.storage, a.now(), userID(r), revisionId)
+	respond(w, err, http.StatusNoContent, nil)
+}
+
+func (a *API) moveItem(w http.ResponseWriter, r *http.Request, rawId string) {
+	ctx := r.Context()
+	var req moveRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	item, err := a.findItem(ctx, userID(r), rawId)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "item not found")
+		return
+	}
+	if req.Category == "" {
+		req.Category = "default"
+	}
+	respond(w, a.storage.MoveWishItem(ctx, userID(r), item.ID, req.Category, req.Position), http.StatusNoContent, nil)
+}
+
+func applyItemRequest(item messages.WishItem, req itemRequest) messages.WishItem {
+	if req.Name != nil {
+		item.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URL != nil {
+		item.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.ImageURL != nil {
+		item.ImageURL = *req.ImageURL
+	}
+	if req.Price != nil {
+		item.Price = *req.Price
+	}
+	if req.Currency != nil {
+		item.Currency = *req.Currency
+	}
+	if req.Priority != nil {
+		item.Priority = *req.Priority
+	}
+	if req.Visibility != nil {
+		item.Visibility = *req.Visibility
+	}
+	if req.Note != nil {
+		item.Note = strings.TrimSpace(*req.Note)
+	}
+	if req.Tags != nil {
+		item.Tags = req.Tags
+	}
+	return item
+}
+
+func (a *API) findItem(ctx context.Context, userId int64, rawId string) (messages.WishItem, error) {
+	id, err := strconv.ParseInt(rawId, 10, 64)
+	if err != nil {
+		return messages.WishItem{}, messages.ErrItemNotFound
+	}
+	if item, ok := a.storage.GetWishListByCategory(ctx, userId).Find(id); ok {
+		return item, nil
+	}
+	return messages.WishItem{}, messages.ErrItemNotFound
+}
+
+// respond writes the body of a successful storage call or the status errorStatus picks.
+func respond(w http.ResponseWriter, err error, status int, body any) {
+	switch {
+	case err != nil:
+		writeFailure(w, err)
+	case body == nil || status == http.StatusNoContent:
+		w.WriteHeader(status)
+	default:
+		writeJSON(w, status, body)
+	}
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// errorStatus is 404 for a missing record, 409 for a taken name or an undo something newer
+// stands in the way of, 410 for an undo that came too late, 403 for an exhausted quota,
+// 400 for other invalid input and 500 for anything else.
+func errorStatus(err error) int {
+	var invalid *messages.ValidationError
+	switch {
+	case errors.Is(err, messages.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, messages.ErrDuplicate), errors.Is(err, messages.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, messages.ErrUndoUnavailable):
+		return http.StatusGone
+	case errors.Is(err, messages.ErrQuotaExceeded):
+		return http.StatusForbidden
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeFailure(w http.ResponseWriter, err error) {
+	writeError(w, errorStatus(err), err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
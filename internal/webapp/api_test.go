@@ -0,0 +1,251 @@
+package webapp
+
+import (
+	"encoding/json"
+	"github.com/roman-clancy/ho4uha-bot/internal/clock"
+	"github.com/roman-clancy/ho4uha-bot/internal/storage/inmemory"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type wishlistResponse struct {
+	Categories []categoryJSON `json:"categories"`
+}
+
+type testClient struct {
+	t        *testing.T
+	api      *API
+	initData string
+}
+
+func newTestClient(t *testing.T) *testClient {
+	storage, err := inmemory.New()
+	require.NoError(t, err)
+	storage.Clock = clock.NewFake(testNow)
+	api := New(storage, testToken)
+	api.now = func() time.Time { return testNow }
+	return &testClient{t: t, api: api, initData: initDataFor(42, testNow, testToken)}
+}
+
+func (c *testClient) do(method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "tma "+c.initData)
+	rec := httptest.NewRecorder()
+	c.api.ServeHTTP(rec, req)
+	return rec
+}
+
+func (c *testClient) wishlist() wishlistResponse {
+	rec := c.do(http.MethodGet, "/api/wishlist", "")
+	require.Equal(c.t, http.StatusOK, rec.Code)
+	var resp wishlistResponse
+	require.NoError(c.t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+func (c *testClient) itemId(name string) int64 {
+	for _, cat := range c.wishlist().Categories {
+		for _, item := range cat.Items {
+			if item.Name == name {
+				return item.ID
+			}
+		}
+	}
+	c.t.Fatalf("item %s not found", name)
+	return 0
+}
+
+func TestAPI_Auth(t *testing.T) {
+	client := newTestClient(t)
+
+	t.Run("Should reject request without init data", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/wishlist", nil)
+		rec := httptest.NewRecorder()
+		client.api.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Should reject init data signed by someone else", func(t *testing.T) {
+		client.initData = initDataFor(42, testNow, "1:FORGED")
+		require.Equal(t, http.StatusUnauthorized, client.do(http.MethodGet, "/api/wishlist", "").Code)
+	})
+
+	t.Run("Should accept valid init data and start with an empty default category", func(t *testing.T) {
+		client.initData = initDataFor(42, testNow, testToken)
+		resp := client.wishlist()
+		require.Len(t, resp.Categories, 1)
+		require.Equal(t, "default", resp.Categories[0].Name)
+		require.Empty(t, resp.Categories[0].Items)
+	})
+}
+
+func TestAPI_Categories(t *testing.T) {
+	client := newTestClient(t)
+	require.Equal(t, http.StatusCreated, client.do(http.MethodPost, "/api/categories", `{"name":"Книги"}`).Code)
+	require.Equal(t, http.StatusCreated, client.do(http.MethodPost, "/api/categories", `{"name":"Игры/настолки"}`).Code)
+
+	t.Run("Should not create duplicate or reserved names", func(t *testing.T) {
+		require.Equal(t, http.StatusConflict, client.do(http.MethodPost, "/api/categories", `{"name":"Книги"}`).Code)
+		require.Equal(t, http.StatusBadRequest, client.do(http.MethodPost, "/api/categories", `{"name":"default"}`).Code)
+	})
+
+	t.Run("Should reorder categories with escaped names in path", func(t *testing.T) {
+		rec := client.do(http.MethodPost, "/api/categories/"+"%D0%98%D0%B3%D1%80%D1%8B%2F%D0%BD%D0%B0%D1%81%D1%82%D0%BE%D0%BB%D0%BA%D0%B8"+"/move", `{"position":0}`)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		names := []string{}
+		for _, cat := range client.wishlist().Categories {
+			names = append(names, cat.Name)
+		}
+		require.Equal(t, []string{"default", "Игры/настолки", "Книги"}, names)
+	})
+
+	t.Run("Should rename and delete category", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, client.do(http.MethodPatch, "/api/categories/%D0%9A%D0%BD%D0%B8%D0%B3%D0%B8", `{"name":"Чтение"}`).Code)
+		require.Equal(t, http.StatusOK, client.do(http.MethodDelete, "/api/categories/%D0%A7%D1%82%D0%B5%D0%BD%D0%B8%D0%B5", "").Code)
+		require.Len(t, client.wishlist().Categories, 2)
+		require.Equal(t, http.StatusNotFound, client.do(http.MethodDelete, "/api/categories/missing", "").Code)
+	})
+}
+
+func (c *testClient) undoToken(rec *httptest.ResponseRecorder) string {
+	require.Equal(c.t, http.StatusOK, rec.Code)
+	var resp undoJSON
+	require.NoError(c.t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotZero(c.t, resp.Undo)
+	return itoa(resp.Undo)
+}
+
+func TestAPI_Undo(t *testing.T) {
+	client := newTestClient(t)
+	require.Equal(t, http.StatusCreated, client.do(http.MethodPost, "/api/categories", `{"name":"Книги"}`).Code)
+	require.Equal(t, http.StatusCreated, client.do(http.MethodPost, "/api/items", `{"category":"Книги","name":"Дюна"}`).Code)
+	categories := func() []string {
+		var names []string
+		for _, cat := range client.wishlist().Categories {
+			names = append(names, cat.Name)
+		}
+		return names
+	}
+
+	t.Run("Should undo deleting an item", func(t *testing.T) {
+		token := client.undoToken(client.do(http.MethodDelete, "/api/items/"+itoa(client.itemId("Дюна")), ""))
+		require.Equal(t, http.StatusNoContent, client.do(http.MethodPost, "/api/undo/"+token, "").Code)
+		client.itemId("Дюна")
+		require.Equal(t, http.StatusGone, client.do(http.MethodPost, "/api/undo/"+token, "").Code, "The same delete should not be undone twice")
+	})
+
+	t.Run("Should undo renaming and deleting a category", func(t *testing.T) {
+		rec := client.do(http.MethodPatch, "/api/categories/%D0%9A%D0%BD%D0%B8%D0%B3%D0%B8", `{"name":"Чтение"}`)
+		require.Contains(t, rec.Body.String(), `"name":"Чтение"`)
+		renamed := client.undoToken(rec)
+		deleted := client.undoToken(client.do(http.MethodDelete, "/api/categories/%D0%A7%D1%82%D0%B5%D0%BD%D0%B8%D0%B5", ""))
+		require.Equal(t, http.StatusConflict, client.do(http.MethodPost, "/api/undo/"+renamed, "").Code, "The delete stands in the way")
+		require.Equal(t, http.StatusNoContent, client.do(http.MethodPost, "/api/undo/"+deleted, "").Code)
+		require.Equal(t, []string{"default", "Чтение"}, categories())
+		require.Equal(t, http.StatusNoContent, client.do(http.MethodPost, "/api/undo/"+renamed, "").Code)
+		require.Equal(t, []string{"default", "Книги"}, categories())
+	})
+
+	t.Run("Shouldn't undo for other users", func(t *testing.T) {
+		token := client.undoToken(client.do(http.MethodDelete, "/api/items/"+itoa(client.itemId("Дюна")), ""))
+		client.initData = initDataFor(7, testNow, testToken)
+		require.Equal(t, http.StatusGone, client.do(http.MethodPost, "/api/undo/"+token, "").Code)
+		require.Equal(t, http.StatusNotFound, client.do(http.MethodPost, "/api/undo/x", "").Code)
+	})
+}
+
+func TestAPI_Items(t *testing.T) {
+	client := newTestClient(t)
+	require.Equal(t, http.StatusCreated, client.do(http.MethodPost, "/api/categories", `{"name":"Книги"}`).Code)
+	require.Equal(t, http.StatusCreated, client.do(http.MethodPost, "/api/items", `{"category":"Книги","name":"Дюна","price":120000,"currency":"RUB"}`).Code)
+	require.Equal(t, http.StatusCreated, client.do(http.MethodPost, "/api/items", `{"category":"Книги","name":"Солярис"}`).Code)
+	require.Equal(t, http.StatusCreated, client.do(http.MethodPost, "/api/items", `{"name":"Носки"}`).Code)
+
+	t.Run("Should answer with the created item", func(t *testing.T) {
+		rec := client.do(http.MethodPost, "/api/items", `{"name":"Плед","price":250000}`)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		var item itemJSON
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &item))
+		require.Equal(t, itemJSON{ID: client.itemId("Плед"), Name: "Плед", Price: 250000}, item)
+		require.NotZero(t, item.ID)
+		require.Equal(t, http.StatusOK, client.do(http.MethodDelete, "/api/items/"+itoa(item.ID), "").Code)
+	})
+
+	t.Run("Should validate new items", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, client.do(http.MethodPost, "/api/items", `{"name":""}`).Code)
+		require.Equal(t, http.StatusNotFound, client.do(http.MethodPost, "/api/items", `{"category":"Нет","name":"x"}`).Code)
+		require.Equal(t, http.StatusBadRequest, client.do(http.MethodPost, "/api/items", `{"name":"x","owner":1}`).Code)
+	})
+
+	t.Run("Should partially update item", func(t *testing.T) {
+		id := client.itemId("Дюна")
+		rec := client.do(http.MethodPatch, "/api/items/"+itoa(id), `{"name":"Дюна. Мессия"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var item itemJSON
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &item))
+		require.Equal(t, itemJSON{ID: id, Name: "Дюна. Мессия", Price: 120000, Currency: "RUB"}, item)
+	})
+
+	t.Run("Should set item visibility", func(t *testing.T) {
+		id := client.itemId("Солярис")
+		require.Equal(t, http.StatusBadRequest, client.do(http.MethodPatch, "/api/items/"+itoa(id), `{"visibility":"secret"}`).Code)
+		rec := client.do(http.MethodPatch, "/api/items/"+itoa(id), `{"visibility":"friends"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `"visibility":"friends"`)
+	})
+
+	t.Run("Should move item between categories", func(t *testing.T) {
+		id := client.itemId("Носки")
+		require.Equal(t, http.StatusNoContent, client.do(http.MethodPost, "/api/items/"+itoa(id)+"/move", `{"category":"Книги","position":0}`).Code)
+		resp := client.wishlist()
+		require.Empty(t, resp.Categories[0].Items)
+		require.Equal(t, "Носки", resp.Categories[1].Items[0].Name)
+	})
+
+	t.Run("Should delete item", func(t *testing.T) {
+		id := client.itemId("Солярис")
+		require.Equal(t, http.StatusOK, client.do(http.MethodDelete, "/api/items/"+itoa(id), "").Code)
+		require.Equal(t, http.StatusNotFound, client.do(http.MethodDelete, "/api/items/"+itoa(id), "").Code)
+	})
+
+	t.Run("Shouldn't touch items of other users", func(t *testing.T) {
+		id := client.itemId("Носки")
+		client.initData = initDataFor(7, testNow, testToken)
+		require.Equal(t, http.StatusNotFound, client.do(http.MethodPatch, "/api/items/"+itoa(id), `{"name":"mine"}`).Code)
+		require.Equal(t, http.StatusNotFound, client.do(http.MethodDelete, "/api/items/"+itoa(id), "").Code)
+	})
+
+	t.Run("Should answer 404 for unknown endpoints", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, client.do(http.MethodGet, "/api/unknown", "").Code)
+		require.Equal(t, http.StatusNotFound, client.do(http.MethodPut, "/api/items", "").Code)
+	})
+}
+
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func TestAPI_Validation(t *testing.T) {
+	client := newTestClient(t)
+	client.api.limits.MaxItems = 1
+	client.api.limits.MaxCategories = 1
+
+	t.Run("Should reject garbage names and links", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, client.do(http.MethodPost, "/api/categories", `{"name":"/start"}`).Code)
+		require.Equal(t, http.StatusBadRequest, client.do(http.MethodPost, "/api/categories", `{"name":"`+strings.Repeat("к", 65)+`"}`).Code)
+		require.Equal(t, http.StatusBadRequest, client.do(http.MethodPost, "/api/items", `{"name":"x","url":"javascript:alert(1)"}`).Code)
+	})
+
+	t.Run("Should enforce quotas", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, client.do(http.MethodPost, "/api/categories", `{"name":"Книги"}`).Code)
+		require.Equal(t, http.StatusConflict, client.do(http.MethodPost, "/api/categories", `{"name":"книги"}`).Code)
+		require.Equal(t, http.StatusForbidden, client.do(http.MethodPost, "/api/categories", `{"name":"Игры"}`).Code)
+		require.Equal(t, http.StatusCreated, client.do(http.MethodPost, "/api/items", `{"name":"Дюна"}`).Code)
+		require.Equal(t, http.StatusForbidden, client.do(http.MethodPost, "/api/items", `{"name":"Солярис"}`).Code)
+	})
+}
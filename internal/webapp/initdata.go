@@ -0,0 +1,101 @@
+package webapp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoHash      = errors.New("webapp: init data has no hash")
+	ErrBadHash     = errors.New("webapp: init data signature mismatch")
+	ErrExpired     = errors.New("webapp: init data expired")
+	ErrNoUser      = errors.New("webapp: init data has no user")
+	ErrBadAuthDate = errors.New("webapp: init data has invalid auth_date")
+)
+
+type User struct {
+	ID           int64  `json:"id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name,omitempty"`
+	Username     string `json:"username,omitempty"`
+	LanguageCode string `json:"language_code,omitempty"`
+}
+
+type InitData struct {
+	QueryID  string
+	User     User
+	AuthDate time.Time
+}
+
+// ValidateInitData checks the Telegram.WebApp.initData string the way
+// https://core.telegram.org/bots/webapps#validating-data-received-via-the-mini-app describes.
+// A zero maxAge disables the freshness check.
+func ValidateInitData(initData, botToken string, maxAge time.Duration, now time.Time) (InitData, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return InitData{}, err
+	}
+	hash := values.Get("hash")
+	if hash == "" {
+		return InitData{}, ErrNoHash
+	}
+	expected, err := hex.DecodeString(hash)
+	if err != nil || !hmac.Equal(expected, signature(values, botToken)) {
+		return InitData{}, ErrBadHash
+	}
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return InitData{}, ErrBadAuthDate
+	}
+	result := InitData{
+		QueryID:  values.Get("query_id"),
+		AuthDate: time.Unix(authDate, 0),
+	}
+	if maxAge > 0 && now.Sub(result.AuthDate) > maxAge {
+		return InitData{}, ErrExpired
+	}
+	if err := json.Unmarshal([]byte(values.Get("user")), &result.User); err != nil || result.User.ID == 0 {
+		return InitData{}, ErrNoUser
+	}
+	return result, nil
+}
+
+// SignInitData adds a valid hash to values. Telegram does it for real clients,
+// tests and local tools use it to produce trusted init data.
+func SignInitData(values url.Values, botToken string) string {
+	signed := url.Values{}
+	for k, v := range values {
+		if k != "hash" {
+			signed[k] = v
+		}
+	}
+	signed.Set("hash", hex.EncodeToString(signature(signed, botToken)))
+	return signed.Encode()
+}
+
+func signature(values url.Values, botToken string) []byte {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if k != "hash" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k+"="+values.Get(k))
+	}
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	return mac.Sum(nil)
+}
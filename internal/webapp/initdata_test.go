@@ -0,0 +1,61 @@
+package webapp
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testToken = "123456:TEST-TOKEN"
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func initDataFor(userId int64, authDate time.Time, token string) string {
+	return SignInitData(url.Values{
+		"query_id":  {"AAHdF6IQAAAAAN0XohDhrOrc"},
+		"user":      {`{"id":` + strconv.FormatInt(userId, 10) + `,"first_name":"Аня","username":"anya"}`},
+		"auth_date": {strconv.FormatInt(authDate.Unix(), 10)},
+	}, token)
+}
+
+func TestValidateInitData(t *testing.T) {
+	t.Run("Should accept data signed with the bot token", func(t *testing.T) {
+		data, err := ValidateInitData(initDataFor(42, testNow.Add(-time.Minute), testToken), testToken, time.Hour, testNow)
+		require.NoError(t, err)
+		require.Equal(t, int64(42), data.User.ID)
+		require.Equal(t, "anya", data.User.Username)
+		require.Equal(t, "AAHdF6IQAAAAAN0XohDhrOrc", data.QueryID)
+		require.Equal(t, testNow.Add(-time.Minute).Unix(), data.AuthDate.Unix())
+	})
+
+	t.Run("Should reject data signed with another token", func(t *testing.T) {
+		_, err := ValidateInitData(initDataFor(42, testNow, "654321:OTHER"), testToken, time.Hour, testNow)
+		require.ErrorIs(t, err, ErrBadHash)
+	})
+
+	t.Run("Should reject tampered user", func(t *testing.T) {
+		values, err := url.ParseQuery(initDataFor(42, testNow, testToken))
+		require.NoError(t, err)
+		values.Set("user", `{"id":1,"first_name":"Аня"}`)
+		_, err = ValidateInitData(values.Encode(), testToken, time.Hour, testNow)
+		require.ErrorIs(t, err, ErrBadHash)
+	})
+
+	t.Run("Should reject data without hash", func(t *testing.T) {
+		_, err := ValidateInitData("auth_date=1&user=%7B%7D", testToken, time.Hour, testNow)
+		require.ErrorIs(t, err, ErrNoHash)
+	})
+
+	t.Run("Should reject stale data", func(t *testing.T) {
+		_, err := ValidateInitData(initDataFor(42, testNow.Add(-2*time.Hour), testToken), testToken, time.Hour, testNow)
+		require.ErrorIs(t, err, ErrExpired)
+	})
+
+	t.Run("Should reject signed data without user", func(t *testing.T) {
+		data := SignInitData(url.Values{"auth_date": {strconv.FormatInt(testNow.Unix(), 10)}}, testToken)
+		_, err := ValidateInitData(data, testToken, time.Hour, testNow)
+		require.ErrorIs(t, err, ErrNoUser)
+	})
+}